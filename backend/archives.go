@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+
+	"github.com/gofiber/fiber/v2"
+
+	"backend/pkg"
+)
+
+// archiveImportPath is the only route whose request body is streamed rather than held in memory
+const archiveImportPath = "/api/archives/import"
+
+func (s *Server) handleListArchives(c *fiber.Ctx) error {
+	archives, err := s.archiveManager.List()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "archives": archives})
+}
+
+func (s *Server) handleCreateArchive(c *fiber.Ctx) error {
+	archive, err := s.archiveManager.Create()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(fiber.Map{"success": true, "message": "Archive created", "archive": archive})
+}
+
+func (s *Server) handleDownloadArchive(c *fiber.Ctx) error {
+	archive, err := s.archiveManager.Find(c.Params("archive"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Archive not found"})
+	}
+
+	return c.Download(archive.Path, archive.FileName)
+}
+
+func (s *Server) handleImportArchive(c *fiber.Ctx) error {
+	upload, err := archiveUpload(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Form file 'archive' is required"})
+	}
+
+	archive, err := s.archiveManager.Import(upload)
+	if errors.Is(err, pkg.ErrArchiveTooLarge) {
+		return c.Status(413).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, pkg.ErrInvalidArchive) {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(fiber.Map{"success": true, "message": "Archive imported", "archive": archive})
+}
+
+// archiveUpload returns the 'archive' file of a multipart request, read straight from the body stream
+func archiveUpload(c *fiber.Ctx) (io.Reader, error) {
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	body := c.Request().BodyStream()
+	if boundary == "" || body == nil {
+		return nil, errors.New("request is not a multipart upload")
+	}
+
+	form := multipart.NewReader(body, boundary)
+	for {
+		part, err := form.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "archive" && part.FileName() != "" {
+			return part, nil
+		}
+	}
+}
+
+func (s *Server) handleVerifyArchive(c *fiber.Ctx) error {
+	archive, err := s.archiveManager.Find(c.Params("archive"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Archive not found"})
+	}
+
+	manifest, err := s.archiveManager.Verify(archive.Path)
+	if errors.Is(err, pkg.ErrInvalidArchive) {
+		return c.JSON(fiber.Map{"success": true, "valid": false, "error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "valid": true, "manifest": manifest})
+}
+
+func (s *Server) handleRestoreArchive(c *fiber.Ctx) error {
+	id := c.Params("archive")
+	if _, err := s.archiveManager.Find(id); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Archive not found"})
+	}
+
+	result, err := s.archiveManager.Restore(id)
+	if errors.Is(err, pkg.ErrInvalidArchive) {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	s.afterArchiveRestore()
+
+	return c.JSON(fiber.Map{"success": true, "message": "Archive restored", "result": result})
+}
+
+func (s *Server) handleDeleteArchive(c *fiber.Ctx) error {
+	if err := s.archiveManager.Delete(c.Params("archive")); err != nil {
+		if errors.Is(err, pkg.ErrSnapshotNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Archive not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Archive deleted"})
+}
+
+// afterArchiveRestore refreshes all server state derived from data files
+func (s *Server) afterArchiveRestore() {
+	s.forgetInferredSchemas()
+	if err := s.loadUsers(); err != nil {
+		log.Printf("Warning: Failed to reload users after restore: %v", err)
+	}
+	s.migrateHistory()
+	s.loadSchemas()
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	sessionCookieName  = "session_token"
+	sessionTokenHeader = "X-Session-Token"
+	defaultSessionTTL  = 12 * time.Hour
+)
+
+var (
+	errInvalidToken = errors.New("invalid session token")
+	errTokenExpired = errors.New("session token expired")
+	errTokenRevoked = errors.New("session token revoked")
+)
+
+// Session is an issued login session
+type Session struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// SessionStore issues HMAC-signed session tokens and tracks them so they can be revoked
+type SessionStore struct {
+	mu       sync.Mutex
+	secret   []byte
+	ttl      time.Duration
+	sessions map[string]*Session
+}
+
+// NewSessionStore creates a session store; a random secret is used when none is given
+func NewSessionStore(secret []byte, ttl time.Duration) (*SessionStore, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate session secret: %w", err)
+		}
+	}
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+
+	return &SessionStore{
+		secret:   secret,
+		ttl:      ttl,
+		sessions: make(map[string]*Session),
+	}, nil
+}
+
+// Issue creates a new session for a user and returns its signed token
+func (ss *SessionStore) Issue(userID string) (string, *Session, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, fmt.Errorf("failed to generate session id: %w", err)
+	}
+
+	now := time.Now()
+	session := &Session{
+		ID:        hex.EncodeToString(id),
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ss.ttl),
+	}
+
+	ss.mu.Lock()
+	ss.pruneExpired(now)
+	ss.sessions[session.ID] = session
+	ss.mu.Unlock()
+
+	return ss.sign(session), session, nil
+}
+
+// Verify checks a token's signature, expiry and revocation status
+func (ss *SessionStore) Verify(token string) (*Session, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errInvalidToken
+	}
+
+	expected := ss.mac(payload)
+	given, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, given) {
+		return nil, errInvalidToken
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 {
+		return nil, errInvalidToken
+	}
+
+	expiresUnix, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	if time.Now().After(time.Unix(expiresUnix, 0)) {
+		return nil, errTokenExpired
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	session, exists := ss.sessions[parts[0]]
+	if !exists || session.UserID != parts[1] {
+		return nil, errTokenRevoked
+	}
+	return session, nil
+}
+
+// Revoke invalidates a single session
+func (ss *SessionStore) Revoke(sessionID string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	delete(ss.sessions, sessionID)
+}
+
+// RevokeUser invalidates every session belonging to a user
+func (ss *SessionStore) RevokeUser(userID string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for id, session := range ss.sessions {
+		if session.UserID == userID {
+			delete(ss.sessions, id)
+		}
+	}
+}
+
+// sign encodes a session as payload.signature
+func (ss *SessionStore) sign(session *Session) string {
+	raw := fmt.Sprintf("%s|%s|%d", session.ID, session.UserID, session.ExpiresAt.Unix())
+	payload := base64.RawURLEncoding.EncodeToString([]byte(raw))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(ss.mac(payload))
+}
+
+func (ss *SessionStore) mac(payload string) []byte {
+	h := hmac.New(sha256.New, ss.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// pruneExpired drops expired sessions; callers must hold mu
+func (ss *SessionStore) pruneExpired(now time.Time) {
+	for id, session := range ss.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(ss.sessions, id)
+		}
+	}
+}
+
+// sessionToken extracts a session token from the cookie or request headers
+func sessionToken(c *fiber.Ctx) string {
+	if auth := c.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	if token := c.Get(sessionTokenHeader); token != "" {
+		return token
+	}
+	return c.Cookies(sessionCookieName)
+}
+
+// resolveUser authenticates a request by session token or Basic credentials.
+// Only Basic auth pays the bcrypt cost; token checks are a single HMAC.
+func (s *Server) resolveUser(c *fiber.Ctx) (*User, *Session) {
+	if token := sessionToken(c); token != "" {
+		session, err := s.sessions.Verify(token)
+		if err != nil {
+			return nil, nil
+		}
+		user, ok := s.findUser(session.UserID)
+		if !ok || !user.Active {
+			return nil, nil
+		}
+		return user, session
+	}
+
+	if user, ok := s.basicAuthUser(c); ok {
+		return user, nil
+	}
+	return nil, nil
+}
+
+// basicAuthUser checks HTTP Basic credentials
+func (s *Server) basicAuthUser(c *fiber.Ctx) (*User, bool) {
+	auth := c.Get("Authorization")
+	if !strings.HasPrefix(auth, "Basic ") {
+		return nil, false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "Basic "))
+	if err != nil {
+		return nil, false
+	}
+
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return nil, false
+	}
+	return s.authenticateUser(username, password)
+}
+
+// authMiddleware accepts a session cookie, a bearer/session token header or Basic auth
+func (s *Server) authMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, session := s.resolveUser(c)
+		if user == nil {
+			return s.unauthorized(c)
+		}
+
+		// Store user in context for later use
+		c.Locals("user", user)
+		if session != nil {
+			c.Locals("session", session)
+		}
+		return c.Next()
+	}
+}
+
+func (s *Server) handleLogin(c *fiber.Ctx) error {
+	var req struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"success": false, "message": "Invalid JSON data"})
+	}
+
+	user, ok := s.authenticateUser(strings.TrimSpace(req.Email), req.Password)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"success": false, "message": "Invalid email or password"})
+	}
+
+	token, session, err := s.sessions.Issue(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"success": false, "message": err.Error()})
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HTTPOnly: true,
+		Secure:   c.Protocol() == "https",
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Logged in",
+		"data": fiber.Map{
+			"token":     token,
+			"tokenType": "Session",
+			"header":    sessionTokenHeader,
+			"expiresAt": session.ExpiresAt,
+			"user":      publicUser(*user),
+		},
+	})
+}
+
+func (s *Server) handleLogout(c *fiber.Ctx) error {
+	if session, ok := c.Locals("session").(*Session); ok {
+		s.sessions.Revoke(session.ID)
+	}
+
+	c.ClearCookie(sessionCookieName)
+	return c.JSON(fiber.Map{"success": true, "message": "Logged out"})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSessionStore(t *testing.T, secret string) *SessionStore {
+	t.Helper()
+	ss, err := NewSessionStore([]byte(secret), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ss
+}
+
+func TestSessionTokens(t *testing.T) {
+	ss := newTestSessionStore(t, "test secret")
+	token, session, err := ss.Issue("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verified, err := ss.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if verified.ID != session.ID || verified.UserID != "1" {
+		t.Errorf("Verify = %+v, want %+v", verified, session)
+	}
+	if _, err := newTestSessionStore(t, "other secret").Verify(token); !errors.Is(err, errInvalidToken) {
+		t.Errorf("Verify with another secret = %v, want %v", err, errInvalidToken)
+	}
+
+	payload, signature, _ := strings.Cut(token, ".")
+	raw, _ := base64.RawURLEncoding.DecodeString(payload)
+	forged := base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(raw), "|1|", "|2|", 1)))
+	tampered := map[string]string{
+		"user id":   forged + "." + signature,
+		"signature": payload + "." + base64.RawURLEncoding.EncodeToString([]byte("forged")),
+		"no dot":    payload + signature,
+		"empty":     "",
+		"garbage":   "not.a token",
+	}
+	for name, bad := range tampered {
+		if _, err := ss.Verify(bad); !errors.Is(err, errInvalidToken) {
+			t.Errorf("Verify of a token with a changed %s = %v, want %v", name, err, errInvalidToken)
+		}
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	ss := newTestSessionStore(t, "test secret")
+	_, session, err := ss.Issue("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired := *session
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	if _, err := ss.Verify(ss.sign(&expired)); !errors.Is(err, errTokenExpired) {
+		t.Errorf("Verify of an expired token = %v, want %v", err, errTokenExpired)
+	}
+
+	// Expired sessions are dropped when the next one is issued
+	ss.sessions[session.ID].ExpiresAt = time.Now().Add(-time.Second)
+	if _, _, err := ss.Issue("2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ss.sessions[session.ID]; ok {
+		t.Error("expired session was not pruned")
+	}
+}
+
+func TestSessionRevocation(t *testing.T) {
+	ss := newTestSessionStore(t, "test secret")
+	first, session, _ := ss.Issue("1")
+	second, _, _ := ss.Issue("1")
+	other, _, _ := ss.Issue("2")
+
+	ss.Revoke(session.ID)
+	if _, err := ss.Verify(first); !errors.Is(err, errTokenRevoked) {
+		t.Errorf("Verify of a revoked token = %v, want %v", err, errTokenRevoked)
+	}
+	if _, err := ss.Verify(second); err != nil {
+		t.Errorf("revoking one session revoked another: %v", err)
+	}
+
+	ss.RevokeUser("1")
+	if _, err := ss.Verify(second); !errors.Is(err, errTokenRevoked) {
+		t.Errorf("Verify after RevokeUser = %v, want %v", err, errTokenRevoked)
+	}
+	if _, err := ss.Verify(other); err != nil {
+		t.Errorf("RevokeUser revoked another user's session: %v", err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	s := newTestServer(t, map[string]string{usersFile: testUsers}, ServerOptions{})
+	userinfo := func(setup func(*http.Request)) int {
+		req := apiRequest("GET", "/api/userinfo", "", "")
+		setup(req)
+		resp, _ := do(t, s, req)
+		return resp.StatusCode
+	}
+
+	token := login(t, s, "viewer@example.com", "viewer-password")
+	ways := map[string]func(*http.Request){
+		"session header": func(r *http.Request) { r.Header.Set(sessionTokenHeader, token) },
+		"bearer token":   func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) },
+		"cookie":         func(r *http.Request) { r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token}) },
+		"basic auth":     func(r *http.Request) { r.SetBasicAuth("viewer@example.com", "viewer-password") },
+	}
+	for name, setup := range ways {
+		if status := userinfo(setup); status != 200 {
+			t.Errorf("userinfo with %s = %d, want 200", name, status)
+		}
+	}
+	if status := userinfo(func(r *http.Request) { r.SetBasicAuth("viewer@example.com", "wrong-password") }); status != 401 {
+		t.Errorf("userinfo with a wrong password = %d, want 401", status)
+	}
+	if resp, _ := do(t, s, apiRequest("POST", "/api/login", "", `{"email":"viewer@example.com","password":"wrong-password"}`)); resp.StatusCode != 401 {
+		t.Errorf("login with a wrong password = %d, want 401", resp.StatusCode)
+	}
+
+	// Logging out revokes the session
+	if resp, _ := do(t, s, apiRequest("POST", "/api/logout", token, "")); resp.StatusCode != 200 {
+		t.Fatalf("logout = %d", resp.StatusCode)
+	}
+	if status := userinfo(ways["session header"]); status != 401 {
+		t.Errorf("userinfo after logout = %d, want 401", status)
+	}
+
+	// So do a password reset and a deactivation by an admin
+	admin := login(t, s, "admin@example.com", "admin-password")
+	token = login(t, s, "viewer@example.com", "viewer-password")
+	if resp, body := do(t, s, apiRequest("POST", "/api/users/3/password", admin, `{"password":"new-viewer-password"}`)); resp.StatusCode != 200 {
+		t.Fatalf("password reset = %d %s", resp.StatusCode, body)
+	}
+	if status := userinfo(ways["session header"]); status != 401 {
+		t.Errorf("userinfo after a password reset = %d, want 401", status)
+	}
+
+	token = login(t, s, "viewer@example.com", "new-viewer-password")
+	if resp, body := do(t, s, apiRequest("POST", "/api/users/3/active", admin, `{"active":false}`)); resp.StatusCode != 200 {
+		t.Fatalf("deactivation = %d %s", resp.StatusCode, body)
+	}
+	if status := userinfo(ways["session header"]); status != 401 {
+		t.Errorf("userinfo after deactivation = %d, want 401", status)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"backend/pkg"
+)
+
+// runCodegen writes Go or TypeScript types for the items of a data file. The file's
+// schema sidecar is used when it has one, otherwise a schema is inferred from the data.
+func runCodegen(dataDir string, opts ServerOptions, filename, lang, out, packageName string) error {
+	if lang != "go" && lang != "ts" {
+		return fmt.Errorf("unknown language %q, expected go or ts", lang)
+	}
+	if pkg.IsSidecar(filename) {
+		return fmt.Errorf("%s is a sidecar, not a data file", filename)
+	}
+	filePath := filepath.Join(dataDir, filename)
+	if _, err := os.Stat(filePath); err != nil {
+		return fmt.Errorf("failed to open data file: %w", err)
+	}
+
+	source := pkg.SchemaSidecarName(filename)
+	schema, err := pkg.NewSchemaStore(dataDir).Get(filename)
+	if err != nil {
+		return err
+	}
+	var info *pkg.SchemaInfo
+	if schema != nil {
+		info = schema.Info
+	} else {
+		if info, err = inferSchema(filePath, opts); err != nil {
+			return err
+		}
+		source = filename
+	}
+
+	generator := pkg.NewCodeGenerator(info, pkg.TypeName(filename), source)
+	code := generator.TypeScript()
+	if lang == "go" {
+		if code, err = generator.Go(packageName); err != nil {
+			return err
+		}
+	}
+
+	if out == "" {
+		fmt.Print(code)
+		return nil
+	}
+	if err := os.WriteFile(out, []byte(code), 0644); err != nil {
+		return fmt.Errorf("failed to write generated code: %w", err)
+	}
+	fmt.Printf("✓ Generated %s types for %s in %s\n", lang, filename, out)
+	return nil
+}
+
+// inferSchema reads a data file, decrypting it if configured, and infers its schema
+func inferSchema(filePath string, opts ServerOptions) (*pkg.SchemaInfo, error) {
+	var format pkg.FileFormat
+	for _, name := range opts.EncryptFiles {
+		if name != filepath.Base(filePath) {
+			continue
+		}
+		inner, err := pkg.NewFormatRegistry().Get(filepath.Ext(name))
+		if err != nil {
+			return nil, err
+		}
+		if format, err = pkg.NewEncryptedFormat(inner, opts.EncryptionKey, opts.PreviousKeys...); err != nil {
+			return nil, err
+		}
+	}
+
+	fm, err := pkg.NewFileManagerWithFormat(filePath, format)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fm.Read()
+	if err != nil {
+		return nil, err
+	}
+	return pkg.NewSchemaGenerator().GenerateSchema(data)
+}
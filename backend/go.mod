@@ -3,6 +3,7 @@ module backend
 go 1.25.0
 
 require (
+	github.com/goccy/go-yaml v1.18.0
 	github.com/gofiber/fiber/v2 v2.52.5
 	github.com/oarkflow/jsonschema v0.0.4
 	golang.org/x/crypto v0.43.0
@@ -12,7 +13,6 @@ require (
 require (
 	github.com/andybalholm/brotli v1.0.5 // indirect
 	github.com/goccy/go-json v0.10.5 // indirect
-	github.com/goccy/go-yaml v1.18.0 // indirect
 	github.com/google/uuid v1.5.0 // indirect
 	github.com/gotnospirit/makeplural v0.0.0-20180622080156-a5f48d94d976 // indirect
 	github.com/gotnospirit/messageformat v0.0.0-20221001023931-dfe49f1eb092 // indirect
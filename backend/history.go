@@ -0,0 +1,490 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"backend/pkg"
+)
+
+const (
+	// commitMessageHeader carries an optional message describing a change
+	commitMessageHeader = "X-Commit-Message"
+	maxCommitMessageLen = 500
+
+	// maxDiffContext caps the unchanged lines shown around each unified diff hunk
+	maxDiffContext = 100
+)
+
+// setCommitInfo records the current user and request message as the author of the next version
+func (s *Server) setCommitInfo(c *fiber.Ctx, fm *pkg.FileManager, operation string, ids ...string) {
+	info := pkg.CommitInfo{
+		Operation:   operation,
+		AffectedIDs: ids,
+	}
+	if user := s.currentUser(c); user != nil {
+		info.Author = user.ID
+		info.AuthorName = user.Name
+	}
+
+	message := strings.TrimSpace(c.Get(commitMessageHeader))
+	if message == "" {
+		message = strings.TrimSpace(c.Query("message"))
+	}
+	if len(message) > maxCommitMessageLen {
+		message = message[:maxCommitMessageLen]
+	}
+	info.Message = message
+
+	fm.SetCommitInfo(info)
+}
+
+// parseTimeParam parses an RFC 3339 timestamp or a YYYY-MM-DD date
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+func (s *Server) handleListVersions(c *fiber.Ctx) error {
+	fm, err := s.initFileManager(c.Params("filename"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	filter := pkg.VersionFilter{Author: c.Query("author")}
+	if since := c.Query("since"); since != "" {
+		if filter.Since, err = parseTimeParam(since); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid 'since' time, use RFC 3339 or YYYY-MM-DD"})
+		}
+	}
+	if until := c.Query("until"); until != "" {
+		if filter.Until, err = parseTimeParam(until); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid 'until' time, use RFC 3339 or YYYY-MM-DD"})
+		}
+		// A bare date includes the whole day
+		if len(until) == len("2006-01-02") {
+			filter.Until = filter.Until.Add(24*time.Hour - time.Nanosecond)
+		}
+	}
+
+	versions, err := fm.ListVersions()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "versions": pkg.FilterVersions(versions, filter)})
+}
+
+func (s *Server) handleGetVersion(c *fiber.Ctx) error {
+	fm, err := s.initFileManager(c.Params("filename"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	version, err := fm.FindVersion(c.Params("version"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Version not found"})
+	}
+
+	items, err := fm.ReadVersion(version.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "version": version, "items": items})
+}
+
+func (s *Server) handleRestoreVersion(c *fiber.Ctx) error {
+	fm, err := s.initFileManager(c.Params("filename"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	version, err := fm.FindVersion(c.Params("version"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Version not found"})
+	}
+
+	s.setCommitInfo(c, fm, pkg.OperationRestore)
+	if err := fm.RestoreVersion(version.ID); err != nil {
+		return sendWriteError(c, restoreErrorStatus(err), err)
+	}
+	s.afterRestore(c.Params("filename"))
+
+	return c.JSON(fiber.Map{"success": true, "message": "Version restored"})
+}
+
+func (s *Server) handleDiffVersions(c *fiber.Ctx) error {
+	filename := c.Params("filename")
+	from := c.Query("from")
+	to := c.Query("to", pkg.CurrentVersion)
+	if from == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Query parameter 'from' is required"})
+	}
+
+	fm, err := s.initFileManager(filename)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	for _, name := range []string{from, to} {
+		if name == pkg.CurrentVersion {
+			continue
+		}
+		if _, err := fm.FindVersion(name); err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": fmt.Sprintf("Version %s not found", name)})
+		}
+	}
+
+	if c.Query("mode") == "unified" {
+		context := c.QueryInt("context", 3)
+		if context < 0 {
+			context = 0
+		} else if context > maxDiffContext {
+			context = maxDiffContext
+		}
+		text, err := fm.UnifiedDiff(from, to, context)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		c.Set("Content-Type", "text/x-diff; charset=utf-8")
+		return c.SendString(text)
+	}
+
+	primaryKey := c.Query("key")
+	if primaryKey == "" {
+		schema, err := s.getFileSchema(filename)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		primaryKey = schema.PrimaryKey
+	}
+
+	diff, err := fm.DiffVersions(from, to, primaryKey)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "diff": diff})
+}
+
+func (s *Server) handleListBackups(c *fiber.Ctx) error {
+	fm, err := s.initFileManager(c.Params("filename"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	backups, err := fm.ListBackups()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "backups": backups})
+}
+
+func (s *Server) handleGetBackup(c *fiber.Ctx) error {
+	fm, err := s.initFileManager(c.Params("filename"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	backup, err := fm.FindBackup(c.Params("backup"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Backup not found"})
+	}
+
+	items, err := fm.ReadBackup(backup.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "backup": backup, "items": items})
+}
+
+func (s *Server) handleRestoreBackup(c *fiber.Ctx) error {
+	fm, err := s.initFileManager(c.Params("filename"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	backup, err := fm.FindBackup(c.Params("backup"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Backup not found"})
+	}
+
+	s.setCommitInfo(c, fm, pkg.OperationRestore)
+	if err := fm.RestoreBackup(backup.Path); err != nil {
+		return sendWriteError(c, restoreErrorStatus(err), err)
+	}
+	s.afterRestore(c.Params("filename"))
+
+	return c.JSON(fiber.Map{"success": true, "message": "Backup restored"})
+}
+
+func (s *Server) handleVerifyHistory(c *fiber.Ctx) error {
+	fm, err := s.initFileManager(c.Params("filename"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	versions, backups, err := fm.VerifyHistory()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":  true,
+		"valid":    len(versions) == 0 && len(backups) == 0,
+		"versions": versions,
+		"backups":  backups,
+	})
+}
+
+// migrateHistory imports versions and backups named by timestamp into their manifests
+func (s *Server) migrateHistory() {
+	files, err := s.dataFileNames()
+	if err != nil {
+		log.Printf("Warning: Failed to list data files for history migration: %v", err)
+		return
+	}
+
+	for _, name := range files {
+		filePath := filepath.Join(s.dataDir, name)
+		if err := s.versionManager.MigrateLegacy(filePath); err != nil {
+			log.Printf("Warning: Failed to migrate versions of %s: %v", name, err)
+		}
+		if err := s.backupManager.MigrateLegacy(filePath); err != nil {
+			log.Printf("Warning: Failed to migrate backups of %s: %v", name, err)
+		}
+	}
+}
+
+// afterRestore refreshes server state derived from a restored file
+func (s *Server) afterRestore(filename string) {
+	s.forgetInferredSchemas(filename)
+	if filename == usersFile {
+		if err := s.loadUsers(); err != nil {
+			log.Printf("Warning: Failed to reload users after restore: %v", err)
+		}
+	}
+}
+
+// maxTagLength bounds snapshot tag names
+const maxTagLength = 64
+
+// snapshotID returns the version or backup id from the route
+func snapshotID(c *fiber.Ctx) string {
+	if id := c.Params("version"); id != "" {
+		return id
+	}
+	return c.Params("backup")
+}
+
+// updateSnapshot applies a change to the version or backup named in the route
+func (s *Server) updateSnapshot(c *fiber.Ctx, change func(fm *pkg.FileManager, id string) error, message string) error {
+	fm, err := s.initFileManager(c.Params("filename"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := change(fm, snapshotID(c)); err != nil {
+		if errors.Is(err, pkg.ErrSnapshotNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": message})
+}
+
+// pinSnapshot pins or unpins the version or backup named in the route
+func (s *Server) pinSnapshot(pinned bool) fiber.Handler {
+	message := "Snapshot pinned"
+	if !pinned {
+		message = "Snapshot unpinned"
+	}
+	return func(c *fiber.Ctx) error {
+		return s.updateSnapshot(c, func(fm *pkg.FileManager, id string) error {
+			if c.Params("version") != "" {
+				return fm.PinVersion(id, pinned)
+			}
+			return fm.PinBackup(id, pinned)
+		}, message)
+	}
+}
+
+func (s *Server) handleAddSnapshotTag(c *fiber.Ctx) error {
+	var req struct {
+		Tag string `json:"tag"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON data"})
+	}
+	req.Tag = strings.TrimSpace(req.Tag)
+	if req.Tag == "" || len(req.Tag) > maxTagLength {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("Tag must be 1 to %d characters", maxTagLength)})
+	}
+
+	return s.updateSnapshot(c, func(fm *pkg.FileManager, id string) error {
+		if c.Params("version") != "" {
+			return fm.TagVersion(id, req.Tag, true)
+		}
+		return fm.TagBackup(id, req.Tag, true)
+	}, "Tag added")
+}
+
+func (s *Server) handleRemoveSnapshotTag(c *fiber.Ctx) error {
+	tag := c.Params("tag")
+	return s.updateSnapshot(c, func(fm *pkg.FileManager, id string) error {
+		if c.Params("version") != "" {
+			return fm.TagVersion(id, tag, false)
+		}
+		return fm.TagBackup(id, tag, false)
+	}, "Tag removed")
+}
+
+// handlePruneHistory applies the retention policy to a file's versions and backups.
+// GET and ?dryRun=true only report what would be removed.
+func (s *Server) handlePruneHistory(c *fiber.Ctx) error {
+	filename := c.Params("filename")
+	dryRun := c.Method() == fiber.MethodGet || c.QueryBool("dryRun", false)
+
+	fm, err := s.initFileManager(filename)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	versions, err := fm.PruneVersions(dryRun)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	backups, err := fm.PruneBackups(dryRun)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if !dryRun {
+		log.Printf("Pruned history of %s: %d version(s), %d backup(s)", filename, len(versions.Pruned), len(backups.Pruned))
+	}
+
+	return c.JSON(fiber.Map{"success": true, "dryRun": dryRun, "versions": versions, "backups": backups})
+}
+
+// restoreRequest selects a snapshot by version, backup or point in time, and
+// optionally the ids of the items to restore from it
+type restoreRequest struct {
+	Version string   `json:"version"`
+	Backup  string   `json:"backup"`
+	AsOf    string   `json:"asOf"`
+	IDs     []string `json:"ids"`
+	Key     string   `json:"key"`
+}
+
+// handleRestore restores a whole file or selected items from a version, a backup,
+// or the version current at a point in time
+func (s *Server) handleRestore(c *fiber.Ctx) error {
+	filename := c.Params("filename")
+
+	var req restoreRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON data"})
+	}
+
+	sources := 0
+	for _, value := range []string{req.Version, req.Backup, req.AsOf} {
+		if value != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return c.Status(400).JSON(fiber.Map{"error": "Specify exactly one of version, backup or asOf"})
+	}
+
+	fm, err := s.initFileManager(filename)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Resolve a point in time to the version current at that time
+	if req.AsOf != "" {
+		asOf, err := parseTimeParam(req.AsOf)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid 'asOf' time, use RFC 3339 or YYYY-MM-DD"})
+		}
+		version, err := fm.VersionAsOf(asOf)
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		req.Version = version.ID
+	}
+
+	if req.Version != "" {
+		if _, err := fm.FindVersion(req.Version); err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Version not found"})
+		}
+	} else if _, err := fm.FindBackup(req.Backup); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Backup not found"})
+	}
+
+	s.setCommitInfo(c, fm, pkg.OperationRestore)
+
+	// Whole-file restore
+	if len(req.IDs) == 0 {
+		if req.Version != "" {
+			err = fm.RestoreVersion(req.Version)
+		} else {
+			var backup *pkg.BackupInfo
+			if backup, err = fm.FindBackup(req.Backup); err == nil {
+				err = fm.RestoreBackup(backup.Path)
+			}
+		}
+		if err != nil {
+			return sendWriteError(c, restoreErrorStatus(err), err)
+		}
+		s.afterRestore(filename)
+		return c.JSON(fiber.Map{"success": true, "message": "File restored", "version": req.Version, "backup": req.Backup})
+	}
+
+	// Item restore
+	key := req.Key
+	if key == "" {
+		schema, err := s.getFileSchema(filename)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		key = schema.PrimaryKey
+	}
+
+	var result *pkg.ItemRestoreResult
+	if req.Version != "" {
+		result, err = fm.RestoreItems(req.Version, key, req.IDs)
+	} else {
+		result, err = fm.RestoreBackupItems(req.Backup, key, req.IDs)
+	}
+	if errors.Is(err, pkg.ErrNothingRestored) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error(), "result": result})
+	}
+	if err != nil {
+		return sendWriteError(c, restoreErrorStatus(err), err)
+	}
+	s.afterRestore(filename)
+
+	return c.JSON(fiber.Map{"success": true, "message": "Items restored", "result": result})
+}
+
+// restoreErrorStatus maps a failed restore to a status code. A snapshot that fails
+// its integrity check is a conflict, not a server error.
+func restoreErrorStatus(err error) int {
+	if errors.Is(err, pkg.ErrSnapshotCorrupt) {
+		return 409
+	}
+	return writeErrorStatus(err)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"backend/pkg"
+)
+
+// listVersions returns the versions of a data file, newest first
+func listVersions(t *testing.T, s *Server, token, filename string) []pkg.VersionInfo {
+	t.Helper()
+	resp, body := do(t, s, apiRequest("GET", "/api/files/"+filename+"/versions", token, ""))
+	if resp.StatusCode != 200 {
+		t.Fatalf("list versions = %d %s", resp.StatusCode, body)
+	}
+	var result struct {
+		Versions []pkg.VersionInfo `json:"versions"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result.Versions
+}
+
+func TestVersionHistoryAPI(t *testing.T) {
+	s := newTestServer(t, map[string]string{usersFile: testUsers, "products.json": `[{"id": 1, "name": "Tea"}]`}, ServerOptions{})
+	admin := login(t, s, "admin@example.com", "admin-password")
+	editor := login(t, s, "editor@example.com", "editor-password")
+
+	req := apiRequest("POST", "/api/files/products.json/items", editor, `{"id": 2, "name": "Coffee"}`)
+	req.Header.Set(commitMessageHeader, "Add coffee")
+	if resp, body := do(t, s, req); resp.StatusCode != 200 {
+		t.Fatalf("create = %d %s", resp.StatusCode, body)
+	}
+	if resp, body := do(t, s, apiRequest("POST", "/api/files/products.json/items/1", editor, `{"id": 1, "name": "Green tea"}`)); resp.StatusCode != 200 {
+		t.Fatalf("update = %d %s", resp.StatusCode, body)
+	}
+
+	versions := listVersions(t, s, editor, "products.json")
+	if len(versions) != 2 {
+		t.Fatalf("listed %d versions, want 2", len(versions))
+	}
+	updated, created := versions[0], versions[1]
+	if updated.Operation != pkg.OperationUpdate || updated.Author != "2" || updated.AuthorName != "Eve" {
+		t.Errorf("latest version = %+v, want an update by Eve", updated)
+	}
+	if created.Operation != pkg.OperationCreate || created.Message != "Add coffee" || !reflect.DeepEqual(created.AffectedIDs, []string{"2"}) {
+		t.Errorf("first version = %+v, want the create of item 2 with its message", created)
+	}
+
+	// Previewing a version shows its items without changing the file
+	resp, body := do(t, s, apiRequest("GET", "/api/files/products.json/versions/"+created.ID, editor, ""))
+	var preview struct {
+		Items []map[string]any `json:"items"`
+	}
+	json.Unmarshal(body, &preview)
+	if resp.StatusCode != 200 || len(preview.Items) != 2 || preview.Items[0]["name"] != "Tea" {
+		t.Errorf("preview = %d %s", resp.StatusCode, body)
+	}
+
+	// Only admins restore, and the restore is itself recorded
+	restorePath := "/api/files/products.json/versions/" + created.ID + "/restore"
+	if resp, _ := do(t, s, apiRequest("POST", restorePath, editor, "")); resp.StatusCode != 403 {
+		t.Errorf("restore as editor = %d, want 403", resp.StatusCode)
+	}
+	if resp, _ := do(t, s, apiRequest("POST", "/api/files/products.json/versions/missing/restore", admin, "")); resp.StatusCode != 404 {
+		t.Errorf("restore of a missing version = %d, want 404", resp.StatusCode)
+	}
+	if resp, body := do(t, s, apiRequest("POST", restorePath, admin, "")); resp.StatusCode != 200 {
+		t.Fatalf("restore = %d %s", resp.StatusCode, body)
+	}
+	if items := storedItems(t, s, "products.json"); items[0]["name"] != "Tea" || len(items) != 2 {
+		t.Errorf("after restore the file holds %v", items)
+	}
+
+	versions = listVersions(t, s, admin, "products.json")
+	restored := versions[0]
+	if restored.Operation != pkg.OperationRestore || restored.Author != "1" || restored.Hash != created.Hash || restored.PreRestoreBackup == "" {
+		t.Errorf("restore recorded as %+v", restored)
+	}
+
+	// The backup taken before the restore brings back the replaced data
+	backupPath := "/api/files/products.json/backups/" + restored.PreRestoreBackup
+	if resp, body := do(t, s, apiRequest("GET", backupPath, admin, "")); resp.StatusCode != 200 {
+		t.Fatalf("get pre-restore backup = %d %s", resp.StatusCode, body)
+	}
+	if resp, body := do(t, s, apiRequest("POST", backupPath+"/restore", admin, "")); resp.StatusCode != 200 {
+		t.Fatalf("backup restore = %d %s", resp.StatusCode, body)
+	}
+	if items := storedItems(t, s, "products.json"); items[0]["name"] != "Green tea" {
+		t.Errorf("after backup restore the file holds %v", items)
+	}
+}
@@ -4,7 +4,12 @@ import (
 	"backend/pkg"
 	"flag"
 	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/oarkflow/jsonschema"
@@ -15,6 +20,32 @@ func main() {
 	dataDir := flag.String("data-dir", "./data", "Directory containing data files")
 	allowedFiles := flag.String("files", "", "Comma-separated list of allowed files (empty means all files)")
 	port := flag.String("port", "3003", "Port to run the server on")
+	encryptFiles := flag.String("encrypt-files", "", "Comma-separated list of data files to encrypt at rest (e.g. users.json)")
+	keyFile := flag.String("key-file", "", "File containing the encryption key (defaults to $"+pkg.EncryptionKeyFileEnv+" or $"+pkg.EncryptionKeyEnv+")")
+	previousKeyFile := flag.String("previous-key-file", "", "File containing the previous encryption key, accepted for decryption during rotation")
+	reencrypt := flag.Bool("reencrypt", false, "Re-encrypt encrypted files, their versions and backups with the current key, then exit")
+	sessionSecret := flag.String("session-secret", os.Getenv("SESSION_SECRET"), "Secret used to sign session tokens (defaults to $SESSION_SECRET, random if empty)")
+	sessionTTL := flag.Duration("session-ttl", 12*time.Hour, "Lifetime of login sessions")
+	publicFiles := flag.String("public-files", "menu.json", "Comma-separated list of files served without authentication at /get/:filename")
+	redactFields := flag.String("redact-fields", "", "Comma-separated fields never served publicly, as field or file:field (password is always redacted)")
+	versionsDir := flag.String("versions-dir", "", "Directory for file versions (defaults to the data directory)")
+	maxVersions := flag.Int("max-versions", 0, "Maximum number of versions kept per file (0 = limited by retention only)")
+	retainAll := flag.Duration("retain-all", 24*time.Hour, "Keep every version and backup newer than this")
+	retainDaily := flag.Int("retain-daily", 30, "Keep one version and backup per day for this many days")
+	retainMonthly := flag.Int("retain-monthly", 12, "Keep one version and backup per month for this many months")
+	maxHistorySize := flag.Int64("max-history-size", 0, "Maximum bytes of versions and of backups kept per file (0 = unlimited)")
+	deltaVersions := flag.Bool("delta-versions", false, "Store versions as deltas against the previous version")
+	backupDir := flag.String("backup-dir", "", "Directory for file backups (defaults to <data-dir>/backups)")
+	archiveDir := flag.String("archive-dir", "", "Directory for data directory archives (defaults to <data-dir>/archives)")
+	createArchive := flag.Bool("archive", false, "Write a tar.gz archive of the whole data directory, then exit")
+	backupSchedule := flag.String("backup-schedule", "", "JSON file of scheduled backup jobs and their destinations (local, mount or s3)")
+	restoreArchive := flag.String("restore-archive", "", "Verify a data directory archive and restore it into the data directory, then exit")
+	policyFile := flag.String("policy", "policy.json", "Role policy file mapping roles to allowed files and verbs")
+	codegen := flag.String("codegen", "", "Generate types for a data file's items from its schema sidecar or data, then exit")
+	codegenLang := flag.String("codegen-lang", "ts", "Language of -codegen output: ts (TypeScript interfaces) or go (structs)")
+	codegenOut := flag.String("codegen-out", "", "File to write -codegen output to (defaults to stdout)")
+	codegenPackage := flag.String("codegen-package", "models", "Package name of Go code generated by -codegen")
+	generateKey := flag.Bool("generate-key", false, "Print a new random encryption key and exit")
 	help := flag.Bool("help", false, "Show help information")
 
 	flag.Parse()
@@ -28,6 +59,21 @@ func main() {
 		fmt.Println("Examples:")
 		fmt.Println("  ./server -data-dir=./data -port=8080")
 		fmt.Println("  ./server -files=menu.json,users.json -port=3000")
+		fmt.Println("  ./server -encrypt-files=users.json -key-file=/etc/fishtail/data.key")
+		fmt.Println("  ./server -encrypt-files=users.json -key-file=new.key -previous-key-file=old.key -reencrypt")
+		fmt.Println("  ./server -data-dir=./data -archive")
+		fmt.Println("  ./server -data-dir=./data -restore-archive=site.tar.gz")
+		fmt.Println("  ./server -backup-schedule=backups.json")
+		fmt.Println("  ./server -codegen=menu.json -codegen-lang=go -codegen-out=models/menu.go")
+		return
+	}
+
+	if *generateKey {
+		key, err := pkg.GenerateEncryptionKey()
+		if err != nil {
+			log.Fatalf("Failed to generate key: %v", err)
+		}
+		fmt.Println(key)
 		return
 	}
 
@@ -41,6 +87,80 @@ func main() {
 		}
 	}
 
+	opts := ServerOptions{
+		RestrictFiles: restrictedFiles,
+		EncryptFiles:  splitList(*encryptFiles),
+		SessionSecret: []byte(*sessionSecret),
+		SessionTTL:    *sessionTTL,
+		PublicFiles:   splitList(*publicFiles),
+		RedactFields:  splitList(*redactFields),
+		VersionsDir:   *versionsDir,
+		MaxVersions:   *maxVersions,
+		Retention: &pkg.RetentionPolicy{
+			KeepAllFor:    *retainAll,
+			DailyDays:     *retainDaily,
+			MonthlyMonths: *retainMonthly,
+			MaxTotalSize:  *maxHistorySize,
+		},
+		DeltaVersions: *deltaVersions,
+		BackupDir:     *backupDir,
+		ArchiveDir:    *archiveDir,
+	}
+	if len(opts.EncryptFiles) > 0 {
+		key, err := pkg.LoadEncryptionKey(*keyFile)
+		if err != nil {
+			log.Fatalf("Failed to load encryption key: %v", err)
+		}
+		opts.EncryptionKey = key
+
+		if *previousKeyFile != "" {
+			previous, err := pkg.LoadEncryptionKeyFile(*previousKeyFile)
+			if err != nil {
+				log.Fatalf("Failed to load previous encryption key: %v", err)
+			}
+			opts.PreviousKeys = append(opts.PreviousKeys, previous)
+		}
+	}
+
+	if *codegen != "" {
+		if err := runCodegen(*dataDir, opts, *codegen, *codegenLang, *codegenOut, *codegenPackage); err != nil {
+			log.Fatalf("Code generation failed: %v", err)
+		}
+		return
+	}
+
+	if *backupSchedule != "" {
+		schedule, err := pkg.LoadScheduleConfig(*backupSchedule)
+		if err != nil {
+			log.Fatalf("Failed to load backup schedule: %v", err)
+		}
+		opts.Schedule = schedule
+	}
+
+	policy, err := LoadPolicy(*policyFile)
+	if err != nil {
+		log.Fatalf("Failed to load policy: %v", err)
+	}
+	opts.Policy = policy
+
+	if *reencrypt {
+		if len(opts.EncryptFiles) == 0 {
+			log.Fatal("-reencrypt requires -encrypt-files")
+		}
+		if err := reencryptFiles(*dataDir, opts); err != nil {
+			log.Fatalf("Re-encryption failed: %v", err)
+		}
+		fmt.Println("Re-encryption complete")
+		return
+	}
+
+	if *createArchive || *restoreArchive != "" {
+		if err := runArchiveCommand(*dataDir, opts.ArchiveDir, *createArchive, *restoreArchive); err != nil {
+			log.Fatalf("Archive failed: %v", err)
+		}
+		return
+	}
+
 	fmt.Printf("Starting server on port %s\n", *port)
 	fmt.Printf("Data directory: %s\n", *dataDir)
 	if len(restrictedFiles) > 0 {
@@ -49,9 +169,150 @@ func main() {
 		fmt.Println("Allowed files: all")
 	}
 
-	server := NewServer(*dataDir)
-	server.restrictFiles = restrictedFiles
-	server.app.Listen(":" + *port)
+	if len(opts.EncryptFiles) > 0 {
+		fmt.Printf("Encrypted files: %v\n", opts.EncryptFiles)
+	}
+	fmt.Printf("Public files: %v\n", opts.PublicFiles)
+
+	server, err := NewServerWithOptions(*dataDir, opts)
+	if err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+
+	// Shut down cleanly on Ctrl-C or SIGTERM
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		fmt.Println("Shutting down")
+		if err := server.Shutdown(); err != nil {
+			log.Printf("Warning: Shutdown failed: %v", err)
+		}
+	}()
+
+	if err := server.app.Listen(":" + *port); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+	// Listen returns as soon as shutdown starts
+	<-stopped
+}
+
+// splitList splits a comma-separated flag value and trims spaces
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// runArchiveCommand creates an archive of the data directory, or imports an
+// archive file and restores it, without starting the server
+func runArchiveCommand(dataDir, archiveDir string, create bool, restorePath string) error {
+	if archiveDir == "" {
+		archiveDir = filepath.Join(dataDir, "archives")
+	}
+	archiveManager, err := pkg.NewArchiveManager(dataDir, archiveDir)
+	if err != nil {
+		return err
+	}
+
+	if create {
+		archive, err := archiveManager.Create()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Archived %s to %s (%d bytes)\n", dataDir, archive.Path, archive.Size)
+	}
+
+	if restorePath != "" {
+		file, err := os.Open(restorePath)
+		if err != nil {
+			return fmt.Errorf("failed to open archive: %w", err)
+		}
+		defer file.Close()
+
+		archive, err := archiveManager.Import(file)
+		if err != nil {
+			return err
+		}
+		result, err := archiveManager.Restore(archive.ID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Restored %d files from %s\n", result.Files, restorePath)
+		fmt.Printf("  Previous data kept in %s\n", filepath.Join(dataDir, result.PreviousDataDir))
+	}
+	return nil
+}
+
+// reencryptFiles rewrites every encrypted data file together with its versions
+// and backups using the current key. Plaintext files and files sealed with a
+// previous key are both accepted as input.
+func reencryptFiles(dataDir string, opts ServerOptions) error {
+	registry := pkg.NewFormatRegistry()
+	versionsDir := opts.VersionsDir
+	if versionsDir == "" {
+		versionsDir = dataDir
+	}
+	backupDir := opts.BackupDir
+	if backupDir == "" {
+		backupDir = filepath.Join(dataDir, "backups")
+	}
+	versionManager := pkg.NewVersionManager(versionsDir, 0)
+	backupManager := pkg.NewBackupManager(backupDir)
+
+	for _, name := range opts.EncryptFiles {
+		inner, err := registry.Get(filepath.Ext(name))
+		if err != nil {
+			return err
+		}
+		from, err := pkg.NewEncryptedFormat(inner, opts.EncryptionKey, opts.PreviousKeys...)
+		if err != nil {
+			return err
+		}
+		to, err := pkg.NewEncryptedFormat(inner, opts.EncryptionKey)
+		if err != nil {
+			return err
+		}
+
+		filePath := filepath.Join(dataDir, name)
+		paths := []string{filePath}
+
+		// Versions may share objects and hold encrypted deltas
+		if err := versionManager.ReEncrypt(filePath, from, to); err != nil {
+			return fmt.Errorf("failed to re-encrypt versions of %s: %w", name, err)
+		}
+		fmt.Printf("✓ Re-encrypted versions of %s\n", name)
+
+		backups, err := backupManager.ListBackups(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to list backups of %s: %w", name, err)
+		}
+		for _, backup := range backups {
+			paths = append(paths, backup.Path)
+		}
+
+		for _, path := range paths {
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				continue
+			}
+			if err := pkg.ReEncryptFile(path, from, to); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Re-encrypted %s\n", path)
+		}
+	}
+
+	return nil
 }
 
 func main1() {
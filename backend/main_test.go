@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"backend/pkg"
+)
+
+func TestReencryptWithPreviousKey(t *testing.T) {
+	dataDir := t.TempDir()
+	// Keys are read from files as -key-file and -previous-key-file do
+	keyFile := func(name, hexKey string) *pkg.EncryptionKey {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(hexKey+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		key, err := pkg.LoadEncryptionKeyFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	oldKey, newKey := keyFile("old.key", strings.Repeat("1", 64)), keyFile("new.key", strings.Repeat("2", 64))
+
+	// Users are written encrypted with the old key, leaving a backup behind
+	old, err := NewServerWithOptions(dataDir, ServerOptions{EncryptFiles: []string{usersFile}, EncryptionKey: oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, usersFile), []byte(testUsers), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.loadUsers(); err != nil {
+		t.Fatal(err)
+	}
+	old.Shutdown()
+
+	opts := ServerOptions{EncryptFiles: []string{usersFile}, EncryptionKey: newKey, PreviousKeys: []*pkg.EncryptionKey{oldKey}}
+	if err := reencryptFiles(dataDir, opts); err != nil {
+		t.Fatalf("reencryptFiles: %v", err)
+	}
+
+	current, err := pkg.NewEncryptedFormat(&pkg.JSONFormat{}, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, _ := filepath.Glob(filepath.Join(dataDir, "backups", usersFile, "*Z*.json"))
+	if len(paths) == 0 {
+		t.Fatal("no backups were written")
+	}
+	for _, path := range append(paths, filepath.Join(dataDir, usersFile)) {
+		if encrypted, err := pkg.IsEncryptedFile(path); err != nil || !encrypted {
+			t.Errorf("%s is not encrypted: %v", path, err)
+			continue
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = current.Parse(file)
+		file.Close()
+		if err != nil {
+			t.Errorf("%s cannot be read with the new key alone: %v", path, err)
+		}
+	}
+
+	// Once rotated, the previous key is no longer needed
+	s := newTestServerIn(t, dataDir, ServerOptions{EncryptFiles: []string{usersFile}, EncryptionKey: newKey})
+	login(t, s, "admin@example.com", "admin-password")
+}
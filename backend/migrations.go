@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+
+	"backend/pkg"
+)
+
+// parseMigration reads a migration from the request body, along with the schema it installs if any
+func parseMigration(c *fiber.Ctx) (*pkg.Migration, *pkg.FileSchema, error) {
+	var migration pkg.Migration
+	if err := json.Unmarshal(c.Body(), &migration); err != nil {
+		return nil, nil, err
+	}
+	if err := migration.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if len(migration.Schema) == 0 {
+		return &migration, nil, nil
+	}
+
+	schema, err := pkg.ParseFileSchema(migration.Schema)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &migration, schema, nil
+}
+
+// migrationErrorStatus maps a failed migration or rollback to a status code
+func migrationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, pkg.ErrInvalidMigration):
+		return 400
+	case errors.Is(err, pkg.ErrMigrationNotFound):
+		return 404
+	case errors.Is(err, pkg.ErrMigrationConflict):
+		return 409
+	case errors.Is(err, pkg.ErrMigrationFailed):
+		return 422
+	}
+	return restoreErrorStatus(err)
+}
+
+func (s *Server) handleListMigrations(c *fiber.Ctx) error {
+	filename := c.Params("filename")
+	if !s.dataFileExists(filename) {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found"})
+	}
+
+	fm, err := s.openFileManager(filename)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	migrations, err := fm.Migrations()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "migrations": migrations})
+}
+
+func (s *Server) handlePreviewMigration(c *fiber.Ctx) error {
+	filename := c.Params("filename")
+	if !s.dataFileExists(filename) {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found"})
+	}
+
+	migration, schema, err := parseMigration(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	fm, err := s.initFileManager(filename)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if schema != nil {
+		fm.UseSchema(schema)
+	}
+	info, err := s.getFileSchema(filename)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	preview, err := fm.PreviewMigration(migration, info.PrimaryKey)
+	if err != nil {
+		return sendWriteError(c, migrationErrorStatus(err), err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "preview": preview})
+}
+
+func (s *Server) handleApplyMigration(c *fiber.Ctx) error {
+	filename := c.Params("filename")
+	if !s.dataFileExists(filename) {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found"})
+	}
+
+	migration, schema, err := parseMigration(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	fm, err := s.initFileManager(filename)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	info, err := s.getFileSchema(filename)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// The migrated data is checked against the schema it will be stored under
+	var previousSchema []byte
+	if schema != nil {
+		fm.UseSchema(schema)
+		previousSchema, err = os.ReadFile(s.schemas.Path(filename))
+		if err != nil && !os.IsNotExist(err) {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	s.setCommitInfo(c, fm, pkg.OperationMigrate)
+	record, err := fm.Migrate(migration, info.PrimaryKey, previousSchema)
+	if err != nil {
+		return sendWriteError(c, migrationErrorStatus(err), err)
+	}
+	s.forgetInferredSchemas(filename)
+
+	if schema != nil {
+		if _, err := s.schemas.Put(filename, migration.Schema); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Data was migrated but its schema was not saved: " + err.Error()})
+		}
+	}
+
+	return c.Status(201).JSON(fiber.Map{"success": true, "message": "Migration applied", "migration": record})
+}
+
+func (s *Server) handleRollbackMigration(c *fiber.Ctx) error {
+	filename := c.Params("filename")
+	if !s.dataFileExists(filename) {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found"})
+	}
+
+	fm, err := s.initFileManager(filename)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	record, err := fm.FindMigration(c.Params("migration"))
+	if err != nil {
+		return sendWriteError(c, migrationErrorStatus(err), err)
+	}
+
+	// A migration that replaced the schema is rolled back under the schema it replaced
+	var previous *pkg.FileSchema
+	if len(record.Schema) > 0 {
+		fm.UseSchema(nil)
+		if len(record.PreviousSchema) > 0 {
+			if previous, err = pkg.ParseFileSchema(record.PreviousSchema); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			}
+			fm.UseSchema(previous)
+		}
+	}
+
+	s.setCommitInfo(c, fm, pkg.OperationRestore)
+	record, err = fm.RollbackMigration(record.ID, c.QueryBool("force"))
+	if err != nil {
+		return sendWriteError(c, migrationErrorStatus(err), err)
+	}
+	s.afterRestore(filename)
+
+	if len(record.Schema) > 0 {
+		if previous != nil {
+			_, err = s.schemas.Put(filename, record.PreviousSchema)
+		} else if err = s.schemas.Delete(filename); errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Data was rolled back but its schema was not restored: " + err.Error()})
+		}
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Migration rolled back", "migration": record})
+}
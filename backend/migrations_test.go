@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"backend/pkg"
+)
+
+func TestMigrationAPI(t *testing.T) {
+	const dishes = `[{"id": 1, "name": "Samosa", "dietaryInfo": "V, GF"}, {"id": 2, "name": "Dal", "dietaryInfo": ["VG"]}]`
+	s := newTestServer(t, map[string]string{usersFile: testUsers, "dishes.json": dishes}, ServerOptions{})
+	admin := login(t, s, "admin@example.com", "admin-password")
+	editor := login(t, s, "editor@example.com", "editor-password")
+	sidecar := filepath.Join(s.dataDir, pkg.SchemaSidecarName("dishes.json"))
+
+	const migration = `{"name": "dietary lists",
+		"transforms": [{"op": "split", "field": "dietaryInfo"}],
+		"schema": {"type": "object", "properties": {"dietaryInfo": {"type": "array", "items": {"type": "string"}}}}}`
+
+	if resp, _ := do(t, s, apiRequest("POST", "/api/files/dishes.json/migrations", editor, migration)); resp.StatusCode != 403 {
+		t.Errorf("migrate as editor = %d, want 403", resp.StatusCode)
+	}
+	if resp, body := do(t, s, apiRequest("POST", "/api/files/dishes.json/migrations", admin, `{"name": "nothing"}`)); resp.StatusCode != 400 {
+		t.Errorf("migrate without transforms = %d %s, want 400", resp.StatusCode, body)
+	}
+	// Values a transform cannot convert reject the whole migration
+	failing := `{"name": "names as numbers", "transforms": [{"op": "cast", "field": "name", "type": "number"}]}`
+	if resp, body := do(t, s, apiRequest("POST", "/api/files/dishes.json/migrations", admin, failing)); resp.StatusCode != 422 {
+		t.Errorf("failing migration = %d %s, want 422", resp.StatusCode, body)
+	}
+
+	resp, body := do(t, s, apiRequest("POST", "/api/files/dishes.json/migrations/preview", admin, migration))
+	var preview struct {
+		Preview pkg.MigrationPreview `json:"preview"`
+	}
+	json.Unmarshal(body, &preview)
+	if resp.StatusCode != 200 || preview.Preview.Changed != 1 || len(preview.Preview.Violations) != 0 {
+		t.Errorf("preview = %d %s", resp.StatusCode, body)
+	}
+	if _, err := os.Stat(sidecar); !os.IsNotExist(err) {
+		t.Errorf("preview wrote a schema: %v", err)
+	}
+
+	resp, body = do(t, s, apiRequest("POST", "/api/files/dishes.json/migrations", admin, migration))
+	if resp.StatusCode != 201 {
+		t.Fatalf("migrate = %d %s", resp.StatusCode, body)
+	}
+	var applied struct {
+		Migration pkg.MigrationRecord `json:"migration"`
+	}
+	json.Unmarshal(body, &applied)
+	if items := storedItems(t, s, "dishes.json"); len(items[0]["dietaryInfo"].([]any)) != 2 {
+		t.Errorf("after migrating the file holds %v", items)
+	}
+	if _, err := os.Stat(sidecar); err != nil {
+		t.Errorf("the migration's schema was not installed: %v", err)
+	}
+	// The installed schema now guards writes
+	if status := postItem(t, s, admin, "dishes.json", `{"id": 3, "name": "Korma", "dietaryInfo": "GF"}`); status != 422 {
+		t.Errorf("create against the migrated schema = %d, want 422", status)
+	}
+
+	resp, body = do(t, s, apiRequest("GET", "/api/files/dishes.json/migrations", editor, ""))
+	var listed struct {
+		Migrations []pkg.MigrationRecord `json:"migrations"`
+	}
+	json.Unmarshal(body, &listed)
+	if resp.StatusCode != 200 || len(listed.Migrations) != 1 || listed.Migrations[0].ID != applied.Migration.ID || listed.Migrations[0].Author != "1" {
+		t.Errorf("list migrations = %d %s", resp.StatusCode, body)
+	}
+
+	// Rolling back restores the data and removes the schema the migration added
+	rollback := "/api/files/dishes.json/migrations/" + applied.Migration.ID + "/rollback"
+	if resp, _ := do(t, s, apiRequest("POST", rollback, editor, "")); resp.StatusCode != 403 {
+		t.Errorf("rollback as editor = %d, want 403", resp.StatusCode)
+	}
+	if resp, _ := do(t, s, apiRequest("POST", "/api/files/dishes.json/migrations/missing/rollback", admin, "")); resp.StatusCode != 404 {
+		t.Errorf("rollback of a missing migration = %d, want 404", resp.StatusCode)
+	}
+	if resp, body := do(t, s, apiRequest("POST", rollback, admin, "")); resp.StatusCode != 200 {
+		t.Fatalf("rollback = %d %s", resp.StatusCode, body)
+	}
+	if items := storedItems(t, s, "dishes.json"); items[0]["dietaryInfo"] != "V, GF" {
+		t.Errorf("after rollback the file holds %v", items)
+	}
+	if _, err := os.Stat(sidecar); !os.IsNotExist(err) {
+		t.Errorf("the migration's schema is still installed: %v", err)
+	}
+	if resp, _ := do(t, s, apiRequest("POST", rollback, admin, "")); resp.StatusCode != 409 {
+		t.Errorf("second rollback = %d, want 409", resp.StatusCode)
+	}
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"backend/pkg"
+)
+
+// routeDoc describes a route in the OpenAPI document
+type routeDoc struct {
+	summary string
+	// operation is the operationId. In per-file routes %s is the file's type name, e.g. Product for products.csv.
+	operation string
+	public    bool
+}
+
+// routeDocs documents the API routes, keyed by method and Fiber path. Routes missing
+// here are still listed, with a summary and operationId derived from the path.
+var routeDocs = map[string]routeDoc{
+	"GET /get/:filename":    {summary: "Download a public file", operation: "getPublicFile", public: true},
+	"POST /api/login":       {summary: "Log in and start a session", operation: "login", public: true},
+	"POST /api/logout":      {summary: "End the current session", operation: "logout"},
+	"GET /api/userinfo":     {summary: "Current user and permissions", operation: "getUserInfo"},
+	"GET /api/openapi.json": {summary: "This OpenAPI document", operation: "getOpenAPI"},
+	"GET /api/files":        {summary: "List data files", operation: "listFiles"},
+
+	"GET /api/files/:filename/items":        {summary: "List items, paginated and searchable", operation: "list%sItems"},
+	"POST /api/files/:filename/items":       {summary: "Create an item", operation: "create%sItem"},
+	"GET /api/files/:filename/items/:id":    {summary: "Get an item by primary key", operation: "get%sItem"},
+	"POST /api/files/:filename/items/:id":   {summary: "Update an item", operation: "update%sItem"},
+	"DELETE /api/files/:filename/items/:id": {summary: "Delete an item", operation: "delete%sItem"},
+	"GET /api/files/:filename/fields":       {summary: "List field names", operation: "list%sFields"},
+	"GET /api/files/:filename/metadata":     {summary: "File metadata", operation: "get%sMetadata"},
+	"GET /api/files/:filename/structure":    {summary: "File structure", operation: "get%sStructure"},
+	"GET /api/files/:filename/info":         {summary: "File size, format and counts", operation: "get%sFileInfo"},
+
+	"GET /api/files/:filename/export":           {summary: "Download the file", operation: "exportFile"},
+	"GET /api/files/:filename/schema":           {summary: "Get the file's JSON Schema", operation: "getSchema"},
+	"PUT /api/files/:filename/schema":           {summary: "Replace the file's JSON Schema", operation: "putSchema"},
+	"DELETE /api/files/:filename/schema":        {summary: "Remove the file's JSON Schema", operation: "deleteSchema"},
+	"POST /api/files/:filename/schema/generate": {summary: "Save a schema inferred from the data", operation: "generateSchema"},
+	"POST /api/files/:filename/schema/diff":     {summary: "Compare a proposed schema with the current one", operation: "diffSchema"},
+
+	"GET /api/files/:filename/migrations":                      {summary: "List applied migrations", operation: "listMigrations"},
+	"POST /api/files/:filename/migrations":                     {summary: "Apply a migration", operation: "applyMigration"},
+	"POST /api/files/:filename/migrations/preview":             {summary: "Preview a migration", operation: "previewMigration"},
+	"POST /api/files/:filename/migrations/:migration/rollback": {summary: "Roll back a migration", operation: "rollbackMigration"},
+
+	"GET /api/files/:filename/versions":                       {summary: "List versions", operation: "listVersions"},
+	"GET /api/files/:filename/versions/diff":                  {summary: "Compare two versions", operation: "diffVersions"},
+	"GET /api/files/:filename/versions/verify":                {summary: "Verify the version history", operation: "verifyHistory"},
+	"GET /api/files/:filename/versions/:version":              {summary: "Get a version", operation: "getVersion"},
+	"POST /api/files/:filename/versions/:version/restore":     {summary: "Restore a version", operation: "restoreVersion"},
+	"POST /api/files/:filename/versions/:version/pin":         {summary: "Pin a version", operation: "pinVersion"},
+	"DELETE /api/files/:filename/versions/:version/pin":       {summary: "Unpin a version", operation: "unpinVersion"},
+	"POST /api/files/:filename/versions/:version/tags":        {summary: "Tag a version", operation: "tagVersion"},
+	"DELETE /api/files/:filename/versions/:version/tags/:tag": {summary: "Remove a version tag", operation: "untagVersion"},
+	"GET /api/files/:filename/backups":                        {summary: "List backups", operation: "listBackups"},
+	"GET /api/files/:filename/backups/:backup":                {summary: "Get a backup", operation: "getBackup"},
+	"POST /api/files/:filename/backups/:backup/restore":       {summary: "Restore a backup", operation: "restoreBackup"},
+	"POST /api/files/:filename/backups/:backup/pin":           {summary: "Pin a backup", operation: "pinBackup"},
+	"DELETE /api/files/:filename/backups/:backup/pin":         {summary: "Unpin a backup", operation: "unpinBackup"},
+	"POST /api/files/:filename/backups/:backup/tags":          {summary: "Tag a backup", operation: "tagBackup"},
+	"DELETE /api/files/:filename/backups/:backup/tags/:tag":   {summary: "Remove a backup tag", operation: "untagBackup"},
+	"POST /api/files/:filename/restore":                       {summary: "Restore uploaded data", operation: "restoreFile"},
+	"GET /api/files/:filename/prune":                          {summary: "Preview pruning the history", operation: "previewPrune"},
+	"POST /api/files/:filename/prune":                         {summary: "Prune the history", operation: "pruneHistory"},
+
+	"GET /api/archives":                   {summary: "List archives", operation: "listArchives"},
+	"POST /api/archives":                  {summary: "Archive the data directory", operation: "createArchive"},
+	"POST /api/archives/import":           {summary: "Import an archive", operation: "importArchive"},
+	"GET /api/archives/:archive":          {summary: "Download an archive", operation: "downloadArchive"},
+	"POST /api/archives/:archive/verify":  {summary: "Verify an archive", operation: "verifyArchive"},
+	"POST /api/archives/:archive/restore": {summary: "Restore an archive", operation: "restoreArchive"},
+	"DELETE /api/archives/:archive":       {summary: "Delete an archive", operation: "deleteArchive"},
+	"GET /api/schedule":                   {summary: "Backup schedule status", operation: "getSchedule"},
+	"POST /api/schedule/:job/run":         {summary: "Run a backup job now", operation: "runBackupJob"},
+
+	"POST /api/me/password":        {summary: "Change your password", operation: "changeOwnPassword"},
+	"GET /api/users":               {summary: "List users", operation: "listUsers"},
+	"POST /api/users":              {summary: "Create a user", operation: "createUser"},
+	"POST /api/users/:id/password": {summary: "Reset a user's password", operation: "resetPassword"},
+	"POST /api/users/:id/active":   {summary: "Activate or deactivate a user", operation: "setUserActive"},
+	"POST /api/users/:id/role":     {summary: "Change a user's role", operation: "setUserRole"},
+}
+
+// routeParam matches Fiber path parameters such as :filename
+var routeParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// sectionFields are added to menu.json items by the item handlers
+var sectionFields = []string{"_section_title", "_section_image", "_section_subtitle"}
+
+// openAPIBuilder collects the paths and component schemas of an OpenAPI document
+type openAPIBuilder struct {
+	paths      map[string]map[string]interface{}
+	schemas    map[string]interface{}
+	operations map[string]bool
+}
+
+// handleOpenAPI returns an OpenAPI 3.1 document for the registered API routes. Item
+// routes are listed once per data file the user can read, typed by the file's schema.
+func (s *Server) handleOpenAPI(c *fiber.Ctx) error {
+	b := &openAPIBuilder{
+		paths:      make(map[string]map[string]interface{}),
+		schemas:    baseComponentSchemas(),
+		operations: make(map[string]bool),
+	}
+
+	files := s.readableFiles(c)
+	itemTypes := make(map[string]string, len(files))
+	for _, filename := range files {
+		itemTypes[filename] = s.addItemSchema(b, filename)
+	}
+
+	for _, route := range s.app.GetRoutes(true) {
+		if route.Method == fiber.MethodHead || !strings.HasPrefix(route.Path, "/api/") && !strings.HasPrefix(route.Path, "/get/") {
+			continue
+		}
+		key := route.Method + " " + route.Path
+		doc, documented := routeDocs[key]
+		if !documented {
+			doc = routeDoc{summary: key, operation: operationName(route.Method, route.Path)}
+		}
+
+		if isItemRoute(route.Path) {
+			for _, filename := range files {
+				path := strings.Replace(route.Path, ":filename", filename, 1)
+				op := b.operation(doc, key, route.Path, itemTypes[filename], filename)
+				op["tags"] = []string{filename}
+				b.add(route.Method, path, op)
+			}
+			continue
+		}
+
+		op := b.operation(doc, key, route.Path, "", "")
+		op["tags"] = []string{routeTag(route.Path)}
+		if len(files) > 0 {
+			for _, param := range op["parameters"].([]interface{}) {
+				if param := param.(map[string]interface{}); param["name"] == "filename" {
+					param["schema"] = map[string]interface{}{"type": "string", "enum": files}
+				}
+			}
+		}
+		b.add(route.Method, route.Path, op)
+	}
+
+	return c.JSON(fiber.Map{
+		"openapi": "3.1.0",
+		"info": fiber.Map{
+			"title":       "File Manager API",
+			"version":     "1.0.0",
+			"description": "Generated from the server's routes and the schemas of its data files.",
+		},
+		"servers": []fiber.Map{{"url": c.BaseURL()}},
+		"paths":   b.paths,
+		"components": fiber.Map{
+			"schemas": b.schemas,
+			"securitySchemes": fiber.Map{
+				"basicAuth":     fiber.Map{"type": "http", "scheme": "basic"},
+				"bearerAuth":    fiber.Map{"type": "http", "scheme": "bearer"},
+				"sessionHeader": fiber.Map{"type": "apiKey", "in": "header", "name": sessionTokenHeader},
+				"sessionCookie": fiber.Map{"type": "apiKey", "in": "cookie", "name": sessionCookieName},
+			},
+		},
+		"security": []fiber.Map{
+			{"basicAuth": []string{}}, {"bearerAuth": []string{}}, {"sessionHeader": []string{}}, {"sessionCookie": []string{}},
+		},
+	})
+}
+
+// readableFiles lists the data files shown to the user by /api/files
+func (s *Server) readableFiles(c *fiber.Ctx) []string {
+	entries, err := os.ReadDir(s.dataDir)
+	if err != nil {
+		return nil
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && !pkg.IsSidecar(name) && !s.isRestricted(name) && s.can(c, name, VerbRead) {
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+// addItemSchema adds the item schema of a file to the components and returns its name.
+// Files whose schema cannot be read or inferred get an untyped object.
+func (s *Server) addItemSchema(b *openAPIBuilder, filename string) string {
+	document := map[string]interface{}{"type": "object"}
+	sidecar, err := s.schemas.Get(filename)
+	switch {
+	case err != nil:
+	case sidecar != nil:
+		document = sidecar.Document
+	default:
+		if info, err := s.getFileSchema(filename); err == nil {
+			document = info.Schema
+		}
+	}
+
+	name := pkg.TypeName(filename)
+	for i := 2; b.schemas[name] != nil; i++ {
+		name = fmt.Sprintf("%s%d", pkg.TypeName(filename), i)
+	}
+
+	// References inside the schema are rebased onto its place in the components
+	schema := rebaseRefs(document, "#/components/schemas/"+name).(map[string]interface{})
+	delete(schema, "$schema")
+	delete(schema, "$id")
+
+	// The item routes of menu.json work on the items of each section
+	if filename == "menu.json" {
+		if item := nestedItemSchema(schema); item != nil {
+			properties, _ := item["properties"].(map[string]interface{})
+			if properties == nil {
+				properties = make(map[string]interface{})
+				item["properties"] = properties
+			}
+			for _, field := range sectionFields {
+				properties[field] = map[string]interface{}{"type": []string{"string", "null"}}
+			}
+			b.schemas[name+"Section"] = schema
+			name += "Item"
+			schema = item
+		}
+	}
+
+	b.schemas[name] = schema
+	return name
+}
+
+// nestedItemSchema returns the schema of the entries of a schema's items array
+func nestedItemSchema(schema map[string]interface{}) map[string]interface{} {
+	properties, _ := schema["properties"].(map[string]interface{})
+	items, _ := properties["items"].(map[string]interface{})
+	item, _ := items["items"].(map[string]interface{})
+	return item
+}
+
+// operation builds an operation for the route with the given method and path key. itemType is the component schema
+// name of the file's items in per-file routes.
+func (b *openAPIBuilder) operation(doc routeDoc, key, fiberPath, itemType, filename string) map[string]interface{} {
+	operationID := doc.operation
+	if strings.Contains(operationID, "%s") {
+		operationID = fmt.Sprintf(operationID, pkg.TypeName(filename))
+	}
+
+	parameters := []interface{}{}
+	for _, match := range routeParam.FindAllStringSubmatch(fiberPath, -1) {
+		if match[1] == "filename" && filename != "" {
+			continue
+		}
+		parameters = append(parameters, map[string]interface{}{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+
+	op := map[string]interface{}{
+		"summary":     doc.summary,
+		"operationId": operationID,
+		"parameters":  parameters,
+		"responses": map[string]interface{}{
+			"200": jsonResponse("Success", map[string]interface{}{}),
+			"400": errorResponse("Invalid request"),
+			"404": errorResponse("Not found"),
+		},
+	}
+	if doc.public {
+		op["security"] = []interface{}{}
+	} else {
+		op["responses"].(map[string]interface{})["401"] = errorResponse("Not authenticated")
+		op["responses"].(map[string]interface{})["403"] = errorResponse("Permission denied")
+	}
+	if itemType != "" {
+		b.typeItemOperation(op, key, itemType)
+	}
+	return op
+}
+
+// typeItemOperation sets the request and response bodies of a per-file route
+func (b *openAPIBuilder) typeItemOperation(op map[string]interface{}, key, itemType string) {
+	item := schemaRef(itemType)
+	responses := op["responses"].(map[string]interface{})
+	success := jsonResponse("Success", schemaRef("Success"))
+
+	switch key {
+	case "GET /api/files/:filename/items":
+		op["parameters"] = append(op["parameters"].([]interface{}),
+			queryParameter("page", "integer", "Page number, starting at 1"),
+			queryParameter("pageSize", "integer", "Items per page"),
+			queryParameter("search", "string", "Only items containing this text"),
+		)
+		responses["200"] = jsonResponse("A page of items", map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"items":      map[string]interface{}{"type": "array", "items": item},
+				"page":       map[string]interface{}{"type": "integer"},
+				"totalPages": map[string]interface{}{"type": "integer"},
+				"totalItems": map[string]interface{}{"type": "integer"},
+				"fields":     map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			},
+			"required": []string{"items", "page", "totalPages", "totalItems"},
+		})
+	case "POST /api/files/:filename/items", "POST /api/files/:filename/items/:id":
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": item}},
+		}
+		responses["200"] = success
+		responses["422"] = errorResponse("The item does not match the file's schema")
+	case "GET /api/files/:filename/items/:id":
+		responses["200"] = jsonResponse("The item", item)
+	case "DELETE /api/files/:filename/items/:id":
+		responses["200"] = success
+	case "GET /api/files/:filename/fields":
+		responses["200"] = jsonResponse("Field names", map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"fields": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}},
+		})
+	case "GET /api/files/:filename/info":
+		responses["200"] = jsonResponse("File information", schemaRef("FileInfo"))
+	}
+}
+
+// add adds an operation, numbering its operationId if another operation has it
+func (b *openAPIBuilder) add(method, fiberPath string, op map[string]interface{}) {
+	operationID := op["operationId"].(string)
+	for i := 2; b.operations[op["operationId"].(string)]; i++ {
+		op["operationId"] = fmt.Sprintf("%s%d", operationID, i)
+	}
+	b.operations[op["operationId"].(string)] = true
+
+	path := routeParam.ReplaceAllString(fiberPath, "{$1}")
+	if b.paths[path] == nil {
+		b.paths[path] = make(map[string]interface{})
+	}
+	b.paths[path][strings.ToLower(method)] = op
+}
+
+// isItemRoute reports whether a route is documented once per data file
+func isItemRoute(path string) bool {
+	switch path {
+	case "/api/files/:filename/items", "/api/files/:filename/items/:id",
+		"/api/files/:filename/fields", "/api/files/:filename/metadata",
+		"/api/files/:filename/structure", "/api/files/:filename/info":
+		return true
+	}
+	return false
+}
+
+// routeTag groups a route by the first segment after /api, e.g. files or users
+func routeTag(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/api/"), "/")
+	if strings.HasPrefix(path, "/get/") || segments[0] == "" {
+		return "public"
+	}
+	return strings.TrimSuffix(segments[0], ".json")
+}
+
+// operationName derives an operationId from a method and path, e.g. postApiScheduleJobRun
+func operationName(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == ':' || r == '.' || r == '-' || r == '_'
+	}) {
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+// rebaseRefs copies a schema, moving local references such as #/$defs/x below base
+func rebaseRefs(value interface{}, base string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			if ref, ok := child.(string); ok && key == "$ref" && strings.HasPrefix(ref, "#") {
+				copied[key] = base + strings.TrimPrefix(ref, "#")
+				continue
+			}
+			copied[key] = rebaseRefs(child, base)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, child := range v {
+			copied[i] = rebaseRefs(child, base)
+		}
+		return copied
+	case []string:
+		return append([]string(nil), v...)
+	}
+	return value
+}
+
+// baseComponentSchemas returns the schemas shared by all routes
+func baseComponentSchemas() map[string]interface{} {
+	return map[string]interface{}{
+		"Error": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"error":  map[string]interface{}{"type": "string"},
+				"errors": map[string]interface{}{"type": "array", "items": schemaRef("ValidationError")},
+			},
+			"required": []string{"error"},
+		},
+		"ValidationError": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path":     map[string]interface{}{"type": "string", "description": "JSON Pointer to the value"},
+				"rule":     map[string]interface{}{"type": "string", "description": "Schema keyword that failed"},
+				"expected": map[string]interface{}{},
+				"actual":   map[string]interface{}{},
+				"message":  map[string]interface{}{"type": "string"},
+			},
+			"required": []string{"path", "rule", "message"},
+		},
+		"Success": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"success": map[string]interface{}{"type": "boolean"},
+				"message": map[string]interface{}{"type": "string"},
+			},
+			"required": []string{"success"},
+		},
+		"FileInfo": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"name":       map[string]interface{}{"type": "string"},
+				"format":     map[string]interface{}{"type": "string"},
+				"size":       map[string]interface{}{"type": "integer"},
+				"modified":   map[string]interface{}{"type": "string"},
+				"itemCount":  map[string]interface{}{"type": "integer"},
+				"fieldCount": map[string]interface{}{"type": "integer"},
+			},
+		},
+	}
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonResponse(description string, schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}},
+	}
+}
+
+func errorResponse(description string) map[string]interface{} {
+	return jsonResponse(description, schemaRef("Error"))
+}
+
+func queryParameter(name, schemaType, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"schema":      map[string]interface{}{"type": schemaType},
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"backend/pkg"
+)
+
+// openAPIDocument fetches the OpenAPI document as the given session
+func openAPIDocument(t *testing.T, s *Server, token string) map[string]any {
+	t.Helper()
+	resp, body := do(t, s, apiRequest("GET", "/api/openapi.json", token, ""))
+	if resp.StatusCode != 200 {
+		t.Fatalf("openapi = %d %s", resp.StatusCode, body)
+	}
+	var document map[string]any
+	if err := json.Unmarshal(body, &document); err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	const sidecar = `{"$schema": "https://json-schema.org/draft/2020-12/schema", "type": "object",
+		"properties": {"id": {"type": "integer"}, "size": {"$ref": "#/$defs/size"}},
+		"$defs": {"size": {"type": "string", "enum": ["S", "L"]}}}`
+	s := newTestServer(t, map[string]string{
+		usersFile:                              testUsers,
+		"products.json":                        `[{"id": 1, "size": "S"}]`,
+		pkg.SchemaSidecarName("products.json"): sidecar,
+		"drinks.csv":                           "id,name,price\n1,Tea,2.5\n2,Coffee,3\n",
+	}, ServerOptions{})
+	viewer := login(t, s, "viewer@example.com", "viewer-password")
+	admin := login(t, s, "admin@example.com", "admin-password")
+
+	if resp, _ := do(t, s, apiRequest("GET", "/api/openapi.json", "", "")); resp.StatusCode != 401 {
+		t.Errorf("openapi without a session = %d, want 401", resp.StatusCode)
+	}
+
+	document := openAPIDocument(t, s, viewer)
+	if document["openapi"] != "3.1.0" {
+		t.Errorf("openapi = %v, want 3.1.0", document["openapi"])
+	}
+	paths := document["paths"].(map[string]any)
+	schemas := document["components"].(map[string]any)["schemas"].(map[string]any)
+
+	// Item routes are listed per readable file, typed by the file's schema
+	items, ok := paths["/api/files/products.json/items"].(map[string]any)
+	if !ok {
+		t.Fatalf("paths lack the product items: %v", keys(paths))
+	}
+	create := items["post"].(map[string]any)
+	requestSchema := create["requestBody"].(map[string]any)["content"].(map[string]any)["application/json"].(map[string]any)["schema"]
+	if create["operationId"] != "createProductItem" || !reflect.DeepEqual(requestSchema, map[string]any{"$ref": "#/components/schemas/Product"}) {
+		t.Errorf("create product item = %v", create)
+	}
+	if _, ok := create["responses"].(map[string]any)["422"]; !ok {
+		t.Error("create item does not document the 422 response")
+	}
+	if get := items["get"].(map[string]any); get["operationId"] != "listProductItems" {
+		t.Errorf("list product items operationId = %v", get["operationId"])
+	}
+	if _, ok := paths["/api/files/drinks.csv/items/{id}"].(map[string]any)["delete"]; !ok {
+		t.Error("paths lack the delete route of drinks.csv items")
+	}
+
+	// A sidecar is used as it is, with its references moved under the component
+	product := schemas["Product"].(map[string]any)
+	size := product["properties"].(map[string]any)["size"]
+	if !reflect.DeepEqual(size, map[string]any{"$ref": "#/components/schemas/Product/$defs/size"}) || product["$schema"] != nil {
+		t.Errorf("Product schema = %v", product)
+	}
+	// Files without one are typed by inference
+	drink, _ := schemas["Drink"].(map[string]any)
+	if properties, _ := drink["properties"].(map[string]any); !reflect.DeepEqual(keys(properties), []string{"id", "name", "price"}) {
+		t.Errorf("Drink schema = %v, want the CSV columns", drink)
+	}
+
+	// Other file routes take the readable files as an enum
+	schema := paths["/api/files/{filename}/schema"].(map[string]any)["get"].(map[string]any)
+	parameter := schema["parameters"].([]any)[0].(map[string]any)
+	if enum := parameter["schema"].(map[string]any)["enum"]; !reflect.DeepEqual(enum, []any{"drinks.csv", "products.json"}) {
+		t.Errorf("filename parameter = %v, want the readable files", parameter)
+	}
+	if security, ok := paths["/get/{filename}"].(map[string]any)["get"].(map[string]any)["security"]; !ok || len(security.([]any)) != 0 {
+		t.Errorf("public download security = %v, want none", security)
+	}
+
+	// Every operation has its own id
+	seen := map[string]string{}
+	for path, operations := range paths {
+		for method, op := range operations.(map[string]any) {
+			id := op.(map[string]any)["operationId"].(string)
+			if other, ok := seen[id]; ok {
+				t.Errorf("operationId %s is used by %s and %s %s", id, other, method, path)
+			}
+			seen[id] = method + " " + path
+		}
+	}
+
+	// Files the user cannot read are left out
+	if _, ok := paths["/api/files/users.json/items"]; ok {
+		t.Error("viewer's document lists the users file")
+	}
+	if _, ok := openAPIDocument(t, s, admin)["paths"].(map[string]any)["/api/files/users.json/items"]; !ok {
+		t.Error("admin's document lacks the users file")
+	}
+}
+
+// keys returns the sorted keys of a map
+func keys(m map[string]any) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,599 @@
+package pkg
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// archiveManifestName is the tar entry listing every archived file and its checksum
+	archiveManifestName = "archive-manifest.json"
+	// archiveDataPrefix is the tar directory holding the data directory's contents
+	archiveDataPrefix = "data/"
+	archiveExtension  = ".tar.gz"
+	archiveVersion    = 1
+
+	// DefaultMaxArchiveSize bounds the size of imported archives
+	DefaultMaxArchiveSize = 512 << 20
+	// DefaultMaxExtractedSize bounds the bytes an archive may expand to when read
+	DefaultMaxExtractedSize = 4 << 30
+
+	// Directories inside the data directory used while restoring an archive
+	restoreStagingPrefix = ".restore-"
+	preRestorePrefix     = ".pre-restore-"
+)
+
+// ErrInvalidArchive is returned when an archive is damaged or does not match its manifest
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// ErrArchiveTooLarge is returned when an imported archive exceeds the size limit
+var ErrArchiveTooLarge = errors.New("archive too large")
+
+// ArchiveEntry describes one file stored in an archive
+type ArchiveEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ArchiveManifest lists the contents of a data directory archive
+type ArchiveManifest struct {
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Files     []ArchiveEntry `json:"files"`
+}
+
+// ArchiveInfo contains information about an archive
+type ArchiveInfo struct {
+	ID        string    `json:"id"`
+	FileName  string    `json:"fileName"`
+	Path      string    `json:"-"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ArchiveRestoreResult reports the outcome of restoring an archive
+type ArchiveRestoreResult struct {
+	Files int `json:"files"`
+	// PreviousDataDir names the directory inside the data directory holding the data that was replaced
+	PreviousDataDir string `json:"previousDataDir"`
+}
+
+// ArchiveManager creates point-in-time archives of a whole data directory and restores them
+type ArchiveManager struct {
+	dataDir    string
+	archiveDir string
+	// maxSize bounds imported archives and maxExtracted the bytes read out of any archive
+	maxSize      int64
+	maxExtracted int64
+}
+
+// NewArchiveManager creates an archive manager. Archives are kept in archiveDir,
+// which is never archived itself when it lies inside the data directory.
+func NewArchiveManager(dataDir, archiveDir string) (*ArchiveManager, error) {
+	absData, err := filepath.Abs(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data directory: %w", err)
+	}
+	absArchive, err := filepath.Abs(archiveDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive directory: %w", err)
+	}
+	return &ArchiveManager{
+		dataDir:      absData,
+		archiveDir:   absArchive,
+		maxSize:      DefaultMaxArchiveSize,
+		maxExtracted: DefaultMaxExtractedSize,
+	}, nil
+}
+
+// SetLimits bounds the size of imported archives and the bytes any archive may
+// expand to; a limit of 0 or less keeps the current one
+func (am *ArchiveManager) SetLimits(maxSize, maxExtracted int64) {
+	if maxSize > 0 {
+		am.maxSize = maxSize
+	}
+	if maxExtracted > 0 {
+		am.maxExtracted = maxExtracted
+	}
+}
+
+// ArchiveDir returns the directory archives are kept in
+func (am *ArchiveManager) ArchiveDir() string {
+	return am.archiveDir
+}
+
+// excluded reports whether a top-level entry of the data directory is left out of archives and restores
+func (am *ArchiveManager) excluded(name string) bool {
+	return filepath.Join(am.dataDir, name) == am.archiveDir ||
+		strings.HasPrefix(name, restoreStagingPrefix) ||
+		strings.HasPrefix(name, preRestorePrefix)
+}
+
+// dataFiles returns the top-level files of the data directory, which file managers lock
+func (am *ArchiveManager) dataFiles() ([]string, error) {
+	entries, err := os.ReadDir(am.dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !am.excluded(entry.Name()) {
+			paths = append(paths, filepath.Join(am.dataDir, entry.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// Create writes a consistent archive of the data directory into the archive directory
+func (am *ArchiveManager) Create() (*ArchiveInfo, error) {
+	if err := os.MkdirAll(am.archiveDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	id, createdAt := newSnapshotID()
+	archivePath := filepath.Join(am.archiveDir, id+archiveExtension)
+	err := writeFileAtomic(archivePath, func(w io.Writer) error {
+		_, err := am.stream(w, createdAt)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive: %w", err)
+	}
+
+	return &ArchiveInfo{
+		ID:        id,
+		FileName:  filepath.Base(archivePath),
+		Path:      archivePath,
+		Size:      fileSize(archivePath),
+		CreatedAt: createdAt,
+	}, nil
+}
+
+// Stream writes a consistent archive of the data directory to w and returns its manifest
+func (am *ArchiveManager) Stream(w io.Writer) (*ArchiveManifest, error) {
+	_, createdAt := newSnapshotID()
+	return am.stream(w, createdAt)
+}
+
+// stream locks every data file while the archive is written, so no write lands halfway through
+func (am *ArchiveManager) stream(w io.Writer, createdAt time.Time) (*ArchiveManifest, error) {
+	paths, err := am.dataFiles()
+	if err != nil {
+		return nil, err
+	}
+	unlock := lockFiles(paths, false)
+	defer unlock()
+
+	return am.writeArchive(w, createdAt)
+}
+
+// writeArchive streams the data directory as a gzipped tar followed by its manifest
+func (am *ArchiveManager) writeArchive(w io.Writer, createdAt time.Time) (*ArchiveManifest, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest := ArchiveManifest{Version: archiveVersion, CreatedAt: createdAt, Files: []ArchiveEntry{}}
+
+	err := filepath.WalkDir(am.dataDir, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(am.dataDir, filePath)
+		if err != nil || rel == "." {
+			return err
+		}
+		if top := strings.Split(rel, string(filepath.Separator))[0]; am.excluded(top) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Temporary files of writes in progress elsewhere are skipped, as are symlinks
+		if !entry.Type().IsRegular() || strings.HasSuffix(entry.Name(), ".tmp") {
+			return nil
+		}
+
+		archived, err := addArchiveFile(tw, filePath, archiveDataPrefix+filepath.ToSlash(rel))
+		if errors.Is(err, os.ErrNotExist) {
+			// Pruned history files may disappear while walking
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		archived.Path = filepath.ToSlash(rel)
+		manifest.Files = append(manifest.Files, archived)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode archive manifest: %w", err)
+	}
+	header := &tar.Header{Name: archiveManifestName, Mode: 0644, Size: int64(len(content)), ModTime: createdAt}
+	if err := tw.WriteHeader(header); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(content); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return &manifest, gz.Close()
+}
+
+// addArchiveFile copies one file into the tar and returns its checksum
+func addArchiveFile(tw *tar.Writer, filePath, name string) (ArchiveEntry, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return ArchiveEntry{}, fmt.Errorf("failed to open %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return ArchiveEntry{}, err
+	}
+	header := &tar.Header{Name: name, Mode: int64(stat.Mode().Perm()), Size: stat.Size(), ModTime: stat.ModTime()}
+	if err := tw.WriteHeader(header); err != nil {
+		return ArchiveEntry{}, err
+	}
+
+	// Copy exactly the size in the header even if the file grows meanwhile
+	hash := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(tw, hash), file, stat.Size()); err != nil {
+		return ArchiveEntry{}, fmt.Errorf("failed to archive %s: %w", filePath, err)
+	}
+	return ArchiveEntry{Size: stat.Size(), SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// List returns the stored archives, newest first
+func (am *ArchiveManager) List() ([]ArchiveInfo, error) {
+	entries, err := os.ReadDir(am.archiveDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []ArchiveInfo{}, nil
+		}
+		return nil, fmt.Errorf("failed to read archive directory: %w", err)
+	}
+
+	archives := []ArchiveInfo{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasSuffix(name, archiveExtension) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		id := strings.TrimSuffix(name, archiveExtension)
+		createdAt := info.ModTime()
+		if t, err := time.Parse(snapshotIDLayout, strings.SplitN(id, "-", 2)[0]); err == nil {
+			createdAt = t
+		}
+		archives = append(archives, ArchiveInfo{
+			ID:        id,
+			FileName:  name,
+			Path:      filepath.Join(am.archiveDir, name),
+			Size:      info.Size(),
+			CreatedAt: createdAt,
+		})
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].ID > archives[j].ID
+	})
+	return archives, nil
+}
+
+// Find returns the archive with the given id or file name
+func (am *ArchiveManager) Find(id string) (*ArchiveInfo, error) {
+	archives, err := am.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, archive := range archives {
+		if archive.ID == id || archive.FileName == id {
+			return &archive, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+}
+
+// Delete removes an archive
+func (am *ArchiveManager) Delete(id string) error {
+	archive, err := am.Find(id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(archive.Path)
+}
+
+// Import copies an archive from r into the archive directory after verifying it.
+// Archives larger than the size limit are rejected with ErrArchiveTooLarge.
+func (am *ArchiveManager) Import(r io.Reader) (*ArchiveInfo, error) {
+	if err := os.MkdirAll(am.archiveDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(am.archiveDir, "import-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpFile := tmp.Name()
+	defer os.Remove(tmpFile)
+
+	size, err := io.Copy(tmp, io.LimitReader(r, am.maxSize+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save archive: %w", err)
+	}
+	if size > am.maxSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrArchiveTooLarge, am.maxSize)
+	}
+
+	manifest, err := am.Verify(tmpFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Imported archives keep the time they were created at as their id
+	id := snapshotIDAt(manifest.CreatedAt)
+	archivePath := filepath.Join(am.archiveDir, id+archiveExtension)
+	if err := os.Rename(tmpFile, archivePath); err != nil {
+		return nil, fmt.Errorf("failed to save archive: %w", err)
+	}
+	return &ArchiveInfo{
+		ID:        id,
+		FileName:  filepath.Base(archivePath),
+		Path:      archivePath,
+		Size:      fileSize(archivePath),
+		CreatedAt: manifest.CreatedAt,
+	}, nil
+}
+
+// Verify checks that every file in an archive matches the size and checksum
+// in its manifest and that no file is missing or unexpected
+func (am *ArchiveManager) Verify(archivePath string) (*ArchiveManifest, error) {
+	return readArchive(archivePath, "", am.maxExtracted)
+}
+
+// readArchive verifies an archive, extracting its data files into dir when dir is set.
+// Archives expanding to more than maxExtracted bytes are rejected as invalid.
+func readArchive(archivePath, dir string, maxExtracted int64) (*ArchiveManifest, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer gz.Close()
+
+	var manifest *ArchiveManifest
+	found := make(map[string]ArchiveEntry)
+	tr := tar.NewReader(&extractionLimit{r: gz, remaining: maxExtracted})
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+
+		if header.Name == archiveManifestName {
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return nil, fmt.Errorf("%w: failed to parse manifest: %v", ErrInvalidArchive, err)
+			}
+			continue
+		}
+
+		// Directories are implied by file paths
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		rel, ok := archiveRelPath(header.Name)
+		if !ok || header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%w: unexpected entry %s", ErrInvalidArchive, header.Name)
+		}
+		entry, err := extractArchiveFile(tr, header, dir, rel)
+		if err != nil {
+			return nil, err
+		}
+		found[rel] = entry
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("%w: manifest is missing", ErrInvalidArchive)
+	}
+	if manifest.Version > archiveVersion {
+		return nil, fmt.Errorf("%w: unsupported archive version %d", ErrInvalidArchive, manifest.Version)
+	}
+	for _, expected := range manifest.Files {
+		actual, ok := found[expected.Path]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("%w: %s is missing", ErrInvalidArchive, expected.Path)
+		case actual.Size != expected.Size || actual.SHA256 != expected.SHA256:
+			return nil, fmt.Errorf("%w: checksum mismatch for %s", ErrInvalidArchive, expected.Path)
+		}
+		delete(found, expected.Path)
+	}
+	for rel := range found {
+		return nil, fmt.Errorf("%w: %s is not in the manifest", ErrInvalidArchive, rel)
+	}
+	return manifest, nil
+}
+
+// errArchiveExpansion is returned while reading an archive that decompresses beyond its limit
+var errArchiveExpansion = errors.New("archive expands beyond the size limit")
+
+// extractionLimit reads a decompressed archive, failing once more than remaining bytes are read
+type extractionLimit struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *extractionLimit) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// An archive of exactly the limit still ends cleanly
+		if n, err := l.r.Read(make([]byte, 1)); n == 0 && err != nil {
+			return 0, err
+		}
+		return 0, errArchiveExpansion
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// archiveRelPath returns the data-relative path of a tar entry, rejecting paths that escape the data directory
+func archiveRelPath(name string) (string, bool) {
+	if !strings.HasPrefix(name, archiveDataPrefix) {
+		return "", false
+	}
+	rel := strings.TrimPrefix(name, archiveDataPrefix)
+	if rel == "" || path.IsAbs(rel) || path.Clean(rel) != rel || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return rel, true
+}
+
+// extractArchiveFile checksums one tar entry, writing it below dir when dir is set
+func extractArchiveFile(tr *tar.Reader, header *tar.Header, dir, rel string) (ArchiveEntry, error) {
+	hash := sha256.New()
+	var w io.Writer = hash
+	if dir != "" {
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return ArchiveEntry{}, fmt.Errorf("failed to create directory: %w", err)
+		}
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(header.Mode).Perm()|0600)
+		if err != nil {
+			return ArchiveEntry{}, fmt.Errorf("failed to extract %s: %w", rel, err)
+		}
+		defer out.Close()
+		w = io.MultiWriter(out, hash)
+	}
+
+	size, err := io.Copy(w, tr)
+	if err != nil {
+		return ArchiveEntry{}, fmt.Errorf("%w: failed to read %s: %v", ErrInvalidArchive, rel, err)
+	}
+	return ArchiveEntry{Path: rel, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// Restore replaces the contents of the data directory with an archive. The archive is
+// fully extracted and verified before anything is replaced, and the replaced data is
+// kept in a hidden directory inside the data directory.
+func (am *ArchiveManager) Restore(id string) (*ArchiveRestoreResult, error) {
+	archive, err := am.Find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	stamp := time.Now().UTC().Format(snapshotIDLayout)
+	staging := filepath.Join(am.dataDir, restoreStagingPrefix+stamp)
+	if err := os.Mkdir(staging, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	manifest, err := readArchive(archive.Path, staging, am.maxExtracted)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lock the files being replaced as well as those being restored
+	current, err := am.dataFiles()
+	if err != nil {
+		return nil, err
+	}
+	paths := current
+	for _, entry := range manifest.Files {
+		if !strings.Contains(entry.Path, "/") {
+			paths = append(paths, filepath.Join(am.dataDir, entry.Path))
+		}
+	}
+	unlock := lockFiles(paths, true)
+	defer unlock()
+
+	previous := filepath.Join(am.dataDir, preRestorePrefix+stamp)
+	if err := am.swap(staging, previous); err != nil {
+		return nil, err
+	}
+	return &ArchiveRestoreResult{Files: len(manifest.Files), PreviousDataDir: filepath.Base(previous)}, nil
+}
+
+// swap moves the top-level entries of the data directory into previous and the
+// staged entries into their place, moving everything back if a step fails
+func (am *ArchiveManager) swap(staging, previous string) error {
+	if err := os.Mkdir(previous, 0755); err != nil {
+		return fmt.Errorf("failed to create directory for previous data: %w", err)
+	}
+
+	type move struct{ from, to string }
+	var done []move
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			os.Rename(done[i].to, done[i].from)
+		}
+	}
+	moveAll := func(from, to string, skip func(string) bool) error {
+		entries, err := os.ReadDir(from)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if skip(entry.Name()) {
+				continue
+			}
+			m := move{filepath.Join(from, entry.Name()), filepath.Join(to, entry.Name())}
+			if err := os.Rename(m.from, m.to); err != nil {
+				return err
+			}
+			done = append(done, m)
+		}
+		return nil
+	}
+
+	if err := moveAll(am.dataDir, previous, am.excluded); err != nil {
+		rollback()
+		return fmt.Errorf("failed to move current data aside: %w", err)
+	}
+	if err := moveAll(staging, am.dataDir, am.excluded); err != nil {
+		rollback()
+		return fmt.Errorf("failed to move restored data into place: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package pkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestArchiveManager returns an archive manager for a fresh data directory
+// holding the given files, with archives kept inside it
+func newTestArchiveManager(t *testing.T, files map[string]string) *ArchiveManager {
+	t.Helper()
+	dataDir := t.TempDir()
+	for name, content := range files {
+		target := filepath.Join(dataDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	am, err := NewArchiveManager(dataDir, filepath.Join(dataDir, "archives"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return am
+}
+
+// tarEntry is one entry of a hand-built test archive
+type tarEntry struct {
+	header tar.Header
+	body   string
+}
+
+// buildArchive returns a gzipped tar of the given entries
+func buildArchive(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := entry.header
+		if header.Typeflag == 0 {
+			header.Typeflag = tar.TypeReg
+		}
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(entry.body))
+		}
+		header.Mode = 0644
+		if err := tw.WriteHeader(&header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestArchiveExtractionLimit(t *testing.T) {
+	am := newTestArchiveManager(t, map[string]string{"menu.json": "[]"})
+	am.SetLimits(0, 64<<10)
+
+	// Highly compressible content expanding far past the limit
+	bomb := buildArchive(t, tarEntry{header: tar.Header{Name: "data/menu.json"}, body: string(make([]byte, 1<<20))})
+	if len(bomb) > 64<<10 {
+		t.Fatalf("test archive is %d bytes, want it below the limit", len(bomb))
+	}
+	_, err := am.Import(bytes.NewReader(bomb))
+	if !errors.Is(err, ErrInvalidArchive) || !strings.Contains(err.Error(), errArchiveExpansion.Error()) {
+		t.Errorf("Import of an archive expanding past the limit = %v, want %v", err, errArchiveExpansion)
+	}
+
+	am.SetLimits(1024, 0)
+	if _, err := am.Import(bytes.NewReader(make([]byte, 2048))); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("Import of an archive past the size limit = %v, want ErrArchiveTooLarge", err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(am.ArchiveDir(), "*")); len(leftovers) > 0 {
+		t.Errorf("rejected imports left %v behind", leftovers)
+	}
+}
+
+func TestArchiveRestoreReportsDirectoryName(t *testing.T) {
+	am := newTestArchiveManager(t, map[string]string{"menu.json": `[{"id":1}]`})
+	archive, err := am.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := am.Restore(archive.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(result.PreviousDataDir) != result.PreviousDataDir {
+		t.Errorf("PreviousDataDir = %q, want a bare directory name", result.PreviousDataDir)
+	}
+	if _, err := os.Stat(filepath.Join(am.dataDir, result.PreviousDataDir, "menu.json")); err != nil {
+		t.Errorf("previous data not kept: %v", err)
+	}
+}
+
+// manifestEntry returns the manifest entry of an archive listing the given regular data entries
+func manifestEntry(t *testing.T, entries ...tarEntry) tarEntry {
+	t.Helper()
+	manifest := ArchiveManifest{Version: archiveVersion, CreatedAt: time.Date(2024, 1, 31, 9, 30, 0, 0, time.UTC), Files: []ArchiveEntry{}}
+	for _, entry := range entries {
+		sum := sha256.Sum256([]byte(entry.body))
+		manifest.Files = append(manifest.Files, ArchiveEntry{
+			Path:   strings.TrimPrefix(entry.header.Name, archiveDataPrefix),
+			Size:   int64(len(entry.body)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tarEntry{header: tar.Header{Name: archiveManifestName}, body: string(content)}
+}
+
+func TestArchiveCreateAndRestore(t *testing.T) {
+	am := newTestArchiveManager(t, map[string]string{
+		"menu.json":                        `[{"id": 1, "name": "Tea"}]`,
+		"products.csv":                     "id,name\n1,Tea\n",
+		"versions/menu.json/manifest.json": `[]`,
+		"menu.json.4f2a.tmp":               `[{"id": 1`,
+	})
+	outside := filepath.Join(t.TempDir(), "secret.json")
+	writeTestFile(t, outside, `[]`)
+	if err := os.Symlink(outside, filepath.Join(am.dataDir, "link.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := am.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archives, _ := am.List(); len(archives) != 1 || archives[0].ID != archive.ID {
+		t.Errorf("List = %+v, want the new archive", archives)
+	}
+
+	// Temp files, links and the archive directory itself are left out
+	manifest, err := am.Verify(archive.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archived []string
+	for _, entry := range manifest.Files {
+		archived = append(archived, entry.Path)
+	}
+	if want := []string{"menu.json", "products.csv", "versions/menu.json/manifest.json"}; !reflect.DeepEqual(archived, want) {
+		t.Errorf("archived %v, want %v", archived, want)
+	}
+
+	// Later changes are undone by the restore and kept aside
+	writeTestFile(t, filepath.Join(am.dataDir, "menu.json"), `[]`)
+	writeTestFile(t, filepath.Join(am.dataDir, "drinks.json"), `[]`)
+	result, err := am.Restore(archive.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files != 3 {
+		t.Errorf("restored %d files, want 3", result.Files)
+	}
+	if content, _ := os.ReadFile(filepath.Join(am.dataDir, "menu.json")); string(content) != `[{"id": 1, "name": "Tea"}]` {
+		t.Errorf("menu.json after restore = %s", content)
+	}
+	if _, err := os.Stat(filepath.Join(am.dataDir, "drinks.json")); !os.IsNotExist(err) {
+		t.Error("a file created after the archive survived the restore")
+	}
+	if _, err := os.Stat(filepath.Join(am.dataDir, result.PreviousDataDir, "drinks.json")); err != nil {
+		t.Errorf("replaced data not kept aside: %v", err)
+	}
+	if archives, _ := am.List(); len(archives) != 1 {
+		t.Errorf("restore changed the archives: %+v", archives)
+	}
+}
+
+func TestArchiveRejectsUnsafeEntries(t *testing.T) {
+	safe := tarEntry{header: tar.Header{Name: "data/menu.json"}, body: `[]`}
+	tests := []struct {
+		name    string
+		entries []tarEntry
+	}{
+		{"parent directory", []tarEntry{{header: tar.Header{Name: "data/../escape.json"}, body: `[]`}}},
+		{"nested parent directory", []tarEntry{{header: tar.Header{Name: "data/sub/../../escape.json"}, body: `[]`}}},
+		{"absolute path", []tarEntry{{header: tar.Header{Name: "data//escape.json"}, body: `[]`}}},
+		{"outside the data prefix", []tarEntry{{header: tar.Header{Name: "../escape.json"}, body: `[]`}}},
+		{"symlink", []tarEntry{{header: tar.Header{Name: "data/link.json", Typeflag: tar.TypeSymlink, Linkname: "../../escape.json"}}}},
+		{"hard link", []tarEntry{{header: tar.Header{Name: "data/link.json", Typeflag: tar.TypeLink, Linkname: "/etc/passwd"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			am := newTestArchiveManager(t, map[string]string{"menu.json": `[{"id": 1}]`})
+			entries := append([]tarEntry{safe}, tt.entries...)
+			archive := buildArchive(t, append(entries, manifestEntry(t, entries...))...)
+
+			if _, err := am.Import(bytes.NewReader(archive)); !errors.Is(err, ErrInvalidArchive) || !strings.Contains(err.Error(), "unexpected entry") {
+				t.Errorf("Import = %v, want the entry rejected", err)
+			}
+
+			// Archives copied into the archive directory by hand are checked on restore
+			writeTestFile(t, filepath.Join(am.ArchiveDir(), "manual"+archiveExtension), string(archive))
+			if _, err := am.Restore("manual"); !errors.Is(err, ErrInvalidArchive) || !strings.Contains(err.Error(), "unexpected entry") {
+				t.Errorf("Restore = %v, want the entry rejected", err)
+			}
+			if content, _ := os.ReadFile(filepath.Join(am.dataDir, "menu.json")); string(content) != `[{"id": 1}]` {
+				t.Errorf("a rejected restore changed menu.json to %s", content)
+			}
+			for _, dir := range []string{am.dataDir, filepath.Dir(am.dataDir)} {
+				if _, err := os.Lstat(filepath.Join(dir, "escape.json")); !os.IsNotExist(err) {
+					t.Errorf("an entry was extracted to %s", dir)
+				}
+			}
+			if leftovers, _ := filepath.Glob(filepath.Join(am.dataDir, restoreStagingPrefix+"*")); len(leftovers) > 0 {
+				t.Errorf("staging directories left behind: %v", leftovers)
+			}
+		})
+	}
+}
+
+func TestArchiveVerifyChecksManifest(t *testing.T) {
+	am := newTestArchiveManager(t, nil)
+	menu := tarEntry{header: tar.Header{Name: "data/menu.json"}, body: `[{"id": 1}]`}
+	tampered := tarEntry{header: menu.header, body: `[{"id": 2}]`}
+	extra := tarEntry{header: tar.Header{Name: "data/extra.json"}, body: `[]`}
+
+	tests := []struct {
+		name    string
+		entries []tarEntry
+	}{
+		{"no manifest", []tarEntry{menu}},
+		{"changed content", []tarEntry{tampered, manifestEntry(t, menu)}},
+		{"missing file", []tarEntry{manifestEntry(t, menu)}},
+		{"file not in manifest", []tarEntry{menu, extra, manifestEntry(t, menu)}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "archive"+archiveExtension)
+		writeTestFile(t, path, string(buildArchive(t, tt.entries...)))
+		if _, err := am.Verify(path); !errors.Is(err, ErrInvalidArchive) {
+			t.Errorf("%s: Verify = %v, want %v", tt.name, err, ErrInvalidArchive)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "archive"+archiveExtension)
+	writeTestFile(t, path, string(buildArchive(t, menu, manifestEntry(t, menu))))
+	if manifest, err := am.Verify(path); err != nil || len(manifest.Files) != 1 {
+		t.Errorf("Verify of a valid archive = %+v, %v", manifest, err)
+	}
+}
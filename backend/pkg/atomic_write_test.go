@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// assertNoTempFiles fails if a write left temporary files in dir
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "menu.json")
+	writeTestFile(t, path, "old")
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.Stat(path)
+
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(path)
+	if content, _ := os.ReadFile(path); string(content) != "new" {
+		t.Errorf("content = %q, want %q", content, "new")
+	}
+	// The file is replaced by a rename rather than rewritten in place
+	if os.SameFile(before, after) {
+		t.Error("file was rewritten in place")
+	}
+	if after.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want the replaced file's 0600", after.Mode().Perm())
+	}
+
+	// A failed write leaves the file as it was
+	failure := errors.New("disk full")
+	err = writeFileAtomic(path, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("writeFileAtomic = %v, want %v", err, failure)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "new" {
+		t.Errorf("after a failed write content = %q, want %q", content, "new")
+	}
+	assertNoTempFiles(t, dir)
+
+	// New files get the default mode
+	created := filepath.Join(dir, "drinks.json")
+	if err := serializeAtomic(created, &JSONFormat{}, []map[string]any{{"id": 1.0}}); err != nil {
+		t.Fatal(err)
+	}
+	if stat, err := os.Stat(created); err != nil || stat.Mode().Perm() != 0644 {
+		t.Errorf("new file = %v, %v, want mode 0644", stat, err)
+	}
+}
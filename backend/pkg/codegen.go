@@ -0,0 +1,393 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// initialisms are written in upper case in generated Go names, e.g. ImageURL
+var initialisms = map[string]bool{
+	"api": true, "html": true, "http": true, "id": true, "ip": true,
+	"json": true, "sku": true, "uri": true, "url": true, "uuid": true,
+}
+
+// maxEnumLabelLength bounds the strings of enums emitted as named types. Longer or empty
+// strings are usually text that repeated in a sample rather than a fixed set of choices.
+const maxEnumLabelLength = 32
+
+// tsIdentifier matches property names TypeScript accepts unquoted
+var tsIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// codeObject is an object schema emitted as a Go struct or TypeScript interface
+type codeObject struct {
+	name   string
+	fields []*FieldInfo
+}
+
+// CodeGenerator emits Go structs and TypeScript interfaces for the items of a data file.
+// Nested objects and arrays of objects get their own types, and string enums named types.
+type CodeGenerator struct {
+	source  string
+	objects []*codeObject
+	enums   []*FieldInfo
+	names   map[*FieldInfo]string
+	// paths names the fields of enums, such as items[].dietaryInfo
+	paths map[*FieldInfo]string
+	taken map[string]bool
+}
+
+// NewCodeGenerator names the types of a schema, calling the item type rootName.
+// source describes where the schema came from in the generated header.
+func NewCodeGenerator(info *SchemaInfo, rootName, source string) *CodeGenerator {
+	cg := &CodeGenerator{
+		source: source,
+		names:  make(map[*FieldInfo]string),
+		paths:  make(map[*FieldInfo]string),
+		taken:  make(map[string]bool),
+	}
+	cg.addObject(&FieldInfo{Properties: info.Properties}, rootName, "")
+	return cg
+}
+
+// TypeName returns the item type name of a data file, e.g. Product for products.csv
+func TypeName(filename string) string {
+	base := filepath.Base(filename)
+	return singular(exportedName(strings.TrimSuffix(base, filepath.Ext(base))))
+}
+
+// addObject names an object and the types nested in its fields
+func (cg *CodeGenerator) addObject(field *FieldInfo, name, path string) {
+	name = cg.unique(name)
+	cg.names[field] = name
+
+	object := &codeObject{name: name, fields: sortedFields(field.Properties)}
+	cg.objects = append(cg.objects, object)
+	for _, property := range object.fields {
+		cg.register(property, name+exportedName(property.Name), path+property.Name)
+	}
+}
+
+// register names the nested objects and enums of a field
+func (cg *CodeGenerator) register(field *FieldInfo, name, path string) {
+	switch {
+	case len(field.Properties) > 0:
+		cg.addObject(field, name, path+".")
+	case isStringEnum(field):
+		cg.names[field] = cg.unique(name)
+		cg.paths[field] = path
+		cg.enums = append(cg.enums, field)
+	}
+	if field.Items != nil {
+		cg.register(field.Items, singular(name), path+"[]")
+	}
+}
+
+// unique returns name, numbered if another type already has it
+func (cg *CodeGenerator) unique(name string) string {
+	candidate := name
+	for i := 2; cg.taken[candidate]; i++ {
+		candidate = fmt.Sprintf("%s%d", name, i)
+	}
+	cg.taken[candidate] = true
+	return candidate
+}
+
+// Go returns gofmt-formatted Go source declaring the types in package packageName
+func (cg *CodeGenerator) Go(packageName string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated from %s. DO NOT EDIT.\n\n", cg.source)
+	fmt.Fprintf(&b, "package %s\n", packageName)
+
+	for _, object := range cg.objects {
+		fmt.Fprintf(&b, "\n// %s is generated from the %s schema\n", object.name, cg.source)
+		fmt.Fprintf(&b, "type %s struct {\n", object.name)
+		used := make(map[string]bool)
+		for _, field := range object.fields {
+			name := exportedName(field.Name)
+			for i := 2; used[name]; i++ {
+				name = fmt.Sprintf("%s%d", exportedName(field.Name), i)
+			}
+			used[name] = true
+
+			if field.Description != "" {
+				fmt.Fprintf(&b, "\t// %s\n", oneLine(field.Description))
+			}
+			tag := field.Name
+			if !field.Required {
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(&b, "\t%s %s `json:%s`\n", name, cg.goFieldType(field, !field.Required), strconv.Quote(tag))
+		}
+		b.WriteString("}\n")
+	}
+
+	for _, field := range cg.enums {
+		name := cg.names[field]
+		fmt.Fprintf(&b, "\n// %s is an allowed value of %s\n", name, cg.paths[field])
+		fmt.Fprintf(&b, "type %s string\n\nconst (\n", name)
+		used := make(map[string]bool)
+		for i, value := range field.Enum {
+			constName := name + exportedName(value.(string))
+			if constName == name || used[constName] {
+				constName = fmt.Sprintf("%sValue%d", name, i+1)
+			}
+			used[constName] = true
+			fmt.Fprintf(&b, "\t%s %s = %s\n", constName, name, strconv.Quote(value.(string)))
+		}
+		b.WriteString(")\n")
+	}
+
+	source, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return "", fmt.Errorf("failed to format generated Go code: %w", err)
+	}
+	return string(source), nil
+}
+
+// goFieldType returns the Go type of a field. Optional and nullable scalars and
+// structs are pointers so that a missing value is not confused with a zero value.
+func (cg *CodeGenerator) goFieldType(field *FieldInfo, optional bool) string {
+	goType := cg.goType(field)
+	if (optional || field.Nullable) && !strings.HasPrefix(goType, "[]") && !strings.HasPrefix(goType, "map[") && goType != "any" {
+		return "*" + goType
+	}
+	return goType
+}
+
+// goType returns the Go type of a field's values
+func (cg *CodeGenerator) goType(field *FieldInfo) string {
+	types := field.declaredTypes()
+	if len(types) != 1 {
+		// Mixed values have no single Go type
+		return "any"
+	}
+
+	switch types[0] {
+	case FieldTypeString:
+		if name, ok := cg.names[field]; ok {
+			return name
+		}
+		return "string"
+	case FieldTypeInteger:
+		return "int64"
+	case FieldTypeNumber:
+		return "float64"
+	case FieldTypeBoolean:
+		return "bool"
+	case FieldTypeArray:
+		if field.Items == nil {
+			return "[]any"
+		}
+		return "[]" + cg.goFieldType(field.Items, false)
+	case FieldTypeObject:
+		if name, ok := cg.names[field]; ok {
+			return name
+		}
+		return "map[string]any"
+	}
+	return "any"
+}
+
+// TypeScript returns TypeScript source exporting the types
+func (cg *CodeGenerator) TypeScript() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated from %s. DO NOT EDIT.\n", cg.source)
+
+	for _, object := range cg.objects {
+		fmt.Fprintf(&b, "\nexport interface %s {\n", object.name)
+		for _, field := range object.fields {
+			if field.Description != "" {
+				fmt.Fprintf(&b, "  /** %s */\n", strings.ReplaceAll(oneLine(field.Description), "*/", "* /"))
+			}
+			name := field.Name
+			if !tsIdentifier.MatchString(name) {
+				name = strconv.Quote(name)
+			}
+			if !field.Required {
+				name += "?"
+			}
+			fmt.Fprintf(&b, "  %s: %s;\n", name, cg.tsFieldType(field))
+		}
+		b.WriteString("}\n")
+	}
+
+	for _, field := range cg.enums {
+		values := make([]string, len(field.Enum))
+		for i, value := range field.Enum {
+			values[i] = tsLiteral(value)
+		}
+		fmt.Fprintf(&b, "\nexport type %s = %s;\n", cg.names[field], strings.Join(values, " | "))
+	}
+	return b.String()
+}
+
+// tsFieldType returns the TypeScript type of a field, including null when it is nullable
+func (cg *CodeGenerator) tsFieldType(field *FieldInfo) string {
+	tsType := cg.tsType(field)
+	if field.Nullable {
+		tsType += " | null"
+	}
+	return tsType
+}
+
+// tsType returns the TypeScript type of a field's values, a union for mixed values
+func (cg *CodeGenerator) tsType(field *FieldInfo) string {
+	var options []string
+	for _, t := range field.declaredTypes() {
+		option := "unknown"
+		switch t {
+		case FieldTypeString:
+			option = "string"
+			if name, ok := cg.names[field]; ok {
+				option = name
+			}
+		case FieldTypeInteger, FieldTypeNumber:
+			option = "number"
+		case FieldTypeBoolean:
+			option = "boolean"
+		case FieldTypeArray:
+			option = "unknown[]"
+			if field.Items != nil {
+				element := cg.tsFieldType(field.Items)
+				if strings.Contains(element, " | ") {
+					element = "(" + element + ")"
+				}
+				option = element + "[]"
+			}
+		case FieldTypeObject:
+			option = "Record<string, unknown>"
+			if name, ok := cg.names[field]; ok {
+				option = name
+			}
+		}
+		if !containsString(options, option) {
+			options = append(options, option)
+		}
+	}
+	if len(options) == 0 {
+		return "null"
+	}
+	return strings.Join(options, " | ")
+}
+
+// isStringEnum reports whether a field holds one of a list of short strings
+func isStringEnum(field *FieldInfo) bool {
+	types := field.declaredTypes()
+	if len(field.Enum) < 2 || len(types) != 1 || types[0] != FieldTypeString {
+		return false
+	}
+	for _, value := range field.Enum {
+		s, ok := value.(string)
+		if !ok || s == "" || len(s) > maxEnumLabelLength {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedFields returns properties ordered by name
+func sortedFields(properties map[string]*FieldInfo) []*FieldInfo {
+	fields := make([]*FieldInfo, 0, len(properties))
+	for _, field := range properties {
+		fields = append(fields, field)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+	return fields
+}
+
+// exportedName converts a JSON name such as dietaryInfo, first_name or image-url
+// to an exported Go identifier: DietaryInfo, FirstName, ImageURL
+func exportedName(name string) string {
+	var b strings.Builder
+	for _, word := range splitWords(name) {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		runes := []rune(word)
+		b.WriteString(string(unicode.ToUpper(runes[0])) + string(runes[1:]))
+	}
+
+	result := b.String()
+	if result == "" {
+		return ""
+	}
+	if unicode.IsDigit([]rune(result)[0]) {
+		result = "N" + result
+	}
+	return result
+}
+
+// splitWords splits a name on separators and on lower to upper case changes
+func splitWords(name string) []string {
+	var words []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, string(current))
+			current = nil
+		}
+	}
+	for _, r := range name {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r) || r > unicode.MaxASCII:
+			flush()
+		case unicode.IsUpper(r) && len(current) > 0 && unicode.IsLower(current[len(current)-1]):
+			flush()
+			current = append(current, r)
+		default:
+			current = append(current, r)
+		}
+	}
+	flush()
+	return words
+}
+
+// singular makes the last word of a type name singular, e.g. MenuItems to MenuItem
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies") && len(name) > 3:
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "xes"), strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"):
+		return strings.TrimSuffix(name, "es")
+	case strings.HasSuffix(name, "ss"), strings.HasSuffix(name, "us"), strings.HasSuffix(name, "is"):
+		return name
+	case strings.HasSuffix(name, "s") && len(name) > 1:
+		return strings.TrimSuffix(name, "s")
+	}
+	return name
+}
+
+// tsLiteral writes a value as a TypeScript literal type
+func tsLiteral(value interface{}) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
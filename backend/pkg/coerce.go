@@ -0,0 +1,375 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// coerceKeyword sets how a field's input is converted, on a property or, as the
+// default for all fields, at the root of a sidecar. Nested fields inherit it.
+const coerceKeyword = "x-coerce"
+
+// Coercion modes
+const (
+	// CoerceStrict converts only canonical text: 42, 4.2, true, a JSON array, 2024-01-31
+	CoerceStrict = "strict"
+	// CoerceLenient also trims spaces and accepts thousands separators, yes/no and
+	// on/off, comma-separated lists and common date layouts
+	CoerceLenient = "lenient"
+	// CoerceOff stores values as they are sent
+	CoerceOff = "off"
+)
+
+// jsonNumber matches numbers written as JSON would write them
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9]\d*)(\.\d+)?([eE][+-]?\d+)?$`)
+
+// dateLayouts are the canonical layouts of the date formats
+var dateLayouts = map[string]string{
+	"date":      "2006-01-02",
+	"date-time": time.RFC3339,
+}
+
+// lenientDateLayouts are also accepted for date and date-time fields in lenient mode
+var lenientDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02",
+	"01/02/2006",
+	"1/2/2006",
+	"Jan 2, 2006",
+	"January 2, 2006",
+	"2 Jan 2006",
+	"02 Jan 2006",
+}
+
+// Coercer converts text input, such as form posts and CSV cells, to the types a
+// schema declares. Values already of a declared type are left alone.
+type Coercer struct {
+	info *SchemaInfo
+	mode string
+}
+
+// NewCoercer creates a coercer for a schema. Fields without a mode use the
+// schema's default, which is strict unless the schema sets one.
+func NewCoercer(info *SchemaInfo) *Coercer {
+	mode := info.Coerce
+	if mode == "" {
+		mode = CoerceStrict
+	}
+	return &Coercer{info: info, mode: mode}
+}
+
+// CoerceItem converts the values of an item in place. Values that cannot be
+// converted are returned as violations with paths relative to the item.
+func (c *Coercer) CoerceItem(item map[string]any) ValidationErrors {
+	return c.coerce(item, "")
+}
+
+// CoerceItems converts items in place. Paths start with the item's index.
+func (c *Coercer) CoerceItems(items []map[string]any) ValidationErrors {
+	var violations ValidationErrors
+	for i, item := range items {
+		violations = append(violations, c.coerce(item, fmt.Sprintf("/%d", i))...)
+	}
+	return violations
+}
+
+// coerce converts an item in place, with paths starting at prefix
+func (c *Coercer) coerce(item map[string]any, prefix string) ValidationErrors {
+	return c.coerceObject(item, c.info.Properties, c.mode, prefix)
+}
+
+// coerceObject converts the properties of an object that the schema describes
+func (c *Coercer) coerceObject(object map[string]any, properties map[string]*FieldInfo, mode, path string) ValidationErrors {
+	var violations ValidationErrors
+	for name, value := range object {
+		field, ok := properties[name]
+		if !ok {
+			continue
+		}
+		fieldMode := modeOf(field, mode)
+		fieldPath := path + "/" + escapePointer(name)
+
+		// An empty input for a field that is not a string means no value
+		if s, ok := value.(string); ok && fieldMode != CoerceOff && strings.TrimSpace(s) == "" && !acceptsString(field) {
+			switch {
+			case field.Nullable:
+				object[name] = nil
+			case fieldMode == CoerceLenient && !field.Required:
+				delete(object, name)
+			default:
+				violations = append(violations, coerceError(fieldPath, field, s))
+			}
+			continue
+		}
+
+		converted, fieldViolations := c.coerceValue(value, field, fieldMode, fieldPath)
+		if len(fieldViolations) > 0 {
+			violations = append(violations, fieldViolations...)
+			continue
+		}
+		object[name] = converted
+	}
+	return violations
+}
+
+// coerceValue converts one value to the field's types
+func (c *Coercer) coerceValue(value any, field *FieldInfo, mode, path string) (any, ValidationErrors) {
+	if mode == CoerceOff || value == nil {
+		return value, nil
+	}
+
+	switch v := value.(type) {
+	case string:
+		if acceptsString(field) {
+			return c.coerceDate(v, field, mode, path)
+		}
+		converted, ok := parseText(v, field, mode)
+		if !ok {
+			return nil, ValidationErrors{coerceError(path, field, v)}
+		}
+		// Text such as a comma-separated list holds values that may need converting too
+		return c.coerceValue(converted, field, mode, path)
+	case []any:
+		if field.Items == nil {
+			return v, nil
+		}
+		var violations ValidationErrors
+		itemMode := modeOf(field.Items, mode)
+		for i, item := range v {
+			converted, itemViolations := c.coerceValue(item, field.Items, itemMode, fmt.Sprintf("%s/%d", path, i))
+			if len(itemViolations) > 0 {
+				violations = append(violations, itemViolations...)
+				continue
+			}
+			v[i] = converted
+		}
+		return v, violations
+	case map[string]any:
+		if field.Properties == nil {
+			return v, nil
+		}
+		return v, c.coerceObject(v, field.Properties, mode, path)
+	case float64, int, int64, bool:
+		// Numbers and booleans sent for text fields are written out
+		if mode == CoerceLenient && onlyString(field) {
+			if f, ok := v.(float64); ok {
+				return strconv.FormatFloat(f, 'f', -1, 64), nil
+			}
+			return fmt.Sprint(v), nil
+		}
+	}
+	return value, nil
+}
+
+// coerceDate rewrites a date in the layout of the field's date or date-time format
+func (c *Coercer) coerceDate(s string, field *FieldInfo, mode, path string) (any, ValidationErrors) {
+	layout, ok := dateLayouts[field.Format]
+	if !ok {
+		return s, nil
+	}
+	if _, err := time.Parse(layout, s); err == nil {
+		return s, nil
+	}
+	if mode == CoerceLenient {
+		text := strings.TrimSpace(s)
+		for _, candidate := range lenientDateLayouts {
+			if t, err := time.Parse(candidate, text); err == nil {
+				return t.Format(layout), nil
+			}
+		}
+	}
+	example := time.Date(2024, 1, 31, 9, 30, 0, 0, time.UTC).Format(layout)
+	return nil, ValidationErrors{{
+		Path:     path,
+		Rule:     "format",
+		Expected: field.Format,
+		Actual:   s,
+		Message:  fmt.Sprintf("cannot convert %q to a %s such as %s", s, field.Format, example),
+	}}
+}
+
+// parseText converts text to the first of the field's types it can be read as
+func parseText(s string, field *FieldInfo, mode string) (any, bool) {
+	lenient := mode == CoerceLenient
+	if lenient {
+		s = strings.TrimSpace(s)
+	}
+
+	for _, t := range coercionOrder(field) {
+		switch t {
+		case FieldTypeInteger:
+			if n, ok := parseInteger(s, lenient); ok {
+				return n, true
+			}
+		case FieldTypeNumber:
+			if n, ok := parseNumber(s, lenient); ok {
+				return n, true
+			}
+		case FieldTypeBoolean:
+			if b, ok := parseBoolean(s, lenient); ok {
+				return b, true
+			}
+		case FieldTypeArray:
+			var list []any
+			if err := json.Unmarshal([]byte(s), &list); err == nil {
+				return list, true
+			}
+			if lenient && !strings.HasPrefix(s, "[") {
+				list = []any{}
+				for _, part := range strings.Split(s, ",") {
+					if part = strings.TrimSpace(part); part != "" {
+						list = append(list, part)
+					}
+				}
+				return list, true
+			}
+		case FieldTypeObject:
+			var object map[string]any
+			if err := json.Unmarshal([]byte(s), &object); err == nil {
+				return object, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// coercionOrder lists the types text is tried as. Integers come before numbers so
+// that 42 stays an integer when a field accepts both.
+func coercionOrder(field *FieldInfo) []FieldType {
+	var order []FieldType
+	for _, t := range []FieldType{FieldTypeInteger, FieldTypeNumber, FieldTypeBoolean, FieldTypeArray, FieldTypeObject} {
+		if containsType(field.declaredTypes(), t) {
+			order = append(order, t)
+		}
+	}
+	return order
+}
+
+func parseInteger(s string, lenient bool) (int64, bool) {
+	if lenient {
+		s = strings.ReplaceAll(strings.TrimPrefix(s, "+"), ",", "")
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, true
+	}
+	if !lenient {
+		return 0, false
+	}
+	// 3.0 is an integer written as a number
+	f, ok := parseNumber(s, false)
+	if !ok || f != math.Trunc(f) || math.Abs(f) > 1<<53 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+func parseNumber(s string, lenient bool) (float64, bool) {
+	if lenient {
+		s = strings.ReplaceAll(strings.TrimPrefix(s, "+"), ",", "")
+		if strings.HasPrefix(s, ".") {
+			s = "0" + s
+		} else if strings.HasPrefix(s, "-.") {
+			s = "-0" + s[1:]
+		}
+	}
+	if !jsonNumber.MatchString(s) {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+func parseBoolean(s string, lenient bool) (bool, bool) {
+	if !lenient {
+		b, ok := map[string]bool{"true": true, "false": false}[s]
+		return b, ok
+	}
+	switch strings.ToLower(s) {
+	case "true", "yes", "y", "on", "1":
+		return true, true
+	case "false", "no", "n", "off", "0":
+		return false, true
+	}
+	return false, false
+}
+
+// modeOf returns a field's coercion mode, or the inherited one
+func modeOf(field *FieldInfo, inherited string) string {
+	if field.Coerce != "" {
+		return field.Coerce
+	}
+	return inherited
+}
+
+// acceptsString reports whether a field accepts strings, or has no declared type
+func acceptsString(field *FieldInfo) bool {
+	types := field.declaredTypes()
+	return len(types) == 0 || containsType(types, FieldTypeString)
+}
+
+// onlyString reports whether strings are the only values a field accepts
+func onlyString(field *FieldInfo) bool {
+	types := field.declaredTypes()
+	return len(types) == 1 && types[0] == FieldTypeString
+}
+
+// coerceError describes text that cannot be converted to a field's types
+func coerceError(path string, field *FieldInfo, s string) *ValidationError {
+	names := make([]string, 0, len(field.declaredTypes()))
+	for _, t := range field.declaredTypes() {
+		names = append(names, string(t))
+	}
+	return &ValidationError{
+		Path:     path,
+		Rule:     "type",
+		Expected: names,
+		Actual:   s,
+		Message:  fmt.Sprintf("cannot convert %q to %s", s, strings.Join(names, " or ")),
+	}
+}
+
+// validCoerceMode reports whether mode is a coercion mode, or unset
+func validCoerceMode(mode string) bool {
+	switch mode {
+	case "", CoerceStrict, CoerceLenient, CoerceOff:
+		return true
+	}
+	return false
+}
+
+// checkCoerceModes rejects unknown coercion modes in a schema
+func checkCoerceModes(info *SchemaInfo) error {
+	if !validCoerceMode(info.Coerce) {
+		return fmt.Errorf("invalid %s %q, expected %s, %s or %s", coerceKeyword, info.Coerce, CoerceStrict, CoerceLenient, CoerceOff)
+	}
+	var check func(path string, field *FieldInfo) error
+	check = func(path string, field *FieldInfo) error {
+		if !validCoerceMode(field.Coerce) {
+			return fmt.Errorf("invalid %s %q for %s, expected %s, %s or %s", coerceKeyword, field.Coerce, path, CoerceStrict, CoerceLenient, CoerceOff)
+		}
+		for name, property := range field.Properties {
+			if err := check(path+"."+name, property); err != nil {
+				return err
+			}
+		}
+		if field.Items != nil {
+			return check(path+"[]", field.Items)
+		}
+		return nil
+	}
+	for name, field := range info.Properties {
+		if err := check(name, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+const coerceTestSchema = `{
+  "type": "object",
+  "x-coerce": "lenient",
+  "properties": {
+    "id": {"type": "integer"},
+    "qty": {"type": "integer", "x-coerce": "strict"},
+    "active": {"type": "boolean"},
+    "sizes": {"type": "array", "items": {"type": "integer"}},
+    "born": {"type": "string", "format": "date"},
+    "note": {"type": "integer", "x-coerce": "off"},
+    "rating": {"type": "number"}
+  },
+  "required": ["id"]
+}`
+
+func TestCoercerModes(t *testing.T) {
+	schema, err := ParseFileSchema([]byte(coerceTestSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := map[string]any{
+		"id":     " 1,024 ",
+		"qty":    "7",
+		"active": "yes",
+		"sizes":  "1, 2",
+		"born":   "Jan 31, 2024",
+		"note":   "as sent",
+		"rating": "",
+	}
+	if violations := schema.Coercer().CoerceItem(item); len(violations) > 0 {
+		t.Fatalf("CoerceItem reported %v", violations)
+	}
+	want := map[string]any{
+		"id":     int64(1024),
+		"qty":    int64(7),
+		"active": true,
+		"sizes":  []any{int64(1), int64(2)},
+		"born":   "2024-01-31",
+		"note":   "as sent",
+	}
+	if !reflect.DeepEqual(item, want) {
+		t.Errorf("CoerceItem = %#v, want %#v", item, want)
+	}
+
+	tests := []struct {
+		name string
+		item map[string]any
+		path string
+	}{
+		{"strict field rejects lenient text", map[string]any{"qty": " 7 "}, "/qty"},
+		{"required field rejects empty text", map[string]any{"id": ""}, "/id"},
+		{"unconvertible array element", map[string]any{"sizes": []any{"1", "big"}}, "/sizes/1"},
+		{"unknown date layout", map[string]any{"born": "31st of January"}, "/born"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := schema.Coercer().CoerceItem(tt.item)
+			if len(violations) != 1 || violations[0].Path != tt.path {
+				t.Errorf("CoerceItem(%v) = %v, want one violation at %s", tt.item, violations, tt.path)
+			}
+		})
+	}
+}
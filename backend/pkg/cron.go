@@ -0,0 +1,170 @@
+package pkg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed five-field cron expression: minute, hour, day of month,
+// month and day of week. Times are matched in the server's local time zone.
+type CronSchedule struct {
+	expr    string
+	minutes [60]bool
+	hours   [24]bool
+	days    [32]bool
+	months  [13]bool
+	weekday [7]bool
+	// Like cron, when both day fields are restricted a time matches either of them
+	daysRestricted    bool
+	weekdayRestricted bool
+}
+
+// cronShortcuts are the supported @ forms of common schedules
+var cronShortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseCron parses a cron expression such as "30 2 * * 1-5" or "@daily"
+func ParseCron(expr string) (*CronSchedule, error) {
+	spec := strings.TrimSpace(expr)
+	if shortcut, ok := cronShortcuts[strings.ToLower(spec)]; ok {
+		spec = shortcut
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields", expr)
+	}
+
+	schedule := &CronSchedule{expr: expr}
+	parts := []struct {
+		name     string
+		min, max int
+		names    []string
+		set      func(int)
+	}{
+		{"minute", 0, 59, nil, func(v int) { schedule.minutes[v] = true }},
+		{"hour", 0, 23, nil, func(v int) { schedule.hours[v] = true }},
+		{"day of month", 1, 31, nil, func(v int) { schedule.days[v] = true }},
+		{"month", 1, 12, monthNames, func(v int) { schedule.months[v] = true }},
+		// 7 is accepted as Sunday
+		{"day of week", 0, 7, weekdayNames, func(v int) { schedule.weekday[v%7] = true }},
+	}
+	for i, part := range parts {
+		if err := parseCronField(fields[i], part.min, part.max, part.names, part.set); err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %s: %w", expr, part.name, err)
+		}
+	}
+	schedule.daysRestricted = fields[2] != "*"
+	schedule.weekdayRestricted = fields[4] != "*"
+	return schedule, nil
+}
+
+// parseCronField parses a comma-separated list of values, ranges and steps
+func parseCronField(field string, min, max int, names []string, set func(int)) error {
+	for _, item := range strings.Split(field, ",") {
+		rangePart, step := item, 1
+		if before, after, ok := strings.Cut(item, "/"); ok {
+			n, err := strconv.Atoi(after)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid step %q", after)
+			}
+			rangePart, step = before, n
+		}
+
+		var lo, hi int
+		switch {
+		case rangePart == "*":
+			lo, hi = min, max
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = cronValue(from, min, max, names); err != nil {
+				return err
+			}
+			if hi, err = cronValue(to, min, max, names); err != nil {
+				return err
+			}
+			if lo > hi {
+				return fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			value, err := cronValue(rangePart, min, max, names)
+			if err != nil {
+				return err
+			}
+			// A single value with a step runs from that value to the end
+			lo, hi = value, value
+			if step > 1 {
+				hi = max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set(v)
+		}
+	}
+	return nil
+}
+
+// cronValue parses a number or a month or weekday name
+func cronValue(s string, min, max int, names []string) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(s, name) {
+			return i + min, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("value %q out of range %d-%d", s, min, max)
+	}
+	return v, nil
+}
+
+// String returns the expression the schedule was parsed from
+func (s *CronSchedule) String() string {
+	return s.expr
+}
+
+// dayMatches reports whether a date matches the day-of-month and day-of-week fields
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	day, weekday := s.days[t.Day()], s.weekday[t.Weekday()]
+	if s.daysRestricted && s.weekdayRestricted {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// Next returns the first time after t that matches the schedule, or the zero
+// time if none does within five years (e.g. "0 0 30 2 *")
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !s.months[t.Month()]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !s.hours[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !s.minutes[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@sometimes",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(value string) time.Time {
+		t.Helper()
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		expr, from, want string
+	}{
+		{"@hourly", "2024-01-31 09:30", "2024-01-31 10:00"},
+		{"@daily", "2024-01-31 09:30", "2024-02-01 00:00"},
+		{"30 2 * * *", "2024-01-31 02:30", "2024-02-01 02:30"},
+		{"*/15 * * * *", "2024-01-31 09:31", "2024-01-31 09:45"},
+		{"0 9-17/4 * * *", "2024-01-31 14:00", "2024-01-31 17:00"},
+		{"0 0 * * mon-fri", "2024-02-02 12:00", "2024-02-05 00:00"},
+		{"0 0 * * 7", "2024-01-31 00:00", "2024-02-04 00:00"},
+		{"0 0 29 feb *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"0 0 31 * *", "2024-04-01 00:00", "2024-05-31 00:00"},
+		// When both day fields are restricted either one matches
+		{"0 0 15 * fri", "2024-01-31 00:00", "2024-02-02 00:00"},
+		{"0 0 1 1 *", "2024-12-31 23:59", "2025-01-01 00:00"},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := schedule.Next(at(tt.from)); !got.Equal(at(tt.want)) {
+			t.Errorf("%q.Next(%s) = %s, want %s", tt.expr, tt.from, got.Format("2006-01-02 15:04"), tt.want)
+		}
+	}
+}
+
+func TestCronNextNever(t *testing.T) {
+	schedule, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Next() = %v, want the zero time", next)
+	}
+}
@@ -0,0 +1,308 @@
+package pkg
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrPermanent marks upload failures that retrying cannot fix, such as bad credentials
+var ErrPermanent = errors.New("permanent failure")
+
+// Destination receives backups taken by the scheduler
+type Destination interface {
+	// Name identifies the destination in status reports
+	Name() string
+	// Put stores size bytes read from r under name. r is rewound before each attempt.
+	Put(ctx context.Context, name string, r io.ReadSeeker, size int64) error
+}
+
+// DestinationConfig describes a destination in the schedule file
+type DestinationConfig struct {
+	Type string `json:"type"`
+	// Path is the directory for local and mount destinations
+	Path string `json:"path,omitempty"`
+	// The remaining fields configure S3-compatible destinations
+	Endpoint  string `json:"endpoint,omitempty"`
+	Region    string `json:"region,omitempty"`
+	Bucket    string `json:"bucket,omitempty"`
+	Prefix    string `json:"prefix,omitempty"`
+	AccessKey string `json:"accessKey,omitempty"`
+	SecretKey string `json:"secretKey,omitempty"`
+	PathStyle bool   `json:"pathStyle,omitempty"`
+}
+
+// NewDestination creates a destination from its configuration
+func NewDestination(name string, config DestinationConfig) (Destination, error) {
+	switch config.Type {
+	case "local":
+		return NewLocalDestination(name, config.Path)
+	case "mount":
+		return NewMountDestination(name, config.Path)
+	case "s3":
+		return NewS3Destination(name, config)
+	default:
+		return nil, fmt.Errorf("destination %s: unknown type %q", name, config.Type)
+	}
+}
+
+// LocalDestination copies backups into a local directory
+type LocalDestination struct {
+	name string
+	dir  string
+}
+
+// NewLocalDestination creates a destination writing to dir, creating it if needed
+func NewLocalDestination(name, dir string) (*LocalDestination, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("destination %s: path is required", name)
+	}
+	return &LocalDestination{name: name, dir: dir}, nil
+}
+
+func (d *LocalDestination) Name() string {
+	return d.name
+}
+
+func (d *LocalDestination) Put(ctx context.Context, name string, r io.ReadSeeker, size int64) error {
+	target := filepath.Join(d.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return copyToFile(target, r, size)
+}
+
+// MountDestination copies backups onto a remote file system mounted locally,
+// such as an sshfs or NFS mount. Unlike a local destination it never creates the
+// mount directory, so backups are not silently written to local disk when the
+// mount is missing, and it checks the size of what the remote side stored.
+type MountDestination struct {
+	name string
+	dir  string
+}
+
+// NewMountDestination creates a destination writing below the mount path dir
+func NewMountDestination(name, dir string) (*MountDestination, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("destination %s: path is required", name)
+	}
+	return &MountDestination{name: name, dir: dir}, nil
+}
+
+func (d *MountDestination) Name() string {
+	return d.name
+}
+
+func (d *MountDestination) Put(ctx context.Context, name string, r io.ReadSeeker, size int64) error {
+	stat, err := os.Stat(d.dir)
+	if err != nil {
+		return fmt.Errorf("mount path is not available: %w", err)
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("mount path %s is not a directory", d.dir)
+	}
+
+	target := filepath.Join(d.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := copyToFile(target, r, size); err != nil {
+		return err
+	}
+
+	written, err := os.Stat(target)
+	if err != nil {
+		return fmt.Errorf("failed to check uploaded file: %w", err)
+	}
+	if written.Size() != size {
+		return fmt.Errorf("uploaded file has %d bytes, expected %d", written.Size(), size)
+	}
+	return nil
+}
+
+// copyToFile atomically writes size bytes from r to target
+func copyToFile(target string, r io.ReadSeeker, size int64) error {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return writeFileAtomic(target, func(w io.Writer) error {
+		_, err := io.CopyN(w, r, size)
+		return err
+	})
+}
+
+// S3Destination uploads backups to an S3-compatible object store such as AWS S3 or MinIO
+type S3Destination struct {
+	name      string
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	prefix    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	client    *http.Client
+}
+
+// NewS3Destination creates an S3 destination. Credentials default to
+// $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY.
+func NewS3Destination(name string, config DestinationConfig) (*S3Destination, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, fmt.Errorf("destination %s: endpoint and bucket are required", name)
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("destination %s: invalid endpoint %q", name, config.Endpoint)
+	}
+
+	d := &S3Destination{
+		name:      name,
+		endpoint:  endpoint,
+		region:    config.Region,
+		bucket:    config.Bucket,
+		prefix:    strings.Trim(config.Prefix, "/"),
+		accessKey: config.AccessKey,
+		secretKey: config.SecretKey,
+		pathStyle: config.PathStyle,
+		client:    &http.Client{Timeout: 10 * time.Minute},
+	}
+	if d.region == "" {
+		d.region = "us-east-1"
+	}
+	if d.accessKey == "" {
+		d.accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if d.secretKey == "" {
+		d.secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if d.accessKey == "" || d.secretKey == "" {
+		return nil, fmt.Errorf("destination %s: access key and secret key are required", name)
+	}
+	return d, nil
+}
+
+func (d *S3Destination) Name() string {
+	return d.name
+}
+
+func (d *S3Destination) Put(ctx context.Context, name string, r io.ReadSeeker, size int64) error {
+	// The payload hash is part of the signature
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	hash := sha256.New()
+	if _, err := io.CopyN(hash, r, size); err != nil {
+		return fmt.Errorf("failed to hash upload: %w", err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	key := name
+	if d.prefix != "" {
+		key = d.prefix + "/" + name
+	}
+	target := *d.endpoint
+	if d.pathStyle {
+		target.Path = path.Join("/", d.endpoint.Path, d.bucket, key)
+	} else {
+		target.Host = d.bucket + "." + d.endpoint.Host
+		target.Path = path.Join("/", d.endpoint.Path, key)
+	}
+	// Send the path escaped exactly as it is signed
+	target.RawPath = s3EscapePath(target.Path)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target.String(), io.LimitReader(r, size))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	d.sign(req, hex.EncodeToString(hash.Sum(nil)), time.Now().UTC())
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("upload of %s failed with status %d: %s", key, resp.StatusCode, strings.TrimSpace(string(body)))
+	// Client errors other than timeouts and throttling will fail again
+	if resp.StatusCode/100 == 4 && resp.StatusCode != 408 && resp.StatusCode != 429 {
+		return fmt.Errorf("%w: %v", ErrPermanent, err)
+	}
+	return err
+}
+
+// sign adds an AWS Signature Version 4 authorization header to a request
+func (d *S3Destination) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "content-type:" + req.Header.Get("Content-Type") + "\n" +
+		"host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + d.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+d.secretKey), date)
+	key = hmacSHA256(key, d.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		d.accessKey, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 computes an HMAC-SHA256 of data
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath URI-encodes an object path as SigV4 requires, leaving only
+// unreserved characters and slashes as they are
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,482 @@
+package pkg
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change types reported by the diff engine
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// FieldChange describes a change to a single value inside an item
+type FieldChange struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+	Old  any    `json:"old,omitempty"`
+	New  any    `json:"new,omitempty"`
+}
+
+// ItemDiff describes an added, removed or modified item
+type ItemDiff struct {
+	Key     string         `json:"key"`
+	Item    map[string]any `json:"item,omitempty"`
+	Changes []FieldChange  `json:"changes,omitempty"`
+}
+
+// DataDiff is the structured difference between two snapshots of a file
+type DataDiff struct {
+	From       string     `json:"from"`
+	To         string     `json:"to"`
+	PrimaryKey string     `json:"primaryKey"`
+	Added      []ItemDiff `json:"added"`
+	Removed    []ItemDiff `json:"removed"`
+	Modified   []ItemDiff `json:"modified"`
+}
+
+// IsEmpty reports whether the snapshots are identical
+func (d *DataDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// nestedKeyField identifies objects inside nested arrays, e.g. menu items in a section
+const nestedKeyField = "id"
+
+// DiffData compares two snapshots item by item, matching items on the primary key.
+// Items without the key are matched by position.
+func DiffData(from, to []map[string]any, primaryKey string) *DataDiff {
+	diff := &DataDiff{
+		PrimaryKey: primaryKey,
+		Added:      []ItemDiff{},
+		Removed:    []ItemDiff{},
+		Modified:   []ItemDiff{},
+	}
+
+	fromKeys, fromItems := indexItems(from, primaryKey)
+	toKeys, toItems := indexItems(to, primaryKey)
+
+	for _, key := range fromKeys {
+		oldItem := fromItems[key]
+		newItem, exists := toItems[key]
+		if !exists {
+			diff.Removed = append(diff.Removed, ItemDiff{Key: key, Item: oldItem})
+			continue
+		}
+
+		var changes []FieldChange
+		diffValues("", oldItem, newItem, &changes)
+		if len(changes) > 0 {
+			diff.Modified = append(diff.Modified, ItemDiff{Key: key, Changes: changes})
+		}
+	}
+
+	for _, key := range toKeys {
+		if _, exists := fromItems[key]; !exists {
+			diff.Added = append(diff.Added, ItemDiff{Key: key, Item: toItems[key]})
+		}
+	}
+
+	return diff
+}
+
+// indexItems maps items by primary key, keeping the original order of keys
+func indexItems(items []map[string]any, primaryKey string) ([]string, map[string]map[string]any) {
+	keys := make([]string, 0, len(items))
+	index := make(map[string]map[string]any, len(items))
+	for i, item := range items {
+		key := fmt.Sprintf("#%d", i)
+		if value, ok := item[primaryKey]; ok && primaryKey != "" && isScalarValue(value) {
+			key = fmt.Sprintf("%v", value)
+		}
+		if _, duplicate := index[key]; duplicate {
+			key = fmt.Sprintf("%s#%d", key, i)
+		}
+		keys = append(keys, key)
+		index[key] = item
+	}
+	return keys, index
+}
+
+// diffValues recursively compares two values and records changes below path
+func diffValues(path string, oldValue, newValue any, changes *[]FieldChange) {
+	switch oldTyped := oldValue.(type) {
+	case map[string]any:
+		if newTyped, ok := newValue.(map[string]any); ok {
+			diffMaps(path, oldTyped, newTyped, changes)
+			return
+		}
+	case []any:
+		if newTyped, ok := newValue.([]any); ok {
+			diffArrays(path, oldTyped, newTyped, changes)
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		*changes = append(*changes, FieldChange{Path: path, Type: ChangeModified, Old: oldValue, New: newValue})
+	}
+}
+
+// diffMaps compares the fields of two objects
+func diffMaps(path string, oldMap, newMap map[string]any, changes *[]FieldChange) {
+	keySet := make(map[string]bool)
+	for key := range oldMap {
+		keySet[key] = true
+	}
+	for key := range newMap {
+		keySet[key] = true
+	}
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fieldPath := joinPath(path, key)
+		oldValue, inOld := oldMap[key]
+		newValue, inNew := newMap[key]
+		switch {
+		case !inOld:
+			*changes = append(*changes, FieldChange{Path: fieldPath, Type: ChangeAdded, New: newValue})
+		case !inNew:
+			*changes = append(*changes, FieldChange{Path: fieldPath, Type: ChangeRemoved, Old: oldValue})
+		default:
+			diffValues(fieldPath, oldValue, newValue, changes)
+		}
+	}
+}
+
+// diffArrays compares arrays. Arrays of objects carrying an id are matched by
+// id (path "items[id=app-8].price"), other arrays of equal length by position.
+func diffArrays(path string, oldArr, newArr []any, changes *[]FieldChange) {
+	oldByID, oldOrder, oldKeyed := keyedObjects(oldArr)
+	newByID, newOrder, newKeyed := keyedObjects(newArr)
+
+	if oldKeyed && newKeyed {
+		for _, id := range oldOrder {
+			elementPath := fmt.Sprintf("%s[%s=%s]", path, nestedKeyField, id)
+			newElement, exists := newByID[id]
+			if !exists {
+				*changes = append(*changes, FieldChange{Path: elementPath, Type: ChangeRemoved, Old: oldByID[id]})
+				continue
+			}
+			diffMaps(elementPath, oldByID[id], newElement, changes)
+		}
+		for _, id := range newOrder {
+			if _, exists := oldByID[id]; !exists {
+				elementPath := fmt.Sprintf("%s[%s=%s]", path, nestedKeyField, id)
+				*changes = append(*changes, FieldChange{Path: elementPath, Type: ChangeAdded, New: newByID[id]})
+			}
+		}
+		return
+	}
+
+	if len(oldArr) != len(newArr) {
+		if !reflect.DeepEqual(oldArr, newArr) {
+			*changes = append(*changes, FieldChange{Path: path, Type: ChangeModified, Old: oldArr, New: newArr})
+		}
+		return
+	}
+
+	for i := range oldArr {
+		diffValues(fmt.Sprintf("%s[%d]", path, i), oldArr[i], newArr[i], changes)
+	}
+}
+
+// keyedObjects indexes array elements by id when every element is an object with a unique id
+func keyedObjects(arr []any) (map[string]map[string]any, []string, bool) {
+	if len(arr) == 0 {
+		return map[string]map[string]any{}, nil, true
+	}
+
+	byID := make(map[string]map[string]any, len(arr))
+	order := make([]string, 0, len(arr))
+	for _, element := range arr {
+		obj, ok := element.(map[string]any)
+		if !ok {
+			return nil, nil, false
+		}
+		id, ok := obj[nestedKeyField]
+		if !ok || !isScalarValue(id) {
+			return nil, nil, false
+		}
+		key := fmt.Sprintf("%v", id)
+		if _, duplicate := byID[key]; duplicate {
+			return nil, nil, false
+		}
+		byID[key] = obj
+		order = append(order, key)
+	}
+	return byID, order, true
+}
+
+// joinPath appends a field name to a dotted path
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// isScalarValue reports whether a value is a string, number or boolean
+func isScalarValue(value any) bool {
+	switch value.(type) {
+	case map[string]any, []any, nil:
+		return false
+	default:
+		return true
+	}
+}
+
+// UnifiedDiff returns a unified line diff between two texts. A negative context
+// is treated as zero.
+func UnifiedDiff(fromName, toName string, from, to []byte, context int) string {
+	if context < 0 {
+		context = 0
+	}
+	a := splitLines(string(from))
+	b := splitLines(string(to))
+	ops := diffLines(a, b)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	// Group operations into hunks with surrounding context
+	for start := 0; start < len(ops); {
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start >= len(ops) {
+			break
+		}
+
+		hunkStart := start - context
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			// Stop when the run of unchanged lines is longer than twice the context
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				break
+			}
+			end = run
+		}
+		hunkEnd := end + context
+		if hunkEnd > len(ops) {
+			hunkEnd = len(ops)
+		}
+
+		hunk := ops[hunkStart:hunkEnd]
+		oldStart, newStart := hunk[0].oldLine, hunk[0].newLine
+		oldCount, newCount := 0, 0
+		for _, op := range hunk {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, op := range hunk {
+			out.WriteByte(op.kind)
+			out.WriteString(op.text)
+			out.WriteByte('\n')
+		}
+
+		start = hunkEnd
+	}
+
+	return out.String()
+}
+
+// hunkRange formats the start and length of a hunk side. An empty side starts at
+// the line before it, which is 0 at the top of the file.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// lineOp is one line of a line diff
+type lineOp struct {
+	kind    byte // ' ', '-' or '+'
+	text    string
+	oldLine int
+	newLine int
+}
+
+// splitLines splits text into lines without the trailing newline
+func splitLines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// diffLines computes a line diff with Myers' algorithm in linear space
+func diffLines(a, b []string) []lineOp {
+	ops, _ := diffLinesWithin(a, b, 0)
+	return ops
+}
+
+// diffLinesWithin computes a line diff, giving up and reporting false once it has
+// compared more than limit pairs of lines. A limit of 0 means no limit.
+func diffLinesWithin(a, b []string, limit int) ([]lineOp, bool) {
+	d := &lineDiffer{
+		a:        a,
+		b:        b,
+		deleted:  make([]bool, len(a)),
+		inserted: make([]bool, len(b)),
+		limit:    limit,
+	}
+	size := len(a) + len(b) + 4
+	d.forward = make([]int, size)
+	d.backward = make([]int, size)
+	d.compare(0, len(a), 0, len(b))
+	if d.exceeded() {
+		return nil, false
+	}
+
+	ops := make([]lineOp, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && d.deleted[i]:
+			ops = append(ops, lineOp{kind: '-', text: a[i], oldLine: i, newLine: j})
+			i++
+		case j < len(b) && d.inserted[j]:
+			ops = append(ops, lineOp{kind: '+', text: b[j], oldLine: i, newLine: j})
+			j++
+		default:
+			ops = append(ops, lineOp{kind: ' ', text: a[i], oldLine: i, newLine: j})
+			i++
+			j++
+		}
+	}
+	return ops, true
+}
+
+// lineDiffer marks the lines deleted from a and inserted from b
+type lineDiffer struct {
+	a, b              []string
+	deleted, inserted []bool
+	// forward and backward hold the furthest reaching paths per diagonal
+	forward, backward []int
+	steps, limit      int
+}
+
+func (d *lineDiffer) exceeded() bool {
+	return d.limit > 0 && d.steps > d.limit
+}
+
+// compare diffs a[aLo:aHi] against b[bLo:bHi] by splitting it at the middle snake
+// of a shortest edit script
+func (d *lineDiffer) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	switch {
+	case d.exceeded():
+		return
+	case aLo == aHi:
+		for j := bLo; j < bHi; j++ {
+			d.inserted[j] = true
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.deleted[i] = true
+		}
+	default:
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		d.compare(u, aHi, v, bHi)
+	}
+}
+
+// middleSnake returns the start and end of the diagonal run in the middle of a
+// shortest edit script, found by searching from both ends at once
+func (d *lineDiffer) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	offset := (n+m+1)/2 + 1
+	forward, backward := d.forward, d.backward
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+
+	for D := 0; D <= (n+m+1)/2; D++ {
+		// Forward paths from the top left, x counted from aLo
+		for k := -D; k <= D; k += 2 {
+			var fx int
+			if k == -D || (k != D && forward[offset+k-1] < forward[offset+k+1]) {
+				fx = forward[offset+k+1]
+			} else {
+				fx = forward[offset+k-1] + 1
+			}
+			startX := fx
+			fy := fx - k
+			for fx < n && fy < m && d.a[aLo+fx] == d.b[bLo+fy] {
+				fx++
+				fy++
+			}
+			d.steps += fx - startX + 1
+			forward[offset+k] = fx
+
+			if c := delta - k; odd && c >= -(D-1) && c <= D-1 && fx+backward[offset+c] >= n {
+				return aLo + startX, bLo + startX - k, aLo + fx, bLo + fy
+			}
+		}
+
+		// Backward paths from the bottom right, x counted back from aHi
+		for k := -D; k <= D; k += 2 {
+			var bx int
+			if k == -D || (k != D && backward[offset+k-1] < backward[offset+k+1]) {
+				bx = backward[offset+k+1]
+			} else {
+				bx = backward[offset+k-1] + 1
+			}
+			startX := bx
+			by := bx - k
+			for bx < n && by < m && d.a[aHi-1-bx] == d.b[bHi-1-by] {
+				bx++
+				by++
+			}
+			d.steps += bx - startX + 1
+			backward[offset+k] = bx
+
+			if c := delta - k; !odd && c >= -D && c <= D && bx+forward[offset+c] >= n {
+				return aHi - bx, bHi - by, aHi - startX, bHi - (startX - k)
+			}
+		}
+
+		if d.exceeded() {
+			break
+		}
+	}
+	// Only reached when the limit is exceeded; the caller discards the result
+	return aLo, bLo, aLo, bLo
+}
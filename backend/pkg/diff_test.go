@@ -0,0 +1,111 @@
+package pkg
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiffNegativeContext(t *testing.T) {
+	from := []byte("a\nb\nc\nd\ne\n")
+	to := []byte("a\nb\nX\nd\ne\n")
+
+	got := UnifiedDiff("old", "new", from, to, -5)
+	want := "--- old\n+++ new\n@@ -3,1 +3,1 @@\n-c\n+X\n"
+	if got != want {
+		t.Errorf("UnifiedDiff with negative context:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnifiedDiffEmptySide(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		header   string
+	}{
+		{"added to empty", "", "a\nb\n", "@@ -0,0 +1,2 @@"},
+		{"emptied", "a\nb\n", "", "@@ -1,2 +0,0 @@"},
+		{"inserted after a line", "a\nb\n", "a\nX\nb\n", "@@ -1,0 +2,1 @@"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := UnifiedDiff("old", "new", []byte(tt.from), []byte(tt.to), 0)
+			if !strings.Contains(got, tt.header+"\n") {
+				t.Errorf("UnifiedDiff(%q, %q) = %q, want header %q", tt.from, tt.to, got, tt.header)
+			}
+		})
+	}
+}
+
+func TestDiffLinesShortest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(3)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 2000; i++ {
+		a, b := randomLines(), randomLines()
+		ops := diffLines(a, b)
+
+		var old, new []string
+		edits := 0
+		for _, op := range ops {
+			if op.kind != '+' {
+				old = append(old, op.text)
+			}
+			if op.kind != '-' {
+				new = append(new, op.text)
+			}
+			if op.kind != ' ' {
+				edits++
+			}
+		}
+		if strings.Join(old, "") != strings.Join(a, "") || strings.Join(new, "") != strings.Join(b, "") {
+			t.Fatalf("diffLines(%q, %q) does not rebuild both sides: %v", a, b, ops)
+		}
+		if want := len(a) + len(b) - 2*lcsLength(a, b); edits != want {
+			t.Fatalf("diffLines(%q, %q) made %d edits, want %d", a, b, edits, want)
+		}
+	}
+}
+
+func TestDiffLinesWithinLimit(t *testing.T) {
+	a := make([]string, 2000)
+	b := make([]string, 2000)
+	for i := range a {
+		a[i] = fmt.Sprintf("a%d", i)
+		b[i] = fmt.Sprintf("b%d", i)
+	}
+	if _, ok := diffLinesWithin(a, b, 10000); ok {
+		t.Error("diffLinesWithin succeeded past its limit")
+	}
+	if ops, ok := diffLinesWithin(a, b, 0); !ok || len(ops) != 4000 {
+		t.Errorf("diffLinesWithin without a limit = %d ops, %v", len(ops), ok)
+	}
+}
+
+// lcsLength returns the length of the longest common subsequence of a and b
+func lcsLength(a, b []string) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return lcs[0][0]
+}
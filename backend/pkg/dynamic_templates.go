@@ -113,7 +113,7 @@ func (dtg *DynamicTemplateGenerator) GenerateIndexTemplate(schema *SchemaInfo) s
 
 // GenerateFileViewTemplate generates the data listing template
 func (dtg *DynamicTemplateGenerator) GenerateFileViewTemplate(schema *SchemaInfo) string {
-	return fmt.Sprintf(`<!DOCTYPE html>
+	return `<!DOCTYPE html>
 <html lang="en">
 <head>
     <meta charset="UTF-8">
@@ -242,12 +242,12 @@ func (dtg *DynamicTemplateGenerator) GenerateFileViewTemplate(schema *SchemaInfo
         });
     </script>
 </body>
-</html>`, dtg.getPrimaryKey(schema))
+</html>`
 }
 
 // GenerateFormTemplate generates the create/edit form template
 func (dtg *DynamicTemplateGenerator) GenerateFormTemplate(schema *SchemaInfo) string {
-	return fmt.Sprintf(`<!DOCTYPE html>
+	return `<!DOCTYPE html>
 <html lang="en">
 <head>
     <meta charset="UTF-8">
@@ -307,7 +307,7 @@ func (dtg *DynamicTemplateGenerator) GenerateFormTemplate(schema *SchemaInfo) st
         </div>
     </div>
 </body>
-</html>`, dtg.getPrimaryKey(schema))
+</html>`
 }
 
 // getPrimaryKey returns the primary key field name or "id" as default
@@ -0,0 +1,289 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// EncryptionKeyEnv holds a base64 or hex encoded 32-byte key
+	EncryptionKeyEnv = "FILE_ENCRYPTION_KEY"
+	// EncryptionKeyFileEnv points to a file containing the key
+	EncryptionKeyFileEnv = "FILE_ENCRYPTION_KEY_FILE"
+
+	encryptionMagic = "FTENC1"
+	keyIDLength     = 8
+)
+
+// ErrEncryptionKeyMissing is returned when encryption is requested but no key is configured
+var ErrEncryptionKeyMissing = fmt.Errorf("encryption key not configured: set %s or %s", EncryptionKeyEnv, EncryptionKeyFileEnv)
+
+// EncryptionKey is an AES-256 key with a short identifier stored alongside ciphertext
+type EncryptionKey struct {
+	ID  string
+	key []byte
+}
+
+// NewEncryptionKey creates a key from 32 raw bytes
+func NewEncryptionKey(raw []byte) (*EncryptionKey, error) {
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(raw))
+	}
+
+	sum := sha256.Sum256(raw)
+	return &EncryptionKey{
+		ID:  hex.EncodeToString(sum[:])[:keyIDLength],
+		key: append([]byte(nil), raw...),
+	}, nil
+}
+
+// ParseEncryptionKey decodes a base64 or hex encoded key
+func ParseEncryptionKey(encoded string) (*EncryptionKey, error) {
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return nil, ErrEncryptionKeyMissing
+	}
+
+	if raw, err := hex.DecodeString(encoded); err == nil && len(raw) == 32 {
+		return NewEncryptionKey(raw)
+	}
+	if raw, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+		return NewEncryptionKey(raw)
+	}
+	return nil, errors.New("encryption key must be 32 bytes encoded as hex or base64")
+}
+
+// LoadEncryptionKeyFile reads a key from a file
+func LoadEncryptionKeyFile(path string) (*EncryptionKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	return ParseEncryptionKey(string(content))
+}
+
+// LoadEncryptionKey loads the key from the key file if given, otherwise from the environment
+func LoadEncryptionKey(keyFile string) (*EncryptionKey, error) {
+	if keyFile != "" {
+		return LoadEncryptionKeyFile(keyFile)
+	}
+	if path := os.Getenv(EncryptionKeyFileEnv); path != "" {
+		return LoadEncryptionKeyFile(path)
+	}
+	if value := os.Getenv(EncryptionKeyEnv); value != "" {
+		return ParseEncryptionKey(value)
+	}
+	return nil, ErrEncryptionKeyMissing
+}
+
+// GenerateEncryptionKey returns a new random key encoded as base64
+func GenerateEncryptionKey() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// EncryptedFormat wraps another format and encrypts its output with AES-GCM.
+// The file layout is: magic | key id | nonce | ciphertext.
+type EncryptedFormat struct {
+	inner FileFormat
+	key   *EncryptionKey
+	// previous keys are accepted for decryption during key rotation
+	previous []*EncryptionKey
+}
+
+// NewEncryptedFormat wraps a format with encryption using the given key
+func NewEncryptedFormat(inner FileFormat, key *EncryptionKey, previous ...*EncryptionKey) (*EncryptedFormat, error) {
+	if key == nil {
+		return nil, ErrEncryptionKeyMissing
+	}
+	if inner == nil {
+		return nil, errors.New("inner format is required")
+	}
+	return &EncryptedFormat{
+		inner:    inner,
+		key:      key,
+		previous: previous,
+	}, nil
+}
+
+// Inner returns the wrapped format
+func (f *EncryptedFormat) Inner() FileFormat {
+	return f.inner
+}
+
+// withInner returns a format using the same keys around a different inner format
+func (f *EncryptedFormat) withInner(inner FileFormat) *EncryptedFormat {
+	return &EncryptedFormat{inner: inner, key: f.key, previous: f.previous}
+}
+
+// Parse decrypts and parses data. Plaintext input is passed through to the
+// inner format so existing files are encrypted on their next write.
+func (f *EncryptedFormat) Parse(r io.Reader) ([]map[string]any, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data: %w", err)
+	}
+
+	if !isSealed(data) {
+		return f.inner.Parse(bytes.NewReader(data))
+	}
+
+	plaintext, err := f.Open(data)
+	if err != nil {
+		return nil, err
+	}
+	return f.inner.Parse(bytes.NewReader(plaintext))
+}
+
+// Serialize encodes data with the inner format and encrypts it
+func (f *EncryptedFormat) Serialize(w io.Writer, data []map[string]any) error {
+	var buf bytes.Buffer
+	if err := f.inner.Serialize(&buf, data); err != nil {
+		return err
+	}
+
+	sealed, err := f.Seal(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(sealed)
+	return err
+}
+
+// Seal encrypts raw bytes with the current key
+func (f *EncryptedFormat) Seal(plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(f.key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	header := append([]byte(encryptionMagic), f.key.ID...)
+	out := append(header, nonce...)
+	return gcm.Seal(out, nonce, plaintext, header), nil
+}
+
+// Open decrypts bytes produced by Seal using the current or a previous key
+func (f *EncryptedFormat) Open(data []byte) ([]byte, error) {
+	headerLen := len(encryptionMagic) + keyIDLength
+	if len(data) < headerLen || !bytes.HasPrefix(data, []byte(encryptionMagic)) {
+		return nil, errors.New("data is not encrypted")
+	}
+
+	keyID := string(data[len(encryptionMagic):headerLen])
+	key := f.keyByID(keyID)
+	if key == nil {
+		return nil, fmt.Errorf("no encryption key available for key id %s", keyID)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < headerLen+gcm.NonceSize() {
+		return nil, errors.New("encrypted data is truncated")
+	}
+
+	nonce := data[headerLen : headerLen+gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, data[headerLen+gcm.NonceSize():], data[:headerLen])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+	}
+	return plaintext, nil
+}
+
+// keyByID finds the current or previous key with the given id
+func (f *EncryptedFormat) keyByID(id string) *EncryptionKey {
+	if f.key.ID == id {
+		return f.key
+	}
+	for _, key := range f.previous {
+		if key != nil && key.ID == id {
+			return key
+		}
+	}
+	return nil
+}
+
+func (f *EncryptedFormat) Extension() string {
+	return f.inner.Extension()
+}
+
+func (f *EncryptedFormat) ContentType() string {
+	return "application/octet-stream"
+}
+
+// PlainFormat returns the unencrypted format underlying a possibly encrypted one
+func PlainFormat(format FileFormat) FileFormat {
+	if encrypted, ok := format.(*EncryptedFormat); ok {
+		return encrypted.inner
+	}
+	return format
+}
+
+// isSealed reports whether data starts with the encryption header
+func isSealed(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptionMagic))
+}
+
+// newGCM creates an AES-GCM cipher for a key
+func newGCM(key *EncryptionKey) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsEncryptedFile reports whether a file starts with the encryption header
+func IsEncryptedFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	header := make([]byte, len(encryptionMagic))
+	if _, err := io.ReadFull(file, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		return false, err
+	}
+	return string(header) == encryptionMagic, nil
+}
+
+// ReEncryptFile parses a file with one format and rewrites it atomically with another.
+// It is used for key rotation and for encrypting existing plaintext files.
+func ReEncryptFile(path string, from, to FileFormat) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	data, err := from.Parse(file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return serializeAtomic(path, to, data)
+}
@@ -0,0 +1,173 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testEncryptionKey returns a key made of one repeated byte
+func testEncryptionKey(t *testing.T, b byte) *EncryptionKey {
+	t.Helper()
+	key, err := NewEncryptionKey(bytes.Repeat([]byte{b}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newTestEncryptedFormat(t *testing.T, key *EncryptionKey, previous ...*EncryptionKey) *EncryptedFormat {
+	t.Helper()
+	format, err := NewEncryptedFormat(&JSONFormat{}, key, previous...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return format
+}
+
+func TestSealOpen(t *testing.T) {
+	format := newTestEncryptedFormat(t, testEncryptionKey(t, 1))
+	plaintext := []byte(`[{"id":1,"password":"secret"}]`)
+
+	sealed, err := format.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("secret")) {
+		t.Error("sealed data contains the plaintext")
+	}
+	again, _ := format.Seal(plaintext)
+	if bytes.Equal(sealed, again) {
+		t.Error("sealing twice gave the same output, nonces are reused")
+	}
+
+	opened, err := format.Open(sealed)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("Open = %q, want %q", opened, plaintext)
+	}
+
+	headerLen := len(encryptionMagic) + keyIDLength
+	tampered := map[string][]byte{
+		"ciphertext": flipByte(sealed, len(sealed)-1),
+		"nonce":      flipByte(sealed, headerLen),
+		"key id":     flipByte(sealed, len(encryptionMagic)),
+		"truncated":  sealed[:headerLen+4],
+		"plaintext":  plaintext,
+	}
+	for name, data := range tampered {
+		if _, err := format.Open(data); err == nil {
+			t.Errorf("Open accepted data with a changed %s", name)
+		}
+	}
+
+	if _, err := newTestEncryptedFormat(t, testEncryptionKey(t, 2)).Open(sealed); err == nil {
+		t.Error("Open succeeded with a different key")
+	}
+}
+
+func flipByte(data []byte, i int) []byte {
+	changed := append([]byte(nil), data...)
+	changed[i] ^= 0xff
+	return changed
+}
+
+func TestEncryptedFormatParse(t *testing.T) {
+	format := newTestEncryptedFormat(t, testEncryptionKey(t, 1))
+	items := []map[string]any{{"id": 1.0, "name": "Ada"}}
+
+	var buf bytes.Buffer
+	if err := format.Serialize(&buf, items); err != nil {
+		t.Fatal(err)
+	}
+	if !isSealed(buf.Bytes()) {
+		t.Fatal("Serialize wrote plaintext")
+	}
+	parsed, err := format.Parse(&buf)
+	if err != nil || !reflect.DeepEqual(parsed, items) {
+		t.Errorf("Parse = %v, %v, want %v", parsed, err, items)
+	}
+
+	// Files written before encryption was turned on are still read
+	parsed, err = format.Parse(strings.NewReader(`[{"id": 1, "name": "Ada"}]`))
+	if err != nil || !reflect.DeepEqual(parsed, items) {
+		t.Errorf("Parse of plaintext = %v, %v, want %v", parsed, err, items)
+	}
+}
+
+func TestParseEncryptionKey(t *testing.T) {
+	raw := bytes.Repeat([]byte{7}, 32)
+	want := testEncryptionKey(t, 7).ID
+
+	for _, encoded := range []string{hex.EncodeToString(raw), base64.StdEncoding.EncodeToString(raw) + "\n"} {
+		key, err := ParseEncryptionKey(encoded)
+		if err != nil || key.ID != want {
+			t.Errorf("ParseEncryptionKey(%q) = %v, %v", encoded, key, err)
+		}
+	}
+	for _, encoded := range []string{"", "not a key", base64.StdEncoding.EncodeToString(raw[:16])} {
+		if _, err := ParseEncryptionKey(encoded); err == nil {
+			t.Errorf("ParseEncryptionKey(%q) succeeded", encoded)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey, newKey := testEncryptionKey(t, 1), testEncryptionKey(t, 2)
+
+	// The previous key is read from its own file, as -previous-key-file does
+	keyFile := filepath.Join(dir, "previous.key")
+	if err := os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	previous, err := LoadEncryptionKeyFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous.ID != oldKey.ID {
+		t.Fatalf("key file loaded key %s, want %s", previous.ID, oldKey.ID)
+	}
+
+	path := filepath.Join(dir, "users.json")
+	items := []map[string]any{{"id": "1", "email": "ada@example.com"}}
+	var buf bytes.Buffer
+	if err := newTestEncryptedFormat(t, oldKey).Serialize(&buf, items); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// During rotation, data sealed with the previous key is still readable
+	rotating := newTestEncryptedFormat(t, newKey, previous)
+	content, _ := os.ReadFile(path)
+	if parsed, err := rotating.Parse(bytes.NewReader(content)); err != nil || !reflect.DeepEqual(parsed, items) {
+		t.Fatalf("Parse with the previous key = %v, %v", parsed, err)
+	}
+	if _, err := newTestEncryptedFormat(t, newKey).Parse(bytes.NewReader(content)); err == nil {
+		t.Fatal("Parse succeeded without the previous key")
+	}
+
+	current := newTestEncryptedFormat(t, newKey)
+	if err := ReEncryptFile(path, rotating, current); err != nil {
+		t.Fatalf("ReEncryptFile: %v", err)
+	}
+	content, _ = os.ReadFile(path)
+	if got := string(content[len(encryptionMagic) : len(encryptionMagic)+keyIDLength]); got != newKey.ID {
+		t.Errorf("re-encrypted file uses key %s, want %s", got, newKey.ID)
+	}
+	if parsed, err := current.Parse(bytes.NewReader(content)); err != nil || !reflect.DeepEqual(parsed, items) {
+		t.Errorf("Parse after rotation = %v, %v", parsed, err)
+	}
+	if _, err := newTestEncryptedFormat(t, oldKey).Parse(bytes.NewReader(content)); err == nil {
+		t.Error("the previous key still opens the re-encrypted file")
+	}
+}
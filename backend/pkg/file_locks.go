@@ -0,0 +1,59 @@
+package pkg
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+var (
+	fileLocksMu sync.Mutex
+	fileLocks   = make(map[string]*sync.RWMutex)
+)
+
+// fileLock returns the lock shared by every file manager of a path
+func fileLock(path string) *sync.RWMutex {
+	fileLocksMu.Lock()
+	defer fileLocksMu.Unlock()
+
+	lock, ok := fileLocks[path]
+	if !ok {
+		lock = &sync.RWMutex{}
+		fileLocks[path] = lock
+	}
+	return lock
+}
+
+// lockFiles locks several files in a fixed order so concurrent callers cannot
+// deadlock. Writers are blocked while the returned function has not been called.
+func lockFiles(paths []string, exclusive bool) func() {
+	sorted := make([]string, 0, len(paths))
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		if abs, err := filepath.Abs(path); err == nil && !seen[abs] {
+			seen[abs] = true
+			sorted = append(sorted, abs)
+		}
+	}
+	sort.Strings(sorted)
+
+	locks := make([]*sync.RWMutex, len(sorted))
+	for i, path := range sorted {
+		locks[i] = fileLock(path)
+		if exclusive {
+			locks[i].Lock()
+		} else {
+			locks[i].RLock()
+		}
+	}
+
+	return func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			if exclusive {
+				locks[i].Unlock()
+			} else {
+				locks[i].RUnlock()
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
@@ -12,17 +13,24 @@ import (
 	"github.com/oarkflow/jsonschema"
 )
 
+// ErrValidation is returned when a write does not match the file's schema
+var ErrValidation = errors.New("validation failed")
+
 // FileManager handles generic file CRUD operations with thread safety
 type FileManager struct {
-	mu             sync.RWMutex
+	// mu is shared by all file managers of the same path
+	mu             *sync.RWMutex
 	filePath       string
 	cache          []map[string]any
 	lastMod        time.Time
 	format         FileFormat
 	registry       *FormatRegistry
 	schema         *jsonschema.Schema
+	coercer        *Coercer
 	versionManager *VersionManager
 	backupManager  *BackupManager
+	// commit describes the next write in version history
+	commit CommitInfo
 }
 
 // NewFileManager creates a new generic file manager instance
@@ -57,6 +65,7 @@ func NewFileManagerWithOptions(filePath string, format FileFormat, versionManage
 	}
 
 	fm := &FileManager{
+		mu:             fileLock(absPath),
 		filePath:       absPath,
 		cache:          make([]map[string]any, 0),
 		format:         format,
@@ -126,29 +135,7 @@ func (fm *FileManager) loadFromFileWithLock(acquireLock bool) error {
 
 // writeToFile writes data to file with atomic write
 func (fm *FileManager) writeToFile(data []map[string]any) error {
-	tmpFile := fm.filePath + ".tmp"
-
-	// Write to temporary file
-	file, err := os.Create(tmpFile)
-	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
-	}
-	defer file.Close()
-
-	if err := fm.format.Serialize(file, data); err != nil {
-		os.Remove(tmpFile)
-		return fmt.Errorf("failed to serialize data: %w", err)
-	}
-
-	file.Close()
-
-	// Atomic rename
-	if err := os.Rename(tmpFile, fm.filePath); err != nil {
-		os.Remove(tmpFile) // Clean up temp file
-		return fmt.Errorf("failed to rename file: %w", err)
-	}
-
-	return nil
+	return serializeAtomic(fm.filePath, fm.format, data)
 }
 
 // refreshCache reloads data if file was modified externally
@@ -173,9 +160,7 @@ func deepCopy(src map[string]any) map[string]any {
 		case map[string]any:
 			dst[k] = deepCopy(val)
 		case []any:
-			arr := make([]any, len(val))
-			copy(arr, val)
-			dst[k] = arr
+			dst[k] = deepCopyValue(val)
 		default:
 			dst[k] = v
 		}
@@ -192,12 +177,8 @@ func (fm *FileManager) Create(item map[string]any) error {
 		return err
 	}
 
-	// Validate if schema is set
-	if fm.schema != nil {
-		result := fm.schema.Validate(item)
-		if !result.IsValid() {
-			return fmt.Errorf("validation failed: %v", result.Errors)
-		}
+	if err := fm.validateItem(item); err != nil {
+		return err
 	}
 
 	fm.cache = append(fm.cache, deepCopy(item))
@@ -207,14 +188,7 @@ func (fm *FileManager) Create(item map[string]any) error {
 	}
 
 	// Create backup and version after successful write
-	if _, err := fm.CreateBackup(); err != nil {
-		// Log error but don't fail the operation
-		fmt.Printf("Warning: Failed to create backup: %v\n", err)
-	}
-	if err := fm.CreateVersion(); err != nil {
-		// Log error but don't fail the operation
-		fmt.Printf("Warning: Failed to create version: %v\n", err)
-	}
+	fm.snapshot(OperationCreate, itemIDs(item))
 
 	return fm.loadFromFileWithLock(false)
 }
@@ -228,6 +202,10 @@ func (fm *FileManager) CreateBatch(items []map[string]any) error {
 		return err
 	}
 
+	if err := fm.validateItems(items); err != nil {
+		return err
+	}
+
 	for _, item := range items {
 		fm.cache = append(fm.cache, deepCopy(item))
 	}
@@ -235,6 +213,7 @@ func (fm *FileManager) CreateBatch(items []map[string]any) error {
 	if err := fm.writeToFile(fm.cache); err != nil {
 		return err
 	}
+	fm.snapshot(OperationBulk, itemIDs(items...))
 
 	return fm.loadFromFileWithLock(false)
 }
@@ -336,12 +315,8 @@ func (fm *FileManager) Update(index int, updatedItem map[string]any) error {
 		return errors.New("index out of bounds")
 	}
 
-	// Validate if schema is set
-	if fm.schema != nil {
-		result := fm.schema.Validate(updatedItem)
-		if !result.IsValid() {
-			return fmt.Errorf("validation failed: %v", result.Errors)
-		}
+	if err := fm.validateItem(updatedItem); err != nil {
+		return err
 	}
 
 	fm.cache[index] = deepCopy(updatedItem)
@@ -351,14 +326,7 @@ func (fm *FileManager) Update(index int, updatedItem map[string]any) error {
 	}
 
 	// Create backup and version after successful write
-	if _, err := fm.CreateBackup(); err != nil {
-		// Log error but don't fail the operation
-		fmt.Printf("Warning: Failed to create backup: %v\n", err)
-	}
-	if err := fm.CreateVersion(); err != nil {
-		// Log error but don't fail the operation
-		fmt.Printf("Warning: Failed to create version: %v\n", err)
-	}
+	fm.snapshot(OperationUpdate, itemIDs(updatedItem))
 
 	return fm.loadFromFileWithLock(false)
 }
@@ -372,21 +340,30 @@ func (fm *FileManager) UpdateBy(predicate func(map[string]any) bool, updateFn fu
 		return 0, err
 	}
 
-	count := 0
+	// Changes are applied to a copy so a failed validation leaves the cache untouched
+	updated := make([]map[string]any, len(fm.cache))
+	copy(updated, fm.cache)
+	var changed []map[string]any
 	for i, item := range fm.cache {
 		if predicate(item) {
-			fm.cache[i] = deepCopy(updateFn(item))
-			count++
+			updated[i] = deepCopy(updateFn(deepCopy(item)))
+			changed = append(changed, updated[i])
 		}
 	}
 
+	count := len(changed)
 	if count == 0 {
 		return 0, errors.New("no items matched")
 	}
+	if err := fm.validateItems(changed); err != nil {
+		return 0, err
+	}
+	fm.cache = updated
 
 	if err := fm.writeToFile(fm.cache); err != nil {
 		return 0, err
 	}
+	fm.snapshot(OperationBulk, itemIDs(changed...))
 
 	if err := fm.loadFromFileWithLock(false); err != nil {
 		return 0, err
@@ -415,14 +392,20 @@ func (fm *FileManager) Patch(index int, updates map[string]any) error {
 		return errors.New("index out of bounds")
 	}
 
-	// Merge updates into existing item
+	// Merge updates into a copy of the existing item
+	patched := deepCopy(fm.cache[index])
 	for k, v := range updates {
-		fm.cache[index][k] = v
+		patched[k] = v
 	}
+	if err := fm.validateItem(patched); err != nil {
+		return err
+	}
+	fm.cache[index] = patched
 
 	if err := fm.writeToFile(fm.cache); err != nil {
 		return err
 	}
+	fm.snapshot(OperationUpdate, itemIDs(fm.cache[index]))
 
 	return fm.loadFromFileWithLock(false)
 }
@@ -436,23 +419,34 @@ func (fm *FileManager) PatchBy(predicate func(map[string]any) bool, updates map[
 		return 0, err
 	}
 
-	count := 0
+	// Changes are applied to a copy so a failed validation leaves the cache untouched
+	updated := make([]map[string]any, len(fm.cache))
+	copy(updated, fm.cache)
+	var changed []map[string]any
 	for i, item := range fm.cache {
 		if predicate(item) {
+			patched := deepCopy(item)
 			for k, v := range updates {
-				fm.cache[i][k] = v
+				patched[k] = v
 			}
-			count++
+			updated[i] = patched
+			changed = append(changed, patched)
 		}
 	}
 
+	count := len(changed)
 	if count == 0 {
 		return 0, errors.New("no items matched")
 	}
+	if err := fm.validateItems(changed); err != nil {
+		return 0, err
+	}
+	fm.cache = updated
 
 	if err := fm.writeToFile(fm.cache); err != nil {
 		return 0, err
 	}
+	fm.snapshot(OperationBulk, itemIDs(changed...))
 
 	if err := fm.loadFromFileWithLock(false); err != nil {
 		return 0, err
@@ -474,6 +468,7 @@ func (fm *FileManager) Delete(index int) error {
 		return errors.New("index out of bounds")
 	}
 
+	deleted := fm.cache[index]
 	fm.cache = append(fm.cache[:index], fm.cache[index+1:]...)
 
 	if err := fm.writeToFile(fm.cache); err != nil {
@@ -481,14 +476,7 @@ func (fm *FileManager) Delete(index int) error {
 	}
 
 	// Create backup and version after successful write
-	if _, err := fm.CreateBackup(); err != nil {
-		// Log error but don't fail the operation
-		fmt.Printf("Warning: Failed to create backup: %v\n", err)
-	}
-	if err := fm.CreateVersion(); err != nil {
-		// Log error but don't fail the operation
-		fmt.Printf("Warning: Failed to create version: %v\n", err)
-	}
+	fm.snapshot(OperationDelete, itemIDs(deleted))
 
 	return fm.loadFromFileWithLock(false)
 }
@@ -503,11 +491,13 @@ func (fm *FileManager) DeleteBy(predicate func(map[string]any) bool) (int, error
 	}
 
 	newCache := make([]map[string]any, 0, len(fm.cache))
+	var deleted []map[string]any
 	count := 0
 	for _, item := range fm.cache {
 		if !predicate(item) {
 			newCache = append(newCache, item)
 		} else {
+			deleted = append(deleted, item)
 			count++
 		}
 	}
@@ -521,6 +511,7 @@ func (fm *FileManager) DeleteBy(predicate func(map[string]any) bool) (int, error
 	if err := fm.writeToFile(fm.cache); err != nil {
 		return 0, err
 	}
+	fm.snapshot(OperationDelete, itemIDs(deleted...))
 
 	if err := fm.loadFromFileWithLock(false); err != nil {
 		return 0, err
@@ -558,6 +549,7 @@ func (fm *FileManager) Clear() error {
 	if err := fm.writeToFile(fm.cache); err != nil {
 		return err
 	}
+	fm.snapshot(OperationBulk, nil)
 
 	return fm.loadFromFileWithLock(false)
 }
@@ -567,6 +559,10 @@ func (fm *FileManager) Replace(items []map[string]any) error {
 	fm.mu.Lock()
 	defer fm.mu.Unlock()
 
+	if err := fm.validateItems(items); err != nil {
+		return err
+	}
+
 	newCache := make([]map[string]any, len(items))
 	for i, item := range items {
 		newCache[i] = deepCopy(item)
@@ -577,6 +573,7 @@ func (fm *FileManager) Replace(items []map[string]any) error {
 	if err := fm.writeToFile(fm.cache); err != nil {
 		return err
 	}
+	fm.snapshot(OperationBulk, nil)
 
 	return fm.loadFromFileWithLock(false)
 }
@@ -605,6 +602,56 @@ func (fm *FileManager) SetBackupManager(bm *BackupManager) {
 	fm.backupManager = bm
 }
 
+// SetCommitInfo sets the author, message and operation recorded with the next version.
+// Empty operation and affected ids are filled in by the write method.
+func (fm *FileManager) SetCommitInfo(info CommitInfo) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	fm.commit = info
+}
+
+// takeCommitInfo returns the pending commit info with defaults applied and clears it.
+// Callers must hold the write lock.
+func (fm *FileManager) takeCommitInfo(operation string, ids []string) CommitInfo {
+	info := fm.commit
+	fm.commit = CommitInfo{}
+	if info.Operation == "" {
+		info.Operation = operation
+	}
+	if len(info.AffectedIDs) == 0 {
+		info.AffectedIDs = ids
+	}
+	return info
+}
+
+// itemIDs collects the "id" values of items that have one
+func itemIDs(items ...map[string]any) []string {
+	var ids []string
+	for _, item := range items {
+		if id, ok := item["id"]; ok && id != nil {
+			ids = append(ids, fmt.Sprintf("%v", id))
+		}
+	}
+	return ids
+}
+
+// snapshot records a backup and a version of the cached data when the
+// managers are configured. Failures are logged but don't fail the operation.
+// Callers must hold the write lock.
+func (fm *FileManager) snapshot(operation string, ids []string) {
+	info := fm.takeCommitInfo(operation, ids)
+	if fm.backupManager != nil {
+		if _, err := fm.backupManager.CreateBackup(fm.filePath, fm.cache, fm.format); err != nil {
+			fmt.Printf("Warning: Failed to create backup: %v\n", err)
+		}
+	}
+	if fm.versionManager != nil {
+		if err := fm.versionManager.CreateVersionWithInfo(fm.filePath, fm.cache, fm.format, info); err != nil {
+			fmt.Printf("Warning: Failed to create version: %v\n", err)
+		}
+	}
+}
+
 // CreateVersion creates a version of the current data
 func (fm *FileManager) CreateVersion() error {
 	if fm.versionManager == nil {
@@ -638,20 +685,192 @@ func (fm *FileManager) ListVersions() ([]VersionInfo, error) {
 	return fm.versionManager.ListVersions(fm.filePath)
 }
 
-// RestoreVersion restores a specific version
-func (fm *FileManager) RestoreVersion(versionPath string) error {
+// RestoreVersion restores the version with the given id
+func (fm *FileManager) RestoreVersion(id string) error {
+	if fm.versionManager == nil {
+		return errors.New("version manager not set")
+	}
+
+	// Versions may be stored as deltas, so they are rebuilt rather than copied
+	data, err := fm.versionManager.LoadVersion(fm.filePath, id, fm.format)
+	if err != nil {
+		return err
+	}
+
 	fm.mu.Lock()
 	defer fm.mu.Unlock()
+	return fm.restoreData(data)
+}
 
+// restoreData validates a snapshot's data, backs up the current data and atomically
+// replaces it. The restore is recorded as a new version. Callers must hold the write lock.
+func (fm *FileManager) restoreData(data []map[string]any) error {
+	if err := fm.validateItems(data); err != nil {
+		return err
+	}
+	backupID, err := fm.backupBeforeRestore()
+	if err != nil {
+		return err
+	}
+	if err := fm.writeToFile(data); err != nil {
+		return err
+	}
+	if err := fm.loadFromFileWithLock(false); err != nil {
+		return err
+	}
+	fm.commit.PreRestoreBackup = backupID
+	fm.snapshot(OperationRestore, nil)
+	return nil
+}
+
+// backupBeforeRestore backs up the current data so a restore can be undone, and
+// returns the backup's id. Callers must hold the write lock.
+func (fm *FileManager) backupBeforeRestore() (string, error) {
+	if fm.backupManager == nil {
+		return "", nil
+	}
+	if err := fm.refreshCache(); err != nil {
+		return "", err
+	}
+
+	record, err := fm.backupManager.createBackup(fm.filePath, fm.cache, fm.format)
+	if err != nil {
+		return "", fmt.Errorf("failed to back up current data: %w", err)
+	}
+	return record.ID, nil
+}
+
+// FindVersion returns the version with the given id or file name
+func (fm *FileManager) FindVersion(id string) (*VersionInfo, error) {
+	if fm.versionManager == nil {
+		return nil, errors.New("version manager not set")
+	}
+
+	return fm.versionManager.FindVersion(fm.filePath, id)
+}
+
+// ReadVersion returns the data stored in a version
+func (fm *FileManager) ReadVersion(id string) ([]map[string]any, error) {
+	if fm.versionManager == nil {
+		return nil, errors.New("version manager not set")
+	}
+
+	return fm.versionManager.LoadVersion(fm.filePath, id, fm.format)
+}
+
+// CurrentVersion names the live file in version diffs
+const CurrentVersion = "current"
+
+// readVersionOrCurrent returns the data of a version, or the live data for "current"
+func (fm *FileManager) readVersionOrCurrent(name string) ([]map[string]any, error) {
+	if name == "" || name == CurrentVersion {
+		return fm.Read()
+	}
+	return fm.ReadVersion(name)
+}
+
+// DiffVersions returns the structured difference between two versions, matching items on primaryKey.
+// Either side may be CurrentVersion to compare against the live file.
+func (fm *FileManager) DiffVersions(from, to, primaryKey string) (*DataDiff, error) {
+	fromData, err := fm.readVersionOrCurrent(from)
+	if err != nil {
+		return nil, err
+	}
+	toData, err := fm.readVersionOrCurrent(to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := DiffData(fromData, toData, primaryKey)
+	diff.From = from
+	diff.To = to
+	return diff, nil
+}
+
+// UnifiedDiff returns a unified text diff between two versions serialized in the file's plain format
+func (fm *FileManager) UnifiedDiff(from, to string, context int) (string, error) {
+	fromData, err := fm.readVersionOrCurrent(from)
+	if err != nil {
+		return "", err
+	}
+	toData, err := fm.readVersionOrCurrent(to)
+	if err != nil {
+		return "", err
+	}
+
+	format := PlainFormat(fm.format)
+	var fromBuf, toBuf bytes.Buffer
+	if err := format.Serialize(&fromBuf, fromData); err != nil {
+		return "", err
+	}
+	if err := format.Serialize(&toBuf, toData); err != nil {
+		return "", err
+	}
+
+	return UnifiedDiff(from, to, fromBuf.Bytes(), toBuf.Bytes(), context), nil
+}
+
+// VerifyHistory checks the integrity of all stored versions and backups
+func (fm *FileManager) VerifyHistory() (versions, backups []IntegrityIssue, err error) {
+	if fm.versionManager != nil {
+		if versions, err = fm.versionManager.Verify(fm.filePath, fm.format); err != nil {
+			return nil, nil, err
+		}
+	}
+	if fm.backupManager != nil {
+		if backups, err = fm.backupManager.Verify(fm.filePath, fm.format); err != nil {
+			return nil, nil, err
+		}
+	}
+	return versions, backups, nil
+}
+
+// PruneVersions applies the version retention policy, reporting what was or would be removed
+func (fm *FileManager) PruneVersions(dryRun bool) (*PruneReport, error) {
+	if fm.versionManager == nil {
+		return nil, errors.New("version manager not set")
+	}
+	return fm.versionManager.Prune(fm.filePath, fm.format, dryRun)
+}
+
+// PinVersion exempts a version from pruning, or removes the exemption
+func (fm *FileManager) PinVersion(id string, pinned bool) error {
 	if fm.versionManager == nil {
 		return errors.New("version manager not set")
 	}
+	return fm.versionManager.Pin(fm.filePath, id, pinned)
+}
 
-	if err := fm.versionManager.RestoreVersion(versionPath, fm.filePath, fm.format); err != nil {
-		return err
+// TagVersion adds or removes a tag on a version
+func (fm *FileManager) TagVersion(id, tag string, add bool) error {
+	if fm.versionManager == nil {
+		return errors.New("version manager not set")
 	}
+	return fm.versionManager.Tag(fm.filePath, id, tag, add)
+}
 
-	return fm.loadFromFileWithLock(false)
+// PruneBackups applies the backup retention policy, reporting what was or would be removed
+func (fm *FileManager) PruneBackups(dryRun bool) (*PruneReport, error) {
+	if fm.backupManager == nil {
+		return nil, errors.New("backup manager not set")
+	}
+	return fm.backupManager.Prune(fm.filePath, dryRun)
+}
+
+// PinBackup exempts a backup from pruning, or removes the exemption
+func (fm *FileManager) PinBackup(id string, pinned bool) error {
+	if fm.backupManager == nil {
+		return errors.New("backup manager not set")
+	}
+	return fm.backupManager.Pin(fm.filePath, id, pinned)
+}
+
+// TagBackup adds or removes a tag on a backup
+func (fm *FileManager) TagBackup(id, tag string, add bool) error {
+	if fm.backupManager == nil {
+		return errors.New("backup manager not set")
+	}
+	return fm.backupManager.Tag(fm.filePath, id, tag, add)
 }
 
 // ListBackups returns all backups
@@ -665,18 +884,32 @@ func (fm *FileManager) ListBackups() ([]BackupInfo, error) {
 
 // RestoreBackup restores a specific backup
 func (fm *FileManager) RestoreBackup(backupPath string) error {
+	data, err := fm.ReadBackup(filepath.Base(backupPath))
+	if err != nil {
+		return err
+	}
+
 	fm.mu.Lock()
 	defer fm.mu.Unlock()
+	return fm.restoreData(data)
+}
 
+// FindBackup returns the backup with the given id or file name
+func (fm *FileManager) FindBackup(id string) (*BackupInfo, error) {
 	if fm.backupManager == nil {
-		return errors.New("backup manager not set")
+		return nil, errors.New("backup manager not set")
 	}
 
-	if err := fm.backupManager.RestoreBackup(backupPath, fm.filePath, fm.format); err != nil {
-		return err
+	return fm.backupManager.FindBackup(fm.filePath, id)
+}
+
+// ReadBackup returns the data stored in a backup
+func (fm *FileManager) ReadBackup(id string) ([]map[string]any, error) {
+	if fm.backupManager == nil {
+		return nil, errors.New("backup manager not set")
 	}
 
-	return fm.loadFromFileWithLock(false)
+	return fm.backupManager.LoadBackup(fm.filePath, id, fm.format)
 }
 
 // SetSchema sets a validation schema for the file manager
@@ -689,8 +922,18 @@ func (fm *FileManager) GetSchema() *jsonschema.Schema {
 	return fm.schema
 }
 
-// ValidateData validates all cached data against the schema
-func (fm *FileManager) ValidateData() []error {
+// UseSchema validates writes against a sidecar schema and converts their text input
+// to the schema's types. A nil schema turns both off.
+func (fm *FileManager) UseSchema(schema *FileSchema) {
+	fm.schema, fm.coercer = nil, nil
+	if schema != nil {
+		fm.schema, fm.coercer = schema.Compiled(), schema.Coercer()
+	}
+}
+
+// ValidateData validates all cached data against the schema, as it would be written
+// after coercion. Paths start with the item's index.
+func (fm *FileManager) ValidateData() ValidationErrors {
 	fm.mu.RLock()
 	defer fm.mu.RUnlock()
 
@@ -698,19 +941,53 @@ func (fm *FileManager) ValidateData() []error {
 		return nil
 	}
 
-	var allErrors []error
+	items := make([]map[string]any, len(fm.cache))
 	for i, item := range fm.cache {
-		result := fm.schema.Validate(item)
-		if !result.IsValid() {
-			for _, err := range result.Errors {
-				// Add item index to error message
-				allErrors = append(allErrors, fmt.Errorf("item %d: %v", i, err))
-			}
-		}
+		items[i] = deepCopy(item)
+	}
+	return fm.schemaErrors(items)
+}
+
+// schemaErrors coerces items in place and lists every value that cannot be converted
+// or does not match the schema, with paths starting at the item's index
+func (fm *FileManager) schemaErrors(items []map[string]any) ValidationErrors {
+	var allErrors ValidationErrors
+	for i, item := range items {
+		allErrors = append(allErrors, fm.itemErrors(item, fmt.Sprintf("/%d", i))...)
 	}
 	return allErrors
 }
 
+// itemErrors coerces an item in place and validates it. Values that cannot be
+// converted are not validated further.
+func (fm *FileManager) itemErrors(item map[string]any, prefix string) ValidationErrors {
+	if fm.coercer != nil {
+		if violations := fm.coercer.coerce(item, prefix); len(violations) > 0 {
+			return violations
+		}
+	}
+	if fm.schema == nil {
+		return nil
+	}
+	return schemaViolations(fm.schema, item, prefix)
+}
+
+// validateItems coerces items to the schema's types in place and checks them against it
+func (fm *FileManager) validateItems(items []map[string]any) error {
+	if violations := fm.schemaErrors(items); len(violations) > 0 {
+		return violations
+	}
+	return nil
+}
+
+// validateItem coerces one item in place and checks it. Paths are relative to the item.
+func (fm *FileManager) validateItem(item map[string]any) error {
+	if violations := fm.itemErrors(item, ""); len(violations) > 0 {
+		return violations
+	}
+	return nil
+}
+
 // Remove SanitizeData since jsonschema doesn't provide sanitization
 
 // ConvertFormat converts the file to a new format
@@ -842,27 +1119,7 @@ func (fm *FileManager) Backup(backupPath string) error {
 
 // writeToFileWithPath writes data to a specific path
 func (fm *FileManager) writeToFileWithPath(filePath string, data []map[string]any) error {
-	tmpFile := filePath + ".tmp"
-
-	file, err := os.Create(tmpFile)
-	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
-	}
-	defer file.Close()
-
-	if err := fm.format.Serialize(file, data); err != nil {
-		os.Remove(tmpFile)
-		return fmt.Errorf("failed to serialize data: %w", err)
-	}
-
-	file.Close()
-
-	if err := os.Rename(tmpFile, filePath); err != nil {
-		os.Remove(tmpFile)
-		return fmt.Errorf("failed to rename file: %w", err)
-	}
-
-	return nil
+	return serializeAtomic(filePath, fm.format, data)
 }
 
 // Validate checks data against a validation function
@@ -964,5 +1221,19 @@ func (fm *FileManager) Save(data interface{}) error {
 		return fmt.Errorf("unsupported data type for Save")
 	}
 
-	return fm.writeToFile(items)
+	if err := fm.validateItems(items); err != nil {
+		return err
+	}
+
+	if err := fm.writeToFile(items); err != nil {
+		return err
+	}
+
+	if err := fm.loadFromFileWithLock(false); err != nil {
+		return err
+	}
+
+	// Create backup and version after successful write
+	fm.snapshot(OperationBulk, nil)
+	return nil
 }
@@ -2,9 +2,11 @@ package pkg
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -42,6 +44,11 @@ func NewMetadataExtractor() *MetadataExtractor {
 
 // ExtractMetadata extracts comprehensive metadata from a file
 func (me *MetadataExtractor) ExtractMetadata(filePath string) (*FileMetadata, error) {
+	return me.ExtractMetadataWithFormat(filePath, nil)
+}
+
+// ExtractMetadataWithFormat extracts metadata reading the file with a specific format
+func (me *MetadataExtractor) ExtractMetadataWithFormat(filePath string, fileFormat FileFormat) (*FileMetadata, error) {
 	// Get basic file information
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
@@ -53,7 +60,7 @@ func (me *MetadataExtractor) ExtractMetadata(filePath string) (*FileMetadata, er
 	format := strings.TrimPrefix(ext, ".")
 
 	// Create file manager
-	fm, err := NewFileManager(filePath)
+	fm, err := NewFileManagerWithFormat(filePath, fileFormat)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create file manager: %w", err)
 	}
@@ -355,11 +362,17 @@ func (me *MetadataExtractor) generateValidationInfo(data []map[string]interface{
 		validation["missingRequiredFields"] = missingRequired
 	}
 
-	// Check for data type consistency
+	// Check for data type consistency. Fields with values of several types, at
+	// any depth, are reported separately, naming the items to normalize.
 	typeIssues := make(map[string][]int)
+	var mixedTypes []MixedTypeReport
+	me.collectMixedTypes(data, schema.Properties, schema.PrimaryKey, "", &mixedTypes)
 	for i, item := range data {
 		for _, field := range schema.Fields {
-			if value, exists := item[field.Name]; exists {
+			if field.Mixed() {
+				continue
+			}
+			if value, exists := item[field.Name]; exists && !(value == nil && field.Nullable) {
 				if !me.isValidType(value, field.Type) {
 					if typeIssues[field.Name] == nil {
 						typeIssues[field.Name] = []int{}
@@ -373,12 +386,108 @@ func (me *MetadataExtractor) generateValidationInfo(data []map[string]interface{
 	if len(typeIssues) > 0 {
 		validation["typeInconsistencies"] = typeIssues
 	}
+	if len(mixedTypes) > 0 {
+		validation["mixedTypes"] = mixedTypes
+	}
 
-	validation["isValid"] = len(missingRequired) == 0 && len(typeIssues) == 0
+	validation["isValid"] = len(missingRequired) == 0 && len(typeIssues) == 0 && len(mixedTypes) == 0
 
 	return validation
 }
 
+// MixedTypeReport describes a field whose values have more than one type
+type MixedTypeReport struct {
+	// Field is the path of the field, such as items[].dietaryInfo for a field of array elements
+	Field string            `json:"field"`
+	Types map[FieldType]int `json:"types"`
+	// Expected is the most common type, which the other values could be normalized to
+	Expected FieldType `json:"expected"`
+	// Items identifies the items with values of other types by primary key, or by index without one
+	Items []string `json:"items"`
+}
+
+// collectMixedTypes reports the mixed-type fields of objects and of the objects
+// nested in them. Items are identified by the key of the objects holding the field.
+func (me *MetadataExtractor) collectMixedTypes(objects []map[string]interface{}, fields map[string]*FieldInfo, primaryKey, prefix string, reports *[]MixedTypeReport) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field := fields[name]
+		path := prefix + name
+
+		if field.Mixed() {
+			*reports = append(*reports, me.mixedTypeReport(objects, primaryKey, name, path, field, func(value interface{}) bool {
+				return value == nil || me.isValidType(value, field.Type)
+			}))
+		}
+		if field.Items != nil && field.Items.Mixed() {
+			*reports = append(*reports, me.mixedTypeReport(objects, primaryKey, name, path+"[]", field.Items, func(value interface{}) bool {
+				elements, _ := value.([]interface{})
+				for _, element := range elements {
+					if element != nil && !me.isValidType(element, field.Items.Type) {
+						return false
+					}
+				}
+				return true
+			}))
+		}
+
+		// Descend into nested objects and arrays of objects
+		var nested []map[string]interface{}
+		for _, object := range objects {
+			switch v := object[name].(type) {
+			case map[string]interface{}:
+				nested = append(nested, v)
+			case []interface{}:
+				for _, element := range v {
+					if child, ok := element.(map[string]interface{}); ok {
+						nested = append(nested, child)
+					}
+				}
+			}
+		}
+		if len(field.Properties) > 0 {
+			me.collectMixedTypes(nested, field.Properties, me.nestedPrimaryKey(field.Properties), path+".", reports)
+		}
+		if field.Items != nil && len(field.Items.Properties) > 0 {
+			me.collectMixedTypes(nested, field.Items.Properties, me.nestedPrimaryKey(field.Items.Properties), path+"[].", reports)
+		}
+	}
+}
+
+// nestedPrimaryKey returns the field identifying nested objects, such as their id
+func (me *MetadataExtractor) nestedPrimaryKey(properties map[string]*FieldInfo) string {
+	fields := make([]*FieldInfo, 0, len(properties))
+	for _, field := range properties {
+		fields = append(fields, field)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+	return me.schemaGenerator.findPrimaryKey(fields)
+}
+
+// mixedTypeReport lists the objects whose value of the named field is not consistent with its most common type
+func (me *MetadataExtractor) mixedTypeReport(objects []map[string]interface{}, primaryKey, name, path string, field *FieldInfo, consistent func(interface{}) bool) MixedTypeReport {
+	report := MixedTypeReport{Field: path, Types: field.Types, Expected: field.Type, Items: []string{}}
+	for i, object := range objects {
+		value, exists := object[name]
+		if !exists || consistent(value) {
+			continue
+		}
+		id := strconv.Itoa(i)
+		if key, ok := object[primaryKey]; ok && primaryKey != "" {
+			id = fmt.Sprintf("%v", key)
+		}
+		report.Items = append(report.Items, id)
+	}
+	return report
+}
+
 // isValidType checks if a value matches the expected type
 func (me *MetadataExtractor) isValidType(value interface{}, fieldType FieldType) bool {
 	switch fieldType {
@@ -386,12 +495,17 @@ func (me *MetadataExtractor) isValidType(value interface{}, fieldType FieldType)
 		_, ok := value.(string)
 		return ok
 	case FieldTypeInteger:
-		switch value.(type) {
+		switch v := value.(type) {
 		case int, int8, int16, int32, int64:
 			return true
+		case float64:
+			// JSON decodes every number as a float
+			return v == math.Trunc(v)
 		default:
 			return false
 		}
+	case FieldTypeNull:
+		return value == nil
 	case FieldTypeNumber:
 		switch value.(type) {
 		case int, int8, int16, int32, int64, float32, float64:
@@ -458,7 +572,12 @@ func (me *MetadataExtractor) ExtractMetadataFromDirectory(dirPath string) (map[s
 
 // GetFileStructure returns a summary of file structure
 func (me *MetadataExtractor) GetFileStructure(filePath string) (map[string]interface{}, error) {
-	metadata, err := me.ExtractMetadata(filePath)
+	return me.GetFileStructureWithFormat(filePath, nil)
+}
+
+// GetFileStructureWithFormat returns a summary of file structure reading the file with a specific format
+func (me *MetadataExtractor) GetFileStructureWithFormat(filePath string, fileFormat FileFormat) (map[string]interface{}, error) {
+	metadata, err := me.ExtractMetadataWithFormat(filePath, fileFormat)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,702 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MigrationHistorySuffix names the migration history kept next to a data file, e.g. menu.json.migrations.json
+const MigrationHistorySuffix = ".migrations.json"
+
+// Transform operations
+const (
+	// TransformRename moves a field to the name in To
+	TransformRename = "rename"
+	// TransformCast converts a value to Type: string, integer, number or boolean
+	TransformCast = "cast"
+	// TransformSplit splits a string into an array on Separator (default ",")
+	TransformSplit = "split"
+	// TransformDefault sets Value where the field is missing or null
+	TransformDefault = "default"
+	// TransformCurrency converts an amount such as "$1,299.99" to a number
+	TransformCurrency = "currency"
+	// TransformWrap puts a scalar value into a one-element array
+	TransformWrap = "wrap"
+)
+
+// What a transform does with a value it cannot convert
+const (
+	OnErrorFail = "fail"
+	OnErrorSkip = "skip"
+)
+
+var (
+	// ErrInvalidMigration is returned when a migration is malformed
+	ErrInvalidMigration = errors.New("invalid migration")
+	// ErrMigrationFailed is returned when a migration cannot convert some values
+	ErrMigrationFailed = errors.New("migration failed")
+	// ErrMigrationNotFound is returned when no applied migration has the given id
+	ErrMigrationNotFound = errors.New("migration not found")
+	// ErrMigrationConflict is returned when a migration cannot be rolled back safely
+	ErrMigrationConflict = errors.New("migration cannot be rolled back")
+)
+
+// Transform changes one field of every item. Field is a path such as "price",
+// "details.size" or "items[].dietaryInfo", where [] steps into each element of an array.
+type Transform struct {
+	Op        string    `json:"op"`
+	Field     string    `json:"field"`
+	To        string    `json:"to,omitempty"`
+	Type      FieldType `json:"type,omitempty"`
+	Separator string    `json:"separator,omitempty"`
+	Value     any       `json:"value,omitempty"`
+	// OnError is "fail" (the default) to reject the migration, or "skip" to leave the value as it is
+	OnError string `json:"onError,omitempty"`
+}
+
+// Migration is a named list of transforms applied in order
+type Migration struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Transforms  []Transform `json:"transforms"`
+	// Schema optionally replaces the file's schema sidecar; the migrated data is validated against it
+	Schema json.RawMessage `json:"schema,omitempty"`
+}
+
+// MigrationIssue is a value a transform could not convert
+type MigrationIssue struct {
+	Path    string `json:"path"`
+	Op      string `json:"op"`
+	Value   any    `json:"value"`
+	Error   string `json:"error"`
+	Skipped bool   `json:"skipped"`
+}
+
+// MigrationPreview shows what a migration would change without writing anything
+type MigrationPreview struct {
+	// Changed is the number of items the migration modifies
+	Changed    int              `json:"changed"`
+	Diff       *DataDiff        `json:"diff"`
+	Issues     []MigrationIssue `json:"issues"`
+	Violations ValidationErrors `json:"violations"`
+}
+
+// MigrationRecord is an applied migration in a file's history
+type MigrationRecord struct {
+	Migration
+	ID string `json:"id"`
+	// Version numbers the file's migrations from 1
+	Version    int       `json:"version"`
+	AppliedAt  time.Time `json:"appliedAt"`
+	Author     string    `json:"author,omitempty"`
+	AuthorName string    `json:"authorName,omitempty"`
+	// VersionBefore is the pinned version of the data before the migration, restored on rollback
+	VersionBefore string   `json:"versionBefore"`
+	VersionAfter  string   `json:"versionAfter"`
+	Changed       int      `json:"changed"`
+	Skipped       []string `json:"skipped,omitempty"`
+	// PreviousSchema is the sidecar the migration's schema replaced, empty when there was none
+	PreviousSchema json.RawMessage `json:"previousSchema,omitempty"`
+	RolledBackAt   *time.Time      `json:"rolledBackAt,omitempty"`
+	RolledBackBy   string          `json:"rolledBackBy,omitempty"`
+}
+
+// MigrationHistoryName returns the migration history name of a data file
+func MigrationHistoryName(filename string) string {
+	return sidecarName(filename, MigrationHistorySuffix)
+}
+
+// Validate checks that every transform is complete and known
+func (m *Migration) Validate() error {
+	if strings.TrimSpace(m.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidMigration)
+	}
+	if len(m.Transforms) == 0 {
+		return fmt.Errorf("%w: at least one transform is required", ErrInvalidMigration)
+	}
+
+	for i, t := range m.Transforms {
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("%w: transform %d: %v", ErrInvalidMigration, i+1, err)
+		}
+	}
+	return nil
+}
+
+func (t *Transform) validate() error {
+	segments := strings.Split(t.Field, ".")
+	for i, segment := range segments {
+		name := strings.TrimSuffix(segment, "[]")
+		if name == "" || strings.Contains(name, "[") || strings.Contains(name, "]") {
+			return fmt.Errorf("invalid field %q", t.Field)
+		}
+		if i == len(segments)-1 && name != segment {
+			return fmt.Errorf("field %q must name a field, not array elements", t.Field)
+		}
+	}
+
+	switch t.Op {
+	case TransformRename:
+		if t.To == "" || strings.ContainsAny(t.To, ".[]") {
+			return fmt.Errorf("rename needs a field name in \"to\"")
+		}
+	case TransformCast:
+		switch t.Type {
+		case FieldTypeString, FieldTypeInteger, FieldTypeNumber, FieldTypeBoolean:
+		default:
+			return fmt.Errorf("cannot cast to %q", t.Type)
+		}
+	case TransformDefault:
+		if t.Value == nil {
+			return fmt.Errorf("default needs a value")
+		}
+	case TransformSplit, TransformCurrency, TransformWrap:
+	default:
+		return fmt.Errorf("unknown op %q", t.Op)
+	}
+
+	switch t.OnError {
+	case "", OnErrorFail, OnErrorSkip:
+	default:
+		return fmt.Errorf("onError must be %q or %q", OnErrorFail, OnErrorSkip)
+	}
+	return nil
+}
+
+// apply runs the transforms over data in place and returns the values they could not convert
+func (m *Migration) apply(data []map[string]any) []MigrationIssue {
+	issues := []MigrationIssue{}
+	for _, t := range m.Transforms {
+		segments := strings.Split(t.Field, ".")
+		for i, item := range data {
+			visitField(item, segments, fmt.Sprintf("[%d]", i), func(obj map[string]any, key, path string) {
+				value := obj[key]
+				if err := t.applyTo(obj, key); err != nil {
+					issues = append(issues, MigrationIssue{
+						Path:    path,
+						Op:      t.Op,
+						Value:   value,
+						Error:   err.Error(),
+						Skipped: t.OnError == OnErrorSkip,
+					})
+				}
+			})
+		}
+	}
+	return issues
+}
+
+// visitField calls fn with each object that holds the field at the end of segments.
+// Objects without the path are left alone.
+func visitField(obj map[string]any, segments []string, path string, fn func(obj map[string]any, key, path string)) {
+	name := strings.TrimSuffix(segments[0], "[]")
+	path += "." + name
+	if len(segments) == 1 {
+		fn(obj, name, path)
+		return
+	}
+
+	switch child := obj[name].(type) {
+	case map[string]any:
+		if name == segments[0] {
+			visitField(child, segments[1:], path, fn)
+		}
+	case []any:
+		if name == segments[0] {
+			return
+		}
+		for i, element := range child {
+			if nested, ok := element.(map[string]any); ok {
+				visitField(nested, segments[1:], fmt.Sprintf("%s[%d]", path, i), fn)
+			}
+		}
+	}
+}
+
+// applyTo transforms the field key of obj. Missing and null values are only touched by defaults.
+func (t *Transform) applyTo(obj map[string]any, key string) error {
+	value, exists := obj[key]
+	switch t.Op {
+	case TransformRename:
+		if !exists {
+			return nil
+		}
+		if _, taken := obj[t.To]; taken {
+			return fmt.Errorf("field %q already exists", t.To)
+		}
+		obj[t.To] = value
+		delete(obj, key)
+		return nil
+	case TransformDefault:
+		if !exists || value == nil {
+			obj[key] = deepCopyValue(t.Value)
+		}
+		return nil
+	}
+
+	if !exists || value == nil {
+		return nil
+	}
+	converted, err := t.convert(value)
+	if err != nil {
+		return err
+	}
+	obj[key] = converted
+	return nil
+}
+
+// convert returns a value transformed by a cast, split, currency or wrap
+func (t *Transform) convert(value any) (any, error) {
+	switch t.Op {
+	case TransformCast:
+		return castValue(value, t.Type)
+	case TransformSplit:
+		switch v := value.(type) {
+		case []any:
+			return v, nil
+		case string:
+			separator := t.Separator
+			if separator == "" {
+				separator = ","
+			}
+			parts := []any{}
+			for _, part := range strings.Split(v, separator) {
+				if part = strings.TrimSpace(part); part != "" {
+					parts = append(parts, part)
+				}
+			}
+			return parts, nil
+		}
+	case TransformCurrency:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			return currencyAmount(v)
+		}
+	case TransformWrap:
+		switch v := value.(type) {
+		case []any:
+			return v, nil
+		case map[string]any:
+		default:
+			return []any{v}, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot %s a value of type %s", t.Op, valueType(value))
+}
+
+// castValue converts a scalar to another scalar type
+func castValue(value any, to FieldType) (any, error) {
+	switch value.(type) {
+	case map[string]any, []any:
+		return nil, fmt.Errorf("cannot cast a value of type %s to %s", valueType(value), to)
+	}
+
+	switch to {
+	case FieldTypeString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		default:
+			return fmt.Sprintf("%v", v), nil
+		}
+
+	case FieldTypeNumber, FieldTypeInteger:
+		var n float64
+		switch v := value.(type) {
+		case float64:
+			n = v
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("not a number")
+			}
+			n = parsed
+		default:
+			return nil, fmt.Errorf("cannot cast a value of type %s to %s", valueType(value), to)
+		}
+		if to == FieldTypeInteger && valueType(n) != FieldTypeInteger {
+			return nil, fmt.Errorf("not a whole number")
+		}
+		return n, nil
+
+	case FieldTypeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("not a boolean")
+			}
+			return b, nil
+		case float64:
+			if v == 0 || v == 1 {
+				return v == 1, nil
+			}
+		}
+		return nil, fmt.Errorf("cannot cast a value of type %s to %s", valueType(value), to)
+	}
+	return nil, fmt.Errorf("cannot cast to %s", to)
+}
+
+// currencyAmount parses a single amount such as "$1,299.99" or "-€5"
+func currencyAmount(s string) (float64, error) {
+	amount := strings.TrimSpace(s)
+	negative := strings.HasPrefix(amount, "-")
+	amount = strings.TrimPrefix(amount, "-")
+	for _, symbol := range []string{"$", "€", "£", "¥"} {
+		amount = strings.TrimPrefix(amount, symbol)
+	}
+	if strings.Contains(amount, "/") {
+		return 0, fmt.Errorf("holds several amounts")
+	}
+
+	n, err := strconv.ParseFloat(strings.ReplaceAll(amount, ",", ""), 64)
+	if err != nil {
+		return 0, fmt.Errorf("not an amount")
+	}
+	if negative {
+		n = -n
+	}
+	return n, nil
+}
+
+// valueType names the JSON type of a value
+func valueType(value any) FieldType {
+	return (&SchemaGenerator{}).inferFieldType(value)
+}
+
+// migrationRun is a migration applied to a copy of the cached data
+type migrationRun struct {
+	data   []map[string]any
+	issues []MigrationIssue
+	diff   *DataDiff
+}
+
+// failed returns the issues that reject the migration
+func (r *migrationRun) failed() []MigrationIssue {
+	var failed []MigrationIssue
+	for _, issue := range r.issues {
+		if !issue.Skipped {
+			failed = append(failed, issue)
+		}
+	}
+	return failed
+}
+
+// skipped returns the paths of values left unchanged
+func (r *migrationRun) skipped() []string {
+	var paths []string
+	for _, issue := range r.issues {
+		if issue.Skipped {
+			paths = append(paths, issue.Path)
+		}
+	}
+	return paths
+}
+
+// runMigration applies a migration to a copy of the cached data. The result is
+// passed through the file's format, so values a format cannot hold, such as
+// numbers in CSV, show up as they will be stored. Callers must hold the write lock.
+func (fm *FileManager) runMigration(m *Migration, primaryKey string) (*migrationRun, error) {
+	if err := fm.refreshCache(); err != nil {
+		return nil, err
+	}
+
+	data := make([]map[string]any, len(fm.cache))
+	for i, item := range fm.cache {
+		data[i] = deepCopy(item)
+	}
+	issues := m.apply(data)
+
+	format := PlainFormat(fm.format)
+	var buf bytes.Buffer
+	if err := format.Serialize(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to serialize migrated data: %w", err)
+	}
+	stored, err := format.Parse(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse migrated data: %w", err)
+	}
+
+	diff := DiffData(fm.cache, stored, primaryKey)
+	diff.From, diff.To = CurrentVersion, "migrated"
+	return &migrationRun{data: stored, issues: issues, diff: diff}, nil
+}
+
+// PreviewMigration returns the changes a migration would make, the values it
+// cannot convert and the schema violations of the result
+func (fm *FileManager) PreviewMigration(m *Migration, primaryKey string) (*MigrationPreview, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	run, err := fm.runMigration(m, primaryKey)
+	if err != nil {
+		return nil, err
+	}
+
+	violations := ValidationErrors{}
+	if fm.schema != nil {
+		violations = append(violations, fm.schemaErrors(run.data)...)
+	}
+	return &MigrationPreview{
+		Changed:    len(run.diff.Modified),
+		Diff:       run.diff,
+		Issues:     run.issues,
+		Violations: violations,
+	}, nil
+}
+
+// Migrate applies a migration, validates the result against the file's schema and records
+// it in the migration history. The version before the migration is pinned so it can be
+// rolled back to. previousSchema is the schema sidecar the migration replaces, if any.
+func (fm *FileManager) Migrate(m *Migration, primaryKey string, previousSchema []byte) (*MigrationRecord, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	if fm.versionManager == nil {
+		return nil, errors.New("version manager not set")
+	}
+
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	history, err := fm.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	run, err := fm.runMigration(m, primaryKey)
+	if err != nil {
+		return nil, err
+	}
+	if failed := run.failed(); len(failed) > 0 {
+		return nil, fmt.Errorf("%w: %d values could not be converted, the first at %s (%v): %s",
+			ErrMigrationFailed, len(failed), failed[0].Path, failed[0].Value, failed[0].Error)
+	}
+	if err := fm.validateItems(run.data); err != nil {
+		return nil, err
+	}
+
+	// The current data may not be versioned yet if the file was edited by hand
+	record := MigrationRecord{
+		Migration:      *m,
+		Version:        len(history) + 1,
+		Author:         fm.commit.Author,
+		AuthorName:     fm.commit.AuthorName,
+		Changed:        len(run.diff.Modified),
+		Skipped:        run.skipped(),
+		PreviousSchema: previousSchema,
+	}
+	record.ID, record.AppliedAt = newSnapshotID()
+	before := CommitInfo{
+		Author:     record.Author,
+		AuthorName: record.AuthorName,
+		Message:    fmt.Sprintf("Before migration %d (%s)", record.Version, m.Name),
+		Operation:  OperationUpdate,
+	}
+	if err := fm.versionManager.CreateVersionWithInfo(fm.filePath, fm.cache, fm.format, before); err != nil {
+		return nil, fmt.Errorf("failed to version data before migration: %w", err)
+	}
+	if record.VersionBefore, err = fm.latestVersionID(); err != nil {
+		return nil, err
+	}
+	if err := fm.versionManager.Pin(fm.filePath, record.VersionBefore, true); err != nil {
+		return nil, fmt.Errorf("failed to pin version before migration: %w", err)
+	}
+
+	if !run.diff.IsEmpty() {
+		if fm.commit.Message == "" {
+			fm.commit.Message = fmt.Sprintf("Migration %d (%s)", record.Version, m.Name)
+		}
+		if err := fm.writeToFile(run.data); err != nil {
+			return nil, err
+		}
+		fm.cache = run.data
+		fm.snapshot(OperationMigrate, nil)
+		if err := fm.loadFromFileWithLock(false); err != nil {
+			return nil, err
+		}
+	}
+	if record.VersionAfter, err = fm.latestVersionID(); err != nil {
+		return nil, err
+	}
+
+	if err := fm.saveMigrations(append(history, record)); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// RollbackMigration restores the data a migration replaced. Later migrations must be
+// rolled back first, and unless force is set the data must not have changed since.
+func (fm *FileManager) RollbackMigration(id string, force bool) (*MigrationRecord, error) {
+	if fm.versionManager == nil {
+		return nil, errors.New("version manager not set")
+	}
+
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	history, err := fm.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	index := findMigration(history, id)
+	if index < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMigrationNotFound, id)
+	}
+	record := &history[index]
+	if record.RolledBackAt != nil {
+		return nil, fmt.Errorf("%w: migration %d was already rolled back", ErrMigrationConflict, record.Version)
+	}
+	for _, later := range history[index+1:] {
+		if later.RolledBackAt == nil {
+			return nil, fmt.Errorf("%w: roll back migration %d first", ErrMigrationConflict, later.Version)
+		}
+	}
+
+	if !force {
+		changed, err := fm.changedSince(record.VersionAfter)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			return nil, fmt.Errorf("%w: the data has changed since migration %d; use force to discard those changes",
+				ErrMigrationConflict, record.Version)
+		}
+	}
+
+	data, err := fm.versionManager.LoadVersion(fm.filePath, record.VersionBefore, fm.format)
+	if err != nil {
+		return nil, err
+	}
+	by := fm.commit.AuthorName
+	if by == "" {
+		by = fm.commit.Author
+	}
+	if fm.commit.Message == "" {
+		fm.commit.Message = fmt.Sprintf("Roll back migration %d (%s)", record.Version, record.Name)
+	}
+	if err := fm.restoreData(data); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	record.RolledBackAt, record.RolledBackBy = &now, by
+	if err := fm.saveMigrations(history); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Migrations returns the migrations applied to the file, oldest first
+func (fm *FileManager) Migrations() ([]MigrationRecord, error) {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+	return fm.loadMigrations()
+}
+
+// FindMigration returns the applied migration with the given id or version number
+func (fm *FileManager) FindMigration(id string) (*MigrationRecord, error) {
+	history, err := fm.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	index := findMigration(history, id)
+	if index < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMigrationNotFound, id)
+	}
+	return &history[index], nil
+}
+
+func findMigration(history []MigrationRecord, id string) int {
+	for i, record := range history {
+		if record.ID == id || strconv.Itoa(record.Version) == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// latestVersionID returns the id of the newest version
+func (fm *FileManager) latestVersionID() (string, error) {
+	versions, err := fm.versionManager.ListVersions(fm.filePath)
+	if err != nil {
+		return "", err
+	}
+	if len(versions) == 0 {
+		return "", errors.New("no version was recorded")
+	}
+	return versions[0].ID, nil
+}
+
+// changedSince reports whether the cached data differs from a version. Callers must hold the lock.
+func (fm *FileManager) changedSince(versionID string) (bool, error) {
+	if err := fm.refreshCache(); err != nil {
+		return false, err
+	}
+	version, err := fm.versionManager.FindVersion(fm.filePath, versionID)
+	if err != nil {
+		return false, err
+	}
+	current, err := prepareSnapshot(fm.cache, fm.format)
+	if err != nil {
+		return false, err
+	}
+	return current.hash != version.Hash, nil
+}
+
+// migrationHistoryPath returns the path of the file's migration history
+func (fm *FileManager) migrationHistoryPath() string {
+	return filepath.Join(filepath.Dir(fm.filePath), MigrationHistoryName(fm.filePath))
+}
+
+// loadMigrations reads the migration history. Callers must hold the lock.
+func (fm *FileManager) loadMigrations() ([]MigrationRecord, error) {
+	content, err := os.ReadFile(fm.migrationHistoryPath())
+	if os.IsNotExist(err) {
+		return []MigrationRecord{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration history: %w", err)
+	}
+
+	history := []MigrationRecord{}
+	if err := json.Unmarshal(content, &history); err != nil {
+		return nil, fmt.Errorf("failed to parse migration history: %w", err)
+	}
+	return history, nil
+}
+
+// saveMigrations writes the migration history. Callers must hold the write lock.
+func (fm *FileManager) saveMigrations(history []MigrationRecord) error {
+	content, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode migration history: %w", err)
+	}
+
+	err = writeFileAtomic(fm.migrationHistoryPath(), func(w io.Writer) error {
+		_, err := w.Write(append(content, '\n'))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write migration history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// decodeItems decodes a JSON array of items
+func decodeItems(t *testing.T, content string) []map[string]any {
+	t.Helper()
+	var items []map[string]any
+	if err := json.Unmarshal([]byte(content), &items); err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func TestMigrationTransforms(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform Transform
+		data      string
+		want      string
+		issues    []string
+	}{
+		{
+			name:      "rename",
+			transform: Transform{Op: TransformRename, Field: "cost", To: "price"},
+			data:      `[{"cost": 5}, {"name": "Tea"}]`,
+			want:      `[{"price": 5}, {"name": "Tea"}]`,
+		},
+		{
+			name:      "rename onto an existing field",
+			transform: Transform{Op: TransformRename, Field: "cost", To: "price"},
+			data:      `[{"cost": 5, "price": 6}]`,
+			want:      `[{"cost": 5, "price": 6}]`,
+			issues:    []string{"[0].cost"},
+		},
+		{
+			name:      "cast strings to integers",
+			transform: Transform{Op: TransformCast, Field: "qty", Type: FieldTypeInteger},
+			data:      `[{"qty": "12"}, {"qty": 3}, {"qty": null}, {}]`,
+			want:      `[{"qty": 12}, {"qty": 3}, {"qty": null}, {}]`,
+		},
+		{
+			name:      "cast fractions to integers",
+			transform: Transform{Op: TransformCast, Field: "qty", Type: FieldTypeInteger},
+			data:      `[{"qty": "1.5"}]`,
+			want:      `[{"qty": "1.5"}]`,
+			issues:    []string{"[0].qty"},
+		},
+		{
+			name:      "split nested fields",
+			transform: Transform{Op: TransformSplit, Field: "items[].dietaryInfo"},
+			data:      `[{"items": [{"dietaryInfo": "V, GF"}, {"dietaryInfo": ["VG"]}, {"dietaryInfo": ""}]}]`,
+			want:      `[{"items": [{"dietaryInfo": ["V", "GF"]}, {"dietaryInfo": ["VG"]}, {"dietaryInfo": []}]}]`,
+		},
+		{
+			name:      "currency",
+			transform: Transform{Op: TransformCurrency, Field: "price"},
+			data:      `[{"price": "$1,299.99"}, {"price": "-€5"}, {"price": 2}]`,
+			want:      `[{"price": 1299.99}, {"price": -5}, {"price": 2}]`,
+		},
+		{
+			name:      "skipped currency with several amounts",
+			transform: Transform{Op: TransformCurrency, Field: "price", OnError: OnErrorSkip},
+			data:      `[{"price": "$8.99/15.99"}, {"price": "$3"}]`,
+			want:      `[{"price": "$8.99/15.99"}, {"price": 3}]`,
+			issues:    []string{"[0].price"},
+		},
+		{
+			name:      "wrap",
+			transform: Transform{Op: TransformWrap, Field: "details.tags"},
+			data:      `[{"details": {"tags": "hot"}}, {"details": {"tags": ["mild"]}}]`,
+			want:      `[{"details": {"tags": ["hot"]}}, {"details": {"tags": ["mild"]}}]`,
+		},
+		{
+			name:      "default",
+			transform: Transform{Op: TransformDefault, Field: "available", Value: true},
+			data:      `[{"available": false}, {"available": null}, {}]`,
+			want:      `[{"available": false}, {"available": true}, {"available": true}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migration := &Migration{Name: tt.name, Transforms: []Transform{tt.transform}}
+			if err := migration.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			data := decodeItems(t, tt.data)
+			issues := migration.apply(data)
+			if want := decodeItems(t, tt.want); !reflect.DeepEqual(data, want) {
+				t.Errorf("migrated %v, want %v", data, want)
+			}
+			paths := []string{}
+			for _, issue := range issues {
+				paths = append(paths, issue.Path)
+				if issue.Skipped != (tt.transform.OnError == OnErrorSkip) {
+					t.Errorf("issue %+v skipped = %v", issue, issue.Skipped)
+				}
+			}
+			if tt.issues == nil {
+				tt.issues = []string{}
+			}
+			if !reflect.DeepEqual(paths, tt.issues) {
+				t.Errorf("issues at %v, want %v", paths, tt.issues)
+			}
+		})
+	}
+}
+
+func TestMigrationValidate(t *testing.T) {
+	tests := []Migration{
+		{Transforms: []Transform{{Op: TransformWrap, Field: "tags"}}},
+		{Name: "empty"},
+		{Name: "unknown op", Transforms: []Transform{{Op: "drop", Field: "tags"}}},
+		{Name: "array elements", Transforms: []Transform{{Op: TransformWrap, Field: "tags[]"}}},
+		{Name: "empty segment", Transforms: []Transform{{Op: TransformWrap, Field: "items[]..tags"}}},
+		{Name: "rename into a path", Transforms: []Transform{{Op: TransformRename, Field: "cost", To: "price.amount"}}},
+		{Name: "cast to an array", Transforms: []Transform{{Op: TransformCast, Field: "tags", Type: FieldTypeArray}}},
+		{Name: "default without a value", Transforms: []Transform{{Op: TransformDefault, Field: "tags"}}},
+		{Name: "onError", Transforms: []Transform{{Op: TransformWrap, Field: "tags", OnError: "ignore"}}},
+	}
+	for _, migration := range tests {
+		if err := migration.Validate(); !errors.Is(err, ErrInvalidMigration) {
+			t.Errorf("Validate(%+v) = %v, want %v", migration, err, ErrInvalidMigration)
+		}
+	}
+}
+
+func TestMigrateAndRollback(t *testing.T) {
+	const products = `[{"id": 1, "name": "Tea", "price": "$2.50"}, {"id": 2, "name": "Coffee", "price": "$1,299.00"}]`
+	fm := newTestFileManager(t, "products.json", products)
+	original := readAll(t, fm)
+
+	currency := &Migration{Name: "prices as numbers", Transforms: []Transform{{Op: TransformCurrency, Field: "price"}}}
+	preview, err := fm.PreviewMigration(currency, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Changed != 2 || len(preview.Issues) != 0 || len(preview.Violations) != 0 {
+		t.Errorf("preview = %+v, want two changed items", preview)
+	}
+	if data := readAll(t, fm); !reflect.DeepEqual(data, original) {
+		t.Errorf("preview changed the file to %v", data)
+	}
+
+	fm.SetCommitInfo(CommitInfo{Author: "1", AuthorName: "Ada"})
+	first, err := fm.Migrate(currency, "id", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Version != 1 || first.Changed != 2 || first.AuthorName != "Ada" || first.VersionBefore == "" || first.VersionAfter == first.VersionBefore {
+		t.Errorf("migration recorded as %+v", first)
+	}
+	if data := readAll(t, fm); data[0]["price"] != 2.5 || data[1]["price"] != 1299.0 {
+		t.Errorf("after migrating the file holds %v", data)
+	}
+	// The data before the migration is pinned so retention keeps it
+	before, err := fm.versionManager.FindVersion(fm.filePath, first.VersionBefore)
+	if err != nil || !before.Pinned {
+		t.Errorf("version before the migration = %+v, %v, want it pinned", before, err)
+	}
+
+	// A migration that cannot convert every value changes nothing
+	failing := &Migration{Name: "names as numbers", Transforms: []Transform{{Op: TransformCast, Field: "name", Type: FieldTypeNumber}}}
+	if _, err := fm.Migrate(failing, "id", nil); !errors.Is(err, ErrMigrationFailed) {
+		t.Errorf("Migrate with unconvertible values = %v, want %v", err, ErrMigrationFailed)
+	}
+
+	wrap := &Migration{Name: "names as lists", Transforms: []Transform{{Op: TransformWrap, Field: "name"}}}
+	second, err := fm.Migrate(wrap, "id", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history, _ := fm.Migrations(); len(history) != 2 || history[1].ID != second.ID {
+		t.Errorf("history = %+v, want both migrations", history)
+	}
+
+	// Migrations are rolled back newest first
+	if _, err := fm.RollbackMigration(first.ID, false); !errors.Is(err, ErrMigrationConflict) {
+		t.Errorf("rollback of an older migration = %v, want %v", err, ErrMigrationConflict)
+	}
+	if _, err := fm.RollbackMigration("missing", false); !errors.Is(err, ErrMigrationNotFound) {
+		t.Errorf("rollback of a missing migration = %v, want %v", err, ErrMigrationNotFound)
+	}
+	if _, err := fm.RollbackMigration("2", false); err != nil {
+		t.Fatal(err)
+	}
+	if data := readAll(t, fm); data[0]["name"] != "Tea" || data[0]["price"] != 2.5 {
+		t.Errorf("after rolling back the second migration the file holds %v", data)
+	}
+	if _, err := fm.RollbackMigration(second.ID, false); !errors.Is(err, ErrMigrationConflict) {
+		t.Errorf("second rollback of a migration = %v, want %v", err, ErrMigrationConflict)
+	}
+
+	// Edits made after a migration are only discarded with force
+	if err := fm.Update(0, map[string]any{"id": 1.0, "name": "Green tea", "price": 3.0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fm.RollbackMigration(first.ID, false); !errors.Is(err, ErrMigrationConflict) {
+		t.Errorf("rollback over later edits = %v, want %v", err, ErrMigrationConflict)
+	}
+	fm.SetCommitInfo(CommitInfo{Author: "1", AuthorName: "Ada"})
+	rolledBack, err := fm.RollbackMigration(first.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolledBack.RolledBackAt == nil || rolledBack.RolledBackBy != "Ada" {
+		t.Errorf("rollback recorded as %+v", rolledBack)
+	}
+	if data := readAll(t, fm); !reflect.DeepEqual(data, original) {
+		t.Errorf("after rolling back every migration the file holds %v, want %v", data, original)
+	}
+	if history, _ := fm.Migrations(); history[0].RolledBackAt == nil || history[1].RolledBackAt == nil {
+		t.Errorf("history = %+v, want both rolled back", history)
+	}
+}
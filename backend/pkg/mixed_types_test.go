@@ -0,0 +1,113 @@
+package pkg
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// menuWithMixedDietaryInfo is a menu whose dietaryInfo is sometimes a string and
+// sometimes a list
+const menuWithMixedDietaryInfo = `[
+	{"id": "starters", "items": [
+		{"id": 1, "name": "Samosa", "dietaryInfo": "V", "spice": 1},
+		{"id": 2, "name": "Pakora", "dietaryInfo": ["V", "GF"], "spice": "mild"},
+		{"id": 3, "name": "Soup", "dietaryInfo": null, "spice": 2}
+	]},
+	{"id": "mains", "items": [
+		{"id": 4, "name": "Dal", "dietaryInfo": "VG", "spice": 3},
+		{"id": 5, "name": "Korma", "dietaryInfo": "GF", "spice": 1}
+	]}
+]`
+
+func TestMixedTypeUnions(t *testing.T) {
+	var data []map[string]interface{}
+	if err := json.Unmarshal([]byte(menuWithMixedDietaryInfo), &data); err != nil {
+		t.Fatal(err)
+	}
+	info, err := NewSchemaGenerator().GenerateSchema(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := info.Properties["items"].Items
+	dietaryInfo, spice := items.Properties["dietaryInfo"], items.Properties["spice"]
+	wantTypes := map[FieldType]int{FieldTypeString: 3, FieldTypeArray: 1, FieldTypeNull: 1}
+	if !reflect.DeepEqual(dietaryInfo.Types, wantTypes) || dietaryInfo.Type != FieldTypeString || !dietaryInfo.Mixed() || !dietaryInfo.Nullable {
+		t.Errorf("dietaryInfo = %+v, want mostly strings with a list and a null", dietaryInfo)
+	}
+
+	// Arrays among the types give anyOf branches, null last
+	itemSchema := info.Schema["properties"].(map[string]interface{})["items"].(map[string]interface{})["items"].(map[string]interface{})
+	properties := itemSchema["properties"].(map[string]interface{})
+	wantDietary := map[string]interface{}{"anyOf": []interface{}{
+		map[string]interface{}{"type": "string"},
+		map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "minLength": 1, "maxLength": 2}},
+		map[string]interface{}{"type": "null"},
+	}}
+	if got := properties["dietaryInfo"].(map[string]interface{}); !reflect.DeepEqual(got["anyOf"], wantDietary["anyOf"]) || got["type"] != nil {
+		t.Errorf("dietaryInfo schema = %v, want %v", got, wantDietary)
+	}
+	// Scalars alone give a list of types
+	if got := properties["spice"].(map[string]interface{})["type"]; !reflect.DeepEqual(got, []interface{}{"integer", "string"}) || !spice.Mixed() {
+		t.Errorf("spice type = %v, want integer or string", got)
+	}
+
+	// Every value the data holds is accepted by the union
+	schema := compileGenerated(t, info)
+	for i, item := range data {
+		if violations := schemaViolations(schema.Compiled(), item, ""); len(violations) > 0 {
+			t.Errorf("section %d violates its own schema: %v", i, violations)
+		}
+	}
+	section := deepCopy(data[0])
+	section["items"].([]interface{})[0].(map[string]interface{})["dietaryInfo"] = map[string]interface{}{"vegan": true}
+	violations := schemaViolations(schema.Compiled(), section, "")
+	if len(violations) != 1 || violations[0].Path != "/items/0/dietaryInfo" {
+		t.Errorf("an object dietaryInfo gave violations %v, want one at /items/0/dietaryInfo", violations)
+	}
+}
+
+func TestMixedTypeReport(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "menu.json")
+	writeTestFile(t, path, menuWithMixedDietaryInfo)
+
+	metadata, err := NewMetadataExtractor().ExtractMetadata(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Validation["isValid"] != false {
+		t.Errorf("isValid = %v, want false for mixed types", metadata.Validation["isValid"])
+	}
+	// Items are named by their own ids, and nulls are not reported
+	want := []MixedTypeReport{
+		{
+			Field:    "items[].dietaryInfo",
+			Types:    map[FieldType]int{FieldTypeString: 3, FieldTypeArray: 1, FieldTypeNull: 1},
+			Expected: FieldTypeString,
+			Items:    []string{"2"},
+		},
+		{
+			Field:    "items[].spice",
+			Types:    map[FieldType]int{FieldTypeInteger: 4, FieldTypeString: 1},
+			Expected: FieldTypeInteger,
+			Items:    []string{"2"},
+		},
+	}
+	if got, _ := metadata.Validation["mixedTypes"].([]MixedTypeReport); !reflect.DeepEqual(got, want) {
+		t.Errorf("mixedTypes = %+v, want %+v", got, want)
+	}
+
+	// A field mixing types within its arrays is reported on its elements
+	writeTestFile(t, path, `[{"id": "a", "tags": ["hot", 1]}, {"id": "b", "tags": ["mild"]}, {"id": "c", "tags": ["hot"]}]`)
+	metadata, err = NewMetadataExtractor().ExtractMetadata(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports, _ := metadata.Validation["mixedTypes"].([]MixedTypeReport)
+	if len(reports) != 1 || reports[0].Field != "tags[]" || reports[0].Expected != FieldTypeString || !reflect.DeepEqual(reports[0].Items, []string{"a"}) {
+		t.Errorf("mixedTypes = %+v, want tags[] with item a", reports)
+	}
+}
@@ -0,0 +1,229 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNothingRestored is returned when none of the requested items exist in the snapshot
+var ErrNothingRestored = errors.New("none of the requested items exist in the snapshot")
+
+// ItemRestoreResult reports which items were restored from a snapshot
+type ItemRestoreResult struct {
+	Source   string   `json:"source"`
+	Replaced []string `json:"replaced"`
+	Added    []string `json:"added"`
+	NotFound []string `json:"notFound"`
+}
+
+// RestoreItems restores the items with the given ids from a version, leaving all
+// other items as they are. Items are matched on key at the top level, or on "id"
+// inside nested arrays such as the items of a menu section. Deleted items are re-added.
+func (fm *FileManager) RestoreItems(versionID, key string, ids []string) (*ItemRestoreResult, error) {
+	if fm.versionManager == nil {
+		return nil, errors.New("version manager not set")
+	}
+
+	source, err := fm.versionManager.LoadVersion(fm.filePath, versionID, fm.format)
+	if err != nil {
+		return nil, err
+	}
+	return fm.restoreItems(versionID, source, key, ids)
+}
+
+// RestoreBackupItems restores the items with the given ids from a backup
+func (fm *FileManager) RestoreBackupItems(backupID, key string, ids []string) (*ItemRestoreResult, error) {
+	backup, err := fm.FindBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := fm.ReadBackup(backup.ID)
+	if err != nil {
+		return nil, err
+	}
+	return fm.restoreItems(backup.ID, source, key, ids)
+}
+
+// VersionAsOf returns the newest version recorded at or before t
+func (fm *FileManager) VersionAsOf(t time.Time) (*VersionInfo, error) {
+	versions, err := fm.ListVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	// Versions are listed newest first
+	for _, version := range versions {
+		if !version.Timestamp.After(t) {
+			return &version, nil
+		}
+	}
+	return nil, fmt.Errorf("no version exists at or before %s", t.Format(time.RFC3339))
+}
+
+// RestoreAsOf restores the whole file to its state at time t and returns the version used
+func (fm *FileManager) RestoreAsOf(t time.Time) (*VersionInfo, error) {
+	version, err := fm.VersionAsOf(t)
+	if err != nil {
+		return nil, err
+	}
+	if err := fm.RestoreVersion(version.ID); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// restoreItems copies items from source into the current data, then validates, writes and versions the result
+func (fm *FileManager) restoreItems(sourceName string, source []map[string]any, key string, ids []string) (*ItemRestoreResult, error) {
+	if key == "" {
+		key = "id"
+	}
+
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	if err := fm.refreshCache(); err != nil {
+		return nil, err
+	}
+
+	data := make([]map[string]any, len(fm.cache))
+	for i, item := range fm.cache {
+		data[i] = deepCopy(item)
+	}
+
+	result := &ItemRestoreResult{Source: sourceName, Replaced: []string{}, Added: []string{}, NotFound: []string{}}
+	var changed []map[string]any
+	for _, id := range ids {
+		var item map[string]any
+		var added, ok bool
+		data, item, added, ok = restoreTopLevel(data, source, key, id)
+		if !ok {
+			item, added, ok = restoreNested(data, source, key, id)
+		}
+
+		switch {
+		case !ok:
+			result.NotFound = append(result.NotFound, id)
+			continue
+		case added:
+			result.Added = append(result.Added, id)
+		default:
+			result.Replaced = append(result.Replaced, id)
+		}
+		changed = append(changed, item)
+	}
+
+	if len(changed) == 0 {
+		return result, ErrNothingRestored
+	}
+	if err := fm.validateItems(changed); err != nil {
+		return nil, err
+	}
+
+	backupID, err := fm.backupBeforeRestore()
+	if err != nil {
+		return nil, err
+	}
+	if err := fm.writeToFile(data); err != nil {
+		return nil, err
+	}
+	fm.cache = data
+	fm.commit.PreRestoreBackup = backupID
+	fm.snapshot(OperationRestore, append(result.Replaced, result.Added...))
+
+	return result, fm.loadFromFileWithLock(false)
+}
+
+// restoreTopLevel restores a top-level item matched on key. It returns the updated
+// data, the top-level item that changed, and whether the item was re-added.
+func restoreTopLevel(data, source []map[string]any, key, id string) ([]map[string]any, map[string]any, bool, bool) {
+	sourceIndex := indexOfItem(source, key, id)
+	if sourceIndex < 0 {
+		return data, nil, false, false
+	}
+
+	item := deepCopy(source[sourceIndex])
+	if current := indexOfItem(data, key, id); current >= 0 {
+		data[current] = item
+		return data, item, false, true
+	}
+
+	// Re-insert deleted items where they used to be
+	position := min(sourceIndex, len(data))
+	data = append(data[:position], append([]map[string]any{item}, data[position:]...)...)
+	return data, item, true, true
+}
+
+// restoreNested restores an element with the given "id" from an array field of a
+// top-level item. It returns the parent item that changed and whether the element was re-added.
+func restoreNested(data, source []map[string]any, key, id string) (map[string]any, bool, bool) {
+	for _, sourceParent := range source {
+		for field, value := range sourceParent {
+			elements, ok := value.([]any)
+			if !ok {
+				continue
+			}
+			sourceIndex := indexOfElement(elements, id)
+			if sourceIndex < 0 {
+				continue
+			}
+
+			// The parent must still exist to hold the element
+			parentIndex := indexOfItem(data, key, fmt.Sprintf("%v", sourceParent[key]))
+			if sourceParent[key] == nil || parentIndex < 0 {
+				return nil, false, false
+			}
+			parent := data[parentIndex]
+			element := deepCopyValue(elements[sourceIndex])
+
+			current, _ := parent[field].([]any)
+			if index := indexOfElement(current, id); index >= 0 {
+				current[index] = element
+				parent[field] = current
+				return parent, false, true
+			}
+
+			position := min(sourceIndex, len(current))
+			parent[field] = append(current[:position], append([]any{element}, current[position:]...)...)
+			return parent, true, true
+		}
+	}
+	return nil, false, false
+}
+
+// indexOfItem finds the item whose key field equals id
+func indexOfItem(items []map[string]any, key, id string) int {
+	for i, item := range items {
+		if value, ok := item[key]; ok && fmt.Sprintf("%v", value) == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexOfElement finds the object in an array whose "id" equals id
+func indexOfElement(elements []any, id string) int {
+	for i, element := range elements {
+		if object, ok := element.(map[string]any); ok && object["id"] != nil && fmt.Sprintf("%v", object["id"]) == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// deepCopyValue copies nested maps and arrays
+func deepCopyValue(value any) any {
+	switch val := value.(type) {
+	case map[string]any:
+		return deepCopy(val)
+	case []any:
+		arr := make([]any, len(val))
+		for i, element := range val {
+			arr[i] = deepCopyValue(element)
+		}
+		return arr
+	default:
+		return value
+	}
+}
@@ -0,0 +1,246 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestFileManager returns a file manager with versions and backups over a fresh
+// directory, keeping all history
+func newTestFileManager(t *testing.T, name, content string) *FileManager {
+	t.Helper()
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, name)
+	writeTestFile(t, filePath, content)
+
+	vm := NewVersionManager(dir, 0)
+	vm.SetRetention(RetentionPolicy{})
+	bm := NewBackupManager(filepath.Join(dir, "backups"))
+	bm.SetRetention(RetentionPolicy{})
+	fm, err := NewFileManagerWithOptions(filePath, nil, vm, bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fm
+}
+
+// readAll returns the file manager's current data
+func readAll(t *testing.T, fm *FileManager) []map[string]any {
+	t.Helper()
+	data, err := fm.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRestoreItems(t *testing.T) {
+	fm := newTestFileManager(t, "products.json", `[]`)
+	for _, item := range []map[string]any{
+		{"id": 1.0, "name": "Tea"},
+		{"id": 2.0, "name": "Coffee"},
+		{"id": 3.0, "name": "Juice"},
+	} {
+		if err := fm.Create(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, _ := fm.ListVersions()
+	before := versions[0].ID
+
+	// Later edits: item 2 is deleted, items 1 and 3 change
+	if err := fm.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := fm.Update(0, map[string]any{"id": 1.0, "name": "Green tea"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fm.Update(1, map[string]any{"id": 3.0, "name": "Orange juice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := fm.RestoreItems(before, "id", []string{"2", "3", "9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ItemRestoreResult{Source: before, Replaced: []string{"3"}, Added: []string{"2"}, NotFound: []string{"9"}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("RestoreItems = %+v, want %+v", result, want)
+	}
+	// The deleted item returns to its place and other edits survive
+	wantData := []map[string]any{{"id": 1.0, "name": "Green tea"}, {"id": 2.0, "name": "Coffee"}, {"id": 3.0, "name": "Juice"}}
+	if data := readAll(t, fm); !reflect.DeepEqual(data, wantData) {
+		t.Errorf("after restoring items the file holds %v, want %v", data, wantData)
+	}
+
+	versions, _ = fm.ListVersions()
+	if latest := versions[0]; latest.Operation != OperationRestore || !reflect.DeepEqual(latest.AffectedIDs, []string{"3", "2"}) || latest.PreRestoreBackup == "" {
+		t.Errorf("item restore recorded as %+v", latest)
+	}
+
+	if _, err := fm.RestoreItems(before, "id", []string{"9"}); !errors.Is(err, ErrNothingRestored) {
+		t.Errorf("RestoreItems of missing items = %v, want %v", err, ErrNothingRestored)
+	}
+}
+
+func TestRestoreNestedItems(t *testing.T) {
+	fm := newTestFileManager(t, "menu.json", `[{"id": "mains", "items": [
+		{"id": 1, "name": "Chicken Pakora", "price": 5},
+		{"id": 2, "name": "Samosa", "price": 3}
+	]}]`)
+	if err := fm.CreateVersion(); err != nil {
+		t.Fatal(err)
+	}
+	versions, _ := fm.ListVersions()
+
+	// Samosa is removed and the pakora gets dearer
+	section := map[string]any{"id": "mains", "items": []any{map[string]any{"id": 1.0, "name": "Chicken Pakora", "price": 6.0}}}
+	if err := fm.Update(0, section); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := fm.RestoreItems(versions[0].ID, "id", []string{"2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Added, []string{"2"}) {
+		t.Errorf("RestoreItems = %+v, want item 2 re-added", result)
+	}
+	items := readAll(t, fm)[0]["items"].([]any)
+	if len(items) != 2 || items[0].(map[string]any)["price"] != 6.0 || items[1].(map[string]any)["name"] != "Samosa" {
+		t.Errorf("after restoring a nested item the section holds %v", items)
+	}
+}
+
+func TestRestoreAsOf(t *testing.T) {
+	fm := newTestFileManager(t, "products.json", `[]`)
+	for _, name := range []string{"Tea", "Coffee", "Juice"} {
+		if err := fm.Create(map[string]any{"name": name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, _ := fm.ListVersions()
+	first, second := versions[2], versions[1]
+
+	if _, err := fm.VersionAsOf(first.Timestamp.Add(-time.Nanosecond)); err == nil {
+		t.Error("VersionAsOf before the first version succeeded")
+	}
+	if version, err := fm.VersionAsOf(second.Timestamp); err != nil || version.ID != second.ID {
+		t.Errorf("VersionAsOf the second version's time = %v, %v, want %s", version, err, second.ID)
+	}
+
+	// Any time between two versions picks the earlier one
+	between := second.Timestamp.Add(versions[0].Timestamp.Sub(second.Timestamp) / 2)
+	version, err := fm.RestoreAsOf(between)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.ID != second.ID {
+		t.Errorf("RestoreAsOf picked %s, want %s", version.ID, second.ID)
+	}
+	if data := readAll(t, fm); len(data) != 2 || data[1]["name"] != "Coffee" {
+		t.Errorf("after RestoreAsOf the file holds %v", data)
+	}
+}
+
+func TestRestoreReplacesFileAtomically(t *testing.T) {
+	fm := newTestFileManager(t, "products.json", `[{"id": 1, "name": "Tea"}]`)
+	if err := fm.CreateVersion(); err != nil {
+		t.Fatal(err)
+	}
+	versions, _ := fm.ListVersions()
+	if err := fm.Update(0, map[string]any{"id": 1.0, "name": "Green tea"}); err != nil {
+		t.Fatal(err)
+	}
+
+	before, _ := os.Stat(fm.filePath)
+	if err := fm.RestoreVersion(versions[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(fm.filePath)
+	if os.SameFile(before, after) {
+		t.Error("restore rewrote the file in place instead of renaming a temp file over it")
+	}
+	assertNoTempFiles(t, filepath.Dir(fm.filePath))
+	if data := readAll(t, fm); data[0]["name"] != "Tea" {
+		t.Errorf("after restore the file holds %v", data)
+	}
+
+	// The data the restore replaced is kept in a backup
+	versions, _ = fm.ListVersions()
+	replaced, err := fm.ReadBackup(versions[0].PreRestoreBackup)
+	if err != nil || replaced[0]["name"] != "Green tea" {
+		t.Errorf("pre-restore backup = %v, %v", replaced, err)
+	}
+}
+
+func TestRestoreRejectsInvalidSnapshots(t *testing.T) {
+	fm := newTestFileManager(t, "products.json", `[]`)
+	if err := fm.Create(map[string]any{"id": 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	versions, _ := fm.ListVersions()
+	nameless := versions[0].ID
+	if err := fm.Update(0, map[string]any{"id": 1.0, "name": "Tea"}); err != nil {
+		t.Fatal(err)
+	}
+	backups, _ := fm.ListBackups()
+	named := backups[0]
+
+	schema, err := ParseFileSchema([]byte(`{"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm.UseSchema(schema)
+
+	// Damage the latest backup so it no longer matches its hash
+	writeTestFile(t, named.Path, `[{"id": 1, "name": "Forged"}]`)
+
+	content, _ := os.ReadFile(fm.filePath)
+	before, _ := os.Stat(fm.filePath)
+	var violations ValidationErrors
+	if err := fm.RestoreVersion(nameless); !errors.As(err, &violations) {
+		t.Errorf("restore of a version failing the schema = %v, want validation errors", err)
+	}
+	if err := fm.RestoreBackup(named.Path); !errors.Is(err, ErrSnapshotCorrupt) {
+		t.Errorf("restore of a damaged backup = %v, want %v", err, ErrSnapshotCorrupt)
+	}
+
+	after, _ := os.Stat(fm.filePath)
+	if unchanged, _ := os.ReadFile(fm.filePath); string(unchanged) != string(content) || !os.SameFile(before, after) {
+		t.Error("a rejected restore changed the file")
+	}
+	if after, _ := fm.ListBackups(); len(after) != len(backups) {
+		t.Errorf("rejected restores took %d backups", len(after)-len(backups))
+	}
+}
+
+func TestRestoreSnapshotInOtherFormat(t *testing.T) {
+	fm := newTestFileManager(t, "menu.json", `[{"id": 1, "name": "Green tea"}]`)
+	// A version taken while the file was still CSV
+	versionDir := filepath.Join(filepath.Dir(fm.filePath), "versions", "menu.json")
+	writeTestFile(t, filepath.Join(versionDir, "menu_20240131_093000.csv"), "id,name\n1,Tea\n")
+
+	versions, err := fm.ListVersions()
+	if err != nil || len(versions) != 1 {
+		t.Fatalf("ListVersions = %v, %v", versions, err)
+	}
+	if err := fm.RestoreVersion(versions[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file keeps its own format
+	content, _ := os.ReadFile(fm.filePath)
+	var data []map[string]any
+	if err := json.Unmarshal(content, &data); err != nil {
+		t.Fatalf("restored file is not JSON: %v\n%s", err, content)
+	}
+	if len(data) != 1 || data[0]["name"] != "Tea" {
+		t.Errorf("restored %v", data)
+	}
+}
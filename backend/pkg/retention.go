@@ -0,0 +1,363 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Reasons reported for pruned snapshots
+const (
+	PruneOutsideRetention = "outside retention"
+	PruneOverCount        = "over count limit"
+	PruneOverSize         = "over size limit"
+)
+
+// RetentionPolicy decides which versions or backups are kept. Snapshots newer than
+// KeepAllFor are all kept, then the newest per day for DailyDays days and the newest
+// per month for MonthlyMonths months. MaxCount and MaxTotalSize further cap what is
+// kept, dropping the oldest first. Pinned and tagged snapshots and the newest one are
+// never pruned. The zero value keeps everything.
+type RetentionPolicy struct {
+	KeepAllFor    time.Duration `json:"keepAllFor"`
+	DailyDays     int           `json:"dailyDays"`
+	MonthlyMonths int           `json:"monthlyMonths"`
+	MaxCount      int           `json:"maxCount,omitempty"`
+	MaxTotalSize  int64         `json:"maxTotalSize,omitempty"`
+}
+
+// DefaultRetentionPolicy keeps everything from the last 24 hours, daily snapshots
+// for 30 days and monthly snapshots for a year
+func DefaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{
+		KeepAllFor:    24 * time.Hour,
+		DailyDays:     30,
+		MonthlyMonths: 12,
+	}
+}
+
+// PrunedSnapshot is a version or backup removed, or to be removed, by pruning
+type PrunedSnapshot struct {
+	ID        string    `json:"id"`
+	FileName  string    `json:"fileName"`
+	Timestamp time.Time `json:"timestamp"`
+	Size      int64     `json:"size"`
+	Reason    string    `json:"reason"`
+}
+
+// PruneReport describes the outcome of applying a retention policy
+type PruneReport struct {
+	DryRun     bool             `json:"dryRun"`
+	Kept       int              `json:"kept"`
+	Pruned     []PrunedSnapshot `json:"pruned"`
+	FreedBytes int64            `json:"freedBytes"`
+}
+
+// ErrSnapshotNotFound is returned when no version or backup has the given id
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// windowed reports whether any time-based retention is configured
+func (p RetentionPolicy) windowed() bool {
+	return p.KeepAllFor > 0 || p.DailyDays > 0 || p.MonthlyMonths > 0
+}
+
+// plan splits records, sorted oldest first, into those kept and those pruned
+func (p RetentionPolicy) plan(records []snapshotRecord, now time.Time, sizeOf func(snapshotRecord) int64) ([]snapshotRecord, []PrunedSnapshot) {
+	n := len(records)
+	keep := make([]bool, n)
+	reasons := make([]string, n)
+
+	protected := func(i int) bool {
+		return i == n-1 || records[i].Pinned || len(records[i].Tags) > 0
+	}
+
+	// Grandfather-father-son selection, newest first
+	seenDays := make(map[string]bool)
+	seenMonths := make(map[string]bool)
+	dailyCutoff := now.AddDate(0, 0, -p.DailyDays)
+	monthlyCutoff := now.AddDate(0, -p.MonthlyMonths, 0)
+	for i := n - 1; i >= 0; i-- {
+		ts := records[i].Timestamp.Local()
+		day, month := ts.Format("2006-01-02"), ts.Format("2006-01")
+
+		switch {
+		case !p.windowed() || protected(i) || now.Sub(ts) <= p.KeepAllFor:
+			keep[i] = true
+		case p.DailyDays > 0 && ts.After(dailyCutoff) && !seenDays[day]:
+			keep[i] = true
+		case p.MonthlyMonths > 0 && ts.After(monthlyCutoff) && !seenMonths[month]:
+			keep[i] = true
+		default:
+			reasons[i] = PruneOutsideRetention
+		}
+		if keep[i] {
+			seenDays[day] = true
+			seenMonths[month] = true
+		}
+	}
+
+	// Count limit, dropping the oldest unprotected snapshots
+	if p.MaxCount > 0 {
+		count := 0
+		for i := range records {
+			if keep[i] {
+				count++
+			}
+		}
+		for i := 0; i < n && count > p.MaxCount; i++ {
+			if keep[i] && !protected(i) {
+				keep[i] = false
+				reasons[i] = PruneOverCount
+				count--
+			}
+		}
+	}
+
+	// Size limit, counting files shared by several records once
+	if p.MaxTotalSize > 0 {
+		refs := make(map[string]int)
+		var total int64
+		for i, record := range records {
+			if keep[i] {
+				if refs[record.FileName] == 0 {
+					total += sizeOf(record)
+				}
+				refs[record.FileName]++
+			}
+		}
+		for i := 0; i < n && total > p.MaxTotalSize; i++ {
+			if keep[i] && !protected(i) {
+				keep[i] = false
+				reasons[i] = PruneOverSize
+				if refs[records[i].FileName]--; refs[records[i].FileName] == 0 {
+					total -= sizeOf(records[i])
+				}
+			}
+		}
+	}
+
+	var kept []snapshotRecord
+	pruned := []PrunedSnapshot{}
+	for i, record := range records {
+		if keep[i] {
+			kept = append(kept, record)
+			continue
+		}
+		pruned = append(pruned, PrunedSnapshot{
+			ID:        record.ID,
+			FileName:  record.FileName,
+			Timestamp: record.Timestamp,
+			Size:      sizeOf(record),
+			Reason:    reasons[i],
+		})
+	}
+	return kept, pruned
+}
+
+// newPruneReport summarizes a plan. Freed bytes count files no kept record still uses.
+func newPruneReport(kept []snapshotRecord, pruned []PrunedSnapshot, dryRun bool) *PruneReport {
+	stillUsed := make(map[string]bool, len(kept))
+	for _, record := range kept {
+		stillUsed[record.FileName] = true
+	}
+
+	report := &PruneReport{DryRun: dryRun, Kept: len(kept), Pruned: pruned}
+	counted := make(map[string]bool)
+	for _, snapshot := range pruned {
+		if !stillUsed[snapshot.FileName] && !counted[snapshot.FileName] {
+			report.FreedBytes += snapshot.Size
+			counted[snapshot.FileName] = true
+		}
+	}
+	return report
+}
+
+// fileSize returns the size of a file on disk, or 0 if it is missing
+func fileSize(path string) int64 {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return stat.Size()
+}
+
+// updateRecord applies a change to the record with the given id
+func updateRecord(records []snapshotRecord, id string, change func(*snapshotRecord)) error {
+	for i := range records {
+		if records[i].ID == id || records[i].FileName == id {
+			change(&records[i])
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+}
+
+// setPinned returns a change that pins or unpins a record
+func setPinned(pinned bool) func(*snapshotRecord) {
+	return func(record *snapshotRecord) {
+		record.Pinned = pinned
+	}
+}
+
+// setTag returns a change that adds or removes a tag on a record
+func setTag(tag string, add bool) func(*snapshotRecord) {
+	return func(record *snapshotRecord) {
+		tags := record.Tags[:0:0]
+		for _, existing := range record.Tags {
+			if existing != tag {
+				tags = append(tags, existing)
+			}
+		}
+		if add {
+			tags = append(tags, tag)
+		}
+		record.Tags = tags
+	}
+}
+
+// SetRetention sets the retention policy applied when versions are created
+func (vm *VersionManager) SetRetention(policy RetentionPolicy) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	vm.retention = policy
+}
+
+// Retention returns the retention policy for versions
+func (vm *VersionManager) Retention() RetentionPolicy {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	return vm.retention
+}
+
+// Prune applies the retention policy to a file's versions. With dryRun nothing is removed.
+func (vm *VersionManager) Prune(filePath string, format FileFormat, dryRun bool) (*PruneReport, error) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	records, err := vm.syncManifest(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return vm.prune(filePath, format, records, dryRun)
+}
+
+// prune applies the retention policy to records. Callers must hold the lock.
+func (vm *VersionManager) prune(filePath string, format FileFormat, records []snapshotRecord, dryRun bool) (*PruneReport, error) {
+	versionDir := vm.versionDir(filePath)
+	store := newObjectStore(versionDir, format)
+	sizeOf := func(record snapshotRecord) int64 {
+		if isObjectName(record.FileName) {
+			return fileSize(store.path(record.FileName))
+		}
+		return fileSize(filepath.Join(versionDir, record.FileName))
+	}
+
+	kept, pruned := vm.retention.plan(records, time.Now(), sizeOf)
+	report := newPruneReport(kept, pruned, dryRun)
+	if dryRun || len(pruned) == 0 {
+		return report, nil
+	}
+
+	for _, snapshot := range pruned {
+		if !isObjectName(snapshot.FileName) {
+			os.Remove(filepath.Join(versionDir, snapshot.FileName))
+		}
+	}
+	if err := saveManifest(versionDir, kept); err != nil {
+		return nil, err
+	}
+	// Objects still needed as delta bases survive garbage collection
+	return report, store.gc(kept)
+}
+
+// Pin exempts a version from pruning, or removes the exemption
+func (vm *VersionManager) Pin(filePath, id string, pinned bool) error {
+	return vm.modify(filePath, id, setPinned(pinned))
+}
+
+// Tag adds or removes a tag on a version. Tagged versions are never pruned.
+func (vm *VersionManager) Tag(filePath, id, tag string, add bool) error {
+	return vm.modify(filePath, id, setTag(tag, add))
+}
+
+// modify changes the manifest record of one version
+func (vm *VersionManager) modify(filePath, id string, change func(*snapshotRecord)) error {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	records, err := vm.syncManifest(filePath)
+	if err != nil {
+		return err
+	}
+	if err := updateRecord(records, id, change); err != nil {
+		return err
+	}
+	return saveManifest(vm.versionDir(filePath), records)
+}
+
+// SetRetention sets the retention policy applied when backups are created
+func (bm *BackupManager) SetRetention(policy RetentionPolicy) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.retention = policy
+}
+
+// Prune applies the retention policy to a file's backups. With dryRun nothing is removed.
+func (bm *BackupManager) Prune(filePath string, dryRun bool) (*PruneReport, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	records, err := bm.syncManifest(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return bm.prune(filePath, records, dryRun)
+}
+
+// prune applies the retention policy to records. Callers must hold the lock.
+func (bm *BackupManager) prune(filePath string, records []snapshotRecord, dryRun bool) (*PruneReport, error) {
+	dir := bm.fileBackupDir(filePath)
+	sizeOf := func(record snapshotRecord) int64 {
+		return fileSize(filepath.Join(dir, record.FileName))
+	}
+
+	kept, pruned := bm.retention.plan(records, time.Now(), sizeOf)
+	report := newPruneReport(kept, pruned, dryRun)
+	if dryRun || len(pruned) == 0 {
+		return report, nil
+	}
+
+	for _, snapshot := range pruned {
+		if err := os.Remove(filepath.Join(dir, snapshot.FileName)); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove backup: %w", err)
+		}
+	}
+	return report, saveManifest(dir, kept)
+}
+
+// Pin exempts a backup from pruning, or removes the exemption
+func (bm *BackupManager) Pin(filePath, id string, pinned bool) error {
+	return bm.modify(filePath, id, setPinned(pinned))
+}
+
+// Tag adds or removes a tag on a backup. Tagged backups are never pruned.
+func (bm *BackupManager) Tag(filePath, id, tag string, add bool) error {
+	return bm.modify(filePath, id, setTag(tag, add))
+}
+
+// modify changes the manifest record of one backup
+func (bm *BackupManager) modify(filePath, id string, change func(*snapshotRecord)) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	records, err := bm.syncManifest(filePath)
+	if err != nil {
+		return err
+	}
+	if err := updateRecord(records, id, change); err != nil {
+		return err
+	}
+	return saveManifest(bm.fileBackupDir(filePath), records)
+}
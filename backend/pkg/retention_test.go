@@ -0,0 +1,219 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testRecords returns records for the given timestamps, oldest first, each in its own file
+func testRecords(timestamps ...time.Time) []snapshotRecord {
+	records := make([]snapshotRecord, len(timestamps))
+	for i, ts := range timestamps {
+		records[i] = snapshotRecord{
+			ID:        fmt.Sprintf("%s-%02d", ts.UTC().Format(snapshotIDLayout), i),
+			FileName:  fmt.Sprintf("snapshot-%02d.json", i),
+			Timestamp: ts,
+		}
+	}
+	return records
+}
+
+// planNames returns the file names kept and the reasons given for those pruned
+func planNames(kept []snapshotRecord, pruned []PrunedSnapshot) ([]string, map[string]string) {
+	keptNames := []string{}
+	for _, record := range kept {
+		keptNames = append(keptNames, record.FileName)
+	}
+	reasons := make(map[string]string)
+	for _, snapshot := range pruned {
+		reasons[snapshot.FileName] = snapshot.Reason
+	}
+	return keptNames, reasons
+}
+
+func TestRetentionPlan(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.Local)
+	day := func(year int, month time.Month, d, hour int) time.Time {
+		return time.Date(year, month, d, hour, 0, 0, 0, time.Local)
+	}
+	records := testRecords(
+		day(2022, 11, 1, 9),  // 00 tagged
+		day(2023, 3, 1, 9),   // 01 older than a year
+		day(2023, 3, 2, 9),   // 02 pinned
+		day(2024, 1, 5, 9),   // 03 older in January
+		day(2024, 1, 20, 9),  // 04 newest in January
+		day(2024, 5, 20, 8),  // 05 older on May 20
+		day(2024, 5, 20, 18), // 06 newest on May 20
+		day(2024, 6, 14, 20), // 07 within a day
+		day(2024, 6, 15, 6),  // 08 within a day and the newest
+	)
+	records[0].Tags = []string{"opening"}
+	records[2].Pinned = true
+	sizeOf := func(snapshotRecord) int64 { return 10 }
+	capped := DefaultRetentionPolicy()
+	capped.MaxCount = 3
+
+	tests := []struct {
+		name    string
+		policy  RetentionPolicy
+		kept    []string
+		reasons map[string]string
+	}{
+		{
+			name:   "grandfather-father-son",
+			policy: DefaultRetentionPolicy(),
+			kept:   []string{"snapshot-00.json", "snapshot-02.json", "snapshot-04.json", "snapshot-06.json", "snapshot-07.json", "snapshot-08.json"},
+			reasons: map[string]string{
+				"snapshot-01.json": PruneOutsideRetention,
+				"snapshot-03.json": PruneOutsideRetention,
+				"snapshot-05.json": PruneOutsideRetention,
+			},
+		},
+		{
+			name:   "count limit spares pinned, tagged and newest",
+			policy: capped,
+			kept:   []string{"snapshot-00.json", "snapshot-02.json", "snapshot-08.json"},
+			reasons: map[string]string{
+				"snapshot-01.json": PruneOutsideRetention,
+				"snapshot-03.json": PruneOutsideRetention,
+				"snapshot-04.json": PruneOverCount,
+				"snapshot-05.json": PruneOutsideRetention,
+				"snapshot-06.json": PruneOverCount,
+				"snapshot-07.json": PruneOverCount,
+			},
+		},
+		{
+			name:   "size limit without windows",
+			policy: RetentionPolicy{MaxTotalSize: 60},
+			kept:   []string{"snapshot-00.json", "snapshot-02.json", "snapshot-05.json", "snapshot-06.json", "snapshot-07.json", "snapshot-08.json"},
+			reasons: map[string]string{
+				"snapshot-01.json": PruneOverSize,
+				"snapshot-03.json": PruneOverSize,
+				"snapshot-04.json": PruneOverSize,
+			},
+		},
+		{
+			name:    "zero value keeps everything",
+			policy:  RetentionPolicy{},
+			kept:    []string{"snapshot-00.json", "snapshot-01.json", "snapshot-02.json", "snapshot-03.json", "snapshot-04.json", "snapshot-05.json", "snapshot-06.json", "snapshot-07.json", "snapshot-08.json"},
+			reasons: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, reasons := planNames(tt.policy.plan(records, now, sizeOf))
+			if !reflect.DeepEqual(kept, tt.kept) {
+				t.Errorf("kept %v, want %v", kept, tt.kept)
+			}
+			if !reflect.DeepEqual(reasons, tt.reasons) {
+				t.Errorf("pruned %v, want %v", reasons, tt.reasons)
+			}
+		})
+	}
+}
+
+func TestRetentionSizeCountsSharedFilesOnce(t *testing.T) {
+	now := time.Now()
+	records := testRecords(now.Add(-4*time.Hour), now.Add(-3*time.Hour), now.Add(-2*time.Hour), now.Add(-time.Hour))
+	// The first two records point at the same stored object
+	records[1].FileName = records[0].FileName
+	sizeOf := func(snapshotRecord) int64 { return 10 }
+
+	kept, pruned := RetentionPolicy{MaxTotalSize: 25}.plan(records, now, sizeOf)
+	keptNames, reasons := planNames(kept, pruned)
+	if want := []string{"snapshot-02.json", "snapshot-03.json"}; !reflect.DeepEqual(keptNames, want) {
+		t.Errorf("kept %v, want %v", keptNames, want)
+	}
+	if len(pruned) != 2 || reasons["snapshot-00.json"] != PruneOverSize {
+		t.Errorf("pruned %+v, want both records of the shared object", pruned)
+	}
+	if report := newPruneReport(kept, pruned, false); report.FreedBytes != 10 {
+		t.Errorf("FreedBytes = %d, want the shared object counted once", report.FreedBytes)
+	}
+}
+
+func TestPruneVersions(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "menu.json")
+	format := &JSONFormat{}
+	vm := NewVersionManager(dir, 0)
+	vm.EnableDeltas(0)
+	for i := 1; i <= 5; i++ {
+		data := []map[string]any{{"id": 1.0, "name": "Tea", "price": float64(i)}}
+		if err := vm.CreateVersion(filePath, data, format); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, _ := vm.ListVersions(filePath)
+	oldest, second := versions[4], versions[3]
+	if err := vm.Pin(filePath, second.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Tag(filePath, "missing", "keep", true); err == nil {
+		t.Error("tagging a missing version succeeded")
+	}
+
+	vm.SetRetention(RetentionPolicy{MaxCount: 2})
+	report, err := vm.Prune(filePath, format, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || report.Kept != 2 || len(report.Pruned) != 3 || report.Pruned[0].ID != oldest.ID {
+		t.Errorf("dry run report = %+v", report)
+	}
+	if after, _ := vm.ListVersions(filePath); len(after) != 5 {
+		t.Fatalf("dry run removed versions, %d left", len(after))
+	}
+
+	if _, err := vm.Prune(filePath, format, false); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := vm.ListVersions(filePath)
+	if len(after) != 2 || after[0].ID != versions[0].ID || after[1].ID != second.ID || !after[1].Pinned {
+		t.Fatalf("after pruning listed %+v, want the newest and the pinned version", after)
+	}
+	// Versions stored as deltas still load once their bases are pruned
+	for _, version := range after {
+		if _, err := vm.LoadVersion(filePath, version.ID, format); err != nil {
+			t.Errorf("LoadVersion(%s) after pruning: %v", version.ID, err)
+		}
+	}
+	if issues, err := vm.Verify(filePath, format); err != nil || len(issues) != 0 {
+		t.Errorf("Verify after pruning = %v, %v", issues, err)
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "menu.json")
+	format := &JSONFormat{}
+	bm := NewBackupManager(filepath.Join(dir, "backups"))
+	bm.SetRetention(RetentionPolicy{MaxCount: 1})
+
+	var paths []string
+	for i := 1; i <= 3; i++ {
+		path, err := bm.CreateBackup(filePath, []map[string]any{{"id": float64(i)}}, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+		if i == 1 {
+			if err := bm.Tag(filePath, filepath.Base(path), "opening", true); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Each new backup prunes the last one, but the tagged first backup stays
+	backups, _ := bm.ListBackups(filePath)
+	if len(backups) != 2 || backups[0].Path != paths[2] || backups[1].Path != paths[0] {
+		t.Errorf("listed %+v, want the newest and the tagged backup", backups)
+	}
+	if _, err := os.Stat(paths[1]); !os.IsNotExist(err) {
+		t.Errorf("pruned backup is still on disk: %v", err)
+	}
+}
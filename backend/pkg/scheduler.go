@@ -0,0 +1,409 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRetryDelay is the wait before the first retry of a failed upload
+const DefaultRetryDelay = 30 * time.Second
+
+var (
+	// ErrJobNotFound is returned when no scheduled job has the given name
+	ErrJobNotFound = errors.New("backup job not found")
+	// ErrJobRunning is returned when a job is started while a run is in progress
+	ErrJobRunning = errors.New("backup job is already running")
+)
+
+// BackupJob is a backup taken on a cron schedule and uploaded to destinations
+type BackupJob struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	// Files lists the data files to back up; the whole data directory is archived when empty
+	Files        []string `json:"files,omitempty"`
+	Destinations []string `json:"destinations"`
+	// Retries is the number of further attempts after a failed upload
+	Retries int `json:"retries,omitempty"`
+}
+
+// ScheduleConfig is the schedule file listing destinations and backup jobs
+type ScheduleConfig struct {
+	Destinations map[string]DestinationConfig `json:"destinations"`
+	Jobs         []BackupJob                  `json:"jobs"`
+	// RetryDelay is a duration such as "30s", doubled after each failed attempt
+	RetryDelay string `json:"retryDelay,omitempty"`
+}
+
+// LoadScheduleConfig reads a schedule file
+func LoadScheduleConfig(path string) (*ScheduleConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedule file: %w", err)
+	}
+
+	var config ScheduleConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse schedule file: %w", err)
+	}
+	return &config, nil
+}
+
+// UploadResult reports the upload of one backup object to one destination
+type UploadResult struct {
+	Destination string `json:"destination"`
+	Object      string `json:"object"`
+	Size        int64  `json:"size"`
+	Attempts    int    `json:"attempts"`
+	Success     bool   `json:"success"`
+	Error       string `json:"error,omitempty"`
+}
+
+// JobRun reports one run of a backup job
+type JobRun struct {
+	StartedAt  time.Time      `json:"startedAt"`
+	FinishedAt *time.Time     `json:"finishedAt,omitempty"`
+	Success    bool           `json:"success"`
+	Error      string         `json:"error,omitempty"`
+	Uploads    []UploadResult `json:"uploads"`
+}
+
+// JobStatus describes a scheduled job and its most recent run
+type JobStatus struct {
+	BackupJob
+	NextRun time.Time `json:"nextRun"`
+	Running bool      `json:"running"`
+	LastRun *JobRun   `json:"lastRun,omitempty"`
+	// LastSuccess is when the job last completed without errors
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+}
+
+// scheduledJob is a job with its parsed schedule and run state
+type scheduledJob struct {
+	BackupJob
+	schedule    *CronSchedule
+	next        time.Time
+	running     bool
+	lastRun     *JobRun
+	lastSuccess *time.Time
+}
+
+// Scheduler runs backup jobs in the background on their cron schedules
+type Scheduler struct {
+	mu           sync.Mutex
+	dataDir      string
+	archives     *ArchiveManager
+	destinations map[string]Destination
+	jobs         []*scheduledJob
+	retryDelay   time.Duration
+	// ctx is cancelled by Stop, ending scheduling and pending retries
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler for the jobs in config. Whole data directory
+// backups are streamed from archives.
+func NewScheduler(config *ScheduleConfig, dataDir string, archives *ArchiveManager) (*Scheduler, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		dataDir:      dataDir,
+		archives:     archives,
+		destinations: make(map[string]Destination),
+		retryDelay:   DefaultRetryDelay,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+	if config.RetryDelay != "" {
+		delay, err := time.ParseDuration(config.RetryDelay)
+		if err != nil || delay < 0 {
+			return nil, fmt.Errorf("invalid retry delay %q", config.RetryDelay)
+		}
+		s.retryDelay = delay
+	}
+
+	for name, destConfig := range config.Destinations {
+		destination, err := NewDestination(name, destConfig)
+		if err != nil {
+			return nil, err
+		}
+		s.destinations[name] = destination
+	}
+
+	seen := make(map[string]bool)
+	for _, job := range config.Jobs {
+		if job.Name == "" || strings.ContainsAny(job.Name, `/\`) || seen[job.Name] {
+			return nil, fmt.Errorf("backup job names must be unique and must not contain slashes: %q", job.Name)
+		}
+		seen[job.Name] = true
+
+		schedule, err := ParseCron(job.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", job.Name, err)
+		}
+		if len(job.Destinations) == 0 {
+			return nil, fmt.Errorf("job %s: at least one destination is required", job.Name)
+		}
+		for _, name := range job.Destinations {
+			if _, ok := s.destinations[name]; !ok {
+				return nil, fmt.Errorf("job %s: unknown destination %q", job.Name, name)
+			}
+		}
+		for _, file := range job.Files {
+			if file != filepath.Base(file) || strings.HasPrefix(file, ".") {
+				return nil, fmt.Errorf("job %s: invalid file name %q", job.Name, file)
+			}
+		}
+		s.jobs = append(s.jobs, &scheduledJob{BackupJob: job, schedule: schedule})
+	}
+	return s, nil
+}
+
+// Start runs jobs in the background until Stop is called
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	now := time.Now()
+	for _, job := range s.jobs {
+		job.next = job.schedule.Next(now)
+	}
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.loop()
+}
+
+// Stop stops scheduling jobs, cancels pending retries and waits for running jobs to finish
+func (s *Scheduler) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// loop starts jobs when they are due
+func (s *Scheduler) loop() {
+	defer s.wg.Done()
+
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		var next time.Time
+		for _, job := range s.jobs {
+			if job.next.IsZero() {
+				continue
+			}
+			if !job.next.After(now) {
+				s.startLocked(job)
+				job.next = job.schedule.Next(now)
+			}
+			if next.IsZero() || job.next.Before(next) {
+				next = job.next
+			}
+		}
+		s.mu.Unlock()
+
+		// Wake at least hourly so clock changes are noticed
+		wait := time.Hour
+		if !next.IsZero() && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// RunNow starts a job immediately, outside its schedule
+func (s *Scheduler) RunNow(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		if job.Name != name {
+			continue
+		}
+		if job.running {
+			return ErrJobRunning
+		}
+		s.startLocked(job)
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+}
+
+// startLocked runs a job in the background unless it is already running. Callers must hold the lock.
+func (s *Scheduler) startLocked(job *scheduledJob) {
+	if job.running {
+		fmt.Printf("Warning: Skipping backup job %s, the previous run is still in progress\n", job.Name)
+		return
+	}
+	job.running = true
+	run := &JobRun{StartedAt: time.Now(), Uploads: []UploadResult{}}
+	job.lastRun = run
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		err := s.run(s.ctx, job.BackupJob, run)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		finished := time.Now()
+		run.FinishedAt = &finished
+		run.Success = err == nil
+		if err != nil {
+			run.Error = err.Error()
+			fmt.Printf("Warning: Backup job %s failed: %v\n", job.Name, err)
+		} else {
+			job.lastSuccess = &finished
+		}
+		job.running = false
+	}()
+}
+
+// Status reports every job, ordered by name
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		status := JobStatus{
+			BackupJob:   job.BackupJob,
+			NextRun:     job.next,
+			Running:     job.running,
+			LastSuccess: job.lastSuccess,
+		}
+		if job.lastRun != nil {
+			run := *job.lastRun
+			run.Uploads = append([]UploadResult(nil), job.lastRun.Uploads...)
+			status.LastRun = &run
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// backupObject is a file to upload, named relative to the destination
+type backupObject struct {
+	name    string
+	content io.ReadSeeker
+	size    int64
+}
+
+// run takes the job's backup and uploads it to every destination
+func (s *Scheduler) run(ctx context.Context, job BackupJob, run *JobRun) error {
+	objects, cleanup, err := s.collect(job)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	failed := 0
+	for _, object := range objects {
+		for _, name := range job.Destinations {
+			result := s.upload(ctx, s.destinations[name], object, job.Retries)
+			s.mu.Lock()
+			run.Uploads = append(run.Uploads, result)
+			s.mu.Unlock()
+			if !result.Success {
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d uploads failed", failed, len(objects)*len(job.Destinations))
+	}
+	return nil
+}
+
+// collect takes the backup of a job, either an archive of the data directory
+// or copies of the selected files read at the same point in time
+func (s *Scheduler) collect(job BackupJob) ([]backupObject, func(), error) {
+	id, _ := newSnapshotID()
+
+	if len(job.Files) == 0 {
+		tmp, err := os.CreateTemp("", "backup-*"+archiveExtension)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create temp file: %w", err)
+		}
+		cleanup := func() {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+		if _, err := s.archives.Stream(tmp); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to archive data directory: %w", err)
+		}
+		size, err := tmp.Seek(0, io.SeekCurrent)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		object := backupObject{name: job.Name + "/" + id + archiveExtension, content: tmp, size: size}
+		return []backupObject{object}, cleanup, nil
+	}
+
+	paths := make([]string, len(job.Files))
+	for i, file := range job.Files {
+		paths[i] = filepath.Join(s.dataDir, file)
+	}
+	unlock := lockFiles(paths, false)
+	defer unlock()
+
+	var objects []backupObject
+	for i, file := range job.Files {
+		content, err := os.ReadFile(paths[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		objects = append(objects, backupObject{
+			name:    job.Name + "/" + id + "/" + file,
+			content: bytes.NewReader(content),
+			size:    int64(len(content)),
+		})
+	}
+	return objects, func() {}, nil
+}
+
+// upload puts an object to a destination, retrying with exponential backoff
+func (s *Scheduler) upload(ctx context.Context, destination Destination, object backupObject, retries int) UploadResult {
+	result := UploadResult{Destination: destination.Name(), Object: object.name, Size: object.size}
+	delay := s.retryDelay
+
+	for {
+		result.Attempts++
+		err := destination.Put(ctx, object.name, object.content, object.size)
+		if err == nil {
+			result.Success = true
+			result.Error = ""
+			return result
+		}
+		result.Error = err.Error()
+		if errors.Is(err, ErrPermanent) || result.Attempts > retries {
+			return result
+		}
+
+		select {
+		case <-ctx.Done():
+			result.Error = fmt.Sprintf("%s (cancelled before retrying)", result.Error)
+			return result
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyDestination fails a number of times before accepting uploads
+type flakyDestination struct {
+	failures int
+	err      error
+	attempts []time.Time
+}
+
+func (d *flakyDestination) Name() string {
+	return "flaky"
+}
+
+func (d *flakyDestination) Put(ctx context.Context, name string, r io.ReadSeeker, size int64) error {
+	d.attempts = append(d.attempts, time.Now())
+	if len(d.attempts) <= d.failures {
+		return d.err
+	}
+	return nil
+}
+
+func testObject() backupObject {
+	return backupObject{name: "job/backup.json", content: strings.NewReader("{}"), size: 2}
+}
+
+func TestUploadRetriesWithBackoff(t *testing.T) {
+	const delay = 10 * time.Millisecond
+	s := &Scheduler{retryDelay: delay}
+	destination := &flakyDestination{failures: 3, err: errors.New("connection reset")}
+
+	result := s.upload(context.Background(), destination, testObject(), 3)
+	if !result.Success || result.Attempts != 4 || result.Error != "" {
+		t.Fatalf("upload() = %+v, want success on the 4th attempt", result)
+	}
+	for i := 1; i < len(destination.attempts); i++ {
+		want := delay << (i - 1)
+		if gap := destination.attempts[i].Sub(destination.attempts[i-1]); gap < want {
+			t.Errorf("retry %d after %v, want at least %v", i, gap, want)
+		}
+	}
+}
+
+func TestUploadGivesUpAfterRetries(t *testing.T) {
+	s := &Scheduler{retryDelay: time.Millisecond}
+	destination := &flakyDestination{failures: 10, err: errors.New("connection reset")}
+
+	result := s.upload(context.Background(), destination, testObject(), 2)
+	if result.Success || result.Attempts != 3 || result.Error != "connection reset" {
+		t.Errorf("upload() = %+v, want failure after 3 attempts", result)
+	}
+}
+
+func TestUploadDoesNotRetryPermanentErrors(t *testing.T) {
+	s := &Scheduler{retryDelay: time.Millisecond}
+	destination := &flakyDestination{failures: 10, err: fmt.Errorf("%w: access denied", ErrPermanent)}
+
+	result := s.upload(context.Background(), destination, testObject(), 5)
+	if result.Success || result.Attempts != 1 {
+		t.Errorf("upload() = %+v, want a single failed attempt", result)
+	}
+}
+
+func TestUploadStopsRetryingWhenCancelled(t *testing.T) {
+	s := &Scheduler{retryDelay: time.Hour}
+	destination := &flakyDestination{failures: 10, err: errors.New("connection reset")}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result := s.upload(ctx, destination, testObject(), 5)
+	if result.Success || result.Attempts != 1 || !strings.Contains(result.Error, "cancelled") {
+		t.Errorf("upload() = %+v, want a cancelled failure after one attempt", result)
+	}
+}
@@ -0,0 +1,249 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Kinds of schema changes
+const (
+	SchemaChangeAdded      = "added"
+	SchemaChangeRemoved    = "removed"
+	SchemaChangeType       = "type"
+	SchemaChangeRequired   = "required"
+	SchemaChangeNullable   = "nullable"
+	SchemaChangeEnum       = "enum"
+	SchemaChangeFormat     = "format"
+	SchemaChangePattern    = "pattern"
+	SchemaChangeBounds     = "bounds"
+	SchemaChangePrimaryKey = "primaryKey"
+)
+
+// SchemaChange is one difference between two schemas. A breaking change can reject
+// data the old schema accepted, or remove something clients rely on.
+type SchemaChange struct {
+	// Path names the field, such as price, details.size or items[].price
+	Path     string `json:"path"`
+	Kind     string `json:"kind"`
+	Breaking bool   `json:"breaking"`
+	Old      any    `json:"old,omitempty"`
+	New      any    `json:"new,omitempty"`
+	Message  string `json:"message"`
+}
+
+// SchemaDiff lists the changes from one schema to another
+type SchemaDiff struct {
+	// Breaking is set when any change is breaking
+	Breaking bool           `json:"breaking"`
+	Changes  []SchemaChange `json:"changes"`
+}
+
+// DiffSchemas compares two schemas field by field, including nested objects and array items
+func DiffSchemas(from, to *SchemaInfo) *SchemaDiff {
+	diff := &SchemaDiff{Changes: []SchemaChange{}}
+	if from.PrimaryKey != to.PrimaryKey {
+		diff.add(SchemaChange{
+			Path:     to.PrimaryKey,
+			Kind:     SchemaChangePrimaryKey,
+			Breaking: true,
+			Old:      from.PrimaryKey,
+			New:      to.PrimaryKey,
+			Message:  fmt.Sprintf("primary key changed from %q to %q", from.PrimaryKey, to.PrimaryKey),
+		})
+	}
+	diff.fields("", from.Properties, to.Properties)
+	return diff
+}
+
+func (d *SchemaDiff) add(change SchemaChange) {
+	d.Changes = append(d.Changes, change)
+	d.Breaking = d.Breaking || change.Breaking
+}
+
+// fields compares two sets of properties below prefix
+func (d *SchemaDiff) fields(prefix string, from, to map[string]*FieldInfo) {
+	names := make([]string, 0, len(from)+len(to))
+	for name := range from {
+		names = append(names, name)
+	}
+	for name := range to {
+		if _, ok := from[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := prefix + name
+		oldField, inFrom := from[name]
+		newField, inTo := to[name]
+		switch {
+		case !inFrom:
+			message := "optional field added"
+			if newField.Required {
+				message = "required field added; existing items do not have it"
+			}
+			d.add(SchemaChange{Path: path, Kind: SchemaChangeAdded, Breaking: newField.Required, New: newField.declaredTypes(), Message: message})
+		case !inTo:
+			d.add(SchemaChange{Path: path, Kind: SchemaChangeRemoved, Breaking: true, Old: oldField.declaredTypes(), Message: "field removed"})
+		default:
+			d.field(path, oldField, newField)
+		}
+	}
+}
+
+// field compares one field in both schemas
+func (d *SchemaDiff) field(path string, from, to *FieldInfo) {
+	oldTypes, newTypes := from.declaredTypes(), to.declaredTypes()
+	if !sameTypes(oldTypes, newTypes) {
+		widened := coversTypes(newTypes, oldTypes)
+		message := fmt.Sprintf("type changed from %v to %v", oldTypes, newTypes)
+		if widened {
+			message = fmt.Sprintf("type widened from %v to %v", oldTypes, newTypes)
+		}
+		d.add(SchemaChange{Path: path, Kind: SchemaChangeType, Breaking: !widened, Old: oldTypes, New: newTypes, Message: message})
+	}
+
+	if from.Required != to.Required {
+		message := "no longer required"
+		if to.Required {
+			message = "became required"
+		}
+		d.add(SchemaChange{Path: path, Kind: SchemaChangeRequired, Breaking: to.Required, Old: from.Required, New: to.Required, Message: message})
+	}
+	if from.Nullable != to.Nullable {
+		message := "now accepts null"
+		if !to.Nullable {
+			message = "no longer accepts null"
+		}
+		d.add(SchemaChange{Path: path, Kind: SchemaChangeNullable, Breaking: !to.Nullable, Old: from.Nullable, New: to.Nullable, Message: message})
+	}
+
+	d.enum(path, from.Enum, to.Enum)
+	d.constraint(path, SchemaChangeFormat, "format", from.Format, to.Format)
+	d.constraint(path, SchemaChangePattern, "pattern", from.Pattern, to.Pattern)
+	d.bound(path, "minimum", from.Minimum, to.Minimum, true)
+	d.bound(path, "maximum", from.Maximum, to.Maximum, false)
+	d.bound(path, "minLength", intBound(from.MinLength), intBound(to.MinLength), true)
+	d.bound(path, "maxLength", intBound(from.MaxLength), intBound(to.MaxLength), false)
+
+	if from.Properties != nil && to.Properties != nil {
+		d.fields(path+".", from.Properties, to.Properties)
+	}
+	if from.Items != nil && to.Items != nil {
+		d.field(path+"[]", from.Items, to.Items)
+	}
+}
+
+// enum reports allowed values that were added or removed
+func (d *SchemaDiff) enum(path string, from, to []interface{}) {
+	if len(to) == 0 {
+		if len(from) > 0 {
+			d.add(SchemaChange{Path: path, Kind: SchemaChangeEnum, Old: from, Message: "values no longer restricted"})
+		}
+		return
+	}
+	if len(from) == 0 {
+		d.add(SchemaChange{Path: path, Kind: SchemaChangeEnum, Breaking: true, New: to, Message: "values restricted to a list"})
+		return
+	}
+
+	removed, added := enumDifference(from, to), enumDifference(to, from)
+	if len(removed) > 0 {
+		d.add(SchemaChange{Path: path, Kind: SchemaChangeEnum, Breaking: true, Old: removed, Message: fmt.Sprintf("allowed values removed: %v", removed)})
+	}
+	if len(added) > 0 {
+		d.add(SchemaChange{Path: path, Kind: SchemaChangeEnum, New: added, Message: fmt.Sprintf("allowed values added: %v", added)})
+	}
+}
+
+// constraint reports a format or pattern that was added, changed or removed. Only removing one is compatible.
+func (d *SchemaDiff) constraint(path, kind, name, from, to string) {
+	if from == to {
+		return
+	}
+	message := fmt.Sprintf("%s changed", name)
+	switch {
+	case from == "":
+		message = fmt.Sprintf("%s added", name)
+	case to == "":
+		message = fmt.Sprintf("%s removed", name)
+	}
+	d.add(SchemaChange{Path: path, Kind: kind, Breaking: to != "", Old: from, New: to, Message: message})
+}
+
+// bound reports a changed lower or upper bound. Tightening a bound is breaking.
+func (d *SchemaDiff) bound(path, name string, from, to *float64, lower bool) {
+	switch {
+	case from == nil && to == nil:
+		return
+	case from != nil && to != nil && *from == *to:
+		return
+	}
+
+	change := SchemaChange{Path: path, Kind: SchemaChangeBounds}
+	if from != nil {
+		change.Old = *from
+	}
+	if to != nil {
+		change.New = *to
+	}
+	switch {
+	case to == nil:
+		change.Message = fmt.Sprintf("%s removed", name)
+	case from == nil:
+		change.Breaking = true
+		change.Message = fmt.Sprintf("%s of %v added", name, *to)
+	default:
+		change.Breaking = (*to > *from) == lower
+		change.Message = fmt.Sprintf("%s changed from %v to %v", name, *from, *to)
+	}
+	d.add(change)
+}
+
+// declaredTypes returns the non-null types a field accepts
+func (f *FieldInfo) declaredTypes() []FieldType {
+	if len(f.union) > 0 {
+		return f.union
+	}
+	return f.valueTypes()
+}
+
+// sameTypes reports whether two type lists hold the same types in any order
+func sameTypes(a, b []FieldType) bool {
+	return coversTypes(a, b) && coversTypes(b, a) && len(a) == len(b)
+}
+
+// coversTypes reports whether every value of the old types is accepted by the new types.
+// Numbers accept integers.
+func coversTypes(newTypes, oldTypes []FieldType) bool {
+	for _, t := range oldTypes {
+		if !containsType(newTypes, t) && !(t == FieldTypeInteger && containsType(newTypes, FieldTypeNumber)) {
+			return false
+		}
+	}
+	return true
+}
+
+// enumDifference returns the values of a that are not in b
+func enumDifference(a, b []interface{}) []interface{} {
+	seen := make(map[string]bool, len(b))
+	for _, value := range b {
+		seen[fmt.Sprintf("%T:%v", value, value)] = true
+	}
+	var difference []interface{}
+	for _, value := range a {
+		if !seen[fmt.Sprintf("%T:%v", value, value)] {
+			difference = append(difference, value)
+		}
+	}
+	return difference
+}
+
+func intBound(n *int) *float64 {
+	if n == nil {
+		return nil
+	}
+	f := float64(*n)
+	return &f
+}
@@ -0,0 +1,155 @@
+package pkg
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// schemaInfo parses a JSON Schema document into the fields it describes
+func schemaInfo(t *testing.T, document string) *SchemaInfo {
+	t.Helper()
+	schema, err := ParseFileSchema([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema.Info
+}
+
+// objectSchema returns a document with the given properties and required fields
+func objectSchema(properties, required string) string {
+	return fmt.Sprintf(`{"type": "object", "properties": {"id": {"type": "integer"}, %s}, "required": [%s]}`, properties, required)
+}
+
+func TestDiffSchemas(t *testing.T) {
+	type change struct {
+		path     string
+		kind     string
+		breaking bool
+	}
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		changes []change
+	}{
+		{
+			name:    "optional field added",
+			from:    objectSchema(`"name": {"type": "string"}`, ``),
+			to:      objectSchema(`"name": {"type": "string"}, "notes": {"type": "string"}`, ``),
+			changes: []change{{"notes", SchemaChangeAdded, false}},
+		},
+		{
+			name:    "required field added and field removed",
+			from:    objectSchema(`"name": {"type": "string"}`, ``),
+			to:      objectSchema(`"title": {"type": "string"}`, `"title"`),
+			changes: []change{{"name", SchemaChangeRemoved, true}, {"title", SchemaChangeAdded, true}},
+		},
+		{
+			name:    "type widened",
+			from:    objectSchema(`"price": {"type": "integer"}`, ``),
+			to:      objectSchema(`"price": {"type": ["number", "string"]}`, ``),
+			changes: []change{{"price", SchemaChangeType, false}},
+		},
+		{
+			name:    "type changed",
+			from:    objectSchema(`"price": {"type": "string"}`, ``),
+			to:      objectSchema(`"price": {"type": "number"}`, ``),
+			changes: []change{{"price", SchemaChangeType, true}},
+		},
+		{
+			name:    "union narrowed to a list",
+			from:    objectSchema(`"dietaryInfo": {"anyOf": [{"type": "string"}, {"type": "array", "items": {"type": "string"}}]}`, ``),
+			to:      objectSchema(`"dietaryInfo": {"type": "array", "items": {"type": "string"}}`, ``),
+			changes: []change{{"dietaryInfo", SchemaChangeType, true}},
+		},
+		{
+			name:    "required and null",
+			from:    objectSchema(`"name": {"type": "string"}, "notes": {"type": ["string", "null"]}`, `"name"`),
+			to:      objectSchema(`"name": {"type": ["string", "null"]}, "notes": {"type": "string"}`, `"notes"`),
+			changes: []change{{"name", SchemaChangeRequired, false}, {"name", SchemaChangeNullable, false}, {"notes", SchemaChangeRequired, true}, {"notes", SchemaChangeNullable, true}},
+		},
+		{
+			name:    "enum values",
+			from:    objectSchema(`"size": {"type": "string", "enum": ["S", "M", "L"]}, "spice": {"type": "string", "enum": ["mild"]}`, ``),
+			to:      objectSchema(`"size": {"type": "string", "enum": ["S", "M"]}, "spice": {"type": "string", "enum": ["mild", "hot"]}`, ``),
+			changes: []change{{"size", SchemaChangeEnum, true}, {"spice", SchemaChangeEnum, false}},
+		},
+		{
+			name:    "formats and patterns",
+			from:    objectSchema(`"email": {"type": "string", "format": "email"}, "code": {"type": "string"}`, ``),
+			to:      objectSchema(`"email": {"type": "string"}, "code": {"type": "string", "pattern": "^[A-Z]+$"}`, ``),
+			changes: []change{{"code", SchemaChangePattern, true}, {"email", SchemaChangeFormat, false}},
+		},
+		{
+			name: "bounds tightened and loosened",
+			from: objectSchema(`"qty": {"type": "integer", "minimum": 1, "maximum": 10}, "name": {"type": "string", "maxLength": 20}`, ``),
+			to:   objectSchema(`"qty": {"type": "integer", "minimum": 0, "maximum": 5}, "name": {"type": "string", "minLength": 1}`, ``),
+			changes: []change{
+				{"name", SchemaChangeBounds, true},
+				{"name", SchemaChangeBounds, false},
+				{"qty", SchemaChangeBounds, false},
+				{"qty", SchemaChangeBounds, true},
+			},
+		},
+		{
+			name:    "nested fields",
+			from:    objectSchema(`"items": {"type": "array", "items": {"type": "object", "properties": {"price": {"type": "number"}}}}`, ``),
+			to:      objectSchema(`"items": {"type": "array", "items": {"type": "object", "properties": {"price": {"type": "string"}}}}`, ``),
+			changes: []change{{"items[].price", SchemaChangeType, true}},
+		},
+		{
+			name:    "primary key",
+			from:    objectSchema(`"name": {"type": "string"}`, ``),
+			to:      `{"type": "object", "x-primaryKey": "name", "properties": {"id": {"type": "integer"}, "name": {"type": "string"}}}`,
+			changes: []change{{"name", SchemaChangePrimaryKey, true}},
+		},
+		{
+			name: "unchanged",
+			from: objectSchema(`"name": {"type": "string"}`, `"name"`),
+			to:   objectSchema(`"name": {"type": "string"}`, `"name"`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := DiffSchemas(schemaInfo(t, tt.from), schemaInfo(t, tt.to))
+			changes := []change{}
+			breaking := false
+			for _, c := range diff.Changes {
+				changes = append(changes, change{c.Path, c.Kind, c.Breaking})
+				breaking = breaking || c.Breaking
+			}
+			if tt.changes == nil {
+				tt.changes = []change{}
+			}
+			if !reflect.DeepEqual(changes, tt.changes) {
+				t.Errorf("changes = %+v, want %+v", changes, tt.changes)
+			}
+			if diff.Breaking != breaking {
+				t.Errorf("Breaking = %v with changes %+v", diff.Breaking, diff.Changes)
+			}
+		})
+	}
+}
+
+func TestDiffInferredSchemas(t *testing.T) {
+	// Splitting dietaryInfo into lists narrows its type, while the data stays valid
+	before, err := NewSchemaGenerator().GenerateSchema(decodeItems(t, `[{"id": 1, "dietaryInfo": "V"}, {"id": 2, "dietaryInfo": ["V", "GF"]}, {"id": 3, "dietaryInfo": "GF"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := NewSchemaGenerator().GenerateSchema(decodeItems(t, `[{"id": 1, "dietaryInfo": ["V"]}, {"id": 2, "dietaryInfo": ["V", "GF"]}, {"id": 3, "dietaryInfo": ["GF"]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := DiffSchemas(before, after)
+	if len(diff.Changes) == 0 || !diff.Breaking {
+		t.Fatalf("diff = %+v, want a breaking type change", diff)
+	}
+	first := diff.Changes[0]
+	wantOld, wantNew := []FieldType{FieldTypeString, FieldTypeArray}, []FieldType{FieldTypeArray}
+	if first.Path != "dietaryInfo" || first.Kind != SchemaChangeType || !reflect.DeepEqual(first.Old, wantOld) || !reflect.DeepEqual(first.New, wantNew) {
+		t.Errorf("first change = %+v, want dietaryInfo narrowed from %v to %v", first, wantOld, wantNew)
+	}
+}
@@ -2,7 +2,8 @@ package pkg
 
 import (
 	"fmt"
-	"reflect"
+	"math"
+	"math/rand"
 	"sort"
 	"strings"
 )
@@ -17,6 +18,8 @@ const (
 	FieldTypeBoolean FieldType = "boolean"
 	FieldTypeArray   FieldType = "array"
 	FieldTypeObject  FieldType = "object"
+	// FieldTypeNull is the type of fields whose values are all null
+	FieldTypeNull FieldType = "null"
 )
 
 // FieldInfo contains information about a field
@@ -31,6 +34,24 @@ type FieldInfo struct {
 	Enum        []interface{}         `json:"enum,omitempty"`
 	Description string                `json:"description,omitempty"`
 	Example     interface{}           `json:"example,omitempty"`
+	// Nullable fields also accept null
+	Nullable bool `json:"nullable,omitempty"`
+	// Types counts the values seen of each type, including null. Fields whose
+	// values have several types accept all of them; Type is the most common.
+	Types map[FieldType]int `json:"types,omitempty"`
+	// Format is a JSON Schema format such as date-time, or currency or decimal
+	// for strings holding amounts
+	Format  string `json:"format,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	// Bounds of numbers and of string lengths, inferred from the values seen
+	Minimum   *float64 `json:"minimum,omitempty"`
+	Maximum   *float64 `json:"maximum,omitempty"`
+	MinLength *int     `json:"minLength,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+	// Coerce is how text input for the field is converted: strict, lenient or off
+	Coerce string `json:"coerce,omitempty"`
+	// union lists the non-null types of a schema property that accepts several
+	union []FieldType
 }
 
 // SchemaInfo contains complete schema information for a file
@@ -40,6 +61,8 @@ type SchemaInfo struct {
 	Required   []string               `json:"required"`
 	Properties map[string]*FieldInfo  `json:"properties"`
 	Schema     map[string]interface{} `json:"schema"`
+	// Coerce is the coercion mode of fields that do not set one
+	Coerce string `json:"coerce,omitempty"`
 }
 
 // SchemaGenerator generates JSON schemas from data samples
@@ -54,7 +77,8 @@ func NewSchemaGenerator() *SchemaGenerator {
 	}
 }
 
-// GenerateSchema analyzes data and generates schema information
+// GenerateSchema analyzes data and generates schema information. The types of
+// files with more items than the sample size are inferred from a random sample.
 func (sg *SchemaGenerator) GenerateSchema(data []map[string]interface{}) (*SchemaInfo, error) {
 	if len(data) == 0 {
 		return &SchemaInfo{
@@ -65,130 +89,194 @@ func (sg *SchemaGenerator) GenerateSchema(data []map[string]interface{}) (*Schem
 		}, nil
 	}
 
-	// Analyze field information
-	fieldMap := make(map[string]*FieldInfo)
-	fieldValues := make(map[string]map[string]int) // Track unique values for enums
+	fields := sg.inferFields(data)
 
-	// First pass: collect field information
-	for _, item := range data {
-		for field, value := range item {
-			if _, exists := fieldMap[field]; !exists {
-				fieldMap[field] = &FieldInfo{
-					Name:       field,
-					Properties: make(map[string]*FieldInfo),
-				}
-			}
+	// Set example values
+	for _, field := range fields {
+		if sample, exists := data[0][field.Name]; exists {
+			field.Example = sample
+		}
+	}
 
-			fieldInfo := fieldMap[field]
-			fieldType := sg.inferFieldType(value)
+	// Determine primary key (look for 'id' field or first unique field)
+	primaryKey := sg.findPrimaryKey(fields)
 
-			// Update field type if it's more general
-			if !sg.isMoreSpecificType(fieldInfo.Type, fieldType) {
-				fieldInfo.Type = fieldType
-			}
+	// Build JSON schema
+	jsonSchema := sg.buildJSONSchema(fields)
+
+	return &SchemaInfo{
+		Fields:     fields,
+		PrimaryKey: primaryKey,
+		Required:   sg.getRequiredFields(fields),
+		Properties: sg.buildPropertiesMap(fields),
+		Schema:     jsonSchema,
+	}, nil
+}
 
-			// Track values for enum detection
-			if fieldValues[field] == nil {
-				fieldValues[field] = make(map[string]int)
+// inferFields infers the fields of a set of objects, sorted by name. Types and
+// formats are inferred from a sample of the objects, while whether a field is
+// required or unique is decided from all of them.
+func (sg *SchemaGenerator) inferFields(objects []map[string]interface{}) []*FieldInfo {
+	sample := reservoirSample(objects, sg.maxSampleSize)
+	values := make(map[string][]interface{})
+	var names []string
+	for _, object := range sample {
+		for name, value := range object {
+			if _, seen := values[name]; !seen {
+				names = append(names, name)
 			}
-			fieldValues[field][fmt.Sprintf("%v", value)]++
-
-			// Check if field is array
-			if sg.isArray(value) {
-				fieldInfo.Array = true
-				if arrayItems, ok := value.([]interface{}); ok && len(arrayItems) > 0 {
-					// Infer type of array items
-					itemType := sg.inferFieldType(arrayItems[0])
-					if fieldInfo.Items == nil {
-						fieldInfo.Items = &FieldInfo{
-							Type: itemType,
-						}
+			values[name] = append(values[name], value)
+		}
+	}
+
+	sampled := len(sample) < len(objects)
+	present := make(map[string]int)
+	distinct := make(map[string]map[string]bool)
+	duplicated := make(map[string]bool)
+	if sampled {
+		inSample := make(map[string]bool, len(names))
+		for _, name := range names {
+			inSample[name] = true
+		}
+		for _, object := range objects {
+			for name, value := range object {
+				present[name]++
+				// Fields missing from the sample are inferred from their first values
+				if !inSample[name] && len(values[name]) < sg.maxSampleSize {
+					if _, seen := values[name]; !seen {
+						names = append(names, name)
 					}
+					values[name] = append(values[name], value)
 				}
-			}
 
-			// Check if field is object
-			if sg.isObject(value) {
-				fieldInfo.Type = FieldTypeObject
-				if obj, ok := value.(map[string]interface{}); ok {
-					sg.analyzeObjectProperties(obj, fieldInfo.Properties)
+				if duplicated[name] {
+					continue
 				}
+				if distinct[name] == nil {
+					distinct[name] = make(map[string]bool)
+				}
+				key := fmt.Sprintf("%v", value)
+				if distinct[name][key] {
+					duplicated[name] = true
+					delete(distinct, name)
+					continue
+				}
+				distinct[name][key] = true
 			}
 		}
 	}
-
-	// Second pass: determine required fields and enums
-	var fields []*FieldInfo
-	totalItems := len(data)
-
-	for field, fieldInfo := range fieldMap {
-		// Check if field is required (present in all items)
-		fieldInfo.Required = true
-		for _, item := range data {
-			if _, exists := item[field]; !exists {
-				fieldInfo.Required = false
-				break
-			}
+	sort.Strings(names)
+
+	fields := make([]*FieldInfo, 0, len(names))
+	for _, name := range names {
+		field := sg.inferField(name, values[name], len(sample))
+		if sampled {
+			field.Required = present[name] == len(objects)
+			field.Unique = field.Required && !duplicated[name]
+		} else {
+			field.Required = len(values[name]) == len(objects)
 		}
+		fields = append(fields, field)
+	}
+	return fields
+}
 
-		// Check for unique constraint
-		if uniqueValues := fieldValues[field]; len(uniqueValues) == totalItems {
-			fieldInfo.Unique = true
+// inferField infers a field from the values it has in total objects. Nested
+// objects and the elements of arrays are inferred recursively from all samples.
+func (sg *SchemaGenerator) inferField(name string, values []interface{}, total int) *FieldInfo {
+	field := &FieldInfo{Name: name}
+	stats := newValueStats()
+	distinct := make(map[string]interface{}) // Original value of each unique value
+	var objects []map[string]interface{}
+	var elements []interface{}
+
+	for _, value := range values {
+		stats.add(sg.inferFieldType(value), value)
+		key := fmt.Sprintf("%v", value)
+		if _, seen := distinct[key]; !seen {
+			distinct[key] = value
 		}
 
-		// Check for enum values (if field has few unique values relative to total)
-		if uniqueCount := len(fieldValues[field]); uniqueCount <= 10 && uniqueCount < totalItems/2 {
-			for value := range fieldValues[field] {
-				fieldInfo.Enum = append(fieldInfo.Enum, value)
-			}
-			sort.Slice(fieldInfo.Enum, func(i, j int) bool {
-				return fmt.Sprintf("%v", fieldInfo.Enum[i]) < fmt.Sprintf("%v", fieldInfo.Enum[j])
-			})
+		switch v := value.(type) {
+		case map[string]interface{}:
+			objects = append(objects, v)
+		case []interface{}:
+			elements = append(elements, v...)
 		}
+	}
 
-		// Set example value
-		if len(data) > 0 {
-			if sample, exists := data[0][field]; exists {
-				fieldInfo.Example = sample
-			}
+	field.Type = stats.fieldType()
+	field.Nullable = stats.nulls > 0 && field.Type != FieldTypeNull
+	field.Array = field.Type == FieldTypeArray
+	field.Types = stats.typeCounts()
+
+	// Check for unique constraint
+	field.Unique = len(distinct) == total
+
+	// Check for enum values (if field has few unique values relative to total).
+	// Enums keep the original values so they validate against the field's type;
+	// arrays and objects are never enumerated.
+	if uniqueCount := len(distinct); uniqueCount <= 10 && uniqueCount < total/2 && sg.isEnumerable(distinct) {
+		for _, value := range distinct {
+			field.Enum = append(field.Enum, value)
 		}
+		sort.Slice(field.Enum, func(i, j int) bool {
+			return fmt.Sprintf("%v", field.Enum[i]) < fmt.Sprintf("%v", field.Enum[j])
+		})
+	}
 
-		fields = append(fields, fieldInfo)
+	// Formats, patterns and bounds describe the values an enum doesn't already list
+	if len(field.Enum) == 0 {
+		sg.inferConstraints(field, stats)
 	}
 
-	// Sort fields by name for consistent output
-	sort.Slice(fields, func(i, j int) bool {
-		return fields[i].Name < fields[j].Name
-	})
+	if len(objects) > 0 {
+		field.Properties = sg.buildPropertiesMap(sg.inferFields(objects))
+	}
+	if len(elements) > 0 {
+		elements = reservoirSample(elements, sg.maxSampleSize)
+		field.Items = sg.inferField("", elements, len(elements))
+		// Uniqueness of array elements is not a property of the field
+		field.Items.Unique = false
+	}
 
-	// Determine primary key (look for 'id' field or first unique field)
-	primaryKey := sg.findPrimaryKey(fields)
+	return field
+}
 
-	// Build JSON schema
-	jsonSchema := sg.buildJSONSchema(fields, primaryKey)
+// reservoirSample returns at most n items chosen uniformly at random. The seed is
+// fixed so that the same data always yields the same schema.
+func reservoirSample[T any](items []T, n int) []T {
+	if n <= 0 || len(items) <= n {
+		return items
+	}
 
-	return &SchemaInfo{
-		Fields:     fields,
-		PrimaryKey: primaryKey,
-		Required:   sg.getRequiredFields(fields),
-		Properties: sg.buildPropertiesMap(fields),
-		Schema:     jsonSchema,
-	}, nil
+	rng := rand.New(rand.NewSource(1))
+	sample := make([]T, n)
+	copy(sample, items[:n])
+	for i := n; i < len(items); i++ {
+		if j := rng.Intn(i + 1); j < n {
+			sample[j] = items[i]
+		}
+	}
+	return sample
 }
 
-// inferFieldType determines the type of a value
+// inferFieldType determines the type of a value. Whole numbers decoded as
+// floats, as JSON numbers always are, are integers.
 func (sg *SchemaGenerator) inferFieldType(value interface{}) FieldType {
 	if value == nil {
-		return FieldTypeString
+		return FieldTypeNull
 	}
 
 	switch v := value.(type) {
 	case string:
 		return FieldTypeString
-	case int, int8, int16, int32, int64:
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
 		return FieldTypeInteger
-	case float32, float64:
-		return FieldTypeNumber
+	case float32:
+		return sg.numberType(float64(v))
+	case float64:
+		return sg.numberType(v)
 	case bool:
 		return FieldTypeBoolean
 	case []interface{}:
@@ -196,18 +284,26 @@ func (sg *SchemaGenerator) inferFieldType(value interface{}) FieldType {
 	case map[string]interface{}:
 		return FieldTypeObject
 	default:
-		// Try to convert to string
-		if reflect.TypeOf(v).Kind() == reflect.String {
-			return FieldTypeString
-		}
 		return FieldTypeString
 	}
 }
 
-// isMoreSpecificType checks if newType is more specific than currentType
-func (sg *SchemaGenerator) isMoreSpecificType(current, new FieldType) bool {
-	// For now, just check if they're different
-	return current != "" && current != new
+// numberType reports whether a float holds an integer value that survives a round trip
+func (sg *SchemaGenerator) numberType(v float64) FieldType {
+	if v == math.Trunc(v) && math.Abs(v) <= maxSafeInteger {
+		return FieldTypeInteger
+	}
+	return FieldTypeNumber
+}
+
+// isEnumerable reports whether all values are scalars that can be listed in an enum
+func (sg *SchemaGenerator) isEnumerable(values map[string]interface{}) bool {
+	for _, value := range values {
+		if sg.isArray(value) || sg.isObject(value) {
+			return false
+		}
+	}
+	return true
 }
 
 // isArray checks if a value is an array
@@ -222,31 +318,18 @@ func (sg *SchemaGenerator) isObject(value interface{}) bool {
 	return ok
 }
 
-// analyzeObjectProperties recursively analyzes object properties
-func (sg *SchemaGenerator) analyzeObjectProperties(obj map[string]interface{}, properties map[string]*FieldInfo) {
-	for key, value := range obj {
-		if _, exists := properties[key]; !exists {
-			fieldType := sg.inferFieldType(value)
-			properties[key] = &FieldInfo{
-				Name: key,
-				Type: fieldType,
-			}
-		}
-	}
-}
-
 // findPrimaryKey looks for a primary key field
 func (sg *SchemaGenerator) findPrimaryKey(fields []*FieldInfo) string {
 	// Look for 'id' field first
 	for _, field := range fields {
-		if strings.ToLower(field.Name) == "id" && field.Unique {
+		if strings.ToLower(field.Name) == "id" && field.Unique && sg.isScalarField(field) {
 			return field.Name
 		}
 	}
 
-	// Look for any unique field
+	// Look for any unique scalar field; arrays and objects can't identify an item
 	for _, field := range fields {
-		if field.Unique {
+		if field.Unique && sg.isScalarField(field) {
 			return field.Name
 		}
 	}
@@ -259,6 +342,11 @@ func (sg *SchemaGenerator) findPrimaryKey(fields []*FieldInfo) string {
 	return ""
 }
 
+// isScalarField reports whether a field holds single string, number or boolean values
+func (sg *SchemaGenerator) isScalarField(field *FieldInfo) bool {
+	return !field.Array && field.Type != FieldTypeArray && field.Type != FieldTypeObject
+}
+
 // getRequiredFields returns list of required field names
 func (sg *SchemaGenerator) getRequiredFields(fields []*FieldInfo) []string {
 	var required []string
@@ -280,24 +368,25 @@ func (sg *SchemaGenerator) buildPropertiesMap(fields []*FieldInfo) map[string]*F
 }
 
 // buildJSONSchema builds a JSON schema from field information
-func (sg *SchemaGenerator) buildJSONSchema(fields []*FieldInfo, primaryKey string) map[string]interface{} {
+func (sg *SchemaGenerator) buildJSONSchema(fields []*FieldInfo) map[string]interface{} {
+	return sg.objectSchema(sg.buildPropertiesMap(fields))
+}
+
+// objectSchema builds the schema of objects with the given properties
+func (sg *SchemaGenerator) objectSchema(properties map[string]*FieldInfo) map[string]interface{} {
 	schema := map[string]interface{}{
 		"type":                 "object",
-		"properties":           make(map[string]interface{}),
+		"properties":           sg.buildPropertiesSchema(properties),
 		"additionalProperties": false,
 	}
 
-	properties := schema["properties"].(map[string]interface{})
 	var required []string
-
-	for _, field := range fields {
-		fieldSchema := sg.buildFieldSchema(field)
-		properties[field.Name] = fieldSchema
-
+	for name, field := range properties {
 		if field.Required {
-			required = append(required, field.Name)
+			required = append(required, name)
 		}
 	}
+	sort.Strings(required)
 
 	if len(required) > 0 {
 		schema["required"] = required
@@ -306,10 +395,38 @@ func (sg *SchemaGenerator) buildJSONSchema(fields []*FieldInfo, primaryKey strin
 	return schema
 }
 
-// buildFieldSchema builds schema for a single field
+// buildFieldSchema builds schema for a single field. Fields with values of
+// several types accept each of them, with anyOf when arrays or objects are involved.
 func (sg *SchemaGenerator) buildFieldSchema(field *FieldInfo) map[string]interface{} {
-	fieldSchema := map[string]interface{}{
-		"type": string(field.Type),
+	fieldSchema := make(map[string]interface{})
+	types := field.valueTypes()
+
+	switch {
+	case len(types) > 1 && (containsType(types, FieldTypeArray) || containsType(types, FieldTypeObject)):
+		var branches []interface{}
+		for _, t := range types {
+			branches = append(branches, sg.typeSchema(field, t))
+		}
+		if field.Nullable {
+			branches = append(branches, map[string]interface{}{"type": string(FieldTypeNull)})
+		}
+		fieldSchema["anyOf"] = branches
+	case len(types) > 1:
+		var names []interface{}
+		for _, t := range types {
+			names = append(names, string(t))
+		}
+		if field.Nullable {
+			names = append(names, string(FieldTypeNull))
+		}
+		fieldSchema["type"] = names
+	default:
+		for key, value := range sg.typeSchema(field, field.Type) {
+			fieldSchema[key] = value
+		}
+		if field.Nullable {
+			fieldSchema["type"] = []interface{}{fieldSchema["type"], string(FieldTypeNull)}
+		}
 	}
 
 	if field.Description != "" {
@@ -320,25 +437,33 @@ func (sg *SchemaGenerator) buildFieldSchema(field *FieldInfo) map[string]interfa
 		fieldSchema["enum"] = field.Enum
 	}
 
-	if field.Array {
-		fieldSchema["type"] = "array"
+	sg.addConstraints(fieldSchema, field)
+
+	return fieldSchema
+}
+
+// typeSchema builds the schema of one type of a field's values
+func (sg *SchemaGenerator) typeSchema(field *FieldInfo, fieldType FieldType) map[string]interface{} {
+	schema := map[string]interface{}{
+		"type": string(fieldType),
+	}
+
+	switch fieldType {
+	case FieldTypeArray:
 		if field.Items != nil {
-			fieldSchema["items"] = map[string]interface{}{
-				"type": string(field.Items.Type),
-			}
+			schema["items"] = sg.buildFieldSchema(field.Items)
 		} else {
-			fieldSchema["items"] = map[string]interface{}{
+			schema["items"] = map[string]interface{}{
 				"type": "string",
 			}
 		}
+	case FieldTypeObject:
+		if len(field.Properties) > 0 {
+			schema = sg.objectSchema(field.Properties)
+		}
 	}
 
-	if field.Type == FieldTypeObject && len(field.Properties) > 0 {
-		fieldSchema["type"] = "object"
-		fieldSchema["properties"] = sg.buildPropertiesSchema(field.Properties)
-	}
-
-	return fieldSchema
+	return schema
 }
 
 // buildPropertiesSchema builds schema for nested object properties
@@ -380,34 +505,51 @@ func (sg *SchemaGenerator) GenerateSchemaFromCSV(filePath string) (*SchemaInfo,
 	return sg.GenerateSchema(data)
 }
 
-// ValidateDataAgainstSchema validates data against a schema
-func (sg *SchemaGenerator) ValidateDataAgainstSchema(data []map[string]interface{}, schema *SchemaInfo) []error {
-	var errors []error
+// ValidateDataAgainstSchema validates data against a schema. Paths start with the item's index.
+func (sg *SchemaGenerator) ValidateDataAgainstSchema(data []map[string]interface{}, schema *SchemaInfo) ValidationErrors {
+	var errors ValidationErrors
 
 	for i, item := range data {
 		for _, field := range schema.Fields {
 			value, exists := item[field.Name]
+			path := fmt.Sprintf("/%d/%s", i, escapePointer(field.Name))
 
 			// Check required fields
 			if field.Required && !exists {
-				errors = append(errors, fmt.Errorf("item %d: missing required field '%s'", i, field.Name))
+				errors = append(errors, &ValidationError{
+					Path:    path,
+					Rule:    "required",
+					Message: fmt.Sprintf("missing required field '%s'", field.Name),
+				})
 				continue
 			}
 
 			// Skip validation if field doesn't exist and is not required
-			if !exists {
+			if !exists || (value == nil && field.Nullable) {
 				continue
 			}
 
 			// Validate field type
-			if err := sg.validateFieldValue(value, field); err != nil {
-				errors = append(errors, fmt.Errorf("item %d, field '%s': %w", i, field.Name, err))
+			if err := sg.validateFieldValue(value, field); err != nil && !sg.matchesAnyType(value, field) {
+				errors = append(errors, &ValidationError{
+					Path:     path,
+					Rule:     "type",
+					Expected: field.declaredTypes(),
+					Actual:   value,
+					Message:  err.Error(),
+				})
 			}
 
 			// Validate enum values
 			if len(field.Enum) > 0 {
 				if err := sg.validateEnumValue(value, field); err != nil {
-					errors = append(errors, fmt.Errorf("item %d, field '%s': %w", i, field.Name, err))
+					errors = append(errors, &ValidationError{
+						Path:     path,
+						Rule:     "enum",
+						Expected: field.Enum,
+						Actual:   value,
+						Message:  err.Error(),
+					})
 				}
 			}
 		}
@@ -423,6 +565,10 @@ func (sg *SchemaGenerator) validateFieldValue(value interface{}, field *FieldInf
 		if _, ok := value.(string); !ok {
 			return fmt.Errorf("expected string, got %T", value)
 		}
+	case FieldTypeNull:
+		if value != nil {
+			return fmt.Errorf("expected null, got %T", value)
+		}
 	case FieldTypeInteger:
 		switch value.(type) {
 		case int, int8, int16, int32, int64:
@@ -461,6 +607,16 @@ func (sg *SchemaGenerator) validateFieldValue(value interface{}, field *FieldInf
 	return nil
 }
 
+// matchesAnyType reports whether a value has one of the types seen in a mixed-type field
+func (sg *SchemaGenerator) matchesAnyType(value interface{}, field *FieldInfo) bool {
+	for _, t := range field.valueTypes() {
+		if sg.validateFieldValue(value, &FieldInfo{Type: t}) == nil {
+			return true
+		}
+	}
+	return false
+}
+
 // validateEnumValue validates that a value is in the enum list
 func (sg *SchemaGenerator) validateEnumValue(value interface{}, field *FieldInfo) error {
 	valueStr := fmt.Sprintf("%v", value)
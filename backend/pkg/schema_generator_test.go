@@ -0,0 +1,59 @@
+package pkg
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGenerateSchemaChecksUniquenessOfAllItems(t *testing.T) {
+	const count = 5000
+	data := make([]map[string]interface{}, count)
+	for i := range data {
+		data[i] = map[string]interface{}{
+			"code": fmt.Sprintf("c%d", i),
+			"ref":  fmt.Sprintf("r%d", i),
+			"opt":  fmt.Sprintf("o%d", i),
+		}
+	}
+	// A single duplicate and a single missing value are unlikely to be sampled
+	data[count-1]["code"] = "c0"
+	delete(data[count-2], "opt")
+	data[count-1]["note"] = "only here"
+
+	info, err := NewSchemaGenerator().GenerateSchema(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, opt, note := info.Properties["code"], info.Properties["opt"], info.Properties["note"]
+	if code == nil || code.Unique || !code.Required {
+		t.Errorf("code = %+v, want required and not unique", code)
+	}
+	if opt == nil || opt.Required || opt.Unique {
+		t.Errorf("opt = %+v, want neither required nor unique", opt)
+	}
+	if note == nil || note.Required || note.Type != FieldTypeString {
+		t.Errorf("note = %+v, want an optional string", note)
+	}
+	if info.PrimaryKey != "ref" {
+		t.Errorf("primary key = %q, want the unique ref", info.PrimaryKey)
+	}
+}
+
+func TestGenerateSchemaUniqueWithoutSampling(t *testing.T) {
+	data := []map[string]interface{}{
+		{"id": 1.0, "name": "a"},
+		{"id": 2.0, "name": "a"},
+		{"id": 3.0},
+	}
+	info, err := NewSchemaGenerator().GenerateSchema(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.PrimaryKey != "id" || !info.Properties["id"].Required {
+		t.Errorf("primary key = %q, id = %+v", info.PrimaryKey, info.Properties["id"])
+	}
+	if name := info.Properties["name"]; name.Unique || name.Required {
+		t.Errorf("name = %+v, want neither required nor unique", name)
+	}
+}
@@ -0,0 +1,325 @@
+package pkg
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/oarkflow/jsonschema"
+)
+
+// maxSafeInteger is the largest integer a float64 holds exactly (2^53)
+const maxSafeInteger = 1 << 53
+
+// Formats of string amounts, which JSON Schema has no format for. They are
+// written to schemas as a pattern plus this annotation.
+const (
+	FormatCurrency = "currency"
+	FormatDecimal  = "decimal"
+)
+
+// formatKeyword annotates a schema with a format that is enforced by its pattern
+const formatKeyword = "x-format"
+
+// inferredFormats are the JSON Schema formats detected in strings, most specific first
+var inferredFormats = []string{"date-time", "date", "uuid", "email", "uri"}
+
+// amountPattern matches an amount such as 1,299.99
+const amountPattern = `\d{1,3}(,?\d{3})*(\.\d{1,2})?`
+
+var (
+	// currencyValue matches prices such as "$19.99", or "$8.99/15.99" for several sizes
+	currencyValue = regexp.MustCompile(`^-?([$€£¥])` + amountPattern + `(/[$€£¥]?` + amountPattern + `)*$`)
+	decimalValue  = regexp.MustCompile(`^-?\d+\.\d+$`)
+	// identifierToken splits identifiers such as "app-12" into letters, digits and separators
+	identifierToken = regexp.MustCompile(`[A-Za-z]+|[0-9]+|[^A-Za-z0-9]`)
+)
+
+// maxIdentifierLength bounds the strings considered for id patterns
+const maxIdentifierLength = 64
+
+// valueStats accumulates what the values of one field have in common
+type valueStats struct {
+	types   map[FieldType]int
+	nulls   int
+	strings []string
+	numbers []float64
+}
+
+func newValueStats() *valueStats {
+	return &valueStats{types: make(map[FieldType]int)}
+}
+
+// add records one value of the field
+func (vs *valueStats) add(fieldType FieldType, value interface{}) {
+	if fieldType == FieldTypeNull {
+		vs.nulls++
+		return
+	}
+	vs.types[fieldType]++
+
+	switch v := value.(type) {
+	case string:
+		vs.strings = append(vs.strings, v)
+	case float64:
+		vs.numbers = append(vs.numbers, v)
+	case float32:
+		vs.numbers = append(vs.numbers, float64(v))
+	case int:
+		vs.numbers = append(vs.numbers, float64(v))
+	case int64:
+		vs.numbers = append(vs.numbers, float64(v))
+	case int32:
+		vs.numbers = append(vs.numbers, float64(v))
+	case uint64:
+		vs.numbers = append(vs.numbers, float64(v))
+	}
+}
+
+// count returns the number of non-null values
+func (vs *valueStats) count() int {
+	total := 0
+	for _, n := range vs.types {
+		total += n
+	}
+	return total
+}
+
+// fieldType returns the most common type of the non-null values
+func (vs *valueStats) fieldType() FieldType {
+	if vs.count() == 0 {
+		return FieldTypeNull
+	}
+	return (&FieldInfo{Types: vs.types}).valueTypes()[0]
+}
+
+// typeCounts returns the number of values of each type, including null
+func (vs *valueStats) typeCounts() map[FieldType]int {
+	counts := make(map[FieldType]int, len(vs.types)+1)
+	for fieldType, n := range vs.types {
+		counts[fieldType] = n
+	}
+	if vs.nulls > 0 {
+		counts[FieldTypeNull] = vs.nulls
+	}
+	return counts
+}
+
+// valueTypes returns the types a field's non-null values have, most common first.
+// Integers are counted as numbers when the field also holds other numbers.
+func (f *FieldInfo) valueTypes() []FieldType {
+	if len(f.Types) == 0 {
+		if f.Type == FieldTypeNull {
+			return nil
+		}
+		return []FieldType{f.Type}
+	}
+
+	counts := make(map[FieldType]int)
+	for fieldType, n := range f.Types {
+		if fieldType != FieldTypeNull {
+			counts[fieldType] += n
+		}
+	}
+	if counts[FieldTypeInteger] > 0 && counts[FieldTypeNumber] > 0 {
+		counts[FieldTypeNumber] += counts[FieldTypeInteger]
+		delete(counts, FieldTypeInteger)
+	}
+
+	types := make([]FieldType, 0, len(counts))
+	for fieldType := range counts {
+		types = append(types, fieldType)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if counts[types[i]] != counts[types[j]] {
+			return counts[types[i]] > counts[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	return types
+}
+
+// Mixed reports whether a field's non-null values have more than one type
+func (f *FieldInfo) Mixed() bool {
+	return len(f.valueTypes()) > 1
+}
+
+func containsType(types []FieldType, fieldType FieldType) bool {
+	for _, t := range types {
+		if t == fieldType {
+			return true
+		}
+	}
+	return false
+}
+
+// inferConstraints sets the format, pattern and bounds that all values of a field satisfy
+func (sg *SchemaGenerator) inferConstraints(field *FieldInfo, stats *valueStats) {
+	switch field.Type {
+	case FieldTypeInteger, FieldTypeNumber:
+		// Bounds only hold if every non-null value is a number
+		if len(stats.numbers) == 0 || len(stats.numbers) != stats.count() {
+			return
+		}
+		lo, hi := stats.numbers[0], stats.numbers[0]
+		for _, n := range stats.numbers {
+			lo, hi = math.Min(lo, n), math.Max(hi, n)
+		}
+		field.Minimum, field.Maximum = &lo, &hi
+
+	case FieldTypeString:
+		// Bounds and patterns only hold if every non-null value is a string
+		if len(stats.strings) == 0 || len(stats.strings) != stats.count() {
+			return
+		}
+		field.Format, field.Pattern = inferStringFormat(stats.strings)
+		if field.Format != "" || field.Pattern != "" {
+			return
+		}
+		minLength, maxLength := math.MaxInt, 0
+		for _, s := range stats.strings {
+			n := utf8.RuneCountInString(s)
+			minLength, maxLength = min(minLength, n), max(maxLength, n)
+		}
+		// A minimum length of zero says nothing
+		if minLength > 0 {
+			field.MinLength = &minLength
+		}
+		field.MaxLength = &maxLength
+	}
+}
+
+// inferStringFormat returns the format and pattern that all values match, if any
+func inferStringFormat(values []string) (string, string) {
+	for _, format := range inferredFormats {
+		validate := jsonschema.Formats[format]
+		if allMatch(values, func(s string) bool { return validate(s) }) {
+			return format, ""
+		}
+	}
+
+	if allMatch(values, currencyValue.MatchString) {
+		// A single currency symbol is kept in the pattern
+		symbol := `[$€£¥]`
+		first := currencyValue.FindStringSubmatch(values[0])[1]
+		if allMatch(values, func(s string) bool { return currencyValue.FindStringSubmatch(s)[1] == first }) {
+			symbol = regexp.QuoteMeta(first)
+		}
+		return FormatCurrency, `^-?` + symbol + amountPattern + `(/` + symbol + `?` + amountPattern + `)*$`
+	}
+	if allMatch(values, decimalValue.MatchString) {
+		return FormatDecimal, `^-?\d+(\.\d+)?$`
+	}
+
+	return "", identifierPattern(values)
+}
+
+// identifierPattern returns a pattern for identifiers that share a shape, such as
+// "app-1" and "app-12" (^app-\d+$), or "" when the values are not identifiers
+func identifierPattern(values []string) string {
+	var shape [][]string
+	for _, value := range values {
+		if value == "" || len(value) > maxIdentifierLength || strings.ContainsAny(value, " \t\r\n") {
+			return ""
+		}
+		tokens := identifierToken.FindAllString(value, -1)
+		if shape == nil {
+			shape = make([][]string, len(tokens))
+		}
+		if len(tokens) != len(shape) {
+			return ""
+		}
+		for i, token := range tokens {
+			shape[i] = append(shape[i], token)
+		}
+	}
+
+	var pattern strings.Builder
+	hasDigits := false
+	for _, tokens := range shape {
+		switch {
+		case isDigits(tokens[0]):
+			if !allMatch(tokens, isDigits) {
+				return ""
+			}
+			hasDigits = true
+			pattern.WriteString(`\d+`)
+		case isLetters(tokens[0]):
+			if !allMatch(tokens, isLetters) {
+				return ""
+			}
+			pattern.WriteString(letterPattern(tokens))
+		default:
+			if !allMatch(tokens, func(s string) bool { return s == tokens[0] }) {
+				return ""
+			}
+			pattern.WriteString(regexp.QuoteMeta(tokens[0]))
+		}
+	}
+	if !hasDigits {
+		return ""
+	}
+	return "^" + pattern.String() + "$"
+}
+
+// letterPattern matches a run of letters: literally when all values agree, else by case
+func letterPattern(tokens []string) string {
+	if allMatch(tokens, func(s string) bool { return s == tokens[0] }) {
+		return tokens[0]
+	}
+	switch {
+	case allMatch(tokens, func(s string) bool { return s == strings.ToLower(s) }):
+		return `[a-z]+`
+	case allMatch(tokens, func(s string) bool { return s == strings.ToUpper(s) }):
+		return `[A-Z]+`
+	default:
+		return `[A-Za-z]+`
+	}
+}
+
+// addConstraints writes the inferred format, pattern and bounds of a field to its schema
+func (sg *SchemaGenerator) addConstraints(fieldSchema map[string]interface{}, field *FieldInfo) {
+	switch field.Format {
+	case "":
+	case FormatCurrency, FormatDecimal:
+		fieldSchema[formatKeyword] = field.Format
+	default:
+		fieldSchema["format"] = field.Format
+	}
+	if field.Pattern != "" {
+		fieldSchema["pattern"] = field.Pattern
+	}
+	if field.Minimum != nil {
+		fieldSchema["minimum"] = *field.Minimum
+	}
+	if field.Maximum != nil {
+		fieldSchema["maximum"] = *field.Maximum
+	}
+	if field.MinLength != nil {
+		fieldSchema["minLength"] = *field.MinLength
+	}
+	if field.MaxLength != nil {
+		fieldSchema["maxLength"] = *field.MaxLength
+	}
+}
+
+func allMatch(values []string, match func(string) bool) bool {
+	for _, value := range values {
+		if !match(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+func isLetters(s string) bool {
+	return s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z')
+	}) < 0
+}
@@ -0,0 +1,138 @@
+package pkg
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// compileGenerated compiles the JSON Schema generated for data
+func compileGenerated(t *testing.T, info *SchemaInfo) *FileSchema {
+	t.Helper()
+	content, err := json.Marshal(info.Schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := ParseFileSchema(content)
+	if err != nil {
+		t.Fatalf("generated schema does not compile: %v\n%s", err, content)
+	}
+	return schema
+}
+
+func TestInferFormatsPatternsAndBounds(t *testing.T) {
+	data := []map[string]interface{}{
+		{"id": "app-1", "name": "Tea", "price": "$2.50", "qty": 1.0, "rating": 4.5, "email": "ada@example.com", "updated": "2024-01-31T09:30:00Z", "opened": "2024-01-31"},
+		{"id": "app-12", "name": "Coffee", "price": "$8.99/15.99", "qty": 12.0, "rating": nil, "email": "bo@example.com", "updated": "2024-02-01T12:00:00+01:00", "opened": "2024-02-01"},
+		{"id": "app-7", "name": "Lassi", "price": "$1,299.00", "qty": 3.0, "rating": 3.25, "email": "cy@example.org", "updated": "2024-02-02T08:00:00Z", "opened": "2024-02-02"},
+	}
+	info, err := NewSchemaGenerator().GenerateSchema(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ptr := func(v float64) *float64 { return &v }
+	length := func(n int) *int { return &n }
+	tests := []struct {
+		field    string
+		want     FieldInfo
+		nullable bool
+	}{
+		{"id", FieldInfo{Type: FieldTypeString, Pattern: `^app-\d+$`}, false},
+		{"name", FieldInfo{Type: FieldTypeString, MinLength: length(3), MaxLength: length(6)}, false},
+		{"price", FieldInfo{Type: FieldTypeString, Format: FormatCurrency, Pattern: `^-?\$` + amountPattern + `(/\$?` + amountPattern + `)*$`}, false},
+		{"qty", FieldInfo{Type: FieldTypeInteger, Minimum: ptr(1), Maximum: ptr(12)}, false},
+		{"rating", FieldInfo{Type: FieldTypeNumber, Minimum: ptr(3.25), Maximum: ptr(4.5)}, true},
+		{"email", FieldInfo{Type: FieldTypeString, Format: "email"}, false},
+		{"updated", FieldInfo{Type: FieldTypeString, Format: "date-time"}, false},
+		{"opened", FieldInfo{Type: FieldTypeString, Format: "date"}, false},
+	}
+	for _, tt := range tests {
+		got := info.Properties[tt.field]
+		if got == nil {
+			t.Errorf("%s was not inferred", tt.field)
+			continue
+		}
+		if got.Type != tt.want.Type || got.Format != tt.want.Format || got.Pattern != tt.want.Pattern || got.Nullable != tt.nullable ||
+			!reflect.DeepEqual(got.Minimum, tt.want.Minimum) || !reflect.DeepEqual(got.Maximum, tt.want.Maximum) ||
+			!reflect.DeepEqual(got.MinLength, tt.want.MinLength) || !reflect.DeepEqual(got.MaxLength, tt.want.MaxLength) {
+			t.Errorf("%s = %+v, want %+v with nullable %v", tt.field, got, tt.want, tt.nullable)
+		}
+	}
+
+	properties := info.Schema["properties"].(map[string]interface{})
+	if price := properties["price"].(map[string]interface{}); price[formatKeyword] != FormatCurrency || price["format"] != nil {
+		t.Errorf("price schema = %v, want the currency format as %s", price, formatKeyword)
+	}
+	if rating := properties["rating"].(map[string]interface{}); !reflect.DeepEqual(rating["type"], []interface{}{"number", "null"}) {
+		t.Errorf("rating type = %v, want number or null", rating["type"])
+	}
+
+	// The inferred schema accepts the data it came from and rejects values outside it
+	schema := compileGenerated(t, info)
+	for i, item := range data {
+		if violations := schemaViolations(schema.Compiled(), item, ""); len(violations) > 0 {
+			t.Errorf("item %d violates its own schema: %v", i, violations)
+		}
+	}
+	outliers := map[string]interface{}{
+		"id":      "user-1",
+		"price":   "19.99",
+		"qty":     13.0,
+		"email":   "not an email",
+		"updated": "yesterday",
+		"name":    "Masala chai",
+	}
+	for field, value := range outliers {
+		item := deepCopy(data[0])
+		item[field] = value
+		violations := schemaViolations(schema.Compiled(), item, "")
+		if len(violations) != 1 || violations[0].Path != "/"+field {
+			t.Errorf("%s = %v gave violations %v, want one at /%s", field, value, violations, field)
+		}
+	}
+}
+
+func TestIdentifierPattern(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   string
+	}{
+		{[]string{"app-1", "app-12"}, `^app-\d+$`},
+		{[]string{"SKU_001", "SKU_120"}, `^SKU_\d+$`},
+		{[]string{"a1", "bc22"}, `^[a-z]+\d+$`},
+		{[]string{"Ab1", "cD2"}, `^[A-Za-z]+\d+$`},
+		{[]string{"v1.2", "v10.0"}, `^v\d+\.\d+$`},
+		// Without digits, with spaces or with differing shapes there is no id convention
+		{[]string{"tea", "coffee"}, ""},
+		{[]string{"app 1", "app 2"}, ""},
+		{[]string{"app-1", "app-1-b"}, ""},
+		{[]string{"app-1", ""}, ""},
+	}
+	for _, tt := range tests {
+		if got := identifierPattern(tt.values); got != tt.want {
+			t.Errorf("identifierPattern(%q) = %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestInferNumberTypes(t *testing.T) {
+	data := []map[string]interface{}{
+		{"whole": 1.0, "mixed": 1.0, "none": nil},
+		{"whole": 2.0, "mixed": 2.5, "none": nil},
+	}
+	info, err := NewSchemaGenerator().GenerateSchema(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Properties["whole"].Type; got != FieldTypeInteger {
+		t.Errorf("whole-valued floats inferred as %s, want integer", got)
+	}
+	// Integers and fractions together are numbers, not a union
+	if mixed := info.Properties["mixed"]; mixed.Type != FieldTypeNumber || mixed.Mixed() {
+		t.Errorf("mixed = %+v, want a number", mixed)
+	}
+	if none := info.Properties["none"]; none.Type != FieldTypeNull {
+		t.Errorf("none = %+v, want null", none)
+	}
+}
@@ -0,0 +1,439 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oarkflow/jsonschema"
+)
+
+// SchemaSidecarSuffix names the schema file kept next to a data file, e.g. menu.json.schema.json
+const SchemaSidecarSuffix = ".schema.json"
+
+// primaryKeyKeyword stores the primary key in a sidecar; validators ignore unknown keywords
+const primaryKeyKeyword = "x-primaryKey"
+
+// ErrSchemaExists is returned when generating a sidecar that already exists
+var ErrSchemaExists = errors.New("schema already exists")
+
+// FileSchema is a data file's schema loaded from its sidecar
+type FileSchema struct {
+	// Document is the JSON Schema that each item must match
+	Document map[string]interface{}
+	// Info describes the fields of the schema for forms and primary key lookups
+	Info     *SchemaInfo
+	compiled *jsonschema.Schema
+	coercer  *Coercer
+	modTime  time.Time
+	size     int64
+}
+
+// Compiled returns the validator for the schema
+func (s *FileSchema) Compiled() *jsonschema.Schema {
+	return s.compiled
+}
+
+// Coercer returns the converter of text input to the schema's types
+func (s *FileSchema) Coercer() *Coercer {
+	return s.coercer
+}
+
+// ParseFileSchema parses and compiles a schema document. The root must describe objects.
+func ParseFileSchema(content []byte) (*FileSchema, error) {
+	var document map[string]interface{}
+	if err := json.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	if t, ok := document["type"]; ok && t != string(FieldTypeObject) {
+		return nil, fmt.Errorf("schema type must be %q, got %v", FieldTypeObject, t)
+	}
+
+	// Formats are asserted so that a sidecar's "format" is enforced like its other rules
+	compiled, err := jsonschema.NewCompiler().SetAssertFormat(true).Compile(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema: %w", err)
+	}
+	info := SchemaInfoFromDocument(document)
+	if err := checkCoerceModes(info); err != nil {
+		return nil, err
+	}
+	return &FileSchema{
+		Document: document,
+		Info:     info,
+		compiled: compiled,
+		coercer:  NewCoercer(info),
+	}, nil
+}
+
+// SchemaStore loads schema sidecars from the data directory, reloading them when they change
+type SchemaStore struct {
+	mu    sync.Mutex
+	dir   string
+	cache map[string]*FileSchema
+}
+
+// NewSchemaStore creates a store for the sidecars of data files in dir
+func NewSchemaStore(dir string) *SchemaStore {
+	return &SchemaStore{dir: dir, cache: make(map[string]*FileSchema)}
+}
+
+// IsSchemaSidecar reports whether a file name is a schema sidecar rather than data
+func IsSchemaSidecar(name string) bool {
+	return strings.HasSuffix(name, SchemaSidecarSuffix)
+}
+
+// IsSidecar reports whether a file name is a schema or migration history sidecar rather than data
+func IsSidecar(name string) bool {
+	return IsSchemaSidecar(name) || strings.HasSuffix(name, MigrationHistorySuffix)
+}
+
+// SchemaSidecarName returns the sidecar name of a data file
+func SchemaSidecarName(filename string) string {
+	return sidecarName(filename, SchemaSidecarSuffix)
+}
+
+// sidecarName appends a sidecar suffix to a data file's full name, so that
+// menu.json and menu.csv have sidecars of their own
+func sidecarName(filename, suffix string) string {
+	return filepath.Base(filename) + suffix
+}
+
+// legacySidecarName is the name sidecars had before they kept the data file's
+// extension, e.g. menu.schema.json
+func legacySidecarName(filename, suffix string) string {
+	base := filepath.Base(filename)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + suffix
+}
+
+// RenameLegacySidecars renames sidecars named without the data file's extension
+// to their current names. A legacy sidecar shared by several data files is left
+// alone and reported, since it is unclear which file it belongs to.
+func RenameLegacySidecars(dir string, files []string) error {
+	owners := make(map[string]int)
+	for _, file := range files {
+		for _, suffix := range []string{SchemaSidecarSuffix, MigrationHistorySuffix} {
+			owners[legacySidecarName(file, suffix)]++
+		}
+	}
+
+	var ambiguous []string
+	for _, file := range files {
+		for _, suffix := range []string{SchemaSidecarSuffix, MigrationHistorySuffix} {
+			legacy := legacySidecarName(file, suffix)
+			if _, err := os.Stat(filepath.Join(dir, legacy)); err != nil {
+				continue
+			}
+			if owners[legacy] > 1 {
+				ambiguous = append(ambiguous, legacy)
+				continue
+			}
+			current := filepath.Join(dir, sidecarName(file, suffix))
+			if _, err := os.Stat(current); err == nil {
+				continue
+			}
+			if err := os.Rename(filepath.Join(dir, legacy), current); err != nil {
+				return fmt.Errorf("failed to rename %s: %w", legacy, err)
+			}
+		}
+	}
+	if len(ambiguous) > 0 {
+		slices.Sort(ambiguous)
+		ambiguous = slices.Compact(ambiguous)
+		return fmt.Errorf("sidecars %s are shared by data files with the same name and were not renamed", strings.Join(ambiguous, ", "))
+	}
+	return nil
+}
+
+// Path returns the sidecar path of a data file
+func (ss *SchemaStore) Path(filename string) string {
+	return filepath.Join(ss.dir, SchemaSidecarName(filename))
+}
+
+// Get returns the schema of a data file, or nil when it has no sidecar.
+// A sidecar edited on disk is picked up by the next call.
+func (ss *SchemaStore) Get(filename string) (*FileSchema, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	path := ss.Path(filename)
+	stat, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		delete(ss.cache, filename)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat schema: %w", err)
+	}
+
+	if cached, ok := ss.cache[filename]; ok && cached.modTime.Equal(stat.ModTime()) && cached.size == stat.Size() {
+		return cached, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	schema, err := ParseFileSchema(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %w", filepath.Base(path), err)
+	}
+	schema.modTime, schema.size = stat.ModTime(), stat.Size()
+	ss.cache[filename] = schema
+	return schema, nil
+}
+
+// Put validates a schema document and writes it as the sidecar of a data file
+func (ss *SchemaStore) Put(filename string, content []byte) (*FileSchema, error) {
+	schema, err := ParseFileSchema(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, content, "", "  "); err != nil {
+		return nil, fmt.Errorf("failed to format schema: %w", err)
+	}
+	buf.WriteByte('\n')
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	err = writeFileAtomic(ss.Path(filename), func(w io.Writer) error {
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write schema: %w", err)
+	}
+	delete(ss.cache, filename)
+	return schema, nil
+}
+
+// Generate infers a schema from data and writes it as the sidecar of a data file.
+// An existing sidecar is only replaced when overwrite is set.
+func (ss *SchemaStore) Generate(filename string, data []map[string]interface{}, overwrite bool) (*FileSchema, error) {
+	if _, err := os.Stat(ss.Path(filename)); err == nil && !overwrite {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaExists, SchemaSidecarName(filename))
+	}
+
+	info, err := NewSchemaGenerator().GenerateSchema(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate schema: %w", err)
+	}
+	document := map[string]interface{}{"type": string(FieldTypeObject)}
+	for key, value := range info.Schema {
+		document[key] = value
+	}
+	document["title"] = filepath.Base(filename)
+	if info.PrimaryKey != "" {
+		document[primaryKeyKeyword] = info.PrimaryKey
+	}
+
+	content, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode schema: %w", err)
+	}
+	return ss.Put(filename, content)
+}
+
+// Delete removes the sidecar of a data file. A missing sidecar wraps os.ErrNotExist.
+func (ss *SchemaStore) Delete(filename string) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	delete(ss.cache, filename)
+	if err := os.Remove(ss.Path(filename)); err != nil {
+		return fmt.Errorf("failed to delete schema: %w", err)
+	}
+	return nil
+}
+
+// SchemaInfoFromDocument describes the fields of a JSON Schema document
+func SchemaInfoFromDocument(document map[string]interface{}) *SchemaInfo {
+	properties, _ := document["properties"].(map[string]interface{})
+	required := stringList(document["required"])
+
+	info := &SchemaInfo{
+		Fields:     []*FieldInfo{},
+		Required:   required,
+		Properties: make(map[string]*FieldInfo),
+		Schema:     document,
+	}
+	if info.Required == nil {
+		info.Required = []string{}
+	}
+
+	for name, property := range properties {
+		field := fieldInfoFromSchema(name, property)
+		for _, r := range required {
+			if r == name {
+				field.Required = true
+			}
+		}
+		info.Fields = append(info.Fields, field)
+		info.Properties[name] = field
+	}
+	sort.Slice(info.Fields, func(i, j int) bool {
+		return info.Fields[i].Name < info.Fields[j].Name
+	})
+
+	if mode, ok := document[coerceKeyword].(string); ok {
+		info.Coerce = mode
+	}
+	if key, ok := document[primaryKeyKeyword].(string); ok {
+		info.PrimaryKey = key
+	} else if _, ok := info.Properties["id"]; ok {
+		info.PrimaryKey = "id"
+	} else if len(info.Fields) > 0 {
+		info.PrimaryKey = info.Fields[0].Name
+	}
+	if field, ok := info.Properties[info.PrimaryKey]; ok {
+		field.Unique = true
+	}
+	return info
+}
+
+// fieldInfoFromSchema describes a property of a JSON Schema document
+func fieldInfoFromSchema(name string, property interface{}) *FieldInfo {
+	schema, _ := property.(map[string]interface{})
+	field := &FieldInfo{
+		Name:     name,
+		Type:     schemaType(schema["type"]),
+		Nullable: schemaNullable(schema["type"]),
+	}
+	for _, t := range stringList(schema["type"]) {
+		if t != string(FieldTypeNull) {
+			field.union = append(field.union, FieldType(t))
+		}
+	}
+
+	if format, ok := schema["format"].(string); ok {
+		field.Format = format
+	} else if format, ok := schema[formatKeyword].(string); ok {
+		field.Format = format
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		field.Pattern = pattern
+	}
+	if mode, ok := schema[coerceKeyword].(string); ok {
+		field.Coerce = mode
+	}
+	field.Minimum, field.Maximum = schemaNumber(schema["minimum"]), schemaNumber(schema["maximum"])
+	if n := schemaNumber(schema["minLength"]); n != nil {
+		length := int(*n)
+		field.MinLength = &length
+	}
+	if n := schemaNumber(schema["maxLength"]); n != nil {
+		length := int(*n)
+		field.MaxLength = &length
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		field.Enum = enum
+	}
+	if description, ok := schema["description"].(string); ok {
+		field.Description = description
+	}
+	if field.Type == FieldTypeArray {
+		field.Array = true
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			field.Items = fieldInfoFromSchema("", items)
+		}
+	}
+	if nested, ok := schema["properties"].(map[string]interface{}); ok {
+		field.Properties = make(map[string]*FieldInfo)
+		for key, value := range nested {
+			field.Properties[key] = fieldInfoFromSchema(key, value)
+		}
+		for _, key := range stringList(schema["required"]) {
+			if property, ok := field.Properties[key]; ok {
+				property.Required = true
+			}
+		}
+	}
+
+	// A union takes its type from the first branch; the others add items, properties and null
+	if branches, ok := schema["anyOf"].([]interface{}); ok && schema["type"] == nil {
+		typed := false
+		for _, branch := range branches {
+			option := fieldInfoFromSchema(name, branch)
+			if option.Type == FieldTypeNull {
+				field.Nullable = true
+				continue
+			}
+			field.union = append(field.union, option.declaredTypes()...)
+			if !typed {
+				field.Type, field.Array, typed = option.Type, option.Array, true
+			}
+			if option.Items != nil {
+				field.Items = option.Items
+			}
+			if option.Properties != nil {
+				field.Properties = option.Properties
+			}
+		}
+	}
+	return field
+}
+
+// schemaType returns the field type of a JSON Schema "type", ignoring "null" in type lists
+func schemaType(t interface{}) FieldType {
+	switch v := t.(type) {
+	case string:
+		return FieldType(v)
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != string(FieldTypeNull) {
+				return FieldType(s)
+			}
+		}
+		if len(v) > 0 {
+			return FieldTypeNull
+		}
+	}
+	return FieldTypeString
+}
+
+// schemaNullable reports whether a type list such as ["string", "null"] allows null
+func schemaNullable(t interface{}) bool {
+	types, ok := t.([]interface{})
+	if !ok || len(types) < 2 {
+		return false
+	}
+	for _, item := range types {
+		if item == string(FieldTypeNull) {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaNumber returns a numeric keyword value, or nil when it is absent
+func schemaNumber(value interface{}) *float64 {
+	n, ok := value.(float64)
+	if !ok {
+		return nil
+	}
+	return &n
+}
+
+// stringList converts a decoded JSON array of strings
+func stringList(value interface{}) []string {
+	items, _ := value.([]interface{})
+	var list []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -0,0 +1,41 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSidecarNamesKeepExtension(t *testing.T) {
+	if a, b := SchemaSidecarName("menu.json"), SchemaSidecarName("menu.csv"); a == b {
+		t.Errorf("menu.json and menu.csv share the sidecar %s", a)
+	}
+	if got := MigrationHistoryName("data/menu.json"); got != "menu.json.migrations.json" {
+		t.Errorf("MigrationHistoryName = %s", got)
+	}
+}
+
+func TestRenameLegacySidecars(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"users.json", "users.schema.json", "users.migrations.json", "menu.json", "menu.csv", "menu.schema.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RenameLegacySidecars(dir, []string{"menu.csv", "menu.json", "users.json"}); err == nil {
+		t.Error("a sidecar shared by menu.json and menu.csv was not reported")
+	}
+	for name, exists := range map[string]bool{
+		"users.json.schema.json":     true,
+		"users.json.migrations.json": true,
+		"users.schema.json":          false,
+		"menu.schema.json":           true,
+		"menu.json.schema.json":      false,
+		"menu.csv.schema.json":       false,
+	} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != exists {
+			t.Errorf("%s exists = %v, want %v", name, err == nil, exists)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// manifestFileName is the sidecar listing the snapshots stored in a directory
+const manifestFileName = "manifest.json"
+
+// snapshotIDLayout sorts lexicographically in chronological order
+const snapshotIDLayout = "20060102T150405.000000000Z"
+
+// snapshotRecord is a manifest entry for one version or backup file
+type snapshotRecord struct {
+	ID        string    `json:"id"`
+	FileName  string    `json:"fileName"`
+	Timestamp time.Time `json:"timestamp"`
+	Size      int64     `json:"size,omitempty"`
+	Hash      string    `json:"hash,omitempty"`
+	Pinned    bool      `json:"pinned,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	CommitInfo
+}
+
+var (
+	snapshotIDMu   sync.Mutex
+	lastSnapshotAt time.Time
+	// snapshotIDCount numbers ids made without randomness
+	snapshotIDCount atomic.Uint32
+)
+
+// newSnapshotID returns a unique, monotonically increasing snapshot id and its timestamp
+func newSnapshotID() (string, time.Time) {
+	snapshotIDMu.Lock()
+	now := time.Now().UTC()
+	if !now.After(lastSnapshotAt) {
+		now = lastSnapshotAt.Add(time.Nanosecond)
+	}
+	lastSnapshotAt = now
+	snapshotIDMu.Unlock()
+
+	return snapshotIDAt(now), now
+}
+
+// snapshotIDAt returns a snapshot id for a point in time. The random suffix
+// keeps ids unique across processes writing the same directory.
+func snapshotIDAt(t time.Time) string {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		// The process id and a counter still tell ids of the same instant apart
+		binary.BigEndian.PutUint16(suffix, uint16(os.Getpid()))
+		binary.BigEndian.PutUint16(suffix[2:], uint16(snapshotIDCount.Add(1)))
+	}
+	return t.UTC().Format(snapshotIDLayout) + "-" + hex.EncodeToString(suffix)
+}
+
+// legacySnapshotID derives a stable id for a snapshot file imported from before ids existed
+func legacySnapshotID(t time.Time, fileName string) string {
+	sum := sha256.Sum256([]byte(fileName))
+	return t.UTC().Format(snapshotIDLayout) + "-" + hex.EncodeToString(sum[:2])
+}
+
+// loadManifest reads the snapshot records of a directory
+func loadManifest(dir string) ([]snapshotRecord, error) {
+	content, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []snapshotRecord{}, nil
+		}
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var records []snapshotRecord
+	if err := json.Unmarshal(content, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	// Entries written before ids existed get one from their timestamp
+	for i := range records {
+		if records[i].ID == "" {
+			records[i].ID = legacySnapshotID(records[i].Timestamp, records[i].FileName)
+		}
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+// saveManifest atomically writes the snapshot records of a directory
+func saveManifest(dir string, records []snapshotRecord) error {
+	sortRecords(records)
+	content, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	path := filepath.Join(dir, manifestFileName)
+	tmpFile := path + ".tmp"
+	if err := os.WriteFile(tmpFile, content, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(tmpFile, path); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// sortRecords orders records oldest first
+func sortRecords(records []snapshotRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+}
+
+// findRecord returns the record whose id or file name matches
+func findRecord(records []snapshotRecord, idOrName string) (snapshotRecord, bool) {
+	for _, record := range records {
+		if record.ID == idOrName || record.FileName == idOrName {
+			return record, true
+		}
+	}
+	return snapshotRecord{}, false
+}
+
+// legacyTimestamp parses the timestamp embedded in a legacy snapshot name,
+// falling back to the file's modification time
+func legacyTimestamp(path, stamp, layout string) time.Time {
+	if t, err := time.ParseInLocation(layout, stamp, time.Local); err == nil {
+		return t
+	}
+	if stat, err := os.Stat(path); err == nil {
+		return stat.ModTime()
+	}
+	return time.Time{}
+}
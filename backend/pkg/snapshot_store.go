@@ -0,0 +1,451 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// objectsDirName holds content-addressed snapshots inside a version directory
+	objectsDirName = "objects"
+	deltaExtension = ".delta"
+	deltaMagic     = "FTDELTA1"
+
+	// DefaultMaxDeltaChain bounds how many deltas are applied to rebuild a version
+	DefaultMaxDeltaChain = 10
+
+	// maxDeltaDiffSteps bounds the line comparisons spent on a delta while the file
+	// is locked. Versions that differ more are stored in full.
+	maxDeltaDiffSteps = 1 << 22
+)
+
+// snapshotContent is data prepared for storage
+type snapshotContent struct {
+	hash      string
+	canonical []byte
+	encoded   []byte
+}
+
+// prepareSnapshot serializes data in the file format and hashes its canonical JSON form.
+// The hash is computed after a round trip through the format so it matches what is read back.
+func prepareSnapshot(data []map[string]any, format FileFormat) (*snapshotContent, error) {
+	plain := PlainFormat(format)
+
+	var buf bytes.Buffer
+	if err := plain.Serialize(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to serialize snapshot data: %w", err)
+	}
+
+	parsed, err := plain.Parse(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot data: %w", err)
+	}
+	canonical, err := canonicalJSON(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := buf.Bytes()
+	if encrypted, ok := format.(*EncryptedFormat); ok {
+		if encoded, err = encrypted.Seal(encoded); err != nil {
+			return nil, err
+		}
+	}
+
+	return &snapshotContent{
+		hash:      contentHash(canonical),
+		canonical: canonical,
+		encoded:   encoded,
+	}, nil
+}
+
+// canonicalJSON encodes data with sorted keys, one value per line
+func canonicalJSON(data []map[string]any) ([]byte, error) {
+	if data == nil {
+		data = []map[string]any{}
+	}
+	canonical, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode canonical JSON: %w", err)
+	}
+	return canonical, nil
+}
+
+// contentHash returns the hex sha256 of canonical content
+func contentHash(canonical []byte) string {
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeExclusive writes content to a file that must not exist yet
+func writeExclusive(path string, content []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		os.Remove(path)
+		return fmt.Errorf("failed to write snapshot file: %w", err)
+	}
+	return file.Close()
+}
+
+// objectStore keeps content-addressed snapshots, either full or as deltas against another object
+type objectStore struct {
+	dir    string
+	format FileFormat
+}
+
+// newObjectStore returns the object store inside a version directory
+func newObjectStore(versionDir string, format FileFormat) *objectStore {
+	return &objectStore{dir: filepath.Join(versionDir, objectsDirName), format: format}
+}
+
+// isObjectName reports whether a manifest file name refers to the object store
+func isObjectName(name string) bool {
+	return strings.HasPrefix(name, objectsDirName+"/")
+}
+
+// path returns the absolute path of an object given its manifest file name
+func (s *objectStore) path(name string) string {
+	return filepath.Join(s.dir, strings.TrimPrefix(name, objectsDirName+"/"))
+}
+
+// find returns the manifest file name of the object with a hash
+func (s *objectStore) find(hash string) (string, bool) {
+	for _, ext := range []string{s.format.Extension(), deltaExtension} {
+		if _, err := os.Stat(filepath.Join(s.dir, hash+ext)); err == nil {
+			return objectsDirName + "/" + hash + ext, true
+		}
+	}
+
+	// Objects stored before the file was converted keep their original extension
+	if matches, _ := filepath.Glob(filepath.Join(s.dir, hash+".*")); len(matches) > 0 {
+		return objectsDirName + "/" + filepath.Base(matches[0]), true
+	}
+	return "", false
+}
+
+// writeFull stores a complete snapshot in the file format
+func (s *objectStore) writeFull(content *snapshotContent) (string, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create objects directory: %w", err)
+	}
+	name := content.hash + s.format.Extension()
+	if err := writeExclusive(filepath.Join(s.dir, name), content.encoded); err != nil {
+		return "", err
+	}
+	return objectsDirName + "/" + name, nil
+}
+
+// deltaOp is one instruction for rebuilding canonical JSON from a base
+type deltaOp struct {
+	Copy   int      `json:"copy,omitempty"`
+	Skip   int      `json:"skip,omitempty"`
+	Insert []string `json:"insert,omitempty"`
+}
+
+// writeDelta stores a snapshot as a line delta against a base object. It reports
+// false without writing when the delta would not be smaller than a full copy, or
+// would be too costly to compute.
+func (s *objectStore) writeDelta(content *snapshotContent, baseName string, maxChain int) (string, bool, error) {
+	depth, err := s.depth(baseName)
+	if err != nil || depth+1 > maxChain {
+		return "", false, nil
+	}
+
+	_, baseCanonical, err := s.load(baseName)
+	if err != nil {
+		return "", false, nil
+	}
+
+	ops, ok := buildDelta(splitLines(string(baseCanonical)), splitLines(string(content.canonical)))
+	if !ok {
+		return "", false, nil
+	}
+	payload, err := json.Marshal(ops)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to encode delta: %w", err)
+	}
+	if encrypted, ok := s.format.(*EncryptedFormat); ok {
+		if payload, err = encrypted.Seal(payload); err != nil {
+			return "", false, err
+		}
+	}
+	if len(payload) >= len(content.encoded) {
+		return "", false, nil
+	}
+
+	header := fmt.Sprintf("%s %s %d\n", deltaMagic, objectHash(baseName), depth+1)
+	name := content.hash + deltaExtension
+	if err := writeExclusive(filepath.Join(s.dir, name), append([]byte(header), payload...)); err != nil {
+		return "", false, err
+	}
+	return objectsDirName + "/" + name, true, nil
+}
+
+// objectHash returns the content hash an object is named after
+func objectHash(name string) string {
+	base := filepath.Base(name)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// readDelta splits a delta object into its base hash, chain depth and payload
+func (s *objectStore) readDelta(name string) (string, int, []byte, error) {
+	content, err := os.ReadFile(s.path(name))
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("failed to read delta: %w", err)
+	}
+
+	newline := bytes.IndexByte(content, '\n')
+	if newline < 0 {
+		return "", 0, nil, errors.New("delta header is missing")
+	}
+	fields := strings.Fields(string(content[:newline]))
+	if len(fields) != 3 || fields[0] != deltaMagic {
+		return "", 0, nil, errors.New("delta header is invalid")
+	}
+	depth, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return "", 0, nil, errors.New("delta header is invalid")
+	}
+	return fields[1], depth, content[newline+1:], nil
+}
+
+// depth returns how many deltas must be applied to rebuild an object
+func (s *objectStore) depth(name string) (int, error) {
+	if !strings.HasSuffix(name, deltaExtension) {
+		return 0, nil
+	}
+	_, depth, _, err := s.readDelta(name)
+	return depth, err
+}
+
+// load rebuilds the data and canonical JSON of an object
+func (s *objectStore) load(name string) ([]map[string]any, []byte, error) {
+	if !strings.HasSuffix(name, deltaExtension) {
+		data, err := readSnapshot(s.path(name), s.format)
+		if err != nil {
+			return nil, nil, err
+		}
+		canonical, err := canonicalJSON(data)
+		return data, canonical, err
+	}
+
+	baseHash, _, payload, err := s.readDelta(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	baseName, ok := s.find(baseHash)
+	if !ok {
+		return nil, nil, fmt.Errorf("delta base %s is missing", baseHash)
+	}
+	_, baseCanonical, err := s.load(baseName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if isSealed(payload) {
+		encrypted, ok := s.format.(*EncryptedFormat)
+		if !ok {
+			return nil, nil, errors.New("delta is encrypted but no encryption key is configured")
+		}
+		if payload, err = encrypted.Open(payload); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var ops []deltaOp
+	if err := json.Unmarshal(payload, &ops); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse delta: %w", err)
+	}
+	lines, err := applyDelta(splitLines(string(baseCanonical)), ops)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	canonical := []byte(strings.Join(lines, "\n"))
+	var data []map[string]any
+	if err := json.Unmarshal(canonical, &data); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse rebuilt snapshot: %w", err)
+	}
+	return data, canonical, nil
+}
+
+// referenced returns the object files needed by a set of records, including delta bases
+func (s *objectStore) referenced(records []snapshotRecord) map[string]bool {
+	keep := make(map[string]bool)
+	for _, record := range records {
+		name := record.FileName
+		for isObjectName(name) && !keep[filepath.Base(name)] {
+			keep[filepath.Base(name)] = true
+			if !strings.HasSuffix(name, deltaExtension) {
+				break
+			}
+			baseHash, _, _, err := s.readDelta(name)
+			if err != nil {
+				break
+			}
+			if name, _ = s.find(baseHash); name == "" {
+				break
+			}
+		}
+	}
+	return keep
+}
+
+// gc removes objects no longer referenced by any record or delta
+func (s *objectStore) gc(records []snapshotRecord) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	keep := s.referenced(records)
+	for _, entry := range entries {
+		if !entry.IsDir() && !keep[entry.Name()] {
+			if err := os.Remove(filepath.Join(s.dir, entry.Name())); err != nil {
+				return fmt.Errorf("failed to remove unreferenced object: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// buildDelta encodes the line edits turning base into target. It reports false
+// when the diff would take more than maxDeltaDiffSteps.
+func buildDelta(base, target []string) ([]deltaOp, bool) {
+	lines, ok := diffLinesWithin(base, target, maxDeltaDiffSteps)
+	if !ok {
+		return nil, false
+	}
+	var ops []deltaOp
+	for _, op := range lines {
+		last := len(ops) - 1
+		switch op.kind {
+		case ' ':
+			if last >= 0 && ops[last].Copy > 0 {
+				ops[last].Copy++
+			} else {
+				ops = append(ops, deltaOp{Copy: 1})
+			}
+		case '-':
+			if last >= 0 && ops[last].Skip > 0 {
+				ops[last].Skip++
+			} else {
+				ops = append(ops, deltaOp{Skip: 1})
+			}
+		case '+':
+			if last >= 0 && len(ops[last].Insert) > 0 {
+				ops[last].Insert = append(ops[last].Insert, op.text)
+			} else {
+				ops = append(ops, deltaOp{Insert: []string{op.text}})
+			}
+		}
+	}
+	return ops, true
+}
+
+// applyDelta rebuilds target lines from base lines
+func applyDelta(base []string, ops []deltaOp) ([]string, error) {
+	var out []string
+	pos := 0
+	for _, op := range ops {
+		switch {
+		case op.Copy > 0:
+			if pos+op.Copy > len(base) {
+				return nil, errors.New("delta does not match its base")
+			}
+			out = append(out, base[pos:pos+op.Copy]...)
+			pos += op.Copy
+		case op.Skip > 0:
+			if pos+op.Skip > len(base) {
+				return nil, errors.New("delta does not match its base")
+			}
+			pos += op.Skip
+		default:
+			out = append(out, op.Insert...)
+		}
+	}
+	if pos != len(base) {
+		return nil, errors.New("delta does not match its base")
+	}
+	return out, nil
+}
+
+// reEncrypt rewrites every object with a new key
+func (s *objectStore) reEncrypt(from, to *EncryptedFormat) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		name := objectsDirName + "/" + entry.Name()
+		path := s.path(name)
+		if !strings.HasSuffix(name, deltaExtension) {
+			if err := ReEncryptFile(path, from, to); err != nil {
+				return err
+			}
+			continue
+		}
+
+		baseHash, depth, payload, err := s.readDelta(name)
+		if err != nil {
+			return err
+		}
+		if isSealed(payload) {
+			if payload, err = from.Open(payload); err != nil {
+				return fmt.Errorf("failed to decrypt %s: %w", path, err)
+			}
+		}
+		if payload, err = to.Seal(payload); err != nil {
+			return err
+		}
+
+		header := fmt.Sprintf("%s %s %d\n", deltaMagic, baseHash, depth)
+		tmpFile := path + ".tmp"
+		if err := os.WriteFile(tmpFile, append([]byte(header), payload...), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		if err := os.Rename(tmpFile, path); err != nil {
+			os.Remove(tmpFile)
+			return fmt.Errorf("failed to rename file: %w", err)
+		}
+	}
+	return nil
+}
+
+// IntegrityIssue describes a snapshot that failed verification
+type IntegrityIssue struct {
+	ID       string `json:"id"`
+	FileName string `json:"fileName"`
+	Problem  string `json:"problem"`
+}
+
+// verifyRecord checks that a snapshot can be read and matches its recorded hash
+func verifyRecord(record snapshotRecord, load func(snapshotRecord) ([]byte, error)) *IntegrityIssue {
+	canonical, err := load(record)
+	if err != nil {
+		return &IntegrityIssue{ID: record.ID, FileName: record.FileName, Problem: err.Error()}
+	}
+	if record.Hash != "" && contentHash(canonical) != record.Hash {
+		return &IntegrityIssue{ID: record.ID, FileName: record.FileName, Problem: "content hash mismatch"}
+	}
+	return nil
+}
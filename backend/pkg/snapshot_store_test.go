@@ -0,0 +1,36 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBuildDeltaRoundTrip(t *testing.T) {
+	base := []string{"{", `"a": 1,`, `"b": 2,`, `"c": 3`, "}"}
+	target := []string{"{", `"b": 2,`, `"a": 1,`, `"c": 4,`, `"d": 5`, "}"}
+
+	ops, ok := buildDelta(base, target)
+	if !ok {
+		t.Fatal("buildDelta gave up on a small diff")
+	}
+	got, err := applyDelta(base, ops)
+	if err != nil {
+		t.Fatalf("applyDelta: %v", err)
+	}
+	if strings.Join(got, "\n") != strings.Join(target, "\n") {
+		t.Errorf("applyDelta = %q, want %q", got, target)
+	}
+}
+
+func TestBuildDeltaGivesUpOnLargeDiffs(t *testing.T) {
+	base := make([]string, 5000)
+	target := make([]string, 5000)
+	for i := range base {
+		base[i] = fmt.Sprintf(`"old%d": %d,`, i, i)
+		target[i] = fmt.Sprintf(`"new%d": %d,`, i, i)
+	}
+	if _, ok := buildDelta(base, target); ok {
+		t.Error("buildDelta did not give up on a diff past maxDeltaDiffSteps")
+	}
+}
@@ -0,0 +1,261 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/oarkflow/jsonschema"
+)
+
+// ValidationError is one value that does not match a schema
+type ValidationError struct {
+	// Path is a JSON Pointer to the value, such as /price or /3/items/0/price
+	Path string `json:"path"`
+	// Rule is the schema keyword that failed, such as required, type, enum or pattern
+	Rule     string `json:"rule"`
+	Expected any    `json:"expected,omitempty"`
+	Actual   any    `json:"actual,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors lists the schema violations of a write or a file. It matches
+// ErrValidation with errors.Is.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return ErrValidation.Error()
+	case 1:
+		return fmt.Sprintf("%v: %v", ErrValidation, e[0])
+	}
+	return fmt.Sprintf("%v: %v (and %d more)", ErrValidation, e[0], len(e)-1)
+}
+
+func (e ValidationErrors) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// Under returns the violations inside the value at pointer, with paths relative to it
+func (e ValidationErrors) Under(pointer string) ValidationErrors {
+	var under ValidationErrors
+	for _, violation := range e {
+		if violation.Path == pointer || strings.HasPrefix(violation.Path, pointer+"/") {
+			relative := *violation
+			relative.Path = strings.TrimPrefix(violation.Path, pointer)
+			under = append(under, &relative)
+		}
+	}
+	return under
+}
+
+// expectedParams names the parameter of a failed keyword that holds the expected value
+var expectedParams = map[string]string{
+	"type":             "expected",
+	"enum":             "expected",
+	"in":               "expected",
+	"pattern":          "pattern",
+	"format":           "format",
+	"minimum":          "minimum",
+	"maximum":          "maximum",
+	"exclusiveMinimum": "exclusive_minimum",
+	"exclusiveMaximum": "exclusive_maximum",
+	"multipleOf":       "divisor",
+	"minLength":        "min_length",
+	"maxLength":        "max_length",
+	"minItems":         "min_items",
+	"maxItems":         "max_items",
+	"minProperties":    "min_properties",
+	"maxProperties":    "max_properties",
+}
+
+// applicatorKeywords only report that a nested value failed, so the nested failures
+// are listed instead. anyOf, oneOf and not are reported where they apply, since their
+// branches are alternatives.
+var applicatorKeywords = map[string]bool{
+	"properties":           true,
+	"patternProperties":    true,
+	"additionalProperties": true,
+	"items":                true,
+	"prefixItems":          true,
+	"contains":             true,
+	"allOf":                true,
+	"then":                 true,
+	"else":                 true,
+	"dependentSchemas":     true,
+	"propertyNames":        true,
+}
+
+// schemaViolations validates a value and lists its violations. Paths start with prefix.
+func schemaViolations(schema *jsonschema.Schema, value any, prefix string) ValidationErrors {
+	result := schema.Validate(value)
+	if result.IsValid() {
+		return nil
+	}
+	var violations ValidationErrors
+	collectViolations(result, value, true, prefix, "", &violations)
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Path < violations[j].Path
+	})
+	return violations
+}
+
+// collectViolations walks an evaluation result. Locations in the result are relative
+// to the parent result, whose value is parent, so they are joined onto location.
+// found is false below values that are missing.
+func collectViolations(result *jsonschema.EvaluationResult, parent any, found bool, prefix, location string, violations *ValidationErrors) {
+	step, actual, exists := childValue(parent, result.InstanceLocation)
+	exists = exists && found
+	location += step
+	path := prefix + location
+
+	keywords := make([]string, 0, len(result.Errors))
+	for keyword := range result.Errors {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+
+	for _, keyword := range keywords {
+		err := result.Errors[keyword]
+		switch {
+		case applicatorKeywords[keyword]:
+			continue
+		case keyword == "required":
+			for _, property := range quotedNames(err.Params) {
+				*violations = append(*violations, &ValidationError{
+					Path:    path + "/" + escapePointer(property),
+					Rule:    "required",
+					Message: fmt.Sprintf("Required property %s is missing", property),
+				})
+			}
+			continue
+		}
+
+		// The validator also checks the schemas of missing properties, which are only
+		// reported as required
+		if !exists {
+			continue
+		}
+
+		violation := &ValidationError{Path: path, Rule: keyword, Actual: actual, Message: err.Error()}
+		if err.Code == "false_schema_mismatch" {
+			violation.Rule = "additionalProperties"
+			violation.Message = "Property is not allowed"
+		}
+		if param, ok := expectedParams[keyword]; ok {
+			violation.Expected = expectedValue(keyword, err.Params[param])
+		}
+		*violations = append(*violations, violation)
+	}
+
+	for _, detail := range result.Details {
+		if !detail.Valid && !skippedBranch(detail.EvaluationPath) {
+			collectViolations(detail, actual, exists, prefix, location, violations)
+		}
+	}
+}
+
+// skippedBranch reports whether an evaluation path is a condition or an alternative,
+// whose failures are not violations of their own
+func skippedBranch(evaluationPath string) bool {
+	switch evaluationPath {
+	case "/if", "/not", "/oneOf":
+		return true
+	}
+	return strings.HasPrefix(evaluationPath, "/anyOf/") || strings.HasPrefix(evaluationPath, "/oneOf/")
+}
+
+// expectedValue converts the expected value of a failed keyword from its message parameter
+func expectedValue(keyword string, param any) any {
+	s, ok := param.(string)
+	if !ok {
+		return param
+	}
+	switch keyword {
+	case "type":
+		return strings.Split(s, ", ")
+	case "pattern", "format", "enum", "in":
+		return s
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return n
+	}
+	return s
+}
+
+// quotedNames reads the property names of a required error, given as 'a', 'b'
+func quotedNames(params map[string]interface{}) []string {
+	list, _ := params["property"].(string)
+	if list == "" {
+		list, _ = params["properties"].(string)
+	}
+	var names []string
+	for _, name := range strings.Split(list, ", ") {
+		if name = strings.Trim(name, "'"); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// childValue returns the escaped JSON Pointer and the value of a location relative to
+// parent. The validator does not escape property names in locations, so /a/b is taken
+// as the property "a/b" when parent has one.
+func childValue(parent any, relative string) (string, any, bool) {
+	if object, ok := parent.(map[string]any); ok && relative != "" {
+		name := strings.TrimPrefix(relative, "/")
+		if child, ok := object[name]; ok {
+			return "/" + escapePointer(name), child, true
+		}
+	}
+	value, exists := pointerValue(parent, relative)
+	return relative, value, exists
+}
+
+// pointerValue returns the value a JSON Pointer refers to
+func pointerValue(root any, pointer string) (any, bool) {
+	if pointer == "" {
+		return root, true
+	}
+	value := root
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch v := value.(type) {
+		case map[string]any:
+			child, ok := v[token]
+			if !ok {
+				return nil, false
+			}
+			value = child
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		case []map[string]any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// escapePointer escapes a property name for use in a JSON Pointer
+func escapePointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaViolations(t *testing.T) {
+	const document = `{"type": "object", "required": ["name"], "additionalProperties": false, "properties": {
+		"id": {"type": "integer"},
+		"name": {"type": "string", "minLength": 1},
+		"price": {"type": "number", "minimum": 0},
+		"code": {"type": "string", "pattern": "^[A-Z]+$"},
+		"a/b": {"type": "string", "maxLength": 1},
+		"c~d": {"type": "integer"},
+		"dietaryInfo": {"anyOf": [{"type": "string"}, {"type": "array", "items": {"type": "string"}}]},
+		"items": {"type": "array", "items": {"type": "object", "properties": {"price": {"type": "number", "minimum": 0}}}}}}`
+	schema, err := ParseFileSchema([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		value  string
+		prefix string
+		want   []ValidationError
+	}{
+		{
+			name:  "valid",
+			value: `{"id": 1, "name": "Tea", "dietaryInfo": ["V"]}`,
+		},
+		{
+			name:  "bounds and types",
+			value: `{"id": "one", "name": "Tea", "price": -1}`,
+			want: []ValidationError{
+				{Path: "/id", Rule: "type", Expected: []string{"integer"}, Actual: "one"},
+				{Path: "/price", Rule: "minimum", Expected: 0.0, Actual: -1.0},
+			},
+		},
+		{
+			name:  "required and additional properties",
+			value: `{"extra": true}`,
+			want: []ValidationError{
+				{Path: "/extra", Rule: "additionalProperties", Actual: true},
+				{Path: "/name", Rule: "required"},
+			},
+		},
+		{
+			name:  "pattern and escaped names",
+			value: `{"name": "Tea", "code": "abc", "a/b": "xy", "c~d": "x"}`,
+			want: []ValidationError{
+				{Path: "/a~1b", Rule: "maxLength", Expected: 1.0, Actual: "xy"},
+				{Path: "/code", Rule: "pattern", Expected: "^[A-Z]+$", Actual: "abc"},
+				{Path: "/c~0d", Rule: "type", Expected: []string{"integer"}, Actual: "x"},
+			},
+		},
+		{
+			name:  "union reported at the field",
+			value: `{"name": "Tea", "dietaryInfo": 5}`,
+			want: []ValidationError{
+				{Path: "/dietaryInfo", Rule: "anyOf", Actual: 5.0},
+			},
+		},
+		{
+			name:   "nested array elements below a prefix",
+			value:  `{"name": "Tea", "items": [{"price": 1}, {"price": -2}]}`,
+			prefix: "/3",
+			want: []ValidationError{
+				{Path: "/3/items/1/price", Rule: "minimum", Expected: 0.0, Actual: -2.0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value any
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			got := []ValidationError{}
+			for _, violation := range schemaViolations(schema.Compiled(), value, tt.prefix) {
+				if violation.Message == "" {
+					t.Errorf("violation at %s has no message", violation.Path)
+				}
+				violation.Message = ""
+				got = append(got, *violation)
+			}
+			if tt.want == nil {
+				tt.want = []ValidationError{}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("violations = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidationErrorsUnder(t *testing.T) {
+	violations := ValidationErrors{
+		{Path: "/1/price", Rule: "minimum"},
+		{Path: "/1", Rule: "type"},
+		{Path: "/10/price", Rule: "minimum"},
+		{Path: "/2/name", Rule: "required"},
+	}
+	if !errors.Is(violations, ErrValidation) {
+		t.Error("ValidationErrors does not match ErrValidation")
+	}
+
+	// Paths become relative, and /10 is not inside /1
+	under := violations.Under("/1")
+	want := ValidationErrors{{Path: "/price", Rule: "minimum"}, {Path: "", Rule: "type"}}
+	if !reflect.DeepEqual(under, want) {
+		t.Errorf("Under(/1) = %+v, want %+v", under, want)
+	}
+	if violations[0].Path != "/1/price" {
+		t.Error("Under changed the original violations")
+	}
+	if under := violations.Under("/3"); len(under) != 0 {
+		t.Errorf("Under(/3) = %+v, want none", under)
+	}
+}
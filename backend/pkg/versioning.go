@@ -1,234 +1,713 @@
 package pkg
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Operations recorded in version commit metadata
+const (
+	OperationCreate  = "create"
+	OperationUpdate  = "update"
+	OperationDelete  = "delete"
+	OperationRestore = "restore"
+	OperationBulk    = "bulk"
+	OperationMigrate = "migrate"
+)
+
+// Layouts of the timestamps embedded in snapshot names before ids were introduced
+const (
+	legacyVersionLayout = "20060102_150405"
+	legacyBackupLayout  = "20060102_150405_000"
+)
+
+// CommitInfo describes who made a change and why
+type CommitInfo struct {
+	Author      string   `json:"author,omitempty"`
+	AuthorName  string   `json:"authorName,omitempty"`
+	Message     string   `json:"message,omitempty"`
+	Operation   string   `json:"operation,omitempty"`
+	AffectedIDs []string `json:"affectedIds,omitempty"`
+	// PreRestoreBackup is the backup of the data a restore replaced
+	PreRestoreBackup string `json:"preRestoreBackup,omitempty"`
+}
+
+// ErrSnapshotCorrupt is returned when a snapshot no longer matches its content hash
+var ErrSnapshotCorrupt = errors.New("snapshot does not match its content hash")
+
 // VersionManager handles file versioning and backups
 type VersionManager struct {
-	basePath    string
-	maxVersions int
+	mu        sync.Mutex
+	basePath  string
+	retention RetentionPolicy
+	// deltas stores versions as line deltas against the previous version
+	deltas        bool
+	maxDeltaChain int
 }
 
-// NewVersionManager creates a new version manager
+// NewVersionManager creates a new version manager using the default retention
+// policy, keeping at most maxVersions versions per file when maxVersions > 0
 func NewVersionManager(basePath string, maxVersions int) *VersionManager {
+	retention := DefaultRetentionPolicy()
+	retention.MaxCount = maxVersions
 	return &VersionManager{
-		basePath:    basePath,
-		maxVersions: maxVersions,
+		basePath:  basePath,
+		retention: retention,
 	}
 }
 
+// EnableDeltas stores new versions as deltas against the previous one,
+// with at most maxChain deltas between full snapshots
+func (vm *VersionManager) EnableDeltas(maxChain int) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	if maxChain <= 0 {
+		maxChain = DefaultMaxDeltaChain
+	}
+	vm.deltas = true
+	vm.maxDeltaChain = maxChain
+}
+
 // CreateVersion creates a new version of the file
 func (vm *VersionManager) CreateVersion(filePath string, data []map[string]any, format FileFormat) error {
-	versionDir := filepath.Join(vm.basePath, "versions", filepath.Base(filePath))
+	return vm.CreateVersionWithInfo(filePath, data, format, CommitInfo{})
+}
+
+// CreateVersionWithInfo creates a new version and records its commit metadata in the manifest.
+// Versions are stored by content hash; nothing is recorded when the data equals the latest version.
+func (vm *VersionManager) CreateVersionWithInfo(filePath string, data []map[string]any, format FileFormat, info CommitInfo) error {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	versionDir := vm.versionDir(filePath)
 	if err := os.MkdirAll(versionDir, 0755); err != nil {
 		return fmt.Errorf("failed to create version directory: %w", err)
 	}
 
-	timestamp := time.Now().Format("20060102_150405")
-	versionFile := filepath.Join(versionDir, fmt.Sprintf("%s_%s%s", strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath)), timestamp, format.Extension()))
+	records, err := vm.syncManifest(filePath)
+	if err != nil {
+		return err
+	}
 
-	file, err := os.Create(versionFile)
+	content, err := prepareSnapshot(data, format)
 	if err != nil {
-		return fmt.Errorf("failed to create version file: %w", err)
+		return fmt.Errorf("failed to write version: %w", err)
+	}
+
+	// Skip no-op versions
+	if len(records) > 0 && records[len(records)-1].Hash == content.hash {
+		return nil
+	}
+
+	store := newObjectStore(versionDir, format)
+	name, exists := store.find(content.hash)
+	if !exists {
+		if name, err = vm.storeObject(store, records, content); err != nil {
+			return fmt.Errorf("failed to write version: %w", err)
+		}
 	}
-	defer file.Close()
 
-	if err := format.Serialize(file, data); err != nil {
-		os.Remove(versionFile)
-		return fmt.Errorf("failed to serialize version data: %w", err)
+	id, timestamp := newSnapshotID()
+	records = append(records, snapshotRecord{
+		ID:         id,
+		FileName:   name,
+		Timestamp:  timestamp,
+		Size:       int64(len(content.encoded)),
+		Hash:       content.hash,
+		CommitInfo: info,
+	})
+
+	if err := saveManifest(versionDir, records); err != nil {
+		return err
 	}
 
 	// Clean up old versions
-	return vm.cleanupOldVersions(versionDir)
+	_, err = vm.prune(filePath, format, records, false)
+	return err
 }
 
-// ListVersions returns all available versions for a file
-func (vm *VersionManager) ListVersions(filePath string) ([]VersionInfo, error) {
-	versionDir := filepath.Join(vm.basePath, "versions", filepath.Base(filePath))
+// storeObject writes new content as a delta against the latest version when
+// deltas are enabled and that is smaller, otherwise as a full snapshot
+func (vm *VersionManager) storeObject(store *objectStore, records []snapshotRecord, content *snapshotContent) (string, error) {
+	if vm.deltas && len(records) > 0 {
+		if latest := records[len(records)-1]; isObjectName(latest.FileName) {
+			name, ok, err := store.writeDelta(content, latest.FileName, vm.maxDeltaChain)
+			if err != nil {
+				return "", err
+			}
+			if ok {
+				return name, nil
+			}
+		}
+	}
+	return store.writeFull(content)
+}
+
+// loadRecord returns the data and canonical JSON of a version
+func (vm *VersionManager) loadRecord(filePath string, record snapshotRecord, format FileFormat) ([]map[string]any, []byte, error) {
+	versionDir := vm.versionDir(filePath)
+	if isObjectName(record.FileName) {
+		return newObjectStore(versionDir, format).load(record.FileName)
+	}
+
+	data, err := readSnapshot(filepath.Join(versionDir, record.FileName), format)
+	if err != nil {
+		return nil, nil, err
+	}
+	canonical, err := canonicalJSON(data)
+	return data, canonical, err
+}
+
+// Verify checks that every version can be rebuilt and matches its content hash
+func (vm *VersionManager) Verify(filePath string, format FileFormat) ([]IntegrityIssue, error) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	records, err := vm.syncManifest(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	issues := []IntegrityIssue{}
+	for _, record := range records {
+		if issue := verifyRecord(record, func(record snapshotRecord) ([]byte, error) {
+			_, canonical, err := vm.loadRecord(filePath, record, format)
+			return canonical, err
+		}); issue != nil {
+			issues = append(issues, *issue)
+		}
+	}
+	return issues, nil
+}
+
+// ReEncrypt rewrites all versions of a file with a new key
+func (vm *VersionManager) ReEncrypt(filePath string, from, to *EncryptedFormat) error {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	records, err := vm.syncManifest(filePath)
+	if err != nil {
+		return err
+	}
+
+	versionDir := vm.versionDir(filePath)
+	for _, record := range records {
+		if !isObjectName(record.FileName) {
+			if err := ReEncryptFile(filepath.Join(versionDir, record.FileName), from, to); err != nil {
+				return err
+			}
+		}
+	}
+	return newObjectStore(versionDir, to).reEncrypt(from, to)
+}
+
+// versionDir returns the directory holding versions of a file
+func (vm *VersionManager) versionDir(filePath string) string {
+	return filepath.Join(vm.basePath, "versions", filepath.Base(filePath))
+}
+
+// syncManifest loads the manifest of a file's versions, importing version
+// files created before the manifest existed. Callers must hold the lock.
+func (vm *VersionManager) syncManifest(filePath string) ([]snapshotRecord, error) {
+	versionDir := vm.versionDir(filePath)
+	records, err := loadManifest(versionDir)
+	if err != nil {
+		return nil, err
+	}
 
 	entries, err := os.ReadDir(versionDir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return []VersionInfo{}, nil
+			return records, nil
 		}
 		return nil, err
 	}
 
-	var versions []VersionInfo
+	known := make(map[string]bool, len(records))
+	for _, record := range records {
+		known[record.FileName] = true
+	}
+
+	imported := false
 	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), filepath.Ext(filePath)) {
-			parts := strings.Split(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())), "_")
-			if len(parts) >= 2 {
-				timestamp, err := time.Parse("20060102_150405", parts[len(parts)-1])
-				if err == nil {
-					versions = append(versions, VersionInfo{
-						FileName:  entry.Name(),
-						Path:      filepath.Join(versionDir, entry.Name()),
-						Timestamp: timestamp,
-					})
-				}
-			}
+		name := entry.Name()
+		if entry.IsDir() || known[name] || name == manifestFileName || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+
+		// Legacy names look like <name>_20060102_150405<ext>
+		parts := strings.Split(strings.TrimSuffix(name, filepath.Ext(name)), "_")
+		stamp := ""
+		if len(parts) >= 3 {
+			stamp = parts[len(parts)-2] + "_" + parts[len(parts)-1]
+		}
+		path := filepath.Join(versionDir, name)
+		timestamp := legacyTimestamp(path, stamp, legacyVersionLayout)
+
+		record := snapshotRecord{
+			ID:        legacySnapshotID(timestamp, name),
+			FileName:  name,
+			Timestamp: timestamp.UTC(),
+		}
+		if info, err := entry.Info(); err == nil {
+			record.Size = info.Size()
 		}
+		records = append(records, record)
+		imported = true
 	}
 
-	// Sort by timestamp (newest first)
-	sort.Slice(versions, func(i, j int) bool {
-		return versions[i].Timestamp.After(versions[j].Timestamp)
-	})
+	if imported {
+		if err := saveManifest(versionDir, records); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// MigrateLegacy imports version files named by timestamp into the manifest
+func (vm *VersionManager) MigrateLegacy(filePath string) error {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	_, err := vm.syncManifest(filePath)
+	return err
+}
+
+// ListVersions returns all available versions for a file
+func (vm *VersionManager) ListVersions(filePath string) ([]VersionInfo, error) {
+	vm.mu.Lock()
+	records, err := vm.syncManifest(filePath)
+	vm.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
 
+	versionDir := vm.versionDir(filePath)
+	versions := []VersionInfo{}
+	// Newest first
+	for i := len(records) - 1; i >= 0; i-- {
+		versions = append(versions, versionInfo(versionDir, records[i]))
+	}
 	return versions, nil
 }
 
+// FindVersion returns the version of a file with the given id
+func (vm *VersionManager) FindVersion(filePath, id string) (*VersionInfo, error) {
+	vm.mu.Lock()
+	records, err := vm.syncManifest(filePath)
+	vm.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	record, ok := findRecord(records, id)
+	if !ok {
+		return nil, fmt.Errorf("version %s not found", id)
+	}
+	version := versionInfo(vm.versionDir(filePath), record)
+	return &version, nil
+}
+
+// LoadVersion returns the data stored in the version of a file with the given id
+func (vm *VersionManager) LoadVersion(filePath, id string, format FileFormat) ([]map[string]any, error) {
+	vm.mu.Lock()
+	records, err := vm.syncManifest(filePath)
+	vm.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	record, ok := findRecord(records, id)
+	if !ok {
+		return nil, fmt.Errorf("version %s not found", id)
+	}
+	data, canonical, err := vm.loadRecord(filePath, record, format)
+	if err != nil {
+		return nil, err
+	}
+	if record.Hash != "" && contentHash(canonical) != record.Hash {
+		return nil, fmt.Errorf("version %s: %w", record.ID, ErrSnapshotCorrupt)
+	}
+	return data, nil
+}
+
+// versionInfo converts a manifest record to its public form
+func versionInfo(versionDir string, record snapshotRecord) VersionInfo {
+	return VersionInfo{
+		ID:         record.ID,
+		FileName:   record.FileName,
+		Path:       filepath.Join(versionDir, record.FileName),
+		Timestamp:  record.Timestamp,
+		Size:       record.Size,
+		Hash:       record.Hash,
+		Pinned:     record.Pinned,
+		Tags:       record.Tags,
+		CommitInfo: record.CommitInfo,
+	}
+}
+
 // RestoreVersion restores a specific version
 func (vm *VersionManager) RestoreVersion(versionPath, targetPath string, format FileFormat) error {
-	file, err := os.Open(versionPath)
+	data, err := readSnapshot(versionPath, format)
 	if err != nil {
-		return fmt.Errorf("failed to open version file: %w", err)
+		return err
 	}
-	defer file.Close()
+	return serializeAtomic(targetPath, format, data)
+}
 
-	data, err := format.Parse(file)
+// readSnapshot parses a version or backup file, which may have been stored in
+// another format than the file currently uses
+func readSnapshot(path string, format FileFormat) ([]map[string]any, error) {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("failed to parse version data: %w", err)
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
 	}
 
-	// Write to target file
-	targetFile, err := os.Create(targetPath)
+	snapshotFormat, err := detectSnapshotFormat(path, content, format)
 	if err != nil {
-		return fmt.Errorf("failed to create target file: %w", err)
+		return nil, err
 	}
-	defer targetFile.Close()
-
-	return format.Serialize(targetFile, data)
+	data, err := snapshotFormat.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot: %w", err)
+	}
+	return data, nil
 }
 
-// DeleteVersion deletes a specific version
-func (vm *VersionManager) DeleteVersion(versionPath string) error {
-	return os.Remove(versionPath)
+// detectSnapshotFormat picks the format of a snapshot from its extension, so snapshots
+// taken before the file was converted stay readable, and from its encryption header
+func detectSnapshotFormat(path string, content []byte, format FileFormat) (FileFormat, error) {
+	inner := PlainFormat(format)
+	if ext := filepath.Ext(path); ext != inner.Extension() {
+		if other, err := NewFormatRegistry().Get(ext); err == nil {
+			inner = other
+		}
+	}
+
+	if !isSealed(content) {
+		return inner, nil
+	}
+	encrypted, ok := format.(*EncryptedFormat)
+	if !ok {
+		return nil, errors.New("snapshot is encrypted but no encryption key is configured")
+	}
+	if inner == encrypted.inner {
+		return encrypted, nil
+	}
+	return encrypted.withInner(inner), nil
 }
 
-// cleanupOldVersions removes versions beyond the maximum limit
-func (vm *VersionManager) cleanupOldVersions(versionDir string) error {
-	entries, err := os.ReadDir(versionDir)
+// DeleteVersion deletes a specific version of a file
+func (vm *VersionManager) DeleteVersion(filePath, id string, format FileFormat) error {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	records, err := vm.syncManifest(filePath)
 	if err != nil {
 		return err
 	}
-
-	if len(entries) <= vm.maxVersions {
-		return nil
+	record, ok := findRecord(records, id)
+	if !ok {
+		return fmt.Errorf("version %s not found", id)
 	}
 
-	// Sort by modification time (oldest first)
-	sort.Slice(entries, func(i, j int) bool {
-		infoI, errI := entries[i].Info()
-		infoJ, errJ := entries[j].Info()
-		if errI != nil || errJ != nil {
-			return false
+	versionDir := vm.versionDir(filePath)
+	kept := make([]snapshotRecord, 0, len(records))
+	for _, existing := range records {
+		if existing.ID != record.ID {
+			kept = append(kept, existing)
 		}
-		return infoI.ModTime().Before(infoJ.ModTime())
-	})
+	}
+	if !isObjectName(record.FileName) {
+		os.Remove(filepath.Join(versionDir, record.FileName))
+	}
+	if err := saveManifest(versionDir, kept); err != nil {
+		return err
+	}
+	return newObjectStore(versionDir, format).gc(kept)
+}
 
-	// Remove oldest versions
-	for i := 0; i < len(entries)-vm.maxVersions; i++ {
-		os.Remove(filepath.Join(versionDir, entries[i].Name()))
+// removeRecord drops the manifest entry of a deleted snapshot file
+func removeRecord(dir, fileName string) error {
+	records, err := loadManifest(dir)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	kept := records[:0]
+	for _, record := range records {
+		if record.FileName != fileName {
+			kept = append(kept, record)
+		}
+	}
+	return saveManifest(dir, kept)
 }
 
 // VersionInfo contains information about a version
 type VersionInfo struct {
+	ID        string    `json:"id"`
 	FileName  string    `json:"fileName"`
-	Path      string    `json:"path"`
+	Path      string    `json:"-"`
 	Timestamp time.Time `json:"timestamp"`
+	Size      int64     `json:"size,omitempty"`
+	Hash      string    `json:"hash,omitempty"`
+	Pinned    bool      `json:"pinned,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	CommitInfo
+}
+
+// VersionFilter selects versions by author and time range. Zero values match everything.
+type VersionFilter struct {
+	Author string
+	Since  time.Time
+	Until  time.Time
+}
+
+// Matches reports whether a version passes the filter
+func (f VersionFilter) Matches(version VersionInfo) bool {
+	if f.Author != "" && !strings.EqualFold(version.Author, f.Author) && !strings.EqualFold(version.AuthorName, f.Author) {
+		return false
+	}
+	if !f.Since.IsZero() && version.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && version.Timestamp.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// FilterVersions returns the versions matching a filter
+func FilterVersions(versions []VersionInfo, filter VersionFilter) []VersionInfo {
+	filtered := []VersionInfo{}
+	for _, version := range versions {
+		if filter.Matches(version) {
+			filtered = append(filtered, version)
+		}
+	}
+	return filtered
 }
 
 // BackupManager handles file backups
 type BackupManager struct {
+	mu        sync.Mutex
 	backupDir string
+	retention RetentionPolicy
 }
 
-// NewBackupManager creates a new backup manager
+// NewBackupManager creates a new backup manager using the default retention policy
 func NewBackupManager(backupDir string) *BackupManager {
 	return &BackupManager{
 		backupDir: backupDir,
+		retention: DefaultRetentionPolicy(),
 	}
 }
 
+// fileBackupDir returns the directory holding backups of a file
+func (bm *BackupManager) fileBackupDir(filePath string) string {
+	return filepath.Join(bm.backupDir, filepath.Base(filePath))
+}
+
 // CreateBackup creates a backup of the file
 func (bm *BackupManager) CreateBackup(filePath string, data []map[string]any, format FileFormat) (string, error) {
-	if err := os.MkdirAll(bm.backupDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	record, err := bm.createBackup(filePath, data, format)
+	if err != nil {
+		return "", err
 	}
+	return filepath.Join(bm.fileBackupDir(filePath), record.FileName), nil
+}
+
+// createBackup stores a backup unless the latest one holds the same data, and returns its record
+func (bm *BackupManager) createBackup(filePath string, data []map[string]any, format FileFormat) (snapshotRecord, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
 
-	timestamp := time.Now().Format("20060102_150405_000")
-	backupFile := filepath.Join(bm.backupDir, fmt.Sprintf("%s_backup_%s%s",
-		strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath)),
-		timestamp,
-		format.Extension()))
+	dir := bm.fileBackupDir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return snapshotRecord{}, fmt.Errorf("failed to create backup directory: %w", err)
+	}
 
-	file, err := os.Create(backupFile)
+	records, err := bm.syncManifest(filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to create backup file: %w", err)
+		return snapshotRecord{}, err
+	}
+
+	content, err := prepareSnapshot(data, format)
+	if err != nil {
+		return snapshotRecord{}, fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	// An identical latest backup already covers this data
+	if len(records) > 0 && records[len(records)-1].Hash == content.hash {
+		return records[len(records)-1], nil
+	}
+
+	id, timestamp := newSnapshotID()
+	backupFile := filepath.Join(dir, id+format.Extension())
+	if err := writeExclusive(backupFile, content.encoded); err != nil {
+		return snapshotRecord{}, fmt.Errorf("failed to write backup: %w", err)
 	}
-	defer file.Close()
 
-	if err := format.Serialize(file, data); err != nil {
-		os.Remove(backupFile)
-		return "", fmt.Errorf("failed to serialize backup data: %w", err)
+	record := snapshotRecord{
+		ID:        id,
+		FileName:  filepath.Base(backupFile),
+		Timestamp: timestamp,
+		Size:      int64(len(content.encoded)),
+		Hash:      content.hash,
+	}
+	records = append(records, record)
+	if err := saveManifest(dir, records); err != nil {
+		return snapshotRecord{}, err
 	}
 
-	return backupFile, nil
+	// Clean up old backups
+	if _, err := bm.prune(filePath, records, false); err != nil {
+		return snapshotRecord{}, err
+	}
+
+	return record, nil
 }
 
-// ListBackups returns all available backups
-func (bm *BackupManager) ListBackups(filePath string) ([]BackupInfo, error) {
-	pattern := filepath.Join(bm.backupDir, fmt.Sprintf("%s_backup_*%s",
-		strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath)),
-		filepath.Ext(filePath)))
+// syncManifest loads the manifest of a file's backups, moving backups created
+// before the manifest existed into the file's backup directory. Callers must hold the lock.
+func (bm *BackupManager) syncManifest(filePath string) ([]snapshotRecord, error) {
+	dir := bm.fileBackupDir(filePath)
+	records, err := loadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
 
-	matches, err := filepath.Glob(pattern)
+	stem := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	matches, err := filepath.Glob(filepath.Join(bm.backupDir, stem+"_backup_*"+filepath.Ext(filePath)))
 	if err != nil {
 		return nil, err
 	}
+	if len(matches) == 0 {
+		return records, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
 
-	var backups []BackupInfo
 	for _, match := range matches {
-		stat, err := os.Stat(match)
-		if err != nil {
-			continue
+		name := filepath.Base(match)
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, stem+"_backup_"), filepath.Ext(name))
+		timestamp := legacyTimestamp(match, stamp, legacyBackupLayout)
+
+		target := filepath.Join(dir, name)
+		if err := os.Rename(match, target); err != nil {
+			return nil, fmt.Errorf("failed to migrate backup %s: %w", name, err)
 		}
 
-		// Extract timestamp from filename
-		base := strings.TrimSuffix(filepath.Base(match), filepath.Ext(match))
-		parts := strings.Split(base, "_backup_")
-		if len(parts) == 2 {
-			timestamp, err := time.Parse("20060102_150405_000", parts[1])
-			if err == nil {
-				backups = append(backups, BackupInfo{
-					FileName:  filepath.Base(match),
-					Path:      match,
-					Size:      stat.Size(),
-					Timestamp: timestamp,
-				})
-			}
+		record := snapshotRecord{
+			ID:        legacySnapshotID(timestamp, name),
+			FileName:  name,
+			Timestamp: timestamp.UTC(),
 		}
+		if stat, err := os.Stat(target); err == nil {
+			record.Size = stat.Size()
+		}
+		records = append(records, record)
 	}
 
-	// Sort by timestamp (newest first)
-	sort.Slice(backups, func(i, j int) bool {
-		return backups[i].Timestamp.After(backups[j].Timestamp)
-	})
+	if err := saveManifest(dir, records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// MigrateLegacy imports backups named by timestamp into the manifest
+func (bm *BackupManager) MigrateLegacy(filePath string) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	_, err := bm.syncManifest(filePath)
+	return err
+}
+
+// ListBackups returns all available backups
+func (bm *BackupManager) ListBackups(filePath string) ([]BackupInfo, error) {
+	bm.mu.Lock()
+	records, err := bm.syncManifest(filePath)
+	bm.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
 
+	dir := bm.fileBackupDir(filePath)
+	backups := []BackupInfo{}
+	// Newest first
+	for i := len(records) - 1; i >= 0; i-- {
+		backups = append(backups, backupInfo(dir, records[i]))
+	}
 	return backups, nil
 }
 
+// FindBackup returns the backup of a file with the given id
+func (bm *BackupManager) FindBackup(filePath, id string) (*BackupInfo, error) {
+	bm.mu.Lock()
+	records, err := bm.syncManifest(filePath)
+	bm.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	record, ok := findRecord(records, id)
+	if !ok {
+		return nil, fmt.Errorf("backup %s not found", id)
+	}
+	backup := backupInfo(bm.fileBackupDir(filePath), record)
+	return &backup, nil
+}
+
+// Verify checks that every backup can be read and matches its content hash
+func (bm *BackupManager) Verify(filePath string, format FileFormat) ([]IntegrityIssue, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	records, err := bm.syncManifest(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := bm.fileBackupDir(filePath)
+	issues := []IntegrityIssue{}
+	for _, record := range records {
+		if issue := verifyRecord(record, func(record snapshotRecord) ([]byte, error) {
+			data, err := readSnapshot(filepath.Join(dir, record.FileName), format)
+			if err != nil {
+				return nil, err
+			}
+			return canonicalJSON(data)
+		}); issue != nil {
+			issues = append(issues, *issue)
+		}
+	}
+	return issues, nil
+}
+
+// backupInfo converts a manifest record to its public form
+func backupInfo(dir string, record snapshotRecord) BackupInfo {
+	return BackupInfo{
+		ID:        record.ID,
+		FileName:  record.FileName,
+		Path:      filepath.Join(dir, record.FileName),
+		Size:      record.Size,
+		Hash:      record.Hash,
+		Pinned:    record.Pinned,
+		Tags:      record.Tags,
+		Timestamp: record.Timestamp,
+	}
+}
+
 // RestoreBackup restores a backup
 func (bm *BackupManager) RestoreBackup(backupPath, targetPath string, format FileFormat) error {
 	return bm.restoreFromPath(backupPath, targetPath, format)
@@ -236,35 +715,62 @@ func (bm *BackupManager) RestoreBackup(backupPath, targetPath string, format Fil
 
 // DeleteBackup deletes a backup
 func (bm *BackupManager) DeleteBackup(backupPath string) error {
-	return os.Remove(backupPath)
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if err := os.Remove(backupPath); err != nil {
+		return err
+	}
+	return removeRecord(filepath.Dir(backupPath), filepath.Base(backupPath))
 }
 
-// restoreFromPath is a helper method to restore from any path
-func (bm *BackupManager) restoreFromPath(sourcePath, targetPath string, format FileFormat) error {
-	file, err := os.Open(sourcePath)
+// LoadBackup returns the data stored in the backup of a file with the given id,
+// checking it against its content hash
+func (bm *BackupManager) LoadBackup(filePath, id string, format FileFormat) ([]map[string]any, error) {
+	bm.mu.Lock()
+	records, err := bm.syncManifest(filePath)
+	bm.mu.Unlock()
 	if err != nil {
-		return fmt.Errorf("failed to open source file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
 
-	data, err := format.Parse(file)
+	record, ok := findRecord(records, id)
+	if !ok {
+		return nil, fmt.Errorf("backup %s not found", id)
+	}
+	data, err := readSnapshot(filepath.Join(bm.fileBackupDir(filePath), record.FileName), format)
 	if err != nil {
-		return fmt.Errorf("failed to parse source data: %w", err)
+		return nil, err
+	}
+	if record.Hash != "" {
+		canonical, err := canonicalJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		if contentHash(canonical) != record.Hash {
+			return nil, fmt.Errorf("backup %s: %w", record.ID, ErrSnapshotCorrupt)
+		}
 	}
+	return data, nil
+}
 
-	targetFile, err := os.Create(targetPath)
+// restoreFromPath is a helper method to restore from any path
+func (bm *BackupManager) restoreFromPath(sourcePath, targetPath string, format FileFormat) error {
+	data, err := readSnapshot(sourcePath, format)
 	if err != nil {
-		return fmt.Errorf("failed to create target file: %w", err)
+		return err
 	}
-	defer targetFile.Close()
-
-	return format.Serialize(targetFile, data)
+	return serializeAtomic(targetPath, format, data)
 }
 
 // BackupInfo contains information about a backup
 type BackupInfo struct {
+	ID        string    `json:"id"`
 	FileName  string    `json:"fileName"`
-	Path      string    `json:"path"`
+	Path      string    `json:"-"`
 	Size      int64     `json:"size"`
+	Hash      string    `json:"hash,omitempty"`
+	Pinned    bool      `json:"pinned,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
 }
@@ -0,0 +1,228 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestFile writes content to path, creating its directory
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	newer := snapshotRecord{
+		ID:        "20240201T120000.000000000Z-bbbb",
+		FileName:  "objects/ab/abcd.json",
+		Timestamp: time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC),
+		Size:      42,
+		Hash:      "abcd",
+		Tags:      []string{"release"},
+		CommitInfo: CommitInfo{
+			Author:      "1",
+			AuthorName:  "Ada",
+			Message:     "Raise the price of tea",
+			Operation:   OperationUpdate,
+			AffectedIDs: []string{"7"},
+		},
+	}
+	older := snapshotRecord{
+		ID:        "20240131T093000.000000000Z-aaaa",
+		FileName:  "menu_20240131_093000.json",
+		Timestamp: time.Date(2024, 1, 31, 9, 30, 0, 0, time.UTC),
+		Pinned:    true,
+	}
+	if err := saveManifest(dir, []snapshotRecord{newer, older}); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Records come back oldest first
+	if want := []snapshotRecord{older, newer}; !reflect.DeepEqual(loaded, want) {
+		t.Errorf("loadManifest = %+v, want %+v", loaded, want)
+	}
+
+	if missing, err := loadManifest(filepath.Join(dir, "missing")); err != nil || len(missing) != 0 {
+		t.Errorf("loadManifest of a directory without a manifest = %v, %v", missing, err)
+	}
+	writeTestFile(t, filepath.Join(dir, "broken", manifestFileName), `[{"id": `)
+	if _, err := loadManifest(filepath.Join(dir, "broken")); err == nil {
+		t.Error("loadManifest accepted a broken manifest")
+	}
+}
+
+func TestManifestWithoutIDs(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, manifestFileName), `[
+		{"fileName": "menu_20240201_120000.json", "timestamp": "2024-02-01T12:00:00Z"},
+		{"fileName": "menu_20240131_093000.json", "timestamp": "2024-01-31T09:30:00Z"}
+	]`)
+
+	first, err := loadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := loadManifest(dir)
+	if first[0].ID == "" || !reflect.DeepEqual(first, second) {
+		t.Errorf("entries without ids got %+v, then %+v, want the same ids each time", first, second)
+	}
+	if first[0].FileName != "menu_20240131_093000.json" || !strings.HasPrefix(first[0].ID, "20240131T093000") {
+		t.Errorf("first record = %+v, want the oldest entry with an id from its timestamp", first[0])
+	}
+}
+
+func TestVersionCommitInfo(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "menu.json")
+	format := &JSONFormat{}
+	tea := []map[string]any{{"id": 1.0, "name": "Tea", "price": 2.5}}
+	dearTea := []map[string]any{{"id": 1.0, "name": "Tea", "price": 3.0}}
+
+	vm := NewVersionManager(dir, 0)
+	created := CommitInfo{Author: "1", AuthorName: "Ada", Message: "Add tea", Operation: OperationCreate, AffectedIDs: []string{"1"}}
+	updated := CommitInfo{Author: "2", AuthorName: "Bo", Operation: OperationUpdate, AffectedIDs: []string{"1"}}
+	for _, change := range []struct {
+		data []map[string]any
+		info CommitInfo
+	}{
+		{tea, created},
+		// Unchanged data records no version
+		{tea, CommitInfo{Author: "2", Operation: OperationUpdate}},
+		{dearTea, updated},
+	} {
+		if err := vm.CreateVersionWithInfo(filePath, change.data, format, change.info); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A new manager reads everything back from the manifest
+	versions, err := NewVersionManager(dir, 0).ListVersions(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("listed %d versions, want 2", len(versions))
+	}
+	if versions[0].CommitInfo.Author != updated.Author || !reflect.DeepEqual(versions[1].CommitInfo, created) {
+		t.Errorf("versions have commit info %+v and %+v, want %+v and %+v", versions[0].CommitInfo, versions[1].CommitInfo, updated, created)
+	}
+	if versions[0].ID <= versions[1].ID || versions[0].Hash == "" || versions[0].Hash == versions[1].Hash {
+		t.Errorf("versions %+v and %+v lack ordered ids or distinct hashes", versions[0], versions[1])
+	}
+
+	data, err := vm.LoadVersion(filePath, versions[1].ID, format)
+	if err != nil || !reflect.DeepEqual(data, tea) {
+		t.Errorf("LoadVersion = %v, %v, want %v", data, err, tea)
+	}
+
+	if got := FilterVersions(versions, VersionFilter{Author: "ada"}); len(got) != 1 || got[0].ID != versions[1].ID {
+		t.Errorf("FilterVersions by author name = %+v", got)
+	}
+	if got := FilterVersions(versions, VersionFilter{Since: versions[0].Timestamp}); len(got) != 1 || got[0].ID != versions[0].ID {
+		t.Errorf("FilterVersions since the latest version = %+v", got)
+	}
+}
+
+func TestImportLegacyVersions(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "menu.json")
+	format := &JSONFormat{}
+	versionDir := filepath.Join(dir, "versions", "menu.json")
+	writeTestFile(t, filepath.Join(versionDir, "menu_20240131_093000.json"), `[{"id": 1, "name": "Tea"}]`)
+	writeTestFile(t, filepath.Join(versionDir, "menu_20240201_120000.json"), `[{"id": 1, "name": "Green tea"}]`)
+	// Names without a timestamp fall back to the modification time
+	modified := time.Date(2023, 12, 24, 18, 0, 0, 0, time.UTC)
+	writeTestFile(t, filepath.Join(versionDir, "menu-old.json"), `[]`)
+	if err := os.Chtimes(filepath.Join(versionDir, "menu-old.json"), modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	vm := NewVersionManager(dir, 0)
+	// Keep the imported versions, which are older than the default retention
+	vm.SetRetention(RetentionPolicy{})
+	versions, err := vm.ListVersions(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		fileName  string
+		timestamp time.Time
+	}{
+		{"menu_20240201_120000.json", time.Date(2024, 2, 1, 12, 0, 0, 0, time.Local)},
+		{"menu_20240131_093000.json", time.Date(2024, 1, 31, 9, 30, 0, 0, time.Local)},
+		{"menu-old.json", modified},
+	}
+	if len(versions) != len(want) {
+		t.Fatalf("imported %d versions, want %d", len(versions), len(want))
+	}
+	for i, w := range want {
+		if versions[i].FileName != w.fileName || !versions[i].Timestamp.Equal(w.timestamp) {
+			t.Errorf("version %d = %s at %s, want %s at %s", i, versions[i].FileName, versions[i].Timestamp, w.fileName, w.timestamp)
+		}
+	}
+
+	// Imported ids are stable and the versions stay readable
+	again, err := NewVersionManager(dir, 0).ListVersions(filePath)
+	if err != nil || !reflect.DeepEqual(again, versions) {
+		t.Errorf("second import = %+v, %v, want %+v", again, err, versions)
+	}
+	data, err := vm.LoadVersion(filePath, versions[0].ID, format)
+	if err != nil || data[0]["name"] != "Green tea" {
+		t.Errorf("LoadVersion of an imported version = %v, %v", data, err)
+	}
+
+	// New versions are added next to the imported ones
+	if err := vm.CreateVersion(filePath, []map[string]any{{"id": 1.0, "name": "Black tea"}}, format); err != nil {
+		t.Fatal(err)
+	}
+	versions, _ = vm.ListVersions(filePath)
+	if len(versions) != 4 || versions[0].Hash == "" {
+		t.Errorf("after a new version listed %+v", versions)
+	}
+}
+
+func TestImportLegacyBackups(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "menu.json")
+	backupDir := filepath.Join(dir, "backups")
+	writeTestFile(t, filepath.Join(backupDir, "menu_backup_20240131_093000_000.json"), `[{"id": 1, "name": "Tea"}]`)
+	// Backups of other files stay where they are
+	writeTestFile(t, filepath.Join(backupDir, "drinks_backup_20240131_093000_000.json"), `[]`)
+
+	bm := NewBackupManager(backupDir)
+	backups, err := bm.ListBackups(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 || !backups[0].Timestamp.Equal(time.Date(2024, 1, 31, 9, 30, 0, 0, time.Local)) {
+		t.Fatalf("imported backups %+v", backups)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "menu.json", "menu_backup_20240131_093000_000.json")); err != nil {
+		t.Errorf("legacy backup not moved into the file's backup directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "drinks_backup_20240131_093000_000.json")); err != nil {
+		t.Errorf("backup of another file was moved: %v", err)
+	}
+
+	data, err := bm.LoadBackup(filePath, backups[0].ID, &JSONFormat{})
+	if err != nil || data[0]["name"] != "Tea" {
+		t.Errorf("LoadBackup of an imported backup = %v, %v", data, err)
+	}
+	if again, err := NewBackupManager(backupDir).ListBackups(filePath); err != nil || !reflect.DeepEqual(again, backups) {
+		t.Errorf("second import = %+v, %v, want %+v", again, err, backups)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+
+	"backend/pkg"
+)
+
+// Verb is an operation that can be granted on a data file
+type Verb string
+
+const (
+	VerbRead    Verb = "read"
+	VerbCreate  Verb = "create"
+	VerbUpdate  Verb = "update"
+	VerbDelete  Verb = "delete"
+	VerbExport  Verb = "export"
+	VerbRestore Verb = "restore"
+)
+
+// Built-in roles
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+)
+
+// AllVerbs lists every verb in display order
+var AllVerbs = []Verb{VerbRead, VerbCreate, VerbUpdate, VerbDelete, VerbExport, VerbRestore}
+
+// Policy maps roles to the verbs they may use on each file.
+// File keys are exact names or filepath.Match patterns; an exact name wins
+// over a pattern, and a longer pattern wins over a shorter one.
+type Policy struct {
+	DefaultRole string                       `json:"defaultRole"`
+	Roles       map[string]map[string][]Verb `json:"roles"`
+}
+
+// DefaultPolicy returns the policy used when no policy file exists
+func DefaultPolicy() *Policy {
+	return &Policy{
+		DefaultRole: RoleViewer,
+		Roles: map[string]map[string][]Verb{
+			RoleViewer: {
+				"*":       {VerbRead},
+				usersFile: {},
+			},
+			RoleEditor: {
+				"*":       {VerbRead, VerbCreate, VerbUpdate, VerbDelete, VerbExport},
+				usersFile: {},
+			},
+			RoleAdmin: {
+				"*": AllVerbs,
+			},
+		},
+	}
+}
+
+// LoadPolicy reads a policy file, falling back to the default policy if it does not exist
+func LoadPolicy(path string) (*Policy, error) {
+	if path == "" {
+		return DefaultPolicy(), nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return DefaultPolicy(), nil
+		}
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var policy Policy
+	if err := json.Unmarshal(content, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+	if len(policy.Roles) == 0 {
+		return nil, fmt.Errorf("policy file %s defines no roles", path)
+	}
+	if policy.DefaultRole == "" {
+		policy.DefaultRole = RoleViewer
+	}
+	return &policy, nil
+}
+
+// HasRole reports whether a role is defined
+func (p *Policy) HasRole(role string) bool {
+	_, ok := p.Roles[role]
+	return ok
+}
+
+// effectiveRole maps an empty role to the policy default
+func (p *Policy) effectiveRole(role string) string {
+	if role == "" {
+		return p.DefaultRole
+	}
+	return role
+}
+
+// Verbs returns the verbs a role may use on a file
+func (p *Policy) Verbs(role, filename string) []Verb {
+	rules, ok := p.Roles[p.effectiveRole(role)]
+	if !ok {
+		return nil
+	}
+
+	if verbs, ok := rules[filename]; ok {
+		return verbs
+	}
+
+	bestPattern := ""
+	var bestVerbs []Verb
+	for pattern, verbs := range rules {
+		if matched, err := filepath.Match(pattern, filename); err == nil && matched && len(pattern) > len(bestPattern) {
+			bestPattern = pattern
+			bestVerbs = verbs
+		}
+	}
+	return bestVerbs
+}
+
+// Allowed reports whether a role may use a verb on a file
+func (p *Policy) Allowed(role, filename string, verb Verb) bool {
+	for _, v := range p.Verbs(role, filename) {
+		if v == verb {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the effective verbs of a role for each of the given files
+func (p *Policy) Permissions(role string, files []string) map[string][]Verb {
+	permissions := make(map[string][]Verb, len(files))
+	for _, file := range files {
+		verbs := p.Verbs(role, file)
+		if verbs == nil {
+			verbs = []Verb{}
+		}
+		permissions[file] = verbs
+	}
+	return permissions
+}
+
+// can reports whether the authenticated user may use a verb on a file
+func (s *Server) can(c *fiber.Ctx, filename string, verb Verb) bool {
+	user := s.currentUser(c)
+	if user == nil {
+		return false
+	}
+	return s.policy.Allowed(user.Role, filepath.Base(filename), verb)
+}
+
+// requirePermission rejects requests for the :filename route parameter that the user's role does not allow
+func (s *Server) requirePermission(verb Verb) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if s.currentUser(c) == nil {
+			return s.unauthorized(c)
+		}
+
+		filename := c.Params("filename")
+		if !s.can(c, filename, verb) {
+			return c.Status(403).JSON(fiber.Map{
+				"error": fmt.Sprintf("Permission denied: %s on %s", verb, filename),
+			})
+		}
+		return c.Next()
+	}
+}
+
+// dataFileNames returns the names of all data files in the data directory
+func (s *Server) dataFileNames() ([]string, error) {
+	entries, err := os.ReadDir(s.dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) != "" && !pkg.IsSidecar(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *Server) handleUserInfo(c *fiber.Ctx) error {
+	user := s.currentUser(c)
+	if user == nil {
+		return s.unauthorized(c)
+	}
+
+	files, err := s.dataFileNames()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"success": false, "message": err.Error()})
+	}
+
+	info := publicUser(*user)
+	info["role"] = s.policy.effectiveRole(user.Role)
+	info["permissions"] = s.policy.Permissions(user.Role, files)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    info,
+	})
+}
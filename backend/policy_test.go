@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestPolicyVerbs(t *testing.T) {
+	policy := &Policy{
+		DefaultRole: RoleViewer,
+		Roles: map[string]map[string][]Verb{
+			RoleViewer: {
+				"*":       {VerbRead},
+				usersFile: {},
+			},
+			RoleEditor: {
+				"*":          {VerbRead},
+				"*.json":     {VerbRead, VerbUpdate},
+				"menu*.json": {VerbRead, VerbCreate, VerbUpdate},
+				"menu.json":  {VerbRead},
+			},
+		},
+	}
+
+	tests := []struct {
+		role, file string
+		want       []Verb
+	}{
+		{RoleEditor, "menu.json", []Verb{VerbRead}},
+		{RoleEditor, "menu-lunch.json", []Verb{VerbRead, VerbCreate, VerbUpdate}},
+		{RoleEditor, "products.json", []Verb{VerbRead, VerbUpdate}},
+		{RoleEditor, "products.csv", []Verb{VerbRead}},
+		{RoleViewer, usersFile, []Verb{}},
+		{RoleViewer, "menu.json", []Verb{VerbRead}},
+		{"", "menu.json", []Verb{VerbRead}},
+		{"owner", "menu.json", nil},
+	}
+	for _, tt := range tests {
+		if got := policy.Verbs(tt.role, tt.file); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Verbs(%q, %q) = %v, want %v", tt.role, tt.file, got, tt.want)
+		}
+	}
+
+	if policy.Allowed(RoleViewer, usersFile, VerbRead) {
+		t.Error("an exact entry without verbs did not override the wildcard")
+	}
+	if !policy.Allowed(RoleEditor, "products.json", VerbUpdate) || policy.Allowed(RoleEditor, "menu.json", VerbUpdate) {
+		t.Error("Allowed does not follow Verbs")
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	policy, err := LoadPolicy(filepath.Join(dir, "missing.json"))
+	if err != nil || !reflect.DeepEqual(policy, DefaultPolicy()) {
+		t.Errorf("LoadPolicy of a missing file = %v, %v, want the default policy", policy, err)
+	}
+
+	policy, err = LoadPolicy(write("policy.json", `{"roles": {"viewer": {"*": ["read"]}}}`))
+	if err != nil || policy.DefaultRole != RoleViewer || !policy.Allowed("", "menu.json", VerbRead) {
+		t.Errorf("LoadPolicy = %+v, %v", policy, err)
+	}
+
+	for name, content := range map[string]string{"empty.json": `{"roles": {}}`, "broken.json": `{"roles": `} {
+		if _, err := LoadPolicy(write(name, content)); err == nil {
+			t.Errorf("LoadPolicy accepted %s", content)
+		}
+	}
+}
+
+func TestRoutePermissions(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		usersFile:       testUsers,
+		"products.json": `[{"id": 1, "name": "Tea"}]`,
+	}, ServerOptions{})
+	tokens := map[string]string{
+		RoleViewer: login(t, s, "viewer@example.com", "viewer-password"),
+		RoleEditor: login(t, s, "editor@example.com", "editor-password"),
+		RoleAdmin:  login(t, s, "admin@example.com", "admin-password"),
+	}
+
+	// The roles of the default policy allowed on one route of each group
+	routes := []struct {
+		method, path, body string
+		allowed            []string
+	}{
+		{"GET", "/api/files/products.json/items", "", []string{RoleViewer, RoleEditor, RoleAdmin}},
+		{"POST", "/api/files/products.json/items", `{"id": 2, "name": "Coffee"}`, []string{RoleEditor, RoleAdmin}},
+		{"POST", "/api/files/products.json/items/1", `{"id": 1, "name": "Green tea"}`, []string{RoleEditor, RoleAdmin}},
+		{"GET", "/api/files/products.json/export", "", []string{RoleEditor, RoleAdmin}},
+		{"POST", "/api/files/products.json/versions/missing/restore", "", []string{RoleAdmin}},
+		{"POST", "/api/files/products.json/backups/missing/pin", "", []string{RoleAdmin}},
+		{"GET", "/api/files/users.json/items", "", []string{RoleAdmin}},
+		{"PUT", "/api/files/products.json/schema", `{"type": "object"}`, []string{RoleAdmin}},
+		{"GET", "/api/archives", "", []string{RoleAdmin}},
+		{"GET", "/api/users", "", []string{RoleAdmin}},
+		{"DELETE", "/api/files/products.json/items/2", "", []string{RoleEditor, RoleAdmin}},
+	}
+	for _, route := range routes {
+		for _, role := range []string{RoleViewer, RoleEditor, RoleAdmin} {
+			allowed := slices.Contains(route.allowed, role)
+			resp, body := do(t, s, apiRequest(route.method, route.path, tokens[role], route.body))
+			if denied := resp.StatusCode == 403; denied == allowed {
+				t.Errorf("%s %s as %s = %d %s, allowed %v", route.method, route.path, role, resp.StatusCode, body, allowed)
+			}
+		}
+	}
+
+	if resp, _ := do(t, s, apiRequest("GET", "/api/files/products.json/items", "", "")); resp.StatusCode != 401 {
+		t.Errorf("anonymous request = %d, want 401", resp.StatusCode)
+	}
+}
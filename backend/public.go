@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"backend/pkg"
+)
+
+// alwaysRedactedFields are never served publicly regardless of configuration
+var alwaysRedactedFields = []string{"password"}
+
+var errInvalidFileName = errors.New("invalid file name")
+
+// RedactRule removes a field from public responses, for one file or for all files
+type RedactRule struct {
+	File  string
+	Field string
+}
+
+// parseRedactRules parses "field" and "file:field" entries
+func parseRedactRules(fields []string) []RedactRule {
+	var rules []RedactRule
+	for _, field := range alwaysRedactedFields {
+		rules = append(rules, RedactRule{Field: field})
+	}
+	for _, entry := range fields {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if file, field, ok := strings.Cut(entry, ":"); ok {
+			rules = append(rules, RedactRule{File: file, Field: field})
+		} else {
+			rules = append(rules, RedactRule{Field: entry})
+		}
+	}
+	return rules
+}
+
+// redactedFields returns the field names to strip from a file
+func (s *Server) redactedFields(filename string) map[string]bool {
+	fields := make(map[string]bool)
+	for _, rule := range s.redactRules {
+		if rule.File == "" || rule.File == filename {
+			fields[strings.ToLower(rule.Field)] = true
+		}
+	}
+	return fields
+}
+
+// redactValue removes redacted fields from maps at any depth
+func redactValue(value any, fields map[string]bool) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, nested := range v {
+			if fields[strings.ToLower(key)] {
+				delete(v, key)
+				continue
+			}
+			v[key] = redactValue(nested, fields)
+		}
+		return v
+	case []any:
+		for i, nested := range v {
+			v[i] = redactValue(nested, fields)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// isPublicFile reports whether a file is on the public allowlist (exact match)
+func (s *Server) isPublicFile(filename string) bool {
+	for _, file := range s.publicFiles {
+		if file == filename {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveDataFile returns the path of a data file from its decoded name. Names
+// with separators or traversal are rejected, as are symlinks that resolve
+// outside the data directory.
+func (s *Server) resolveDataFile(decoded string) (string, error) {
+	if decoded == "" || decoded == "." || decoded == ".." ||
+		strings.ContainsAny(decoded, "/\\\x00") || decoded != filepath.Base(decoded) {
+		return "", errInvalidFileName
+	}
+
+	dataDir, err := filepath.EvalSymlinks(s.dataDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve data directory: %w", err)
+	}
+	dataDir, err = filepath.Abs(dataDir)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(filepath.Join(dataDir, decoded))
+	if err != nil {
+		return "", err
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(dataDir, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", errInvalidFileName
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", errInvalidFileName
+	}
+
+	return resolved, nil
+}
+
+// handleGetFileContent serves allowlisted data files without authentication
+func (s *Server) handleGetFileContent(c *fiber.Ctx) error {
+	notFound := func() error {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found"})
+	}
+
+	// Decoded once, so the allowlist check and the file opened see the same name
+	filename, err := url.PathUnescape(c.Params("filename"))
+	if err != nil || !s.isPublicFile(filename) || s.isEncrypted(filename) {
+		return notFound()
+	}
+
+	filePath, err := s.resolveDataFile(filename)
+	if err != nil {
+		return notFound()
+	}
+
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return notFound()
+	}
+
+	fm, err := pkg.NewFileManager(filePath)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to read file"})
+	}
+	items, err := fm.Read()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to read file"})
+	}
+
+	fields := s.redactedFields(filename)
+	for i, item := range items {
+		items[i] = redactValue(item, fields).(map[string]any)
+	}
+
+	var buf bytes.Buffer
+	format := fm.GetFormat()
+	if err := format.Serialize(&buf, items); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to read file"})
+	}
+	content := buf.Bytes()
+
+	sum := sha256.Sum256(content)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	modified := stat.ModTime().UTC().Truncate(time.Second)
+
+	c.Set("ETag", etag)
+	c.Set("Last-Modified", modified.Format(http.TimeFormat))
+	c.Set("Cache-Control", "public, max-age=0, must-revalidate")
+
+	if match := c.Get("If-None-Match"); match != "" {
+		if etagMatches(match, etag) {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+	} else if since := c.Get("If-Modified-Since"); since != "" {
+		if t, err := http.ParseTime(since); err == nil && !modified.After(t) {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+	}
+
+	c.Set("Content-Type", format.ContentType())
+	return c.Send(content)
+}
+
+// etagMatches checks an If-None-Match header value against an ETag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResolveDataFile(t *testing.T) {
+	s := newTestServer(t, map[string]string{"menu.json": `[]`}, ServerOptions{})
+	outside := filepath.Join(t.TempDir(), "secret.json")
+	if err := os.WriteFile(outside, []byte(`[]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(s.dataDir, "outside.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("menu.json", filepath.Join(s.dataDir, "inside.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(s.dataDir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"menu.json", "inside.json"} {
+		if _, err := s.resolveDataFile(name); err != nil {
+			t.Errorf("resolveDataFile(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", ".", "..", "../menu.json", "sub/../menu.json", `..\menu.json`, "menu.json\x00", "outside.json", "sub", "missing.json"} {
+		if path, err := s.resolveDataFile(name); err == nil {
+			t.Errorf("resolveDataFile(%q) = %q, want an error", name, path)
+		}
+	}
+}
+
+func TestGetFileContentTraversal(t *testing.T) {
+	s := newTestServer(t, map[string]string{usersFile: testUsers, "menu.json": `[{"id": 1}]`}, ServerOptions{
+		PublicFiles: []string{"menu.json", "../" + usersFile, "outside.json"},
+	})
+	outside := filepath.Join(t.TempDir(), "secret.json")
+	if err := os.WriteFile(outside, []byte(`[{"secret": true}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(s.dataDir, "outside.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, body := do(t, s, apiRequest("GET", "/get/menu.json", "", "")); resp.StatusCode != 200 {
+		t.Fatalf("GET /get/menu.json = %d %s", resp.StatusCode, body)
+	}
+	for _, path := range []string{
+		"/get/" + usersFile,
+		"/get/..%2F" + usersFile,
+		"/get/%2e%2e%2F" + usersFile,
+		"/get/%252e%252e%252F" + usersFile,
+		"/get/..%5C" + usersFile,
+		"/get/outside.json",
+	} {
+		if resp, body := do(t, s, apiRequest("GET", path, "", "")); resp.StatusCode != 404 {
+			t.Errorf("GET %s = %d %s, want 404", path, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestGetFileContentRedaction(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"staff.json": `[{"id": 1, "name": "Ada", "Password": "x", "salary": 10, "internal": "y", "login": {"password": "z", "user": "ada"}}]`,
+		"menu.json":  `[{"id": 1, "salary": 10, "internal": "y"}]`,
+	}, ServerOptions{
+		PublicFiles:  []string{"staff.json", "menu.json"},
+		RedactFields: []string{"staff.json:salary", "internal"},
+	})
+
+	tests := []struct {
+		file string
+		want []map[string]any
+	}{
+		{"staff.json", []map[string]any{{"id": 1.0, "name": "Ada", "login": map[string]any{"user": "ada"}}}},
+		{"menu.json", []map[string]any{{"id": 1.0, "salary": 10.0}}},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, s, apiRequest("GET", "/get/"+tt.file, "", ""))
+		if resp.StatusCode != 200 {
+			t.Fatalf("GET /get/%s = %d %s", tt.file, resp.StatusCode, body)
+		}
+		var got []map[string]any
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GET /get/%s = %s, want %v", tt.file, body, tt.want)
+		}
+	}
+
+	// Redaction only changes responses, never the file
+	if _, ok := storedItems(t, s, "staff.json")[0]["salary"]; !ok {
+		t.Error("redaction removed a field from the stored file")
+	}
+}
+
+func TestGetFileContentCaching(t *testing.T) {
+	s := newTestServer(t, map[string]string{"menu.json": `[{"id": 1}]`}, ServerOptions{PublicFiles: []string{"menu.json"}})
+	modified := time.Date(2024, 1, 31, 9, 30, 0, 0, time.UTC)
+	menuPath := filepath.Join(s.dataDir, "menu.json")
+	if err := os.Chtimes(menuPath, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(header, value string) *http.Response {
+		req := apiRequest("GET", "/get/menu.json", "", "")
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		resp, _ := do(t, s, req)
+		return resp
+	}
+
+	resp := get("", "")
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != 200 || etag == "" {
+		t.Fatalf("GET = %d with ETag %q", resp.StatusCode, etag)
+	}
+	if got := resp.Header.Get("Last-Modified"); got != modified.Format(http.TimeFormat) {
+		t.Errorf("Last-Modified = %q, want %q", got, modified.Format(http.TimeFormat))
+	}
+
+	tests := []struct {
+		header, value string
+		status        int
+	}{
+		{"If-None-Match", etag, 304},
+		{"If-None-Match", `"other", W/` + etag, 304},
+		{"If-None-Match", "*", 304},
+		{"If-None-Match", `"other"`, 200},
+		{"If-Modified-Since", modified.Format(http.TimeFormat), 304},
+		{"If-Modified-Since", modified.Add(-time.Second).Format(http.TimeFormat), 200},
+	}
+	for _, tt := range tests {
+		if got := get(tt.header, tt.value).StatusCode; got != tt.status {
+			t.Errorf("GET with %s: %s = %d, want %d", tt.header, tt.value, got, tt.status)
+		}
+	}
+
+	if err := os.WriteFile(menuPath, []byte(`[{"id": 2}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if resp := get("If-None-Match", etag); resp.StatusCode != 200 || resp.Header.Get("ETag") == etag {
+		t.Errorf("GET after a change = %d with ETag %q, want 200 with a new ETag", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"backend/pkg"
+)
+
+func (s *Server) handleScheduleStatus(c *fiber.Ctx) error {
+	if s.scheduler == nil {
+		return c.JSON(fiber.Map{"success": true, "enabled": false, "jobs": []pkg.JobStatus{}})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "enabled": true, "jobs": s.scheduler.Status()})
+}
+
+func (s *Server) handleRunBackupJob(c *fiber.Ctx) error {
+	if s.scheduler == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "No backup schedule is configured"})
+	}
+
+	err := s.scheduler.RunNow(c.Params("job"))
+	switch {
+	case errors.Is(err, pkg.ErrJobNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, pkg.ErrJobRunning):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(202).JSON(fiber.Map{"success": true, "message": "Backup job started"})
+}
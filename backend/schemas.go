@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+
+	"backend/pkg"
+)
+
+// loadSchemas loads the schema sidecars of all data files, reporting any that are invalid
+func (s *Server) loadSchemas() {
+	files, err := s.dataFileNames()
+	if err != nil {
+		log.Printf("Warning: Failed to list data files for schema loading: %v", err)
+		return
+	}
+	if err := pkg.RenameLegacySidecars(s.dataDir, files); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	for _, name := range files {
+		schema, err := s.schemas.Get(name)
+		if err != nil {
+			log.Printf("Warning: Requests for %s will fail until its schema is fixed: %v", name, err)
+		} else if schema != nil {
+			log.Printf("Enforcing schema %s for %s", pkg.SchemaSidecarName(name), name)
+		} else {
+			log.Printf("No schema %s for %s; its input is stored as sent without conversion or validation", pkg.SchemaSidecarName(name), name)
+		}
+	}
+}
+
+// dataFileExists reports whether filename is an existing data file
+func (s *Server) dataFileExists(filename string) bool {
+	if pkg.IsSidecar(filename) {
+		return false
+	}
+	stat, err := os.Stat(filepath.Join(s.dataDir, filename))
+	return err == nil && !stat.IsDir()
+}
+
+// schemaViolations lists the items of a file that do not match schema
+func (s *Server) schemaViolations(filename string, schema *pkg.FileSchema) (pkg.ValidationErrors, error) {
+	fm, err := s.openFileManager(filename)
+	if err != nil {
+		return nil, err
+	}
+	fm.UseSchema(schema)
+
+	violations := pkg.ValidationErrors{}
+	return append(violations, fm.ValidateData()...), nil
+}
+
+func (s *Server) handleGetSchema(c *fiber.Ctx) error {
+	filename := c.Params("filename")
+	if !s.dataFileExists(filename) {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found"})
+	}
+
+	sidecar, err := s.schemas.Get(filename)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if sidecar != nil {
+		return c.JSON(fiber.Map{
+			"success":    true,
+			"source":     "sidecar",
+			"file":       pkg.SchemaSidecarName(filename),
+			"primaryKey": sidecar.Info.PrimaryKey,
+			"fields":     sidecar.Info.Fields,
+			"schema":     sidecar.Document,
+		})
+	}
+
+	info, err := s.getFileSchema(filename)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"success":    true,
+		"source":     "inferred",
+		"primaryKey": info.PrimaryKey,
+		"fields":     info.Fields,
+		"schema":     info.Schema,
+	})
+}
+
+func (s *Server) handlePutSchema(c *fiber.Ctx) error {
+	filename := c.Params("filename")
+	if !s.dataFileExists(filename) {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found"})
+	}
+
+	schema, err := pkg.ParseFileSchema(c.Body())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Refuse a schema the current data does not match, or that breaks clients, unless forced
+	violations, err := s.schemaViolations(filename, schema)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	diff, err := s.schemaDiff(filename, schema)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(violations) > 0 && !c.QueryBool("force") {
+		return c.Status(422).JSON(fiber.Map{
+			"error":      "Existing data does not match the schema; use force=true to save it anyway",
+			"violations": violations,
+			"diff":       diff,
+		})
+	}
+	if diff.Breaking && !c.QueryBool("force") {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "The schema has breaking changes; use force=true to save it anyway",
+			"diff":  diff,
+		})
+	}
+
+	if _, err := s.schemas.Put(filename, c.Body()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Schema saved", "violations": violations, "diff": diff})
+}
+
+// schemaDiff compares a proposed schema with the file's current one, sidecar or inferred
+func (s *Server) schemaDiff(filename string, proposed *pkg.FileSchema) (*pkg.SchemaDiff, error) {
+	current, err := s.getFileSchema(filename)
+	if err != nil {
+		return nil, err
+	}
+	return pkg.DiffSchemas(current, proposed.Info), nil
+}
+
+// handleDiffSchema reviews a proposed schema without saving it: what changes
+// from the current schema and which existing items it would reject
+func (s *Server) handleDiffSchema(c *fiber.Ctx) error {
+	filename := c.Params("filename")
+	if !s.dataFileExists(filename) {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found"})
+	}
+
+	schema, err := pkg.ParseFileSchema(c.Body())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	diff, err := s.schemaDiff(filename, schema)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	violations, err := s.schemaViolations(filename, schema)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "diff": diff, "violations": violations})
+}
+
+func (s *Server) handleGenerateSchema(c *fiber.Ctx) error {
+	filename := c.Params("filename")
+	if !s.dataFileExists(filename) {
+		return c.Status(404).JSON(fiber.Map{"error": "File not found"})
+	}
+
+	fm, err := s.openFileManager(filename)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	data, err := fm.Read()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	schema, err := s.schemas.Generate(filename, data, c.QueryBool("overwrite"))
+	if errors.Is(err, pkg.ErrSchemaExists) {
+		return c.Status(409).JSON(fiber.Map{"error": "Schema already exists; use overwrite=true to replace it"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Inference can miss rules the data relies on, so report what to review
+	violations, err := s.schemaViolations(filename, schema)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"success":    true,
+		"message":    "Schema generated",
+		"file":       pkg.SchemaSidecarName(filename),
+		"schema":     schema.Document,
+		"violations": violations,
+	})
+}
+
+func (s *Server) handleDeleteSchema(c *fiber.Ctx) error {
+	if err := s.schemas.Delete(c.Params("filename")); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c.Status(404).JSON(fiber.Map{"error": "Schema not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Schema deleted"})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"backend/pkg"
+)
+
+// postItem creates an item in a data file as the given session and returns the response status
+func postItem(t *testing.T, s *Server, token, filename, item string) int {
+	t.Helper()
+	resp, body := do(t, s, apiRequest("POST", "/api/files/"+filename+"/items", token, item))
+	if resp.StatusCode != 200 {
+		t.Logf("POST %s item = %d %s", filename, resp.StatusCode, body)
+	}
+	return resp.StatusCode
+}
+
+// storedItems reads a JSON data file straight from disk
+func storedItems(t *testing.T, s *Server, filename string) []map[string]any {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(s.dataDir, filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []map[string]any
+	if err := json.Unmarshal(content, &items); err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func TestWritesCoercedOnlyWithSidecar(t *testing.T) {
+	const products = `[{"id": 1, "qty": 5, "active": true, "rating": 4.5}]`
+	const item = `{"id": 2, "qty": "12.5", "active": "yes", "rating": ""}`
+
+	s := newTestServer(t, map[string]string{usersFile: testUsers, "products.json": products}, ServerOptions{})
+	token := login(t, s, "admin@example.com", "admin-password")
+
+	if status := postItem(t, s, token, "products.json", item); status != 200 {
+		t.Fatalf("create without a sidecar = %d, want 200", status)
+	}
+	want := map[string]any{"id": 2.0, "qty": "12.5", "active": "yes", "rating": ""}
+	if got := storedItems(t, s, "products.json")[1]; !reflect.DeepEqual(got, want) {
+		t.Errorf("without a sidecar stored %v, want the input as sent %v", got, want)
+	}
+
+	sidecar := `{"type": "object", "x-coerce": "lenient", "properties": {
+		"id": {"type": "integer"}, "qty": {"type": "number"}, "active": {"type": "boolean"}, "rating": {"type": "number"}}}`
+	if err := os.WriteFile(filepath.Join(s.dataDir, pkg.SchemaSidecarName("products.json")), []byte(sidecar), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status := postItem(t, s, token, "products.json", strings.Replace(item, `"id": 2`, `"id": 3`, 1)); status != 200 {
+		t.Fatalf("create with a lenient sidecar = %d, want 200", status)
+	}
+	want = map[string]any{"id": 3.0, "qty": 12.5, "active": true}
+	if got := storedItems(t, s, "products.json")[2]; !reflect.DeepEqual(got, want) {
+		t.Errorf("with a lenient sidecar stored %v, want %v", got, want)
+	}
+}
+
+func TestSchemaDiffAPI(t *testing.T) {
+	const products = `[{"id": 1, "name": "Tea", "price": 2.5}, {"id": 2, "name": "Coffee", "price": "$3"}]`
+	s := newTestServer(t, map[string]string{usersFile: testUsers, "products.json": products}, ServerOptions{})
+	viewer := login(t, s, "viewer@example.com", "viewer-password")
+
+	// The proposed schema is compared with the one inferred from the data, and nothing is saved
+	proposed := `{"type": "object", "required": ["name"], "properties": {
+		"id": {"type": "integer"}, "name": {"type": "string"}, "price": {"type": "number"}}}`
+	resp, body := do(t, s, apiRequest("POST", "/api/files/products.json/schema/diff", viewer, proposed))
+	if resp.StatusCode != 200 {
+		t.Fatalf("diff = %d %s", resp.StatusCode, body)
+	}
+	var result struct {
+		Diff       pkg.SchemaDiff       `json:"diff"`
+		Violations pkg.ValidationErrors `json:"violations"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatal(err)
+	}
+	var price *pkg.SchemaChange
+	for i, change := range result.Diff.Changes {
+		if change.Path == "price" && change.Kind == pkg.SchemaChangeType {
+			price = &result.Diff.Changes[i]
+		}
+	}
+	if !result.Diff.Breaking || price == nil || !price.Breaking {
+		t.Errorf("diff = %+v, want price narrowed to numbers as a breaking change", result.Diff)
+	}
+	if len(result.Violations) != 1 || result.Violations[0].Path != "/1/price" {
+		t.Errorf("violations = %+v, want the string price of the second item", result.Violations)
+	}
+	if _, err := os.Stat(filepath.Join(s.dataDir, pkg.SchemaSidecarName("products.json"))); !os.IsNotExist(err) {
+		t.Errorf("diff saved the proposed schema: %v", err)
+	}
+
+	if resp, _ := do(t, s, apiRequest("POST", "/api/files/products.json/schema/diff", viewer, `{"type": 5}`)); resp.StatusCode != 400 {
+		t.Errorf("diff with an invalid schema = %d, want 400", resp.StatusCode)
+	}
+}
+
+// validationErrors posts a write and returns the errors of its 422 response, without messages
+func validationErrors(t *testing.T, s *Server, token, path, body string) []map[string]any {
+	t.Helper()
+	resp, content := do(t, s, apiRequest("POST", path, token, body))
+	if resp.StatusCode != 422 {
+		t.Fatalf("POST %s = %d %s, want 422", path, resp.StatusCode, content)
+	}
+	var result struct {
+		Error  string           `json:"error"`
+		Errors []map[string]any `json:"errors"`
+	}
+	if err := json.Unmarshal(content, &result); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(result.Error, pkg.ErrValidation.Error()) {
+		t.Errorf("error = %q, want a validation error", result.Error)
+	}
+	for _, violation := range result.Errors {
+		if message, _ := violation["message"].(string); message == "" {
+			t.Errorf("violation %v has no message", violation)
+		}
+		delete(violation, "message")
+	}
+	return result.Errors
+}
+
+func TestValidationErrorResponse(t *testing.T) {
+	const products = `[{"id": 1, "name": "Tea", "price": 2.5, "tags": ["hot"]}]`
+	const productSchema = `{"type": "object", "required": ["name"], "properties": {
+		"id": {"type": "integer"}, "name": {"type": "string"}, "price": {"type": "number", "minimum": 0},
+		"tags": {"type": "array", "items": {"type": "string"}}}}`
+	const menu = `[{"title": "Starters", "items": [{"id": 1, "name": "Samosa", "price": 3}]},
+		{"title": "Mains", "items": [{"id": 5, "name": "Dal", "price": 9}]}]`
+	const menuSchema = `{"type": "object", "properties": {"items": {"type": "array", "items": {"type": "object",
+		"properties": {"price": {"type": "number", "minimum": 0}}}}}}`
+	s := newTestServer(t, map[string]string{
+		usersFile:                              testUsers,
+		"products.json":                        products,
+		pkg.SchemaSidecarName("products.json"): productSchema,
+		"menu.json":                            menu,
+		pkg.SchemaSidecarName("menu.json"):     menuSchema,
+	}, ServerOptions{})
+	editor := login(t, s, "editor@example.com", "editor-password")
+
+	// Every violation is listed with a JSON Pointer into the request body
+	got := validationErrors(t, s, editor, "/api/files/products.json/items", `{"id": 2, "price": -1, "tags": ["mild", 1]}`)
+	want := []map[string]any{
+		{"path": "/name", "rule": "required"},
+		{"path": "/price", "rule": "minimum", "expected": 0.0, "actual": -1.0},
+		{"path": "/tags/1", "rule": "type", "expected": []any{"string"}, "actual": 1.0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("create errors = %v, want %v", got, want)
+	}
+
+	// Updates report paths in the item, not in the file
+	got = validationErrors(t, s, editor, "/api/files/products.json/items/1", `{"id": 1, "name": "Tea", "price": -2}`)
+	if want := []map[string]any{{"path": "/price", "rule": "minimum", "expected": 0.0, "actual": -2.0}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("update errors = %v, want %v", got, want)
+	}
+
+	// So do updates of items nested in menu sections
+	got = validationErrors(t, s, editor, "/api/files/menu.json/items/5", `{"id": 5, "name": "Dal", "price": -3}`)
+	if want := []map[string]any{{"path": "/price", "rule": "minimum", "expected": 0.0, "actual": -3.0}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("menu item update errors = %v, want %v", got, want)
+	}
+
+	// Rejected writes leave the files as they were
+	if items := storedItems(t, s, "products.json"); len(items) != 1 || items[0]["price"] != 2.5 {
+		t.Errorf("after rejected writes products.json holds %v", items)
+	}
+	if items := storedItems(t, s, "menu.json"); items[1]["items"].([]any)[0].(map[string]any)["price"] != 9.0 {
+		t.Errorf("after a rejected write menu.json holds %v", items)
+	}
+}
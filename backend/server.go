@@ -1,20 +1,24 @@
 package main
 
 import (
-	"encoding/base64"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/gofiber/fiber/v2/middleware/recover"
 
 	"backend/pkg"
 )
@@ -25,10 +29,62 @@ type Server struct {
 	dataDir            string
 	restrictFiles      []string
 	users              []User
+	usersMu            sync.RWMutex
+	createUserMu       sync.Mutex // Held from the duplicate check of a new user until it is saved
 	schemaGenerator    *pkg.SchemaGenerator
 	dynamicTemplateGen *pkg.DynamicTemplateGenerator
 	metadataExtractor  *pkg.MetadataExtractor
-	fileSchemas        map[string]*pkg.SchemaInfo // Cache for file schemas
+	schemas            *pkg.SchemaStore
+	fileSchemas        map[string]*inferredSchema // Cache for schemas inferred from data
+	fileSchemasMu      sync.Mutex
+	encryptFiles       []string
+	encryptionKey      *pkg.EncryptionKey
+	previousKeys       []*pkg.EncryptionKey
+	sessions           *SessionStore
+	policy             *Policy
+	publicFiles        []string
+	redactRules        []RedactRule
+	versionManager     *pkg.VersionManager
+	backupManager      *pkg.BackupManager
+	archiveManager     *pkg.ArchiveManager
+	scheduler          *pkg.Scheduler
+}
+
+// ServerOptions configures optional server behaviour
+type ServerOptions struct {
+	RestrictFiles []string
+	// EncryptFiles lists data files stored encrypted at rest
+	EncryptFiles  []string
+	EncryptionKey *pkg.EncryptionKey
+	// PreviousKeys are still accepted for decryption after a key rotation
+	PreviousKeys []*pkg.EncryptionKey
+	// SessionSecret signs session tokens; a random secret is used when empty
+	SessionSecret []byte
+	SessionTTL    time.Duration
+	// Policy controls which roles may use which verbs on each file
+	Policy *Policy
+	// PublicFiles are served without authentication by /get/:filename
+	PublicFiles []string
+	// RedactFields are removed from public responses, as "field" or "file:field"
+	RedactFields []string
+	// VersionsDir holds the versions/ tree; defaults to the data directory
+	VersionsDir string
+	// MaxVersions caps the versions kept per file; 0 leaves it to the retention policy
+	MaxVersions int
+	// Retention applies to versions and backups; defaults to pkg.DefaultRetentionPolicy
+	Retention *pkg.RetentionPolicy
+	// DeltaVersions stores versions as deltas against the previous version
+	DeltaVersions bool
+	// BackupDir holds backups; defaults to <data dir>/backups
+	BackupDir string
+	// ArchiveDir holds whole data directory archives; defaults to <data dir>/archives
+	ArchiveDir string
+	// MaxArchiveSize bounds uploaded archives; defaults to pkg.DefaultMaxArchiveSize
+	MaxArchiveSize int64
+	// MaxExtractedSize bounds the bytes an archive may expand to; defaults to pkg.DefaultMaxExtractedSize
+	MaxExtractedSize int64
+	// Schedule configures background backups; none are taken when nil
+	Schedule *pkg.ScheduleConfig
 }
 
 type User struct {
@@ -36,6 +92,7 @@ type User struct {
 	Name         string `json:"name"`
 	Email        string `json:"email"`
 	Password     string `json:"password,omitempty"` // Hashed password
+	Role         string `json:"role,omitempty"`
 	Age          int    `json:"age"`
 	Active       bool   `json:"active"`
 	LastModified string `json:"lastModified,omitempty"`
@@ -52,27 +109,99 @@ type FileInfo struct {
 }
 
 func NewServer(dataDir string, restrictFiles ...string) *Server {
-	// Create Fiber app
-	app := fiber.New()
+	server, err := NewServerWithOptions(dataDir, ServerOptions{RestrictFiles: restrictFiles})
+	if err != nil {
+		log.Fatalf("Failed to create server: %v", err)
+	}
+	return server
+}
+
+// NewServerWithOptions creates a server with full options
+func NewServerWithOptions(dataDir string, opts ServerOptions) (*Server, error) {
+	if len(opts.EncryptFiles) > 0 && opts.EncryptionKey == nil {
+		return nil, pkg.ErrEncryptionKeyMissing
+	}
+
+	sessions, err := NewSessionStore(opts.SessionSecret, opts.SessionTTL)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Policy == nil {
+		opts.Policy = DefaultPolicy()
+	}
+	if opts.VersionsDir == "" {
+		opts.VersionsDir = dataDir
+	}
+	if opts.Retention == nil {
+		retention := pkg.DefaultRetentionPolicy()
+		opts.Retention = &retention
+	}
+	if opts.BackupDir == "" {
+		opts.BackupDir = filepath.Join(dataDir, "backups")
+	}
+	if opts.ArchiveDir == "" {
+		opts.ArchiveDir = filepath.Join(dataDir, "archives")
+	}
+	archiveManager, err := pkg.NewArchiveManager(dataDir, opts.ArchiveDir)
+	if err != nil {
+		return nil, err
+	}
+	archiveManager.SetLimits(opts.MaxArchiveSize, opts.MaxExtractedSize)
+
+	// Create Fiber app. Bodies are streamed so archive uploads never sit in
+	// memory; limitBody holds every other route to Fiber's default limit.
+	app := fiber.New(fiber.Config{StreamRequestBody: true, DisablePreParseMultipartForm: true})
 
 	// Middleware
+	app.Use(recover.New())
+	app.Use(limitBody(fiber.DefaultBodyLimit, archiveImportPath))
 	app.Use(logger.New())
 	app.Use(cors.New())
 
 	server := &Server{
 		app:                app,
 		dataDir:            dataDir,
-		restrictFiles:      restrictFiles,
+		restrictFiles:      opts.RestrictFiles,
 		schemaGenerator:    pkg.NewSchemaGenerator(),
 		dynamicTemplateGen: pkg.NewDynamicTemplateGenerator(),
 		metadataExtractor:  pkg.NewMetadataExtractor(),
-		fileSchemas:        make(map[string]*pkg.SchemaInfo),
+		schemas:            pkg.NewSchemaStore(dataDir),
+		fileSchemas:        make(map[string]*inferredSchema),
+		encryptFiles:       opts.EncryptFiles,
+		encryptionKey:      opts.EncryptionKey,
+		previousKeys:       opts.PreviousKeys,
+		sessions:           sessions,
+		policy:             opts.Policy,
+		publicFiles:        opts.PublicFiles,
+		redactRules:        parseRedactRules(opts.RedactFields),
+		versionManager:     pkg.NewVersionManager(opts.VersionsDir, opts.MaxVersions),
+		backupManager:      pkg.NewBackupManager(opts.BackupDir),
+		archiveManager:     archiveManager,
+	}
+	if opts.DeltaVersions {
+		server.versionManager.EnableDeltas(pkg.DefaultMaxDeltaChain)
+	}
+	versionRetention := *opts.Retention
+	if opts.MaxVersions > 0 {
+		versionRetention.MaxCount = opts.MaxVersions
+	}
+	server.versionManager.SetRetention(versionRetention)
+	server.backupManager.SetRetention(*opts.Retention)
+	if opts.Schedule != nil {
+		if server.scheduler, err = pkg.NewScheduler(opts.Schedule, dataDir, archiveManager); err != nil {
+			return nil, err
+		}
 	}
 
 	// Load users for authentication
 	if err := server.loadUsers(); err != nil {
 		log.Printf("Warning: Failed to load users: %v", err)
 	}
+	server.migrateHistory()
+	server.loadSchemas()
+	if server.scheduler != nil {
+		server.scheduler.Start()
+	}
 	app.Static("/", "./dist", fiber.Static{
 		Index:    "index.html",
 		Compress: true,
@@ -80,116 +209,39 @@ func NewServer(dataDir string, restrictFiles ...string) *Server {
 	})
 	server.publicRoutes()
 	server.setupRoutes()
-	return server
-}
-
-// loadUsers loads user data from users.json file
-func (s *Server) loadUsers() error {
-	userFilePath := filepath.Join(s.dataDir, "users.json")
-	fm, err := pkg.NewFileManager(userFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to create user file manager: %w", err)
-	}
-
-	usersData, err := fm.Read()
-	if err != nil {
-		return fmt.Errorf("failed to read users: %w", err)
-	}
-
-	s.users = make([]User, 0, len(usersData))
-	for _, userData := range usersData {
-		user := User{
-			ID:     fmt.Sprintf("%v", userData["id"]),
-			Name:   fmt.Sprintf("%v", userData["name"]),
-			Email:  fmt.Sprintf("%v", userData["email"]),
-			Active: userData["active"] == true,
-		}
-		if age, ok := userData["age"].(float64); ok {
-			user.Age = int(age)
-		}
-		if lastMod, ok := userData["lastModified"].(string); ok {
-			user.LastModified = lastMod
-		}
-
-		// Handle password - if not present, use default and hash it
-		if password, ok := userData["password"].(string); ok && password != "" {
-			// If password is already hashed (bcrypt format), use it
-			if strings.HasPrefix(password, "$2a$") || strings.HasPrefix(password, "$2b$") || strings.HasPrefix(password, "$2y$") {
-				user.Password = password
-			} else {
-				// Plain text password, hash it
-				hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-				if err != nil {
-					log.Printf("Warning: Failed to hash password for user %s: %v", user.Email, err)
-					continue
-				}
-				user.Password = string(hashedPassword)
-			}
-		} else {
-			// No password set, use default password "password123" and hash it
-			defaultPassword := "password123"
-			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(defaultPassword), bcrypt.DefaultCost)
-			if err != nil {
-				log.Printf("Warning: Failed to hash default password for user %s: %v", user.Email, err)
-				continue
-			}
-			user.Password = string(hashedPassword)
-		}
-
-		if user.Active {
-			s.users = append(s.users, user)
-		}
-	}
-
-	return nil
-}
-
-// authenticateUser validates user credentials
-func (s *Server) authenticateUser(email, password string) (*User, bool) {
-	for _, user := range s.users {
-		if user.Email == email && user.Active {
-			// Verify hashed password
-			err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-			if err == nil {
-				return &user, true
-			}
-		}
-	}
-	return nil, false
+	return server, nil
 }
 
-// basicAuthMiddleware provides HTTP Basic Authentication
-func (s *Server) basicAuthMiddleware() fiber.Handler {
+// limitBody reads request bodies into memory, answering 413 for those over limit
+// bytes. Bodies posted to the streamed paths are left for their handlers to read.
+func limitBody(limit int, streamed ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		auth := c.Get("Authorization")
-		if auth == "" {
-			return s.unauthorized(c)
+		if c.Method() == fiber.MethodPost && slices.Contains(streamed, c.Path()) {
+			// Whatever the handler leaves unread cannot be told apart from the next request
+			c.Context().SetConnectionClose()
+			return c.Next()
 		}
 
-		if !strings.HasPrefix(auth, "Basic ") {
-			return s.unauthorized(c)
+		req := c.Request()
+		body := req.BodyStream()
+		if body == nil {
+			return c.Next()
 		}
-
-		encodedCredentials := strings.TrimPrefix(auth, "Basic ")
-		decodedCredentials, err := base64.StdEncoding.DecodeString(encodedCredentials)
-		if err != nil {
-			return s.unauthorized(c)
+		content := []byte(nil)
+		if req.Header.ContentLength() <= limit {
+			var err error
+			if content, err = io.ReadAll(io.LimitReader(body, int64(limit)+1)); err != nil {
+				c.Context().SetConnectionClose()
+				return c.Status(400).JSON(fiber.Map{"error": "Failed to read request body"})
+			}
 		}
-
-		credentials := string(decodedCredentials)
-		parts := strings.SplitN(credentials, ":", 2)
-		if len(parts) != 2 {
-			return s.unauthorized(c)
+		// Chunked bodies carry no length up front, so only their content tells
+		if req.Header.ContentLength() > limit || len(content) > limit {
+			c.Context().SetConnectionClose()
+			return c.Status(413).JSON(fiber.Map{"error": "Request body too large"})
 		}
 
-		username, password := parts[0], parts[1]
-		user, authenticated := s.authenticateUser(username, password)
-		if !authenticated {
-			return s.unauthorized(c)
-		}
-
-		// Store user in context for later use
-		c.Locals("user", user)
+		req.SetBody(content)
 		return c.Next()
 	}
 }
@@ -204,38 +256,85 @@ func (s *Server) unauthorized(c *fiber.Ctx) error {
 
 func (s *Server) publicRoutes() {
 	s.app.Get("/get/:filename", s.handleGetFileContent)
-	s.app.Get("/api/userinfo", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"success": true,
-			"data": fiber.Map{
-				"name": "Guest User",
-			},
-		})
-	})
+	s.app.Post("/api/login", s.handleLogin)
 }
 
 func (s *Server) setupRoutes() {
 	// Apply authentication middleware to all routes except public ones
-	s.app.Use(s.basicAuthMiddleware())
+	s.app.Use(s.authMiddleware())
+
+	s.app.Post("/api/logout", s.handleLogout)
+	s.app.Get("/api/userinfo", s.handleUserInfo)
+	s.app.Get("/api/openapi.json", s.handleOpenAPI)
 
 	// Main routes
 	s.app.Get("/files", s.handleHome)
 	s.app.Get("/files/:filename", s.handleFileView)
 	s.app.Get("/files/:filename/create", s.handleCreateForm)
 	s.app.Get("/files/:filename/edit/:id", s.handleEditForm)
-	s.app.Get("/files/:filename/search", s.handleSearch)
+	s.app.Get("/files/:filename/search", s.requirePermission(VerbRead), s.handleSearch)
 
 	// API routes
 	s.app.Get("/api/files", s.handleListFiles)
-	s.app.Post("/api/files/:filename/items", s.handleCreateItem)
-	s.app.Get("/api/files/:filename/items/:id", s.handleGetItem)
-	s.app.Post("/api/files/:filename/items/:id", s.handleUpdateItem)
-	s.app.Delete("/api/files/:filename/items/:id", s.handleDeleteItem)
-	s.app.Get("/api/files/:filename/items", s.handleListItems)
-	s.app.Get("/api/files/:filename/fields", s.handleGetFields)
-	s.app.Get("/api/files/:filename/metadata", s.handleGetMetadata)
-	s.app.Get("/api/files/:filename/structure", s.handleGetStructure)
-	s.app.Get("/api/files/:filename/info", s.handleGetFileInfo)
+	s.app.Post("/api/files/:filename/items", s.requirePermission(VerbCreate), s.handleCreateItem)
+	s.app.Get("/api/files/:filename/items/:id", s.requirePermission(VerbRead), s.handleGetItem)
+	s.app.Post("/api/files/:filename/items/:id", s.requirePermission(VerbUpdate), s.handleUpdateItem)
+	s.app.Delete("/api/files/:filename/items/:id", s.requirePermission(VerbDelete), s.handleDeleteItem)
+	s.app.Get("/api/files/:filename/items", s.requirePermission(VerbRead), s.handleListItems)
+	s.app.Get("/api/files/:filename/fields", s.requirePermission(VerbRead), s.handleGetFields)
+	s.app.Get("/api/files/:filename/metadata", s.requirePermission(VerbRead), s.handleGetMetadata)
+	s.app.Get("/api/files/:filename/structure", s.requirePermission(VerbRead), s.handleGetStructure)
+	s.app.Get("/api/files/:filename/info", s.requirePermission(VerbRead), s.handleGetFileInfo)
+	s.app.Get("/api/files/:filename/export", s.requirePermission(VerbExport), s.handleExportFile)
+	s.app.Get("/api/files/:filename/schema", s.requirePermission(VerbRead), s.handleGetSchema)
+	s.app.Put("/api/files/:filename/schema", s.requireAdmin(), s.handlePutSchema)
+	s.app.Delete("/api/files/:filename/schema", s.requireAdmin(), s.handleDeleteSchema)
+	s.app.Post("/api/files/:filename/schema/generate", s.requireAdmin(), s.handleGenerateSchema)
+	s.app.Post("/api/files/:filename/schema/diff", s.requirePermission(VerbRead), s.handleDiffSchema)
+	s.app.Get("/api/files/:filename/migrations", s.requirePermission(VerbRead), s.handleListMigrations)
+	s.app.Post("/api/files/:filename/migrations", s.requireAdmin(), s.handleApplyMigration)
+	s.app.Post("/api/files/:filename/migrations/preview", s.requireAdmin(), s.handlePreviewMigration)
+	s.app.Post("/api/files/:filename/migrations/:migration/rollback", s.requireAdmin(), s.handleRollbackMigration)
+
+	// Version and backup history
+	s.app.Get("/api/files/:filename/versions", s.requirePermission(VerbRead), s.handleListVersions)
+	s.app.Get("/api/files/:filename/versions/diff", s.requirePermission(VerbRead), s.handleDiffVersions)
+	s.app.Get("/api/files/:filename/versions/verify", s.requirePermission(VerbRead), s.handleVerifyHistory)
+	s.app.Get("/api/files/:filename/versions/:version", s.requirePermission(VerbRead), s.handleGetVersion)
+	s.app.Post("/api/files/:filename/versions/:version/restore", s.requirePermission(VerbRestore), s.handleRestoreVersion)
+	s.app.Post("/api/files/:filename/versions/:version/pin", s.requirePermission(VerbRestore), s.pinSnapshot(true))
+	s.app.Delete("/api/files/:filename/versions/:version/pin", s.requirePermission(VerbRestore), s.pinSnapshot(false))
+	s.app.Post("/api/files/:filename/versions/:version/tags", s.requirePermission(VerbRestore), s.handleAddSnapshotTag)
+	s.app.Delete("/api/files/:filename/versions/:version/tags/:tag", s.requirePermission(VerbRestore), s.handleRemoveSnapshotTag)
+	s.app.Get("/api/files/:filename/backups", s.requirePermission(VerbRead), s.handleListBackups)
+	s.app.Get("/api/files/:filename/backups/:backup", s.requirePermission(VerbRead), s.handleGetBackup)
+	s.app.Post("/api/files/:filename/backups/:backup/restore", s.requirePermission(VerbRestore), s.handleRestoreBackup)
+	s.app.Post("/api/files/:filename/backups/:backup/pin", s.requirePermission(VerbRestore), s.pinSnapshot(true))
+	s.app.Delete("/api/files/:filename/backups/:backup/pin", s.requirePermission(VerbRestore), s.pinSnapshot(false))
+	s.app.Post("/api/files/:filename/backups/:backup/tags", s.requirePermission(VerbRestore), s.handleAddSnapshotTag)
+	s.app.Delete("/api/files/:filename/backups/:backup/tags/:tag", s.requirePermission(VerbRestore), s.handleRemoveSnapshotTag)
+	s.app.Post("/api/files/:filename/restore", s.requirePermission(VerbRestore), s.handleRestore)
+	s.app.Get("/api/files/:filename/prune", s.requirePermission(VerbRead), s.handlePruneHistory)
+	s.app.Post("/api/files/:filename/prune", s.requireAdmin(), s.handlePruneHistory)
+
+	// Whole data directory archives
+	s.app.Get("/api/archives", s.requireAdmin(), s.handleListArchives)
+	s.app.Post("/api/archives", s.requireAdmin(), s.handleCreateArchive)
+	s.app.Post(archiveImportPath, s.requireAdmin(), s.handleImportArchive)
+	s.app.Get("/api/archives/:archive", s.requireAdmin(), s.handleDownloadArchive)
+	s.app.Post("/api/archives/:archive/verify", s.requireAdmin(), s.handleVerifyArchive)
+	s.app.Post("/api/archives/:archive/restore", s.requireAdmin(), s.handleRestoreArchive)
+	s.app.Delete("/api/archives/:archive", s.requireAdmin(), s.handleDeleteArchive)
+	s.app.Get("/api/schedule", s.requireAdmin(), s.handleScheduleStatus)
+	s.app.Post("/api/schedule/:job/run", s.requireAdmin(), s.handleRunBackupJob)
+
+	// User management routes
+	s.app.Post("/api/me/password", s.handleChangeOwnPassword)
+	s.app.Get("/api/users", s.requireAdmin(), s.handleListUsers)
+	s.app.Post("/api/users", s.requireAdmin(), s.handleCreateUser)
+	s.app.Post("/api/users/:id/password", s.requireAdmin(), s.handleResetPassword)
+	s.app.Post("/api/users/:id/active", s.requireAdmin(), s.handleSetUserActive)
+	s.app.Post("/api/users/:id/role", s.requireAdmin(), s.handleSetUserRole)
 }
 
 func (s *Server) handleHome(c *fiber.Ctx) error {
@@ -275,45 +374,6 @@ func (s *Server) handleSearch(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"results": results})
 }
 
-func (s *Server) handleGetFileContent(c *fiber.Ctx) error {
-	filename := c.Params("filename")
-	for _, file := range s.restrictFiles {
-		if strings.Contains(filename, file) {
-			return c.Redirect("/")
-		}
-	}
-	filePath := filepath.Join(s.dataDir, filename)
-	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return c.Status(404).JSON(fiber.Map{"error": "File not found"})
-	}
-
-	// Read file content
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to read file"})
-	}
-
-	// Set appropriate content type based on file extension
-	ext := strings.ToLower(filepath.Ext(filename))
-	var contentType string
-	switch ext {
-	case ".json":
-		contentType = "application/json"
-	case ".yaml", ".yml":
-		contentType = "application/yaml"
-	case ".csv":
-		contentType = "text/csv"
-	case ".xml":
-		contentType = "application/xml"
-	default:
-		contentType = "text/plain"
-	}
-
-	c.Set("Content-Type", contentType)
-	return c.Send(content)
-}
-
 func (s *Server) handleGetItem(c *fiber.Ctx) error {
 	filename := c.Params("filename")
 	id := c.Params("id")
@@ -414,8 +474,9 @@ func (s *Server) handleCreateItem(c *fiber.Ctx) error {
 					section["items"] = sectionItems
 					items[i] = section
 
+					s.setCommitInfo(c, fm, pkg.OperationCreate, fmt.Sprintf("%v", item["id"]))
 					if err := fm.Save(items); err != nil {
-						return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+						return sendItemError(c, err, fmt.Sprintf("/%d/items/%d", i, len(sectionItems)-1))
 					}
 
 					return c.JSON(fiber.Map{"success": true, "message": "Item created"})
@@ -427,8 +488,9 @@ func (s *Server) handleCreateItem(c *fiber.Ctx) error {
 	}
 
 	// For other files, create directly
+	s.setCommitInfo(c, fm, pkg.OperationCreate)
 	if err := fm.Create(item); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		return sendWriteError(c, writeErrorStatus(err), err)
 	}
 
 	return c.JSON(fiber.Map{"success": true, "message": "Item created"})
@@ -482,8 +544,9 @@ func (s *Server) handleUpdateItem(c *fiber.Ctx) error {
 							items[i] = section
 
 							// Save the entire structure
+							s.setCommitInfo(c, fm, pkg.OperationUpdate, id)
 							if err := fm.Save(items); err != nil {
-								return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+								return sendItemError(c, err, fmt.Sprintf("/%d/items/%d", i, j))
 							}
 
 							updated = true
@@ -518,8 +581,9 @@ func (s *Server) handleUpdateItem(c *fiber.Ctx) error {
 			}
 			items[i] = item
 
+			s.setCommitInfo(c, fm, pkg.OperationUpdate, id)
 			if err := fm.Save(items); err != nil {
-				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+				return sendItemError(c, err, fmt.Sprintf("/%d", i))
 			}
 
 			return c.JSON(fiber.Map{"success": true, "message": "Item updated"})
@@ -556,8 +620,9 @@ func (s *Server) handleDeleteItem(c *fiber.Ctx) error {
 							items[i] = section
 
 							// Save the entire structure
+							s.setCommitInfo(c, fm, pkg.OperationDelete, id)
 							if err := fm.Save(items); err != nil {
-								return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+								return sendWriteError(c, writeErrorStatus(err), err)
 							}
 
 							return c.JSON(fiber.Map{"success": true, "message": "Item deleted"})
@@ -574,6 +639,7 @@ func (s *Server) handleDeleteItem(c *fiber.Ctx) error {
 	items, _ := fm.Read()
 	for i, it := range items {
 		if fmt.Sprintf("%v", it["id"]) == id {
+			s.setCommitInfo(c, fm, pkg.OperationDelete)
 			if err := fm.Delete(i); err != nil {
 				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 			}
@@ -584,6 +650,16 @@ func (s *Server) handleDeleteItem(c *fiber.Ctx) error {
 	return c.Status(404).JSON(fiber.Map{"error": "Item not found"})
 }
 
+// isRestricted reports whether a file is hidden from the file list
+func (s *Server) isRestricted(filename string) bool {
+	for _, restrictFile := range s.restrictFiles {
+		if strings.Contains(filename, restrictFile) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Server) handleListFiles(c *fiber.Ctx) error {
 	files, err := ioutil.ReadDir(s.dataDir)
 	if err != nil {
@@ -592,16 +668,9 @@ func (s *Server) handleListFiles(c *fiber.Ctx) error {
 
 	var fileList []FileInfo
 	for _, file := range files {
-		if !file.IsDir() {
+		if !file.IsDir() && !pkg.IsSidecar(file.Name()) {
 			// Skip restricted files
-			restricted := false
-			for _, restrictFile := range s.restrictFiles {
-				if strings.Contains(file.Name(), restrictFile) {
-					restricted = true
-					break
-				}
-			}
-			if restricted {
+			if s.isRestricted(file.Name()) || !s.can(c, file.Name(), VerbRead) {
 				continue
 			}
 
@@ -749,7 +818,12 @@ func (s *Server) handleGetMetadata(c *fiber.Ctx) error {
 	filename := c.Params("filename")
 	filePath := filepath.Join(s.dataDir, filename)
 
-	metadata, err := s.metadataExtractor.ExtractMetadata(filePath)
+	format, err := s.formatFor(filename)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	metadata, err := s.metadataExtractor.ExtractMetadataWithFormat(filePath, format)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -764,7 +838,12 @@ func (s *Server) handleGetStructure(c *fiber.Ctx) error {
 	filename := c.Params("filename")
 	filePath := filepath.Join(s.dataDir, filename)
 
-	structure, err := s.metadataExtractor.GetFileStructure(filePath)
+	format, err := s.formatFor(filename)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	structure, err := s.metadataExtractor.GetFileStructureWithFormat(filePath, format)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -809,68 +888,177 @@ func (s *Server) handleGetFileInfo(c *fiber.Ctx) error {
 	})
 }
 
-// getFileSchema gets or generates schema for a file
+func (s *Server) handleExportFile(c *fiber.Ctx) error {
+	filename := c.Params("filename")
+
+	fm, err := s.initFileManager(filename)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	items, err := fm.Read()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Export in the plain file format, decrypting encrypted files
+	format := pkg.PlainFormat(fm.GetFormat())
+
+	var buf bytes.Buffer
+	if err := format.Serialize(&buf, items); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set("Content-Type", format.ContentType())
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(filename)))
+	return c.Send(buf.Bytes())
+}
+
+// inferredSchema is a schema generated from a data file as it was at modTime
+type inferredSchema struct {
+	info    *pkg.SchemaInfo
+	modTime time.Time
+	size    int64
+}
+
+// getFileSchema returns the schema from a file's sidecar, or one generated from its data
 func (s *Server) getFileSchema(filename string) (*pkg.SchemaInfo, error) {
-	// Check cache first
-	if schema, exists := s.fileSchemas[filename]; exists {
-		return schema, nil
+	sidecar, err := s.schemas.Get(filename)
+	if err != nil {
+		return nil, err
+	}
+	if sidecar != nil {
+		return sidecar.Info, nil
 	}
 
-	// Generate schema from file
-	filePath := filepath.Join(s.dataDir, filename)
-	schema, err := s.schemaGenerator.GenerateSchemaFromFile(filePath)
+	// Inferred schemas are cached until the data file changes
+	stat, err := os.Stat(filepath.Join(s.dataDir, filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate schema: %w", err)
+	}
+	s.fileSchemasMu.Lock()
+	cached, exists := s.fileSchemas[filename]
+	s.fileSchemasMu.Unlock()
+	if exists && cached.modTime.Equal(stat.ModTime()) && cached.size == stat.Size() {
+		return cached.info, nil
+	}
+
+	fm, err := s.openFileManager(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate schema: %w", err)
+	}
+	data, err := fm.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate schema: %w", err)
+	}
+	schema, err := s.schemaGenerator.GenerateSchema(data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate schema: %w", err)
 	}
 
-	// Cache the schema
-	s.fileSchemas[filename] = schema
+	s.fileSchemasMu.Lock()
+	s.fileSchemas[filename] = &inferredSchema{info: schema, modTime: stat.ModTime(), size: stat.Size()}
+	s.fileSchemasMu.Unlock()
 	return schema, nil
 }
 
-// convertFormValue converts form string value to appropriate type based on field info
-func (s *Server) convertFormValue(value string, field *pkg.FieldInfo) (interface{}, error) {
-	if value == "" {
-		return nil, nil
+// forgetInferredSchemas drops cached inferred schemas, or all of them when no file is given
+func (s *Server) forgetInferredSchemas(filenames ...string) {
+	s.fileSchemasMu.Lock()
+	defer s.fileSchemasMu.Unlock()
+
+	if len(filenames) == 0 {
+		s.fileSchemas = make(map[string]*inferredSchema)
+	}
+	for _, filename := range filenames {
+		delete(s.fileSchemas, filename)
 	}
+}
 
-	switch field.Type {
-	case pkg.FieldTypeString:
-		return value, nil
-	case pkg.FieldTypeInteger:
-		// Try to parse as int
-		if intVal, err := strconv.Atoi(value); err == nil {
-			return intVal, nil
-		}
-		return nil, fmt.Errorf("invalid integer value: %s", value)
-	case pkg.FieldTypeNumber:
-		// Try to parse as float
-		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
-			return floatVal, nil
-		}
-		return nil, fmt.Errorf("invalid number value: %s", value)
-	case pkg.FieldTypeBoolean:
-		// Handle checkbox values
-		return value == "on" || value == "true" || value == "1", nil
-	case pkg.FieldTypeArray:
-		// Split comma-separated values
-		if value == "" {
-			return []interface{}{}, nil
+// initFileManager opens a data file, enforcing its schema sidecar when it has one
+func (s *Server) initFileManager(filename string) (*pkg.FileManager, error) {
+	fm, err := s.openFileManager(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := s.schemas.Get(filename)
+	if err != nil {
+		return nil, err
+	}
+	// Without a sidecar, input is stored as sent
+	if schema != nil {
+		fm.UseSchema(schema)
+	}
+	return fm, nil
+}
+
+// openFileManager opens a data file without its schema
+func (s *Server) openFileManager(filename string) (*pkg.FileManager, error) {
+	if pkg.IsSidecar(filename) {
+		return nil, fmt.Errorf("%s is a sidecar, not a data file", filename)
+	}
+	filePath := filepath.Join(s.dataDir, filename)
+	format, err := s.formatFor(filename)
+	if err != nil {
+		return nil, err
+	}
+	return pkg.NewFileManagerWithOptions(filePath, format, s.versionManager, s.backupManager)
+}
+
+// sendWriteError responds to a failed write. Schema violations are listed under
+// errors, one per value, so that clients can point at the fields.
+func sendWriteError(c *fiber.Ctx, status int, err error) error {
+	body := fiber.Map{"error": err.Error()}
+	var violations pkg.ValidationErrors
+	if errors.As(err, &violations) {
+		body["errors"] = violations
+	}
+	return c.Status(status).JSON(body)
+}
+
+// sendItemError responds to a failed write of the item at pointer in the file's data.
+// The item's violations are reported relative to it, as paths into the request body.
+func sendItemError(c *fiber.Ctx, err error, pointer string) error {
+	var violations pkg.ValidationErrors
+	if errors.As(err, &violations) {
+		if own := violations.Under(pointer); len(own) > 0 {
+			err = own
 		}
-		values := strings.Split(value, ",")
-		result := make([]interface{}, len(values))
-		for i, v := range values {
-			result[i] = strings.TrimSpace(v)
+	}
+	return sendWriteError(c, writeErrorStatus(err), err)
+}
+
+// writeErrorStatus maps a failed write to a status code. Data rejected by the
+// file's schema is unprocessable, not a server error.
+func writeErrorStatus(err error) int {
+	if errors.Is(err, pkg.ErrValidation) {
+		return 422
+	}
+	return 500
+}
+
+// isEncrypted reports whether a data file is configured for encryption at rest
+func (s *Server) isEncrypted(filename string) bool {
+	for _, file := range s.encryptFiles {
+		if file == filepath.Base(filename) {
+			return true
 		}
-		return result, nil
-	default:
-		return value, nil
 	}
+	return false
 }
 
-func (s *Server) initFileManager(filename string) (*pkg.FileManager, error) {
-	filePath := filepath.Join(s.dataDir, filename)
-	return pkg.NewFileManager(filePath)
+// formatFor returns the file format to use for a data file, or nil to auto-detect
+func (s *Server) formatFor(filename string) (pkg.FileFormat, error) {
+	if !s.isEncrypted(filename) {
+		return nil, nil
+	}
+
+	inner, err := pkg.NewFormatRegistry().Get(filepath.Ext(filename))
+	if err != nil {
+		return nil, err
+	}
+	return pkg.NewEncryptedFormat(inner, s.encryptionKey, s.previousKeys...)
 }
 
 func (s *Server) getAvailableFiles() ([]FileInfo, error) {
@@ -888,7 +1076,7 @@ func (s *Server) getAvailableFiles() ([]FileInfo, error) {
 
 		name := entry.Name()
 		ext := filepath.Ext(name)
-		if ext == "" {
+		if ext == "" || pkg.IsSidecar(name) {
 			continue
 		}
 
@@ -907,7 +1095,7 @@ func (s *Server) getAvailableFiles() ([]FileInfo, error) {
 		}
 
 		filePath := filepath.Join(s.dataDir, name)
-		fm, err := pkg.NewFileManager(filePath)
+		fm, err := s.initFileManager(name)
 		if err != nil {
 			continue
 		}
@@ -942,3 +1130,13 @@ func (s *Server) Start(port string) error {
 	log.Printf("Server starting on port %s", port)
 	return s.app.Listen(":" + port)
 }
+
+// Shutdown stops accepting requests, waits for open ones to finish, then stops
+// the backup scheduler so running jobs clean up their temporary archives
+func (s *Server) Shutdown() error {
+	err := s.app.Shutdown()
+	if s.scheduler != nil {
+		s.scheduler.Stop()
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"backend/pkg"
+)
+
+// testUsers holds one user per built-in role, with plaintext passwords as in a fresh install
+const testUsers = `[
+  {"id": "1", "name": "Ada", "email": "admin@example.com", "password": "admin-password", "role": "admin", "active": true},
+  {"id": "2", "name": "Eve", "email": "editor@example.com", "password": "editor-password", "role": "editor", "active": true},
+  {"id": "3", "name": "Vic", "email": "viewer@example.com", "password": "viewer-password", "role": "viewer", "active": true}
+]`
+
+// newTestServer creates a server over a fresh data directory holding the given files
+func newTestServer(t *testing.T, files map[string]string, opts ServerOptions) *Server {
+	t.Helper()
+	dataDir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dataDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return newTestServerIn(t, dataDir, opts)
+}
+
+// newTestServerIn creates a server over an existing data directory
+func newTestServerIn(t *testing.T, dataDir string, opts ServerOptions) *Server {
+	t.Helper()
+	server, err := NewServerWithOptions(dataDir, opts)
+	if err != nil {
+		t.Fatalf("NewServerWithOptions: %v", err)
+	}
+	t.Cleanup(func() { server.Shutdown() })
+	return server
+}
+
+// do sends a request to the server's app and returns the response and its body
+func do(t *testing.T, s *Server, req *http.Request) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+// apiRequest builds a JSON request made with a session token, or anonymously when token is empty
+func apiRequest(method, path, token, body string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set(sessionTokenHeader, token)
+	}
+	return req
+}
+
+// login signs a user in and returns their session token
+func login(t *testing.T, s *Server, email, password string) string {
+	t.Helper()
+	resp, body := do(t, s, apiRequest("POST", "/api/login", "", `{"email":"`+email+`","password":"`+password+`"}`))
+	if resp.StatusCode != 200 {
+		t.Fatalf("login as %s = %d %s", email, resp.StatusCode, body)
+	}
+
+	var result struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result.Data.Token
+}
+
+// archiveUploadRequest builds a multipart archive import request for an admin session
+func archiveUploadRequest(t *testing.T, token string, archive []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("archive", "upload.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(archive)
+	form.Close()
+
+	req := httptest.NewRequest("POST", archiveImportPath, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set(sessionTokenHeader, token)
+	return req
+}
+
+func TestBodyLimit(t *testing.T) {
+	s := newTestServer(t, map[string]string{usersFile: testUsers}, ServerOptions{})
+	oversized := strings.Repeat("x", fiber.DefaultBodyLimit+1)
+
+	req := httptest.NewRequest("POST", "/api/login", strings.NewReader(oversized))
+	req.Header.Set("Content-Type", "application/json")
+	if resp, body := do(t, s, req); resp.StatusCode != 413 {
+		t.Errorf("oversized login = %d %s, want 413", resp.StatusCode, body)
+	}
+
+	// Without a Content-Length the body is sent chunked
+	req = httptest.NewRequest("POST", "/api/login", io.MultiReader(strings.NewReader(oversized)))
+	req.ContentLength = -1
+	req.TransferEncoding = []string{"chunked"}
+	req.Header.Set("Content-Type", "application/json")
+	if resp, body := do(t, s, req); resp.StatusCode != 413 {
+		t.Errorf("oversized chunked login = %d %s, want 413", resp.StatusCode, body)
+	}
+
+	// Bodies within the limit still reach their handlers
+	login(t, s, "admin@example.com", "admin-password")
+}
+
+func TestArchiveImportStreamsLargeUploads(t *testing.T) {
+	// Random content does not compress, so the archive exceeds the default body limit
+	source := t.TempDir()
+	large := make([]byte, fiber.DefaultBodyLimit+(1<<20))
+	rand.Read(large)
+	if err := os.WriteFile(filepath.Join(source, "blob.bin"), large, 0644); err != nil {
+		t.Fatal(err)
+	}
+	am, err := pkg.NewArchiveManager(source, filepath.Join(t.TempDir(), "archives"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if _, err := am.Stream(&archive); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer(t, map[string]string{usersFile: testUsers}, ServerOptions{})
+	token := login(t, s, "admin@example.com", "admin-password")
+	if resp, body := do(t, s, archiveUploadRequest(t, token, archive.Bytes())); resp.StatusCode != 201 {
+		t.Fatalf("import of a %d byte archive = %d %s, want 201", archive.Len(), resp.StatusCode, body)
+	}
+
+	small := newTestServer(t, map[string]string{usersFile: testUsers}, ServerOptions{MaxArchiveSize: 1 << 20})
+	token = login(t, small, "admin@example.com", "admin-password")
+	if resp, body := do(t, small, archiveUploadRequest(t, token, archive.Bytes())); resp.StatusCode != 413 {
+		t.Errorf("import past MaxArchiveSize = %d %s, want 413", resp.StatusCode, body)
+	}
+}
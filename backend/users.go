@@ -0,0 +1,426 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+
+	"backend/pkg"
+)
+
+const (
+	usersFile = "users.json"
+
+	// RoleAdmin can manage users and restore snapshots
+	RoleAdmin = "admin"
+
+	minPasswordLength = 8
+)
+
+// isBcryptHash reports whether a stored password is already a bcrypt hash
+func isBcryptHash(password string) bool {
+	return strings.HasPrefix(password, "$2a$") || strings.HasPrefix(password, "$2b$") || strings.HasPrefix(password, "$2y$")
+}
+
+// loadUsers loads user data from users.json, migrating plaintext passwords to
+// bcrypt hashes and writing them back to the file
+func (s *Server) loadUsers() error {
+	fm, err := s.initFileManager(usersFile)
+	if err != nil {
+		return fmt.Errorf("failed to create user file manager: %w", err)
+	}
+
+	usersData, err := fm.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read users: %w", err)
+	}
+
+	users := make([]User, 0, len(usersData))
+	migrated := make(map[string]string)
+	for _, userData := range usersData {
+		user := User{
+			ID:     fmt.Sprintf("%v", userData["id"]),
+			Name:   fmt.Sprintf("%v", userData["name"]),
+			Email:  fmt.Sprintf("%v", userData["email"]),
+			Active: userData["active"] == true,
+		}
+		if age, ok := userData["age"].(float64); ok {
+			user.Age = int(age)
+		}
+		if role, ok := userData["role"].(string); ok {
+			user.Role = role
+		}
+		if lastMod, ok := userData["lastModified"].(string); ok {
+			user.LastModified = lastMod
+		}
+
+		password, _ := userData["password"].(string)
+		switch {
+		case password == "":
+			// Users without a password cannot sign in until an admin sets one
+			log.Printf("Warning: User %s has no password and cannot sign in", user.Email)
+		case isBcryptHash(password):
+			user.Password = password
+		default:
+			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+			if err != nil {
+				log.Printf("Warning: Failed to hash password for user %s: %v", user.Email, err)
+				continue
+			}
+			user.Password = string(hashedPassword)
+			migrated[user.ID] = user.Password
+		}
+
+		users = append(users, user)
+	}
+
+	// Persist migrated hashes so plaintext passwords never stay on disk
+	if len(migrated) > 0 {
+		_, err := fm.UpdateBy(func(item map[string]any) bool {
+			_, ok := migrated[fmt.Sprintf("%v", item["id"])]
+			return ok
+		}, func(item map[string]any) map[string]any {
+			item["password"] = migrated[fmt.Sprintf("%v", item["id"])]
+			return item
+		})
+		if err != nil {
+			return fmt.Errorf("failed to persist password hashes: %w", err)
+		}
+		log.Printf("Migrated %d plaintext password(s) to bcrypt hashes", len(migrated))
+	}
+
+	hasAdmin := false
+	for _, user := range users {
+		if user.Role == RoleAdmin && user.Active && user.Password != "" {
+			hasAdmin = true
+			break
+		}
+	}
+	if !hasAdmin {
+		log.Printf("Warning: No active admin user in %s; user management is unavailable", usersFile)
+	}
+
+	s.usersMu.Lock()
+	s.users = users
+	s.usersMu.Unlock()
+
+	return nil
+}
+
+// authenticateUser validates user credentials
+func (s *Server) authenticateUser(email, password string) (*User, bool) {
+	s.usersMu.RLock()
+	defer s.usersMu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Email == email && user.Active && user.Password != "" {
+			// Verify hashed password
+			err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+			if err == nil {
+				return &user, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// findUser returns a copy of the user with the given id
+func (s *Server) findUser(id string) (*User, bool) {
+	s.usersMu.RLock()
+	defer s.usersMu.RUnlock()
+
+	for _, user := range s.users {
+		if user.ID == id {
+			return &user, true
+		}
+	}
+	return nil, false
+}
+
+// currentUser returns the authenticated user stored by the auth middleware
+func (s *Server) currentUser(c *fiber.Ctx) *User {
+	user, _ := c.Locals("user").(*User)
+	return user
+}
+
+// requireAdmin rejects requests from users without the admin role
+func (s *Server) requireAdmin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := s.currentUser(c)
+		if user == nil {
+			return s.unauthorized(c)
+		}
+		if user.Role != RoleAdmin {
+			return c.Status(403).JSON(fiber.Map{"error": "Admin access required"})
+		}
+		return c.Next()
+	}
+}
+
+// hashPassword checks the password policy and returns a bcrypt hash
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hashed), nil
+}
+
+// publicUser returns user data safe to send to clients
+func publicUser(user User) fiber.Map {
+	return fiber.Map{
+		"id":           user.ID,
+		"name":         user.Name,
+		"email":        user.Email,
+		"role":         user.Role,
+		"age":          user.Age,
+		"active":       user.Active,
+		"hasPassword":  user.Password != "",
+		"lastModified": user.LastModified,
+	}
+}
+
+// updateUserRecord applies changes to a stored user and reloads the user list
+func (s *Server) updateUserRecord(c *fiber.Ctx, id string, changes map[string]any) error {
+	fm, err := s.initFileManager(usersFile)
+	if err != nil {
+		return err
+	}
+	s.setCommitInfo(c, fm, pkg.OperationUpdate, id)
+
+	changes["lastModified"] = time.Now().Format(time.RFC3339)
+	if _, err := fm.PatchBy(func(item map[string]any) bool {
+		return fmt.Sprintf("%v", item["id"]) == id
+	}, changes); err != nil {
+		return err
+	}
+
+	return s.loadUsers()
+}
+
+func (s *Server) handleListUsers(c *fiber.Ctx) error {
+	s.usersMu.RLock()
+	defer s.usersMu.RUnlock()
+
+	users := make([]fiber.Map, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, publicUser(user))
+	}
+
+	return c.JSON(fiber.Map{"success": true, "users": users})
+}
+
+func (s *Server) handleCreateUser(c *fiber.Ctx) error {
+	var req struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Role     string `json:"role"`
+		Age      int    `json:"age"`
+		Active   *bool  `json:"active"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON data"})
+	}
+
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" || req.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Name and email are required"})
+	}
+
+	if req.Role != "" && !s.policy.HasRole(req.Role) {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("Unknown role: %s", req.Role)})
+	}
+
+	hashed, err := hashPassword(req.Password)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	s.createUserMu.Lock()
+	defer s.createUserMu.Unlock()
+
+	s.usersMu.RLock()
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, req.Email) || (req.ID != "" && user.ID == req.ID) {
+			s.usersMu.RUnlock()
+			return c.Status(409).JSON(fiber.Map{"error": "User already exists"})
+		}
+	}
+	if req.ID == "" {
+		req.ID = fmt.Sprintf("u%d", len(s.users)+1)
+		for s.userIDTaken(req.ID) {
+			req.ID = fmt.Sprintf("u%d", time.Now().UnixNano())
+		}
+	}
+	s.usersMu.RUnlock()
+
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+
+	fm, err := s.initFileManager(usersFile)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	user := map[string]any{
+		"id":           req.ID,
+		"name":         req.Name,
+		"email":        req.Email,
+		"password":     hashed,
+		"role":         req.Role,
+		"age":          req.Age,
+		"active":       active,
+		"lastModified": time.Now().Format(time.RFC3339),
+	}
+	s.setCommitInfo(c, fm, pkg.OperationCreate, req.ID)
+	if err := fm.Create(user); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := s.loadUsers(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	created, ok := s.findUser(req.ID)
+	if !ok {
+		return c.Status(500).JSON(fiber.Map{"error": "User was not found after saving"})
+	}
+	return c.Status(201).JSON(fiber.Map{"success": true, "message": "User created", "user": publicUser(*created)})
+}
+
+// userIDTaken reports whether a user id is in use; callers must hold usersMu
+func (s *Server) userIDTaken(id string) bool {
+	for _, user := range s.users {
+		if user.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleResetPassword(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON data"})
+	}
+
+	if _, ok := s.findUser(id); !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	hashed, err := hashPassword(req.Password)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := s.updateUserRecord(c, id, map[string]any{"password": hashed}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	s.sessions.RevokeUser(id)
+
+	return c.JSON(fiber.Map{"success": true, "message": "Password reset"})
+}
+
+func (s *Server) handleSetUserActive(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req struct {
+		Active *bool `json:"active"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Active == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Field 'active' is required"})
+	}
+
+	if _, ok := s.findUser(id); !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+	if current := s.currentUser(c); current != nil && current.ID == id && !*req.Active {
+		return c.Status(400).JSON(fiber.Map{"error": "You cannot deactivate your own account"})
+	}
+
+	if err := s.updateUserRecord(c, id, map[string]any{"active": *req.Active}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !*req.Active {
+		s.sessions.RevokeUser(id)
+	}
+
+	message := "User deactivated"
+	if *req.Active {
+		message = "User activated"
+	}
+	return c.JSON(fiber.Map{"success": true, "message": message})
+}
+
+func (s *Server) handleSetUserRole(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON data"})
+	}
+	if !s.policy.HasRole(req.Role) {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("Unknown role: %s", req.Role)})
+	}
+
+	if _, ok := s.findUser(id); !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+	if current := s.currentUser(c); current != nil && current.ID == id && req.Role != RoleAdmin {
+		return c.Status(400).JSON(fiber.Map{"error": "You cannot remove your own admin role"})
+	}
+
+	if err := s.updateUserRecord(c, id, map[string]any{"role": req.Role}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Role updated"})
+}
+
+func (s *Server) handleChangeOwnPassword(c *fiber.Ctx) error {
+	current := s.currentUser(c)
+	if current == nil {
+		return s.unauthorized(c)
+	}
+
+	var req struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON data"})
+	}
+
+	if _, ok := s.authenticateUser(current.Email, req.CurrentPassword); !ok {
+		return c.Status(403).JSON(fiber.Map{"error": "Current password is incorrect"})
+	}
+
+	hashed, err := hashPassword(req.NewPassword)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := s.updateUserRecord(c, current.ID, map[string]any{"password": hashed}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	// Sign out other sessions; the caller logs in again with the new password
+	s.sessions.RevokeUser(current.ID)
+
+	return c.JSON(fiber.Map{"success": true, "message": "Password changed"})
+}
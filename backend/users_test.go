@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// captureLog collects log output for the rest of a test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+// storedPasswords reads the password of each user in users.json straight from disk
+func storedPasswords(t *testing.T, s *Server) map[string]string {
+	t.Helper()
+	passwords := make(map[string]string)
+	for _, user := range storedItems(t, s, usersFile) {
+		password, _ := user["password"].(string)
+		passwords[fmt.Sprint(user["id"])] = password
+	}
+	return passwords
+}
+
+func TestLoadUsersMigratesPlaintextPasswords(t *testing.T) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte("hashed-password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := strings.TrimSuffix(testUsers, "]") + `,
+  {"id": "4", "name": "Hal", "email": "hashed@example.com", "password": "` + string(hashed) + `", "role": "viewer", "active": true},
+  {"id": "5", "name": "Nia", "email": "nopassword@example.com", "role": "viewer", "active": true}
+]`
+	s := newTestServer(t, map[string]string{usersFile: users}, ServerOptions{})
+
+	content, err := os.ReadFile(filepath.Join(s.dataDir, usersFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plaintext := range []string{"admin-password", "editor-password", "viewer-password"} {
+		if bytes.Contains(content, []byte(plaintext)) {
+			t.Errorf("users.json still holds the plaintext password %q", plaintext)
+		}
+	}
+	migrated := storedPasswords(t, s)
+	for id, password := range migrated {
+		if id != "5" && !isBcryptHash(password) {
+			t.Errorf("user %s has password %q, want a bcrypt hash", id, password)
+		}
+	}
+	if migrated["4"] != string(hashed) {
+		t.Errorf("existing hash was rewritten to %q", migrated["4"])
+	}
+	if migrated["5"] != "" {
+		t.Errorf("user without a password was given %q", migrated["5"])
+	}
+
+	login(t, s, "admin@example.com", "admin-password")
+	login(t, s, "hashed@example.com", "hashed-password")
+	if resp, _ := do(t, s, apiRequest("POST", "/api/login", "", `{"email":"nopassword@example.com","password":""}`)); resp.StatusCode != 401 {
+		t.Errorf("login without a password = %d, want 401", resp.StatusCode)
+	}
+
+	// Loading again leaves the hashes as they are
+	restarted := newTestServerIn(t, s.dataDir, ServerOptions{})
+	for id, password := range storedPasswords(t, restarted) {
+		if password != migrated[id] {
+			t.Errorf("user %s was migrated again", id)
+		}
+	}
+}
+
+func TestNoActiveAdmin(t *testing.T) {
+	users := strings.Replace(testUsers, `"role": "admin", "active": true`, `"role": "admin", "active": false`, 1)
+	logs := captureLog(t)
+	s := newTestServer(t, map[string]string{usersFile: users}, ServerOptions{})
+
+	if !strings.Contains(logs.String(), "No active admin user") {
+		t.Errorf("no warning about the missing admin in %q", logs.String())
+	}
+	if resp, _ := do(t, s, apiRequest("POST", "/api/login", "", `{"email":"admin@example.com","password":"admin-password"}`)); resp.StatusCode != 401 {
+		t.Errorf("login of an inactive admin = %d, want 401", resp.StatusCode)
+	}
+
+	token := login(t, s, "editor@example.com", "editor-password")
+	for _, req := range []struct{ method, path, body string }{
+		{"GET", "/api/users", ""},
+		{"POST", "/api/users", `{"name":"Mal","email":"mal@example.com","password":"long-enough","role":"admin"}`},
+		{"POST", "/api/users/1/active", `{"active":true}`},
+	} {
+		if resp, body := do(t, s, apiRequest(req.method, req.path, token, req.body)); resp.StatusCode != 403 {
+			t.Errorf("%s %s as editor = %d %s, want 403", req.method, req.path, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	s := newTestServer(t, map[string]string{usersFile: testUsers}, ServerOptions{})
+	token := login(t, s, "admin@example.com", "admin-password")
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"short password", `{"name":"Sam","email":"sam@example.com","password":"short"}`, 400},
+		{"unknown role", `{"name":"Sam","email":"sam@example.com","password":"long-enough","role":"owner"}`, 400},
+		{"taken email", `{"name":"Sam","email":"Editor@Example.com","password":"long-enough"}`, 409},
+		{"taken id", `{"id":"2","name":"Sam","email":"sam@example.com","password":"long-enough"}`, 409},
+	}
+	for _, tt := range tests {
+		if resp, body := do(t, s, apiRequest("POST", "/api/users", token, tt.body)); resp.StatusCode != tt.status {
+			t.Errorf("%s: create = %d %s, want %d", tt.name, resp.StatusCode, body, tt.status)
+		}
+	}
+
+	// Of concurrent requests for the same email, exactly one creates the user
+	var wg sync.WaitGroup
+	statuses := make([]int, 5)
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := s.app.Test(apiRequest("POST", "/api/users", token, `{"name":"Sam","email":"sam@example.com","password":"long-enough"}`), -1)
+			if err == nil {
+				statuses[i] = resp.StatusCode
+			}
+		}(i)
+	}
+	wg.Wait()
+	created := 0
+	for _, status := range statuses {
+		if status == 201 {
+			created++
+		} else if status != 409 {
+			t.Errorf("concurrent create = %d, want 201 or 409", status)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d concurrent creates succeeded, want 1", created)
+	}
+
+	var listed struct {
+		Users []map[string]any `json:"users"`
+	}
+	_, body := do(t, s, apiRequest("GET", "/api/users", token, ""))
+	if err := json.Unmarshal(body, &listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Users) != 4 {
+		t.Errorf("listed %d users, want 4", len(listed.Users))
+	}
+	for _, user := range listed.Users {
+		if _, ok := user["password"]; ok {
+			t.Errorf("user list exposes the password of %v", user["email"])
+		}
+	}
+	login(t, s, "sam@example.com", "long-enough")
+}
@@ -1,12 +1,9 @@
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/shared/components/ui/card";
 import { Badge } from "@/shared/components/ui/badge";
+import type { MenuItem as GeneratedMenuItem } from "@/types/generated/menu";
 
-export interface MenuItemData {
-    id: string;
-    name: string;
-    description: string;
-    price: string;
-    category: string;
+// A menu item from the generated type, with its dietary info as a list
+export interface MenuItemData extends Omit<GeneratedMenuItem, "dietaryInfo"> {
     dietaryInfo: string[];
 }
 
@@ -1,8 +1,8 @@
 import { MenuItemData } from "@/components/fishtail/MenuItem";
+import type { Menu, MenuItem } from "@/types/generated/menu";
 
-interface MenuCategory {
-    title: string;
-    subtitle: string;
+// Sections as the page shows them, built from the generated Menu type
+interface MenuCategory extends Pick<Menu, "title" | "subtitle"> {
     image: string;
     items: MenuItemData[];
 }
@@ -21,11 +21,11 @@ const categoryImages: { [key: string]: string } = {
 };
 
 // Cache for menu data
-let menuDataCache: MenuCategory[] | null = null;
+let menuDataCache: Menu[] | null = null;
 let cacheTimestamp: number | null = null;
 const CACHE_DURATION = 5 * 60 * 1000; // 5 minutes
 
-export async function fetchMenuData(): Promise<MenuCategory[]> {
+export async function fetchMenuData(): Promise<Menu[]> {
     // Check cache first
     if (menuDataCache && cacheTimestamp && (Date.now() - cacheTimestamp) < CACHE_DURATION) {
         return menuDataCache;
@@ -39,7 +39,7 @@ export async function fetchMenuData(): Promise<MenuCategory[]> {
         const data = await response.json();
 
         // Handle both single category and array of categories
-        let categories: any[] = [];
+        let categories: Menu[] = [];
         if (Array.isArray(data)) {
             categories = data;
         } else if (data && typeof data === 'object') {
@@ -63,15 +63,15 @@ export async function getMenuCategories(): Promise<MenuCategory[]> {
     const rawData = await fetchMenuData();
 
     // Transform the data to match the expected format
-    return rawData.map((category: any) => ({
+    return rawData.map((category: Menu) => ({
         title: category.title || '',
         subtitle: category.subtitle || '',
         image: categoryImages[category.title] || categoryImages.default,
-        items: (category.items || []).map((item: any) => {
+        items: (category.items || []).map((item: MenuItem) => {
             // Handle dietaryInfo as either string or array
             let dietaryInfo: string[] = [];
             if (Array.isArray(item.dietaryInfo)) {
-                dietaryInfo = item.dietaryInfo.filter((info: any) => info && info.trim() !== '');
+                dietaryInfo = item.dietaryInfo.filter((info: string) => info && info.trim() !== '');
             } else if (typeof item.dietaryInfo === 'string') {
                 // Split string by common separators and filter empty values
                 dietaryInfo = item.dietaryInfo
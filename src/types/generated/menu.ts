@@ -0,0 +1,19 @@
+// Code generated from menu.json. DO NOT EDIT.
+
+export interface Menu {
+  image?: string;
+  items: MenuItem[];
+  subtitle: string;
+  title: string;
+}
+
+export interface MenuItem {
+  category: string;
+  description: string;
+  dietaryInfo: MenuItemDietaryInfo[] | string;
+  id: string;
+  name: string;
+  price: string;
+}
+
+export type MenuItemDietaryInfo = "Dairy Free" | "Dairy Free Upon Request" | "GF" | "GF Upon Request" | "Nuts and Dairy Free Upon Request" | "Vegan" | "Vegan Upon Request";